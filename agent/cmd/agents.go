@@ -0,0 +1,126 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/situation-sh/situation/agent/config"
+	"github.com/situation-sh/situation/pkg/models"
+	"github.com/situation-sh/situation/pkg/store"
+	"github.com/urfave/cli/v3"
+	"golang.org/x/mod/semver"
+)
+
+var staleAfter time.Duration = 48 * time.Hour
+
+var agentsCmd = cli.Command{
+	Name:  "agents",
+	Usage: "Inspect the agents that report to the database",
+	Commands: []*cli.Command{
+		&agentsListCmd,
+	},
+}
+
+var agentsListCmd = cli.Command{
+	Name:    "list",
+	Aliases: []string{"ls"},
+	Usage:   "List the registered agents",
+	Action:  agentsListAction,
+	Flags: []cli.Flag{
+		&cli.DurationFlag{
+			Name:        "stale-after",
+			Usage:       "Flag the agents that have not been seen for this duration",
+			Value:       staleAfter,
+			Destination: &staleAfter,
+		},
+	},
+}
+
+func init() {
+	agentsListCmd.Flags = append(agentsListCmd.Flags, dbFlag())
+}
+
+// canonicalVersion returns the semver form of an agent version
+// (it returns an empty string if the version is not valid)
+func canonicalVersion(v string) string {
+	if !strings.HasPrefix(v, "v") {
+		v = "v" + v
+	}
+	if !semver.IsValid(v) {
+		return ""
+	}
+	return semver.Canonical(v)
+}
+
+// newestVersion returns the most recent version among the agents
+func newestVersion(agents []*models.Agent) string {
+	newest := ""
+	for _, a := range agents {
+		v := canonicalVersion(a.Version)
+		if v != "" && (newest == "" || semver.Compare(v, newest) > 0) {
+			newest = v
+		}
+	}
+	return newest
+}
+
+// agentFlags returns the warnings attached to an agent
+func agentFlags(a *models.Agent, newest string, now time.Time) []string {
+	flags := make([]string, 0)
+	if a.LastSeen.IsZero() || now.Sub(a.LastSeen) > staleAfter {
+		flags = append(flags, "stale")
+	}
+	if v := canonicalVersion(a.Version); v != "" && newest != "" && semver.Compare(v, newest) < 0 {
+		flags = append(flags, "outdated")
+	}
+	return flags
+}
+
+func agentsListAction(ctx context.Context, cmd *cli.Command) error {
+	storage, err := store.NewStorage(db,
+		store.WithAgent(config.AgentString()),
+		store.WithErrorHandler(func(err error) {
+			logger.WithField("on", "storage").Warn(err)
+		}),
+		store.ReadOnly(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create storage: %v", err)
+	}
+
+	agents, err := storage.GetAgents(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list agents: %w", err)
+	}
+
+	now := time.Now()
+	newest := newestVersion(agents)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "AGENT\tVERSION\tPLATFORM\tHOST\tLAST SEEN\tSTATUS\tFLAGS")
+	for _, a := range agents {
+		host := ""
+		if a.Machine != nil {
+			host = a.Machine.Hostname
+		}
+		lastSeen := "never"
+		if !a.LastSeen.IsZero() {
+			lastSeen = a.LastSeen.Local().Format(time.DateTime)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s/%s\t%s\t%s\t%s\t%s\n",
+			a.Agent,
+			a.Version,
+			a.Platform,
+			a.Arch,
+			host,
+			lastSeen,
+			a.LastStatus,
+			strings.Join(agentFlags(a, newest, now), ","),
+		)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,168 @@
+package cmd
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/situation-sh/situation/agent/config"
+	"github.com/situation-sh/situation/pkg/models"
+	"github.com/situation-sh/situation/pkg/store"
+	"github.com/situation-sh/situation/pkg/utils"
+	"github.com/urfave/cli/v3"
+)
+
+// diffNow refers to the current state of the inventory
+const diffNow = "now"
+
+var (
+	diffFrom         string = ""
+	diffTo           string = diffNow
+	diffFormat       string = "text"
+	diffValidFormats        = []string{"text", "json"}
+	diffList         bool   = false
+)
+
+var diffCmd = cli.Command{
+	Name:      "diff",
+	Usage:     "Show what has changed in the inventory between two runs",
+	UsageText: "situation diff [--from <run|time>] [--to <run|time>] [--format text|json]",
+	Action:    diffAction,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:        "from",
+			Usage:       "Run ID, time (RFC3339 or date) or duration (e.g. 24h) to start from (default: the run before the latest one)",
+			Destination: &diffFrom,
+		},
+		&cli.StringFlag{
+			Name:        "to",
+			Usage:       "Run ID, time or duration to compare with (now for the current state)",
+			Value:       diffTo,
+			Destination: &diffTo,
+		},
+		&cli.StringFlag{
+			Name:        "format",
+			Aliases:     []string{"f"},
+			Usage:       fmt.Sprintf("Output format %v", diffValidFormats),
+			Value:       diffFormat,
+			Destination: &diffFormat,
+			Validator: func(s string) error {
+				if !utils.Includes(diffValidFormats, s) {
+					return fmt.Errorf("invalid format: %s (choose from %v)", s, diffValidFormats)
+				}
+				return nil
+			},
+		},
+		&cli.BoolFlag{
+			Name:        "list",
+			Usage:       "List the runs of the history",
+			Destination: &diffList,
+		},
+	},
+}
+
+func init() {
+	diffCmd.Flags = append(diffCmd.Flags, dbFlag())
+}
+
+// resolveRun returns the run a reference points to: a run ID, the
+// last run before a time (or a duration ago), the run before the
+// latest one if the reference is empty or nil for the current state
+func resolveRun(ctx context.Context, storage *store.BunStorage, ref string) (*models.Run, error) {
+	var run *models.Run
+	var err error
+	switch ref {
+	case diffNow:
+		return nil, nil
+	case "":
+		run, err = storage.GetPreviousRun(ctx)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("the history is empty (runs are recorded at the end of situation run)")
+		}
+	default:
+		if id, parseErr := strconv.ParseInt(ref, 10, 64); parseErr == nil {
+			run, err = storage.GetRun(ctx, id)
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil, fmt.Errorf("unknown run: %d", id)
+			}
+			break
+		}
+		t, parseErr := parseSince(ref)
+		if parseErr != nil {
+			return nil, parseErr
+		}
+		run, err = storage.GetRunAt(ctx, t)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("no run before %s", t.Local().Format(time.DateTime))
+		}
+	}
+	return run, err
+}
+
+func diffListRuns(ctx context.Context, storage *store.BunStorage) error {
+	runs, err := storage.ListRuns(ctx, 0)
+	if err != nil {
+		return fmt.Errorf("failed to list runs: %w", err)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tFINISHED\tDURATION\tAGENT\tSTATUS")
+	for _, r := range runs {
+		duration := ""
+		if !r.StartedAt.IsZero() {
+			duration = r.FinishedAt.Sub(r.StartedAt).Truncate(time.Millisecond).String()
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n",
+			r.ID,
+			r.FinishedAt.Local().Format(time.DateTime),
+			duration,
+			r.Agent,
+			r.Status,
+		)
+	}
+	return w.Flush()
+}
+
+func diffAction(ctx context.Context, cmd *cli.Command) error {
+	storage, err := store.NewStorage(db,
+		store.WithAgent(config.AgentString()),
+		store.WithErrorHandler(func(err error) {
+			logger.WithField("on", "storage").Warn(err)
+		}),
+		store.ReadOnly(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create storage: %v", err)
+	}
+
+	if diffList {
+		return diffListRuns(ctx, storage)
+	}
+
+	from, err := resolveRun(ctx, storage, diffFrom)
+	if err != nil {
+		return err
+	}
+	to, err := resolveRun(ctx, storage, diffTo)
+	if err != nil {
+		return err
+	}
+	diff, err := storage.DiffRuns(ctx, from, to)
+	if err != nil {
+		return fmt.Errorf("failed to compare runs: %w", err)
+	}
+
+	switch diffFormat {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(diff)
+	default:
+		return diff.WriteText(os.Stdout)
+	}
+}
@@ -17,7 +17,7 @@ var exploreCmd = cli.Command{
 }
 
 func init() {
-	exploreCmd.Flags = append(exploreCmd.Flags, dbFlag())
+	exploreCmd.Flags = append(exploreCmd.Flags, dbFlag(), refreshFlag())
 }
 
 func exploreAction(ctx context.Context, cmd *cli.Command) error {
@@ -31,5 +31,7 @@ func exploreAction(ctx context.Context, cmd *cli.Command) error {
 		return fmt.Errorf("failed to create storage: %v", err)
 	}
 
-	return tui.NewRootModel(ctx, storage).Run()
+	return tui.NewRootModel(ctx, storage).
+		WithRefresh(refreshInterval).
+		Run()
 }
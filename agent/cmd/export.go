@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/situation-sh/situation/agent/config"
+	"github.com/situation-sh/situation/pkg/export"
+	"github.com/situation-sh/situation/pkg/store"
+	"github.com/situation-sh/situation/pkg/utils"
+	"github.com/urfave/cli/v3"
+)
+
+var (
+	exportFormat  string = export.Formats[0]
+	exportOut     string = "-"
+	exportSubnet  string
+	exportMachine string
+	exportDepth   int = store.DefaultTopologyDepth
+)
+
+var exportCmd = cli.Command{
+	Name:      "export",
+	Usage:     "Export the network topology (DOT, Mermaid or Cytoscape JSON)",
+	UsageText: "situation export [--format dot|mermaid|cytoscape] [--subnet 10.0.0.0/24 | --machine web01 [--depth 1]] [--out topology.dot]",
+	Action:    exportAction,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:        "format",
+			Aliases:     []string{"f"},
+			Usage:       fmt.Sprintf("Output format %v", export.Formats),
+			Value:       exportFormat,
+			Destination: &exportFormat,
+			Validator: func(s string) error {
+				if !utils.Includes(export.Formats, s) {
+					return fmt.Errorf("invalid format: %s (choose from %v)", s, export.Formats)
+				}
+				return nil
+			},
+		},
+		&cli.StringFlag{
+			Name:        "out",
+			Aliases:     []string{"o"},
+			Usage:       "Output file (- for the standard output)",
+			Value:       exportOut,
+			Destination: &exportOut,
+		},
+		&cli.StringFlag{
+			Name:        "subnet",
+			Usage:       "Only export this subnet (CIDR or ID)",
+			Destination: &exportSubnet,
+		},
+		&cli.StringFlag{
+			Name:        "machine",
+			Usage:       "Only export the neighbourhood of this machine (ID, IP or hostname)",
+			Destination: &exportMachine,
+		},
+		&cli.IntFlag{
+			Name:        "depth",
+			Usage:       "Number of hops (shared subnet or flow) around --machine",
+			Value:       exportDepth,
+			Destination: &exportDepth,
+		},
+	},
+}
+
+func init() {
+	exportCmd.Flags = append(exportCmd.Flags, dbFlag())
+}
+
+func exportAction(ctx context.Context, cmd *cli.Command) error {
+	if exportSubnet != "" && exportMachine != "" {
+		return fmt.Errorf("--subnet and --machine cannot be used together")
+	}
+
+	storage, err := store.NewStorage(db,
+		store.WithAgent(config.AgentString()),
+		store.WithErrorHandler(func(err error) {
+			logger.WithField("on", "storage").Warn(err)
+		}),
+		store.ReadOnly(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create storage: %v", err)
+	}
+
+	opts := store.TopologyOptions{Subnet: exportSubnet, Depth: exportDepth}
+	if exportMachine != "" {
+		if opts.Machine, err = storage.ResolveMachine(ctx, exportMachine); err != nil {
+			return err
+		}
+	}
+	topology, err := storage.Topology(ctx, opts)
+	if err != nil {
+		return fmt.Errorf("failed to build the topology: %w", err)
+	}
+
+	var w io.Writer = os.Stdout
+	if exportOut != "-" {
+		f, err := os.Create(exportOut) // #nosec G304
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	if err := export.Render(w, topology, exportFormat); err != nil {
+		return fmt.Errorf("failed to export the topology: %w", err)
+	}
+	if exportOut != "-" {
+		logger.Infof("Topology written to %s", exportOut)
+	}
+	return nil
+}
@@ -2,7 +2,6 @@ package cmd
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"log/slog"
 
@@ -24,34 +23,22 @@ var (
 
 var (
 	mcpTransport       string = "stdio"
-	mcpValidTransports        = []string{"stdio"} // []string{"http", "stdio"}
-	// mcpPort            uint16 = 8080
-	// mcpHost            string = "localhost"
+	mcpValidTransports        = []string{"stdio", "http"}
+	mcpQueryTimeout           = store.DefaultQueryTimeout
+	mcpMaxRows                = store.DefaultQueryMaxRows
 )
 
-// currently we do not implement the HTTP transport because of security
-// and binary weight concerns but we keep the code and flags for future
-// use and to avoid breaking changes
+// the HTTP transport is opt-in and always requires authentication
+// (bearer token and/or mTLS), see mcp_http.go
 var mcpCmd = cli.Command{
 	Name:   "mcp",
 	Usage:  "Start an MCP server to query collected data",
 	Action: mcpAction,
 	Flags: []cli.Flag{
-		// &cli.StringFlag{
-		// 	Name:        "host",
-		// 	Value:       "localhost",
-		// 	Destination: &mcpHost,
-		// 	Usage:       "Host to listen on for MCP server",
-		// },
-		// &cli.Uint16Flag{
-		// 	Name:        "port",
-		// 	Value:       8080,
-		// 	Destination: &mcpPort,
-		// 	Usage:       "Port to listen on for MCP server",
-		// },
 		&cli.StringFlag{
 			Name:        "transport",
 			Aliases:     []string{"t"},
+			Usage:       fmt.Sprintf("MCP transport %v", mcpValidTransports),
 			Value:       mcpValidTransports[0],
 			Destination: &mcpTransport,
 			Validator: func(s string) error {
@@ -61,6 +48,50 @@ var mcpCmd = cli.Command{
 				return nil
 			},
 		},
+		&cli.DurationFlag{
+			Name:        "query-timeout",
+			Usage:       "Statement timeout of the query tool",
+			Value:       mcpQueryTimeout,
+			Destination: &mcpQueryTimeout,
+		},
+		&cli.IntFlag{
+			Name:        "max-rows",
+			Usage:       "Maximum number of rows returned by the query tool",
+			Value:       mcpMaxRows,
+			Destination: &mcpMaxRows,
+		},
+		&cli.StringFlag{
+			Name:        "listen",
+			Usage:       "Address to listen on (http transport)",
+			Value:       mcpListen,
+			Destination: &mcpListen,
+		},
+		&cli.StringFlag{
+			Name:        "token",
+			Usage:       "Bearer token expected from the clients (http transport)",
+			Destination: &mcpToken,
+			Sources:     cli.EnvVars("SITUATION_MCP_TOKEN"),
+		},
+		&cli.StringFlag{
+			Name:        "tls-cert",
+			Usage:       "TLS certificate file (http transport)",
+			Destination: &mcpTLSCert,
+		},
+		&cli.StringFlag{
+			Name:        "tls-key",
+			Usage:       "TLS private key file (http transport)",
+			Destination: &mcpTLSKey,
+		},
+		&cli.StringFlag{
+			Name:        "client-ca",
+			Usage:       "CA bundle used to verify client certificates, enables mTLS (http transport)",
+			Destination: &mcpClientCA,
+		},
+		&cli.StringSliceFlag{
+			Name:        "allowed-origin",
+			Usage:       "Origin allowed to send cross-origin requests, e.g. https://assistant.example.com (http transport, repeatable)",
+			Destination: &mcpAllowedOrigins,
+		},
 	},
 }
 
@@ -95,13 +126,14 @@ func mcpError(err error) *mcp.CallToolResult {
 }
 
 type QueryArgs struct {
-	SQL string `json:"sql" jsonschema:"description:SQL query to execute"`
+	SQL     string `json:"sql" jsonschema:"description:single SELECT (or WITH) statement to execute"`
+	MaxRows int    `json:"max_rows,omitempty" jsonschema:"description:maximum number of rows to return (bounded by the server)"`
 }
 
 var queryTool = mcp.Tool{
 	Title:       "Run SQL query on your infrastructure data",
 	Name:        "query",
-	Description: "Execute a read-only SQL query, returns JSON rows",
+	Description: "Execute a single read-only SELECT/WITH statement, returns the columns, the JSON rows and whether the output has been truncated",
 	Meta:        mcp.Meta{"dialect": "unknown"},
 	Annotations: &mcp.ToolAnnotations{
 		DestructiveHint: new(false),
@@ -177,48 +209,27 @@ func mcpAction(ctx context.Context, cmd *cli.Command) error {
 	}
 
 	mcp.AddTool(server, &queryTool, func(ctx context.Context, req *mcp.CallToolRequest, args QueryArgs) (*mcp.CallToolResult, any, error) {
-		var results []map[string]any
-		rows, err := storage.DB().QueryContext(ctx, args.SQL)
+		maxRows := mcpMaxRows
+		if args.MaxRows > 0 && args.MaxRows < maxRows {
+			maxRows = args.MaxRows
+		}
+		result, err := storage.SafeQuery(ctx, args.SQL, store.QueryOptions{
+			Timeout: mcpQueryTimeout,
+			MaxRows: maxRows,
+		})
 		if err != nil {
 			return mcpError(err), nil, nil
 		}
-		defer rows.Close()
-
-		cols, _ := rows.Columns()
-		for rows.Next() {
-			vals := make([]any, len(cols))
-			ptrs := make([]any, len(cols))
-			for i := range vals {
-				ptrs[i] = &vals[i]
-			}
-			if err := rows.Scan(ptrs...); err != nil {
-				// ignore currently
-				continue
-			}
-			row := make(map[string]any, len(cols))
-			for i, c := range cols {
-				row[c] = vals[i]
-			}
-			results = append(results, row)
-		}
-
-		out, _ := json.MarshalIndent(results, "", "  ")
-		return &mcp.CallToolResult{
-			Content: []mcp.Content{&mcp.TextContent{Text: string(out)}},
-		}, nil, nil
+		return mcpJSON(result), nil, nil
 	})
 
+	addInventoryTools(server, storage)
+	addInventoryResources(server, storage)
+	addInventoryPrompts(server, storage)
+
 	switch mcpTransport {
-	// case "http":
-	// 	return nil
-	// handler := mcp.NewStreamableHTTPHandler(
-	// 	func(*http.Request) *mcp.Server { return server },
-	// 	&mcp.StreamableHTTPOptions{},
-	// )
-	// return http.ListenAndServe(
-	// 	net.JoinHostPort(mcpHost, fmt.Sprintf("%d", mcpPort)),
-	// 	handler,
-	// )
+	case "http":
+		return serveMCPHTTP(ctx, server)
 	case "stdio":
 		return server.Run(ctx, &mcp.StdioTransport{})
 	default:
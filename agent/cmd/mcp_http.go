@@ -0,0 +1,299 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/auth"
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// maximum number of bytes read from a request body to
+// extract the JSON-RPC method for the audit log
+const mcpAuditPeekSize = 64 * 1024
+
+var (
+	mcpListen         string = "localhost:8080"
+	mcpToken          string = ""
+	mcpTLSCert        string = ""
+	mcpTLSKey         string = ""
+	mcpClientCA       string = ""
+	mcpAllowedOrigins        = []string{}
+)
+
+// mcpIdentityKey is the context key of the authenticated client
+type mcpIdentityKey struct{}
+
+// mcpIdentity returns the identity of the client that has been
+// authenticated (common name of its certificate or "token")
+func mcpIdentity(r *http.Request) string {
+	if r.TLS != nil && len(r.TLS.PeerCertificates) > 0 {
+		return "cert:" + r.TLS.PeerCertificates[0].Subject.CommonName
+	}
+	if info := auth.TokenInfoFromContext(r.Context()); info != nil {
+		return info.UserID
+	}
+	return ""
+}
+
+// mcpTokenVerifier checks the bearer token against the configured one
+// in constant time
+func mcpTokenVerifier(token string) auth.TokenVerifier {
+	return func(ctx context.Context, candidate string, req *http.Request) (*auth.TokenInfo, error) {
+		if subtle.ConstantTimeCompare([]byte(candidate), []byte(token)) != 1 {
+			return nil, auth.ErrInvalidToken
+		}
+		// the static token does not expire but the sdk requires
+		// an expiration date
+		return &auth.TokenInfo{
+			UserID:     "token",
+			Expiration: time.Now().Add(time.Minute),
+		}, nil
+	}
+}
+
+// mcpRequireClientCert rejects the requests that do not come with
+// a verified client certificate (defense in depth as the TLS config
+// already requires it)
+func mcpRequireClientCert(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+			http.Error(w, "client certificate required", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// statusRecorder keeps the status code sent to the client
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusRecorder) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusRecorder) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush is required to stream server-sent events
+func (w *statusRecorder) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap is used by http.ResponseController
+func (w *statusRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// jsonrpcCall is the subset of a JSON-RPC message we log
+type jsonrpcCall struct {
+	Method string `json:"method"`
+	Params struct {
+		Name string `json:"name"`
+		URI  string `json:"uri"`
+	} `json:"params"`
+}
+
+// peekJSONRPC reads the beginning of the body to extract the JSON-RPC
+// method and restores the body for the next handlers
+func peekJSONRPC(r *http.Request) *jsonrpcCall {
+	if r.Body == nil || r.Method != http.MethodPost {
+		return nil
+	}
+	head, err := io.ReadAll(io.LimitReader(r.Body, mcpAuditPeekSize))
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(head), r.Body), r.Body}
+	if err != nil {
+		return nil
+	}
+	var call jsonrpcCall
+	if err := json.Unmarshal(head, &call); err != nil {
+		return nil
+	}
+	return &call
+}
+
+// mcpAudit logs every request received by the MCP server. It must wrap
+// the authentication middleware so that rejected requests are logged too.
+func mcpAudit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		call := peekJSONRPC(r)
+		rec := &statusRecorder{ResponseWriter: w}
+
+		// the identity is only known once the authentication
+		// middleware has run, so we catch the request downstream
+		var identity string
+		next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), mcpIdentityKey{}, &identity)))
+
+		entry := logger.WithField("on", "mcp").
+			WithField("remote", r.RemoteAddr).
+			WithField("method", r.Method).
+			WithField("path", r.URL.Path).
+			WithField("status", rec.status).
+			WithField("duration", time.Since(start)).
+			WithField("client", identity).
+			WithField("user_agent", r.UserAgent())
+		if sid := r.Header.Get("Mcp-Session-Id"); sid != "" {
+			entry = entry.WithField("session", sid)
+		}
+		if call != nil && call.Method != "" {
+			entry = entry.WithField("rpc", call.Method)
+			if call.Params.Name != "" {
+				entry = entry.WithField("tool", call.Params.Name)
+			}
+			if call.Params.URI != "" {
+				entry = entry.WithField("uri", call.Params.URI)
+			}
+		}
+		if rec.status >= 400 {
+			entry.Warn("MCP request rejected")
+		} else {
+			entry.Info("MCP request")
+		}
+	})
+}
+
+// mcpRecordIdentity stores the authenticated identity so that
+// the audit middleware can log it
+func mcpRecordIdentity(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if p, ok := r.Context().Value(mcpIdentityKey{}).(*string); ok {
+			*p = mcpIdentity(r)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// mcpHTTPHandler returns the streamable HTTP handler wrapped with
+// authentication and audit logging
+func mcpHTTPHandler(server *mcp.Server) (http.Handler, error) {
+	if mcpToken == "" && mcpClientCA == "" {
+		return nil, fmt.Errorf("the http transport requires authentication (pass --token or --client-ca)")
+	}
+
+	cop := http.NewCrossOriginProtection()
+	for _, origin := range mcpAllowedOrigins {
+		if err := cop.AddTrustedOrigin(origin); err != nil {
+			return nil, fmt.Errorf("invalid allowed origin: %w", err)
+		}
+	}
+
+	var handler http.Handler = mcp.NewStreamableHTTPHandler(
+		func(*http.Request) *mcp.Server { return server },
+		&mcp.StreamableHTTPOptions{
+			Logger:                slog.New(newSlogHandler()),
+			CrossOriginProtection: cop,
+		},
+	)
+	handler = mcpRecordIdentity(handler)
+	if mcpToken != "" {
+		handler = auth.RequireBearerToken(mcpTokenVerifier(mcpToken), nil)(handler)
+	}
+	if mcpClientCA != "" {
+		handler = mcpRequireClientCert(handler)
+	}
+	return mcpAudit(handler), nil
+}
+
+// mcpTLSConfig returns the TLS configuration of the HTTP transport
+// (nil if TLS is not enabled)
+func mcpTLSConfig() (*tls.Config, error) {
+	if mcpTLSCert == "" && mcpTLSKey == "" {
+		if mcpClientCA != "" {
+			return nil, fmt.Errorf("--client-ca requires --tls-cert and --tls-key")
+		}
+		return nil, nil
+	}
+	if mcpTLSCert == "" || mcpTLSKey == "" {
+		return nil, fmt.Errorf("both --tls-cert and --tls-key must be provided")
+	}
+
+	cert, err := tls.LoadX509KeyPair(mcpTLSCert, mcpTLSKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+	}
+	cfg := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+	}
+
+	if mcpClientCA != "" {
+		pem, err := os.ReadFile(mcpClientCA)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in %s", mcpClientCA)
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return cfg, nil
+}
+
+// serveMCPHTTP starts the streamable HTTP transport and stops
+// it when the context is cancelled
+func serveMCPHTTP(ctx context.Context, server *mcp.Server) error {
+	handler, err := mcpHTTPHandler(server)
+	if err != nil {
+		return err
+	}
+	tlsConfig, err := mcpTLSConfig()
+	if err != nil {
+		return err
+	}
+
+	srv := &http.Server{
+		Addr:              mcpListen,
+		Handler:           handler,
+		TLSConfig:         tlsConfig,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		srv.Shutdown(shutdownCtx)
+	}()
+
+	log := logger.WithField("on", "mcp").WithField("listen", mcpListen)
+	if tlsConfig == nil {
+		log.Warn("MCP server listening without TLS, the bearer token is sent in clear text")
+		err = srv.ListenAndServe()
+	} else {
+		log.WithField("mtls", tlsConfig.ClientCAs != nil).Info("MCP server listening")
+		err = srv.ListenAndServeTLS("", "")
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestMCPHTTPHandler(t *testing.T) {
+	defer func(token, ca string) { mcpToken, mcpClientCA = token, ca }(mcpToken, mcpClientCA)
+	s := mcp.NewServer(&mcp.Implementation{Name: "test"}, nil)
+
+	mcpToken, mcpClientCA = "", ""
+	if _, err := mcpHTTPHandler(s); err == nil {
+		t.Fatal("the http transport must require authentication")
+	}
+
+	mcpToken = "s3cr3t"
+	handler, err := mcpHTTPHandler(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+
+	body := `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-06-18","capabilities":{},"clientInfo":{"name":"test","version":"0"}}}`
+	for _, tc := range []struct {
+		token  string
+		status int
+	}{
+		{"", http.StatusUnauthorized},
+		{"wrong", http.StatusUnauthorized},
+		{"s3cr3t", http.StatusOK},
+	} {
+		req, _ := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", "application/json, text/event-stream")
+		if tc.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tc.status {
+			t.Errorf("token %q: expected status %d, got %d", tc.token, tc.status, resp.StatusCode)
+		}
+	}
+}
+
+func TestPeekJSONRPC(t *testing.T) {
+	body := `{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"query","arguments":{"sql":"SELECT 1"}}}`
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	call := peekJSONRPC(req)
+	if call == nil || call.Method != "tools/call" || call.Params.Name != "query" {
+		t.Fatalf("unexpected call: %+v", call)
+	}
+	// the body must be left intact
+	rest, err := io.ReadAll(req.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(rest) != body {
+		t.Errorf("body has been altered: %s", rest)
+	}
+}
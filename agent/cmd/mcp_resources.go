@@ -0,0 +1,219 @@
+package cmd
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/situation-sh/situation/pkg/store"
+)
+
+const (
+	mcpMachineURIPrefix = "situation://machine/"
+	mcpSubnetURIPrefix  = "situation://subnet/"
+	mcpLatestRunURI     = "situation://run/latest"
+)
+
+// mcpMachineURI returns the URI of the machine resource
+func mcpMachineURI(id int64) string {
+	return fmt.Sprintf("%s%d", mcpMachineURIPrefix, id)
+}
+
+// mcpSubnetURI returns the URI of the subnet resource
+// (the CIDR is kept as is, e.g. situation://subnet/10.0.0.0/24)
+func mcpSubnetURI(cidr string) string {
+	return mcpSubnetURIPrefix + cidr
+}
+
+// mcpJSONResource renders v as a JSON resource
+func mcpJSONResource(uri string, v any) (*mcp.ResourceContents, error) {
+	out, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return &mcp.ResourceContents{URI: uri, MIMEType: "application/json", Text: string(out)}, nil
+}
+
+// mcpResourceError turns "no rows" errors into the
+// resource not found error of the protocol
+func mcpResourceError(uri string, err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return mcp.ResourceNotFoundError(uri)
+	}
+	return err
+}
+
+func readMachineResource(ctx context.Context, storage *store.BunStorage, uri string) (*mcp.ResourceContents, error) {
+	id, err := strconv.ParseInt(strings.TrimPrefix(uri, mcpMachineURIPrefix), 10, 64)
+	if err != nil {
+		return nil, mcp.ResourceNotFoundError(uri)
+	}
+	details, err := storage.GetMachineDetails(ctx, id)
+	if err != nil {
+		return nil, mcpResourceError(uri, err)
+	}
+	return mcpJSONResource(uri, details)
+}
+
+func readSubnetResource(ctx context.Context, storage *store.BunStorage, uri string) (*mcp.ResourceContents, error) {
+	// the CIDR may be percent-encoded (10.0.0.0%2F24)
+	cidr, err := url.PathUnescape(strings.TrimPrefix(uri, mcpSubnetURIPrefix))
+	if err != nil {
+		return nil, mcp.ResourceNotFoundError(uri)
+	}
+	_, ipnet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, mcp.ResourceNotFoundError(uri)
+	}
+	details, err := storage.GetSubnetDetails(ctx, ipnet.String())
+	if err != nil {
+		return nil, mcpResourceError(uri, err)
+	}
+	return mcpJSONResource(uri, details)
+}
+
+func readLatestRunResource(ctx context.Context, storage *store.BunStorage) (*mcp.ResourceContents, error) {
+	run, err := storage.GetLatestRun(ctx, 0)
+	if err != nil {
+		return nil, mcpResourceError(mcpLatestRunURI, err)
+	}
+	return mcpJSONResource(mcpLatestRunURI, run)
+}
+
+// addInventoryResources publishes the machines, the subnets
+// and the latest run as browsable resources
+func addInventoryResources(server *mcp.Server, storage *store.BunStorage) {
+	server.AddResourceTemplate(
+		&mcp.ResourceTemplate{
+			Name:        "machine",
+			Title:       "Machine",
+			Description: "Machine with hardware, network interfaces (and subnets), applications (with endpoints and users), parent and hosted machines",
+			MIMEType:    "application/json",
+			URITemplate: mcpMachineURIPrefix + "{id}",
+		},
+		func(ctx context.Context, req *mcp.ReadResourceRequest) (*mcp.ReadResourceResult, error) {
+			contents, err := readMachineResource(ctx, storage, req.Params.URI)
+			if err != nil {
+				return nil, err
+			}
+			return &mcp.ReadResourceResult{Contents: []*mcp.ResourceContents{contents}}, nil
+		},
+	)
+
+	server.AddResourceTemplate(
+		&mcp.ResourceTemplate{
+			Name:        "subnet",
+			Title:       "Subnetwork",
+			Description: "Subnetwork with the machines connected to it and the endpoints they expose on it (e.g. situation://subnet/10.0.0.0/24)",
+			MIMEType:    "application/json",
+			// reserved expansion as the CIDR contains a slash
+			URITemplate: mcpSubnetURIPrefix + "{+cidr}",
+		},
+		func(ctx context.Context, req *mcp.ReadResourceRequest) (*mcp.ReadResourceResult, error) {
+			contents, err := readSubnetResource(ctx, storage, req.Params.URI)
+			if err != nil {
+				return nil, err
+			}
+			return &mcp.ReadResourceResult{Contents: []*mcp.ResourceContents{contents}}, nil
+		},
+	)
+
+	server.AddResource(
+		&mcp.Resource{
+			Name:        "latest-run",
+			Title:       "Latest run",
+			Description: "Latest agent run (status, module errors) and the objects it created or updated",
+			MIMEType:    "application/json",
+			URI:         mcpLatestRunURI,
+		},
+		func(ctx context.Context, req *mcp.ReadResourceRequest) (*mcp.ReadResourceResult, error) {
+			contents, err := readLatestRunResource(ctx, storage)
+			if err != nil {
+				return nil, err
+			}
+			return &mcp.ReadResourceResult{Contents: []*mcp.ResourceContents{contents}}, nil
+		},
+	)
+}
+
+// mcpPromptResult builds a prompt made of an instruction
+// followed by the embedded resources
+func mcpPromptResult(description string, instruction string, resources ...*mcp.ResourceContents) *mcp.GetPromptResult {
+	messages := []*mcp.PromptMessage{
+		{Role: "user", Content: &mcp.TextContent{Text: instruction}},
+	}
+	for _, r := range resources {
+		messages = append(messages, &mcp.PromptMessage{
+			Role:    "user",
+			Content: &mcp.EmbeddedResource{Resource: r},
+		})
+	}
+	return &mcp.GetPromptResult{Description: description, Messages: messages}
+}
+
+// addInventoryPrompts registers the built-in prompts. They pre-load
+// the resources the model needs to answer.
+func addInventoryPrompts(server *mcp.Server, storage *store.BunStorage) {
+	server.AddPrompt(
+		&mcp.Prompt{
+			Name:        "summarise_subnet_exposure",
+			Title:       "Summarise exposure of a subnet",
+			Description: "Summarise the services exposed on a subnet and the machines behind them",
+			Arguments: []*mcp.PromptArgument{
+				{Name: "subnet", Description: "subnet in CIDR notation (e.g. 10.0.0.0/24)", Required: true},
+			},
+		},
+		func(ctx context.Context, req *mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+			cidr := req.Params.Arguments["subnet"]
+			subnet, err := readSubnetResource(ctx, storage, mcpSubnetURI(cidr))
+			if err != nil {
+				return nil, fmt.Errorf("cannot load subnet %s: %w", cidr, err)
+			}
+			instruction := fmt.Sprintf("Summarise the exposure of the subnet %s. "+
+				"List the services that are reachable (port, protocol, application, machine), "+
+				"highlight the risky ones (remote administration, databases, clear-text protocols, "+
+				"expired or self-signed certificates) and the machines that expose the most. "+
+				"Mention how fresh the data is according to the latest run.", cidr)
+			resources := []*mcp.ResourceContents{subnet}
+			// the subnet alone is enough if no run has been recorded
+			if latest, err := readLatestRunResource(ctx, storage); err == nil {
+				resources = append(resources, latest)
+			}
+			return mcpPromptResult("Exposure of "+cidr, instruction, resources...), nil
+		},
+	)
+
+	server.AddPrompt(
+		&mcp.Prompt{
+			Name:        "explain_machine",
+			Title:       "Explain a machine",
+			Description: "Explain what a machine is, what it runs and how it is connected",
+			Arguments: []*mcp.PromptArgument{
+				{Name: "machine", Description: "machine ID, hostname or IP address", Required: true},
+			},
+		},
+		func(ctx context.Context, req *mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+			ref := req.Params.Arguments["machine"]
+			id, err := storage.ResolveMachine(ctx, ref)
+			if err != nil {
+				return nil, err
+			}
+			machine, err := readMachineResource(ctx, storage, mcpMachineURI(id))
+			if err != nil {
+				return nil, fmt.Errorf("cannot load machine %s: %w", ref, err)
+			}
+			instruction := fmt.Sprintf("Explain the machine %s: its role (guess it from the "+
+				"applications and open ports), its operating system and hardware, the networks it "+
+				"is connected to, the services it exposes and the machines it hosts. "+
+				"Point out anything unusual.", ref)
+			return mcpPromptResult("Machine "+ref, instruction, machine), nil
+		},
+	)
+}
@@ -0,0 +1,217 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/situation-sh/situation/pkg/store"
+)
+
+// high-level tools are read-only and only see the collected data
+var inventoryToolAnnotations = &mcp.ToolAnnotations{
+	DestructiveHint: new(false),
+	IdempotentHint:  true,
+	OpenWorldHint:   new(false),
+	ReadOnlyHint:    true,
+}
+
+type ListMachinesArgs struct {
+	Hostname     string `json:"hostname,omitempty" jsonschema:"hostname pattern, * is a wildcard (e.g. db*), substring match otherwise"`
+	Platform     string `json:"platform,omitempty" jsonschema:"platform (e.g. linux, windows, docker)"`
+	Distribution string `json:"distribution,omitempty" jsonschema:"OS name or base image pattern"`
+	Subnet       string `json:"subnet,omitempty" jsonschema:"only the machines connected to this subnet (CIDR, e.g. 10.0.0.0/24)"`
+	Tag          string `json:"tag,omitempty" jsonschema:"machine tag"`
+	Limit        int    `json:"limit,omitempty" jsonschema:"maximum number of machines (default 100)"`
+}
+
+type GetMachineArgs struct {
+	Machine string `json:"machine" jsonschema:"machine ID, hostname or IP address"`
+}
+
+type FindEndpointsArgs struct {
+	Port     uint16 `json:"port,omitempty" jsonschema:"port number"`
+	Protocol string `json:"protocol,omitempty" jsonschema:"transport (tcp, udp) or application protocol (http, ssh...)"`
+	SaaS     string `json:"saas,omitempty" jsonschema:"SaaS name pattern, * returns all the SaaS endpoints"`
+	Limit    int    `json:"limit,omitempty" jsonschema:"maximum number of endpoints (default 100)"`
+}
+
+type FlowsBetweenArgs struct {
+	A string `json:"a" jsonschema:"first machine (ID, hostname or IP address)"`
+	B string `json:"b" jsonschema:"second machine (ID, hostname or IP address)"`
+}
+
+type WhoListensOnArgs struct {
+	IP   string `json:"ip" jsonschema:"IP address"`
+	Port uint16 `json:"port" jsonschema:"port number"`
+}
+
+type PackagesOnArgs struct {
+	Machine string `json:"machine" jsonschema:"machine ID, hostname or IP address"`
+	Name    string `json:"name,omitempty" jsonschema:"package name pattern, * is a wildcard, substring match otherwise"`
+	Limit   int    `json:"limit,omitempty" jsonschema:"maximum number of packages (default 100)"`
+}
+
+type RecentChangesArgs struct {
+	Since string `json:"since" jsonschema:"RFC3339 date (2025-01-31T00:00:00Z), date (2025-01-31) or duration before now (24h)"`
+	Limit int    `json:"limit,omitempty" jsonschema:"maximum number of objects of each kind (default 100)"`
+}
+
+// mcpJSON returns v as an indented JSON text content
+func mcpJSON(v any) *mcp.CallToolResult {
+	out, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return mcpError(err)
+	}
+	return &mcp.CallToolResult{
+		Content: []mcp.Content{&mcp.TextContent{Text: string(out)}},
+	}
+}
+
+// parseSince accepts an RFC3339 timestamp, a date or
+// a duration (counted back from now)
+func parseSince(s string) (time.Time, error) {
+	if d, err := time.ParseDuration(s); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	for _, layout := range []string{time.RFC3339, time.DateTime, time.DateOnly} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid time: %s (expected RFC3339, date or duration)", s)
+}
+
+// addInventoryTools registers the typed tools that wrap
+// the store queries (they work on both dialects)
+func addInventoryTools(server *mcp.Server, storage *store.BunStorage) {
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "list_machines",
+		Title:       "List machines",
+		Description: "List the machines (with their network interfaces) matching optional filters",
+		Annotations: inventoryToolAnnotations,
+	}, func(ctx context.Context, req *mcp.CallToolRequest, args ListMachinesArgs) (*mcp.CallToolResult, any, error) {
+		machines, err := storage.ListMachines(ctx, store.MachineFilter{
+			Hostname:     args.Hostname,
+			Platform:     args.Platform,
+			Distribution: args.Distribution,
+			Subnet:       args.Subnet,
+			Tag:          args.Tag,
+			Limit:        args.Limit,
+		})
+		if err != nil {
+			return mcpError(err), nil, nil
+		}
+		return mcpJSON(machines), nil, nil
+	})
+
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "get_machine",
+		Title:       "Get machine",
+		Description: "Get a machine with CPU, disks, GPUs, network interfaces (and subnets), applications (with endpoints and users), parent and hosted machines. Packages are listed by packages_on",
+		Annotations: inventoryToolAnnotations,
+	}, func(ctx context.Context, req *mcp.CallToolRequest, args GetMachineArgs) (*mcp.CallToolResult, any, error) {
+		id, err := storage.ResolveMachine(ctx, args.Machine)
+		if err != nil {
+			return mcpError(err), nil, nil
+		}
+		details, err := storage.GetMachineDetails(ctx, id)
+		if err != nil {
+			return mcpError(err), nil, nil
+		}
+		return mcpJSON(details), nil, nil
+	})
+
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "find_endpoints",
+		Title:       "Find endpoints",
+		Description: "Find the network endpoints by port, protocol or SaaS, along with the application and the machine behind them",
+		Annotations: inventoryToolAnnotations,
+	}, func(ctx context.Context, req *mcp.CallToolRequest, args FindEndpointsArgs) (*mcp.CallToolResult, any, error) {
+		endpoints, err := storage.FindEndpoints(ctx, store.EndpointFilter{
+			Port:     args.Port,
+			Protocol: args.Protocol,
+			SaaS:     args.SaaS,
+			Limit:    args.Limit,
+		})
+		if err != nil {
+			return mcpError(err), nil, nil
+		}
+		return mcpJSON(endpoints), nil, nil
+	})
+
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "flows_between",
+		Title:       "Flows between machines",
+		Description: "List the flows between two machines, in both directions",
+		Annotations: inventoryToolAnnotations,
+	}, func(ctx context.Context, req *mcp.CallToolRequest, args FlowsBetweenArgs) (*mcp.CallToolResult, any, error) {
+		a, err := storage.ResolveMachine(ctx, args.A)
+		if err != nil {
+			return mcpError(err), nil, nil
+		}
+		b, err := storage.ResolveMachine(ctx, args.B)
+		if err != nil {
+			return mcpError(err), nil, nil
+		}
+		flows, err := storage.GetFlowsBetween(ctx, a, b)
+		if err != nil {
+			return mcpError(err), nil, nil
+		}
+		return mcpJSON(flows), nil, nil
+	})
+
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "who_listens_on",
+		Title:       "Who listens on",
+		Description: "Find the applications (with machine and users) listening on ip:port, including those bound to all addresses",
+		Annotations: inventoryToolAnnotations,
+	}, func(ctx context.Context, req *mcp.CallToolRequest, args WhoListensOnArgs) (*mcp.CallToolResult, any, error) {
+		ip := net.ParseIP(args.IP)
+		if ip == nil {
+			return mcpError(fmt.Errorf("invalid IP address: %s", args.IP)), nil, nil
+		}
+		endpoints, err := storage.WhoListensOn(ctx, ip.String(), args.Port)
+		if err != nil {
+			return mcpError(err), nil, nil
+		}
+		return mcpJSON(endpoints), nil, nil
+	})
+
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "packages_on",
+		Title:       "Packages on machine",
+		Description: "List the packages installed on a machine, optionally filtered by name",
+		Annotations: inventoryToolAnnotations,
+	}, func(ctx context.Context, req *mcp.CallToolRequest, args PackagesOnArgs) (*mcp.CallToolResult, any, error) {
+		id, err := storage.ResolveMachine(ctx, args.Machine)
+		if err != nil {
+			return mcpError(err), nil, nil
+		}
+		pkgs, err := storage.GetPackagesOn(ctx, id, args.Name, args.Limit)
+		if err != nil {
+			return mcpError(err), nil, nil
+		}
+		return mcpJSON(pkgs), nil, nil
+	})
+
+	mcp.AddTool(server, &mcp.Tool{
+		Name:        "recent_changes",
+		Title:       "Recent changes",
+		Description: "List the machines, network interfaces, applications, endpoints, packages and flows created or updated since a given time",
+		Annotations: inventoryToolAnnotations,
+	}, func(ctx context.Context, req *mcp.CallToolRequest, args RecentChangesArgs) (*mcp.CallToolResult, any, error) {
+		since, err := parseSince(args.Since)
+		if err != nil {
+			return mcpError(err), nil, nil
+		}
+		changes, err := storage.GetChanges(ctx, since, args.Limit)
+		if err != nil {
+			return mcpError(err), nil, nil
+		}
+		return mcpJSON(changes), nil, nil
+	})
+}
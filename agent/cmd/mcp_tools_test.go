@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+	"github.com/situation-sh/situation/pkg/models"
+	"github.com/situation-sh/situation/pkg/store"
+)
+
+func TestParseSince(t *testing.T) {
+	since, err := parseSince("24h")
+	if d := time.Since(since); err != nil || d < 24*time.Hour || d > 25*time.Hour {
+		t.Errorf("unexpected time for 24h: %v (%v)", since, err)
+	}
+	for _, s := range []string{"2025-01-31T00:00:00Z", "2025-01-31 00:00:00", "2025-01-31"} {
+		since, err := parseSince(s)
+		if err != nil || !since.Equal(time.Date(2025, 1, 31, 0, 0, 0, 0, time.UTC)) {
+			t.Errorf("unexpected time for %s: %v (%v)", s, since, err)
+		}
+	}
+	if _, err := parseSince("yesterday"); err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestInventoryTools(t *testing.T) {
+	ctx := context.Background()
+	storage, err := store.NewSQLiteBunStorage(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := storage.Migrate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	machine := models.Machine{Hostname: "db01", Platform: "linux"}
+	if _, err := storage.DB().NewInsert().Model(&machine).Exec(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	subnet := models.Subnetwork{NetworkCIDR: "10.0.0.0/24", NetworkAddr: "10.0.0.0", MaskSize: 24, IPVersion: 4}
+	if _, err := storage.DB().NewInsert().Model(&subnet).Exec(ctx); err != nil {
+		t.Fatal(err)
+	}
+	nic := models.NetworkInterface{MAC: "AA:AA:AA:AA:AA:01", IP: []string{"10.0.0.10"}, MachineID: machine.ID}
+	if _, err := storage.DB().NewInsert().Model(&nic).Exec(ctx); err != nil {
+		t.Fatal(err)
+	}
+	link := models.NetworkInterfaceSubnet{NetworkInterfaceID: nic.ID, SubnetworkID: subnet.ID, IP: "10.0.0.10"}
+	if _, err := storage.DB().NewInsert().Model(&link).Exec(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	s := mcp.NewServer(&mcp.Implementation{Name: "test"}, nil)
+	addInventoryTools(s, storage)
+	addInventoryResources(s, storage)
+	addInventoryPrompts(s, storage)
+
+	serverTransport, clientTransport := mcp.NewInMemoryTransports()
+	if _, err := s.Connect(ctx, serverTransport, nil); err != nil {
+		t.Fatal(err)
+	}
+	client := mcp.NewClient(&mcp.Implementation{Name: "client"}, nil)
+	session, err := client.Connect(ctx, clientTransport, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close()
+
+	for _, tc := range []struct {
+		tool    string
+		args    map[string]any
+		isError bool
+		expect  string
+	}{
+		{"list_machines", map[string]any{"hostname": "db*"}, false, "db01"},
+		{"get_machine", map[string]any{"machine": "DB01"}, false, `"hostname": "db01"`},
+		{"get_machine", map[string]any{"machine": "unknown"}, true, "no machine"},
+		{"who_listens_on", map[string]any{"ip": "nope", "port": 22}, true, "invalid IP"},
+		{"recent_changes", map[string]any{"since": "1h"}, false, "db01"},
+	} {
+		res, err := session.CallTool(ctx, &mcp.CallToolParams{Name: tc.tool, Arguments: tc.args})
+		if err != nil {
+			t.Fatalf("%s: %v", tc.tool, err)
+		}
+		text := res.Content[0].(*mcp.TextContent).Text
+		if res.IsError != tc.isError || !strings.Contains(text, tc.expect) {
+			t.Errorf("%s(%v): unexpected result (error=%v): %s", tc.tool, tc.args, res.IsError, text)
+		}
+	}
+
+	for uri, expect := range map[string]string{
+		"situation://machine/1":            "db01",
+		"situation://subnet/10.0.0.0/24":   "10.0.0.10",
+		"situation://subnet/10.0.0.0%2F24": "db01",
+	} {
+		res, err := session.ReadResource(ctx, &mcp.ReadResourceParams{URI: uri})
+		if err != nil {
+			t.Errorf("failed to read %s: %v", uri, err)
+			continue
+		}
+		if !strings.Contains(res.Contents[0].Text, expect) {
+			t.Errorf("%s: %s not found in %s", uri, expect, res.Contents[0].Text)
+		}
+	}
+	for _, uri := range []string{"situation://machine/42", "situation://subnet/192.168.0.0/24", "situation://run/latest"} {
+		if _, err := session.ReadResource(ctx, &mcp.ReadResourceParams{URI: uri}); err == nil {
+			t.Errorf("%s must not be found", uri)
+		}
+	}
+
+	prompt, err := session.GetPrompt(ctx, &mcp.GetPromptParams{
+		Name:      "explain_machine",
+		Arguments: map[string]string{"machine": "10.0.0.10"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(prompt.Messages) != 2 {
+		t.Fatalf("expected the instruction and the machine, got %d messages", len(prompt.Messages))
+	}
+	if r, ok := prompt.Messages[1].Content.(*mcp.EmbeddedResource); !ok || r.Resource.URI != "situation://machine/1" {
+		t.Errorf("the machine resource is not embedded: %+v", prompt.Messages[1].Content)
+	}
+	if _, err := session.GetPrompt(ctx, &mcp.GetPromptParams{
+		Name:      "summarise_subnet_exposure",
+		Arguments: map[string]string{"subnet": "10.0.0.0/24"},
+	}); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,241 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/situation-sh/situation/agent/config"
+	"github.com/situation-sh/situation/pkg/store"
+	"github.com/situation-sh/situation/pkg/utils"
+	"github.com/urfave/cli/v3"
+)
+
+var queryFormats = []string{"table", "json", "ndjson", "csv"}
+
+var (
+	queryFormat  string        = queryFormats[0]
+	queryMaxRows int           = store.DefaultQueryMaxRows
+	queryTimeout time.Duration = store.DefaultQueryTimeout
+	queryWindow  time.Duration
+)
+
+var queryCmd = cli.Command{
+	Name:      "query",
+	Usage:     "Run a read-only SQL query (or a canned query) against the database",
+	UsageText: "situation query [--format table|json|ndjson|csv] <sql|canned query>\nsituation query (lists the canned queries)",
+	Action:    queryAction,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:        "format",
+			Aliases:     []string{"f"},
+			Usage:       fmt.Sprintf("Output format %v", queryFormats),
+			Value:       queryFormat,
+			Destination: &queryFormat,
+			Validator: func(s string) error {
+				if !utils.Includes(queryFormats, s) {
+					return fmt.Errorf("invalid format: %s (choose from %v)", s, queryFormats)
+				}
+				return nil
+			},
+		},
+		&cli.IntFlag{
+			Name:        "max-rows",
+			Usage:       "Maximum number of rows returned",
+			Value:       queryMaxRows,
+			Destination: &queryMaxRows,
+		},
+		&cli.DurationFlag{
+			Name:        "timeout",
+			Usage:       "Query timeout",
+			Value:       queryTimeout,
+			Destination: &queryTimeout,
+		},
+		&cli.DurationFlag{
+			Name:        "window",
+			Usage:       "Period looked at by the canned queries (default: depends on the query)",
+			Destination: &queryWindow,
+		},
+	},
+}
+
+func init() {
+	queryCmd.Flags = append(queryCmd.Flags, dbFlag())
+}
+
+func listCannedQueries(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAME\tWINDOW\tDESCRIPTION")
+	for _, q := range store.CannedQueries {
+		window := "-"
+		if q.Window > 0 {
+			window = q.Window.String()
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", q.Name, window, q.Description)
+	}
+	tw.Flush()
+}
+
+func queryAction(ctx context.Context, cmd *cli.Command) error {
+	if cmd.Args().Len() == 0 {
+		listCannedQueries(os.Stdout)
+		return nil
+	}
+	if cmd.Args().Len() > 1 {
+		return fmt.Errorf("expected a single SQL query or canned query name (- reads the query from the standard input)")
+	}
+	query := cmd.Args().First()
+	if query == "-" {
+		b, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+		query = string(b)
+	}
+
+	storage, err := store.NewStorage(db,
+		store.WithAgent(config.AgentString()),
+		store.WithErrorHandler(func(err error) {
+			logger.WithField("on", "storage").Warn(err)
+		}),
+		store.ReadOnly(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create storage: %v", err)
+	}
+
+	opts := store.QueryOptions{Timeout: queryTimeout, MaxRows: queryMaxRows}
+	var result *store.QueryResult
+	if store.GetCannedQuery(query) != nil {
+		result, err = storage.RunCannedQuery(ctx, query, queryWindow, opts)
+	} else {
+		result, err = storage.SafeQuery(ctx, query, opts)
+	}
+	if err != nil {
+		return fmt.Errorf("query failed: %w", err)
+	}
+
+	if err := writeQueryResult(os.Stdout, result, queryFormat); err != nil {
+		return err
+	}
+	if result.Truncated {
+		logger.Warnf("Output truncated to %d rows (see --max-rows)", result.MaxRows)
+	}
+	return nil
+}
+
+// writeQueryResult writes the rows in the given format. Columns keep
+// the order of the query.
+func writeQueryResult(w io.Writer, result *store.QueryResult, format string) error {
+	switch format {
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, strings.Join(result.Columns, "\t"))
+		for _, row := range result.Rows {
+			cells := make([]string, len(result.Columns))
+			for i, c := range result.Columns {
+				cells[i] = strings.Join(strings.Fields(queryCell(row[c])), " ")
+			}
+			fmt.Fprintln(tw, strings.Join(cells, "\t"))
+		}
+		return tw.Flush()
+	case "csv":
+		cw := csv.NewWriter(w)
+		if err := cw.Write(result.Columns); err != nil {
+			return err
+		}
+		for _, row := range result.Rows {
+			cells := make([]string, len(result.Columns))
+			for i, c := range result.Columns {
+				cells[i] = queryCell(row[c])
+			}
+			if err := cw.Write(cells); err != nil {
+				return err
+			}
+		}
+		cw.Flush()
+		return cw.Error()
+	case "json":
+		objects := make([]json.RawMessage, 0, len(result.Rows))
+		for _, row := range result.Rows {
+			obj, err := queryObject(result.Columns, row)
+			if err != nil {
+				return err
+			}
+			objects = append(objects, obj)
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(objects)
+	case "ndjson":
+		for _, row := range result.Rows {
+			obj, err := queryObject(result.Columns, row)
+			if err != nil {
+				return err
+			}
+			if _, err := fmt.Fprintf(w, "%s\n", obj); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported format: %s", format)
+	}
+}
+
+// queryObject encodes a row as a JSON object (encoding/json would sort
+// the keys of the map)
+func queryObject(columns []string, row map[string]any) (json.RawMessage, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, c := range columns {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(c)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(row[c])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(value)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// queryCell formats a value for the text outputs
+func queryCell(v any) string {
+	switch x := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return x
+	case json.RawMessage:
+		return string(x)
+	case []byte:
+		return base64.StdEncoding.EncodeToString(x)
+	case time.Time:
+		return x.Format(time.RFC3339)
+	case []any:
+		items := make([]string, len(x))
+		for i, item := range x {
+			items[i] = queryCell(item)
+		}
+		return strings.Join(items, ",")
+	default:
+		return fmt.Sprint(x)
+	}
+}
@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/situation-sh/situation/pkg/store"
+)
+
+func TestWriteQueryResult(t *testing.T) {
+	result := &store.QueryResult{
+		Columns: []string{"hostname", "ip", "tls", "port"},
+		Rows: []map[string]any{
+			{"hostname": "db01", "ip": []any{"10.0.0.10", "fd00::10"}, "tls": json.RawMessage(`{"subject":"CN=db01"}`), "port": int64(5432)},
+			{"hostname": "web, 01", "ip": nil, "tls": nil, "port": int64(443)},
+		},
+	}
+	expected := map[string]string{
+		"csv": "hostname,ip,tls,port\n" +
+			`db01,"10.0.0.10,fd00::10","{""subject"":""CN=db01""}",5432` + "\n" +
+			`"web, 01",,,443` + "\n",
+		"ndjson": `{"hostname":"db01","ip":["10.0.0.10","fd00::10"],"tls":{"subject":"CN=db01"},"port":5432}` + "\n" +
+			`{"hostname":"web, 01","ip":null,"tls":null,"port":443}` + "\n",
+	}
+	for format, want := range expected {
+		var out strings.Builder
+		if err := writeQueryResult(&out, result, format); err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		if out.String() != want {
+			t.Errorf("%s: expected\n%s\ngot\n%s", format, want, out.String())
+		}
+	}
+
+	var out strings.Builder
+	if err := writeQueryResult(&out, result, "json"); err != nil {
+		t.Fatal(err)
+	}
+	rows := make([]map[string]any, 0)
+	if err := json.Unmarshal([]byte(out.String()), &rows); err != nil || len(rows) != 2 {
+		t.Errorf("invalid JSON output (%v):\n%s", err, out.String())
+	}
+
+	out.Reset()
+	if err := writeQueryResult(&out, result, "table"); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "hostname") || !strings.Contains(lines[1], "10.0.0.10,fd00::10") {
+		t.Errorf("unexpected table:\n%s", out.String())
+	}
+}
@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/situation-sh/situation/agent/config"
+	"github.com/situation-sh/situation/pkg/report"
+	"github.com/situation-sh/situation/pkg/store"
+	"github.com/situation-sh/situation/pkg/utils"
+	"github.com/urfave/cli/v3"
+)
+
+var (
+	reportFormat     string        = report.Formats[0]
+	reportOut        string        = "-"
+	reportCertWindow time.Duration = store.DefaultCertificateWindow
+)
+
+var reportCmd = cli.Command{
+	Name:      "report",
+	Usage:     "Render an inventory report (HTML, SVG or Markdown)",
+	UsageText: "situation report [--format html|svg|md] [--out report.html]",
+	Action:    reportAction,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:        "format",
+			Aliases:     []string{"f"},
+			Usage:       fmt.Sprintf("Output format %v (default: guessed from the output file extension, html otherwise)", report.Formats),
+			Destination: &reportFormat,
+			Validator: func(s string) error {
+				if !utils.Includes(report.Formats, s) {
+					return fmt.Errorf("invalid format: %s (choose from %v)", s, report.Formats)
+				}
+				return nil
+			},
+		},
+		&cli.StringFlag{
+			Name:        "out",
+			Aliases:     []string{"o"},
+			Usage:       "Output file (- for the standard output)",
+			Value:       reportOut,
+			Destination: &reportOut,
+		},
+		&cli.DurationFlag{
+			Name:        "cert-window",
+			Usage:       "Report the TLS certificates that expire within this period",
+			Value:       reportCertWindow,
+			Destination: &reportCertWindow,
+		},
+	},
+}
+
+func init() {
+	reportCmd.Flags = append(reportCmd.Flags, dbFlag())
+}
+
+// reportFormatOf returns the format matching the extension of
+// the output file (html if it is unknown)
+func reportFormatOf(out string) string {
+	ext := strings.TrimPrefix(strings.ToLower(filepath.Ext(out)), ".")
+	switch ext {
+	case "htm":
+		return "html"
+	case "markdown":
+		return "md"
+	}
+	if utils.Includes(report.Formats, ext) {
+		return ext
+	}
+	return report.Formats[0]
+}
+
+func reportAction(ctx context.Context, cmd *cli.Command) error {
+	if !cmd.IsSet("format") {
+		reportFormat = reportFormatOf(reportOut)
+	}
+
+	storage, err := store.NewStorage(db,
+		store.WithAgent(config.AgentString()),
+		store.WithErrorHandler(func(err error) {
+			logger.WithField("on", "storage").Warn(err)
+		}),
+		store.ReadOnly(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to create storage: %v", err)
+	}
+
+	r, err := storage.BuildReport(ctx, store.ReportOptions{CertificateWindow: reportCertWindow})
+	if err != nil {
+		return fmt.Errorf("failed to build the report: %w", err)
+	}
+
+	var w io.Writer = os.Stdout
+	if reportOut != "-" {
+		f, err := os.Create(reportOut) // #nosec G304
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	if err := report.Render(w, r, reportFormat); err != nil {
+		return fmt.Errorf("failed to render the report: %w", err)
+	}
+	if reportOut != "-" {
+		logger.Infof("Report written to %s", reportOut)
+	}
+	return nil
+}
@@ -41,6 +41,11 @@ var app = &cli.Command{
 		&exploreCmd,
 		&migrateCmd,
 		&mcpCmd,
+		&agentsCmd,
+		&diffCmd,
+		&reportCmd,
+		&queryCmd,
+		&exportCmd,
 	},
 	Before: func(ctx context.Context, c *cli.Command) (context.Context, error) {
 		level := logrus.Level(logLevel)
@@ -1,8 +1,12 @@
 package cmd
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"sort"
 	"strings"
 	"time"
@@ -26,6 +30,10 @@ var (
 	failfast          bool   = false
 	explore           bool   = false
 	noMigrate         bool   = false
+	noCentralConfig   bool   = false
+
+	refreshInterval time.Duration = tui.DefaultRefreshInterval
+	runHistory      int           = store.DefaultRunHistory
 )
 
 var runCmd = cli.Command{
@@ -36,13 +44,24 @@ var runCmd = cli.Command{
 		&cli.BoolFlag{
 			Name:        "explore",
 			Destination: &explore,
-			Usage:       "Run the explorer after the run",
+			Usage:       "Follow the run in the explorer",
 		},
 		&cli.BoolFlag{
 			Name:        "no-migrate",
 			Destination: &noMigrate,
 			Usage:       "Skip database migrations",
 		},
+		&cli.BoolFlag{
+			Name:        "no-central-config",
+			Destination: &noCentralConfig,
+			Usage:       "Do not merge the configuration documents stored in the database",
+		},
+		&cli.IntFlag{
+			Name:        "history",
+			Value:       runHistory,
+			Destination: &runHistory,
+			Usage:       "Number of runs kept in the history used by the diff command (0 disables the history)",
+		},
 		&cli.BoolFlag{
 			Name:        "ignore-missing-deps",
 			Destination: &ignoreMissingDeps,
@@ -63,7 +82,7 @@ var runCmd = cli.Command{
 
 func init() {
 	populateConfig()
-	runCmd.Flags = append(runCmd.Flags, dbFlag())
+	runCmd.Flags = append(runCmd.Flags, dbFlag(), refreshFlag())
 	runCmd.Flags = append(runCmd.Flags, generateFlags()...)
 }
 
@@ -94,6 +113,17 @@ func dbFlag() cli.Flag {
 	return flags[0]
 }
 
+// refreshFlag defines the interval between two checks
+// of the database by the explorer
+func refreshFlag() cli.Flag {
+	return &cli.DurationFlag{
+		Name:        "refresh",
+		Value:       tui.DefaultRefreshInterval,
+		Destination: &refreshInterval,
+		Usage:       "Interval between two database checks of the explorer (0 to disable)",
+	}
+}
+
 func disableFlagName(name string) string {
 	return fmt.Sprintf("no-module-%s", name)
 }
@@ -107,6 +137,10 @@ func moduleEnvName(name string) string {
 // populateConfig adds configuration variables from modules
 // These conf variables will be exported as CLI flags
 func populateConfig() {
+	// targets and exclusions shared by the modules
+	if err := config.Bind(modules.GetScope()); err != nil {
+		panic(err)
+	}
 	// config from modules
 	modules.Walk(func(name string, mod modules.Module) {
 		// add specific config to flags
@@ -204,6 +238,18 @@ func runAction(ctx context.Context, cmd *cli.Command) error {
 		}
 	}
 
+	if !noCentralConfig {
+		if err := applyCentralConfig(ctx, cmd, storage); err != nil {
+			logger.WithField("on", "config").WithError(err).Warn("Failed to apply central configuration")
+		}
+	}
+
+	// register the run in the agents table
+	agent, err := storage.AgentStarted(ctx, config.Version, config.Commit)
+	if err != nil {
+		logger.WithField("on", "storage").WithError(err).Warn("Failed to register agent")
+	}
+
 	newCtx := modules.SituationContext(ctx, config.AgentString(), storage, loggerInterface)
 
 	// scheduler opts
@@ -229,16 +275,106 @@ func runAction(ctx context.Context, cmd *cli.Command) error {
 		}
 	})
 
+	var progress chan modules.Progress
+	if explore {
+		// the explorer follows the modules
+		progress = make(chan modules.Progress, 64)
+		opts = append(opts, modules.WithProgress(func(p modules.Progress) {
+			progress <- p
+		}))
+	}
+
 	// run the scheduler
 	scheduler := modules.NewScheduler(mods, opts...)
-	if err := scheduler.Run(newCtx); err != nil {
-		return err
+	run := func(runCtx context.Context) error {
+		runErr := scheduler.Run(runCtx)
+		if agent != nil {
+			if err := storage.AgentFinished(ctx, agent, runErr, modules.BuildModuleErrors()); err != nil {
+				logger.WithField("on", "storage").WithError(err).Warn("Failed to update agent status")
+			}
+			if runHistory > 0 {
+				if _, err := storage.RecordRun(ctx, agent, runHistory); err != nil {
+					logger.WithField("on", "storage").WithError(err).Warn("Failed to record the run in the history")
+				}
+			}
+		}
+		return runErr
 	}
 
 	if explore {
-		// run the TUI
-		return tui.NewRootModel(ctx, storage).Run()
+		return runAndExplore(newCtx, storage, run, progress)
+	}
+	return run(newCtx)
+}
+
+// runAndExplore runs the modules in the background while the explorer
+// shows their progress and the collected data. The logs are held back
+// until the explorer exits (they would mess the terminal up). Closing
+// the explorer cancels the run.
+func runAndExplore(ctx context.Context, storage *store.BunStorage, run func(context.Context) error, progress chan modules.Progress) error {
+	var logs bytes.Buffer
+	out := logger.Out
+	logger.SetOutput(&logs)
+
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		err := run(runCtx)
+		close(progress)
+		done <- err
+	}()
+
+	exploreErr := tui.NewRootModel(ctx, storage).
+		WithRefresh(refreshInterval).
+		WithProgress(progress).
+		Run()
+
+	cancel()
+	// the explorer does not read the progress anymore
+	go func() {
+		for range progress {
+		}
+	}()
+	runErr := <-done
+
+	logger.SetOutput(out)
+	if _, err := io.Copy(out, &logs); err != nil {
+		logger.WithError(err).Warn("Failed to print the logs of the run")
+	}
+	return errors.Join(runErr, exploreErr)
+}
+
+// applyCentralConfig merges the configuration documents that target
+// this agent. Locally defined values (env and flags) always win.
+func applyCentralConfig(ctx context.Context, cmd *cli.Command, storage *store.BunStorage) error {
+	configs, err := storage.GetAgentConfigs(ctx)
+	if err != nil {
+		return err
+	}
+	if len(configs) == 0 {
+		return nil
 	}
 
-	return nil
+	local := config.LocalOverrides(cmd.IsSet)
+	for _, c := range configs {
+		l := logger.
+			WithField("on", "config").
+			WithField("id", c.ID).
+			WithField("name", c.Name).
+			WithField("target_type", c.TargetType).
+			WithField("target", c.Target)
+		raw, err := json.Marshal(c.Config)
+		if err != nil {
+			l.WithError(err).Warn("Invalid configuration document")
+			continue
+		}
+		if err := config.UpdateFromJSON(raw); err != nil {
+			l.WithError(err).Warn("Cannot apply configuration document")
+			continue
+		}
+		l.Info("Configuration document applied")
+	}
+	return config.Restore(local)
 }
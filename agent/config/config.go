@@ -2,6 +2,7 @@ package config
 
 import (
 	"encoding/hex"
+	"os"
 
 	"github.com/asiffer/puzzle"
 	"github.com/asiffer/puzzle/jsonfile"
@@ -63,10 +64,40 @@ func JSON() ([]byte, error) {
 func UpdateFromJSON(raw []byte) error {
 	return jsonfile.ReadJSONRaw(k, raw)
 }
+
 func ReadEnv() error {
 	return puzzle.ReadEnv(k)
 }
 
+// LocalOverrides returns the current values of the entries that
+// have been set locally, either through their environment variable
+// or through their flag (isSet is called with the flag name).
+func LocalOverrides(isSet func(flagName string) bool) map[string]string {
+	out := make(map[string]string)
+	for entry := range k.Entries() {
+		meta := entry.GetMetadata()
+		_, fromEnv := os.LookupEnv(meta.EnvName)
+		if (meta.EnvName != "" && fromEnv) || (meta.FlagName != "" && isSet(meta.FlagName)) {
+			out[entry.GetKey()] = entry.String()
+		}
+	}
+	return out
+}
+
+// Restore sets back the values returned by LocalOverrides
+func Restore(values map[string]string) error {
+	for key, value := range values {
+		entry, exists := k.GetEntry(key)
+		if !exists {
+			return &puzzle.KeyNotFoundError{Key: key}
+		}
+		if err := entry.Set(value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func SomeFlags(keys ...string) ([]cli.Flag, error) {
 	return urfave3.Build(k.Only(keys...))
 }
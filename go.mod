@@ -68,6 +68,7 @@ require (
 	github.com/ZxillyFork/wazero v0.0.0-20260213135451-912d95480a5c // indirect
 	github.com/alecthomas/kong v1.14.0 // indirect
 	github.com/anthropics/anthropic-sdk-go v1.26.0 // indirect
+	github.com/atotto/clipboard v0.1.4 // indirect
 	github.com/aymanbagabas/go-osc52/v2 v2.0.1 // indirect
 	github.com/blacktop/go-dwarf v1.0.14 // indirect
 	github.com/blacktop/go-macho v1.1.259 // indirect
@@ -0,0 +1,70 @@
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// cytoscapeData is the data of a cytoscape.js element. Compound nodes
+// (subnets, hosts of containers) are the parent of their nodes.
+type cytoscapeData struct {
+	ID     string `json:"id"`
+	Label  string `json:"label,omitempty"`
+	Kind   string `json:"kind"`
+	Parent string `json:"parent,omitempty"`
+	Source string `json:"source,omitempty"`
+	Target string `json:"target,omitempty"`
+}
+
+type cytoscapeElement struct {
+	Data cytoscapeData `json:"data"`
+}
+
+type cytoscapeElements struct {
+	Nodes []cytoscapeElement `json:"nodes"`
+	Edges []cytoscapeElement `json:"edges"`
+}
+
+// renderCytoscape writes the elements JSON expected by cytoscape.js
+func renderCytoscape(w io.Writer, g *graph) error {
+	elements := cytoscapeElements{
+		Nodes: make([]cytoscapeElement, 0),
+		Edges: make([]cytoscapeElement, 0),
+	}
+	node := func(d cytoscapeData) {
+		elements.Nodes = append(elements.Nodes, cytoscapeElement{Data: d})
+	}
+	edge := func(d cytoscapeData) {
+		d.ID = fmt.Sprintf("e%d", len(elements.Edges)+1)
+		elements.Edges = append(elements.Edges, cytoscapeElement{Data: d})
+	}
+
+	for _, s := range g.Subnets {
+		node(cytoscapeData{ID: subnetID(s.ID), Label: subnetLabel(s), Kind: "subnet"})
+	}
+	for _, m := range g.Machines {
+		d := cytoscapeData{ID: machineID(m.ID), Label: machineLabel(m), Kind: "machine"}
+		if _, exists := g.machines[m.ParentID]; exists {
+			d.Parent = machineID(m.ParentID)
+		} else if _, exists := g.subnets[m.SubnetID]; exists {
+			d.Parent = subnetID(m.SubnetID)
+		}
+		node(d)
+	}
+	for _, x := range g.externals {
+		node(cytoscapeData{ID: x.id, Label: x.label, Kind: "external"})
+	}
+
+	for _, l := range g.Links {
+		edge(cytoscapeData{Source: machineID(l.MachineID), Target: subnetID(l.SubnetID), Label: l.IP, Kind: "member"})
+	}
+	for _, f := range g.Flows {
+		src, dst := g.ends(f)
+		edge(cytoscapeData{Source: src, Target: dst, Label: flowLabel(f), Kind: "flow"})
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(map[string]any{"elements": elements})
+}
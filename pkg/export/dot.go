@@ -0,0 +1,70 @@
+package export
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/situation-sh/situation/pkg/store"
+)
+
+var dotEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func dotQuote(s string) string {
+	return `"` + dotEscaper.Replace(s) + `"`
+}
+
+// renderDOT writes a graphviz digraph: subnets and hosts of containers
+// are clusters
+func renderDOT(w io.Writer, g *graph) error {
+	b := bufio.NewWriter(w)
+	fmt.Fprintln(b, "digraph situation {")
+	fmt.Fprintln(b, "  rankdir=LR;")
+	fmt.Fprintln(b, `  node [shape=box, style=rounded, fontname="Helvetica"];`)
+	fmt.Fprintln(b, `  edge [fontname="Helvetica", fontsize=10];`)
+
+	var machine func(m *store.TopologyMachine, indent string)
+	machine = func(m *store.TopologyMachine, indent string) {
+		children := g.children[m.ID]
+		if len(children) == 0 {
+			fmt.Fprintf(b, "%s%s [label=%s];\n", indent, dotQuote(machineID(m.ID)), dotQuote(machineLabel(m)))
+			return
+		}
+		fmt.Fprintf(b, "%ssubgraph %s {\n", indent, dotQuote("cluster_"+machineID(m.ID)))
+		fmt.Fprintf(b, "%s  label=%s;\n", indent, dotQuote(m.Name))
+		fmt.Fprintf(b, "%s  style=dashed;\n", indent)
+		fmt.Fprintf(b, "%s  %s [label=%s];\n", indent, dotQuote(machineID(m.ID)), dotQuote(machineLabel(m)))
+		for _, c := range children {
+			machine(c, indent+"  ")
+		}
+		fmt.Fprintf(b, "%s}\n", indent)
+	}
+
+	for _, s := range g.Subnets {
+		fmt.Fprintf(b, "  subgraph %s {\n", dotQuote("cluster_"+subnetID(s.ID)))
+		fmt.Fprintf(b, "    label=%s;\n", dotQuote(subnetLabel(s)))
+		fmt.Fprintf(b, "    %s [label=%s, shape=ellipse, style=filled, fillcolor=\"#e8f5f0\"];\n", dotQuote(subnetID(s.ID)), dotQuote(s.CIDR))
+		for _, m := range g.clusters[s.ID] {
+			machine(m, "    ")
+		}
+		fmt.Fprintln(b, "  }")
+	}
+	for _, m := range g.clusters[0] {
+		machine(m, "  ")
+	}
+	for _, x := range g.externals {
+		fmt.Fprintf(b, "  %s [label=%s, shape=note];\n", dotQuote(x.id), dotQuote(x.label))
+	}
+
+	for _, l := range g.Links {
+		fmt.Fprintf(b, "  %s -> %s [label=%s, dir=none, style=dashed];\n",
+			dotQuote(machineID(l.MachineID)), dotQuote(subnetID(l.SubnetID)), dotQuote(l.IP))
+	}
+	for _, f := range g.Flows {
+		src, dst := g.ends(f)
+		fmt.Fprintf(b, "  %s -> %s [label=%s];\n", dotQuote(src), dotQuote(dst), dotQuote(flowLabel(f)))
+	}
+	fmt.Fprintln(b, "}")
+	return b.Flush()
+}
@@ -0,0 +1,146 @@
+// Package export renders the network topology (see store.Topology)
+// as a graph description that other tools can draw.
+package export
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/situation-sh/situation/pkg/store"
+)
+
+// Formats lists the supported output formats
+var Formats = []string{"dot", "mermaid", "cytoscape"}
+
+// Render writes the topology in the given format
+func Render(w io.Writer, t *store.Topology, format string) error {
+	g := newGraph(t)
+	switch format {
+	case "dot":
+		return renderDOT(w, g)
+	case "mermaid":
+		return renderMermaid(w, g)
+	case "cytoscape":
+		return renderCytoscape(w, g)
+	default:
+		return fmt.Errorf("unsupported format: %s (choose from %v)", format, Formats)
+	}
+}
+
+// external is a flow end that is not in the inventory
+type external struct {
+	id    string
+	label string
+}
+
+// graph is the format-neutral version of the topology: subnet clusters
+// holding machines, that hold their containers
+type graph struct {
+	*store.Topology
+	subnets   map[int64]*store.TopologySubnet
+	machines  map[int64]*store.TopologyMachine
+	clusters  map[int64][]*store.TopologyMachine // top-level machines by subnet (0 for none)
+	children  map[int64][]*store.TopologyMachine // containers by host
+	externals []*external
+	byAddr    map[string]*external
+}
+
+func newGraph(t *store.Topology) *graph {
+	g := &graph{
+		Topology: t,
+		subnets:  make(map[int64]*store.TopologySubnet),
+		machines: make(map[int64]*store.TopologyMachine),
+		clusters: make(map[int64][]*store.TopologyMachine),
+		children: make(map[int64][]*store.TopologyMachine),
+		byAddr:   make(map[string]*external),
+	}
+	for _, s := range t.Subnets {
+		g.subnets[s.ID] = s
+	}
+	for _, m := range t.Machines {
+		g.machines[m.ID] = m
+	}
+	for _, m := range t.Machines {
+		if _, exists := g.machines[m.ParentID]; exists {
+			g.children[m.ParentID] = append(g.children[m.ParentID], m)
+		} else if _, exists := g.subnets[m.SubnetID]; exists {
+			g.clusters[m.SubnetID] = append(g.clusters[m.SubnetID], m)
+		} else {
+			g.clusters[0] = append(g.clusters[0], m)
+		}
+	}
+	for _, f := range t.Flows {
+		if f.SrcMachineID == 0 {
+			g.external(f.SrcAddr, "")
+		}
+		if f.DstMachineID == 0 {
+			g.external(f.DstAddr, f.SaaS)
+		}
+	}
+	return g
+}
+
+// external returns the node of the address (created if needed)
+func (g *graph) external(addr string, saas string) *external {
+	if x, exists := g.byAddr[addr]; exists {
+		return x
+	}
+	x := &external{id: fmt.Sprintf("x%d", len(g.externals)+1), label: addr}
+	if saas != "" {
+		x.label = saas + " (" + addr + ")"
+	}
+	g.externals = append(g.externals, x)
+	g.byAddr[addr] = x
+	return x
+}
+
+func subnetID(id int64) string {
+	return fmt.Sprintf("s%d", id)
+}
+
+func machineID(id int64) string {
+	return fmt.Sprintf("m%d", id)
+}
+
+// ends returns the ids of the nodes linked by the flow
+func (g *graph) ends(f *store.TopologyFlow) (string, string) {
+	src, dst := machineID(f.SrcMachineID), machineID(f.DstMachineID)
+	if f.SrcMachineID == 0 {
+		src = g.byAddr[f.SrcAddr].id
+	}
+	if f.DstMachineID == 0 {
+		dst = g.byAddr[f.DstAddr].id
+	}
+	return src, dst
+}
+
+func subnetLabel(s *store.TopologySubnet) string {
+	label := s.CIDR
+	if s.VLANID != 0 {
+		label += fmt.Sprintf(" (VLAN %d)", s.VLANID)
+	}
+	if s.Tag != "" {
+		label += " [" + s.Tag + "]"
+	}
+	return label
+}
+
+func machineLabel(m *store.TopologyMachine) string {
+	if m.Platform == "" {
+		return m.Name
+	}
+	return m.Name + " (" + m.Platform + ")"
+}
+
+func flowLabel(f *store.TopologyFlow) string {
+	if len(f.Applications) == 0 {
+		return f.Label()
+	}
+	apps := make([]string, len(f.Applications))
+	for i, a := range f.Applications {
+		// keep the name of the binary only
+		apps[i] = a[strings.LastIndexAny(a, `/\`)+1:]
+	}
+	return f.Label() + " " + strings.Join(apps, ",")
+}
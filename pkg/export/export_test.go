@@ -0,0 +1,86 @@
+package export
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/situation-sh/situation/pkg/store"
+)
+
+func testTopology() *store.Topology {
+	return &store.Topology{
+		Subnets: []*store.TopologySubnet{{ID: 1, CIDR: "10.0.0.0/24", Tag: "lan"}},
+		Machines: []*store.TopologyMachine{
+			{ID: 1, Name: "db01", Platform: "linux", SubnetID: 1},
+			{ID: 2, Name: "web01", Platform: "linux", SubnetID: 1},
+			{ID: 3, Name: `front"end`, Platform: "docker", ParentID: 2},
+		},
+		Links: []*store.TopologyLink{
+			{MachineID: 1, SubnetID: 1, IP: "10.0.0.10"},
+			{MachineID: 2, SubnetID: 1, IP: "10.0.0.20"},
+		},
+		Flows: []*store.TopologyFlow{
+			{SrcMachineID: 2, DstMachineID: 1, Protocol: "tcp", Port: 5432, Applications: []string{"/usr/sbin/nginx"}},
+			{SrcMachineID: 2, DstAddr: "140.82.121.3", SaaS: "GitHub", Protocol: "tcp", Port: 443},
+		},
+	}
+}
+
+func TestRender(t *testing.T) {
+	expected := map[string][]string{
+		"dot": {
+			`subgraph "cluster_s1" {`,
+			`label="10.0.0.0/24 [lan]";`,
+			`subgraph "cluster_m2" {`,
+			`"m3" [label="front\"end (docker)"];`,
+			`"m1" -> "s1" [label="10.0.0.10", dir=none, style=dashed];`,
+			`"m2" -> "m1" [label="tcp/5432 nginx"];`,
+			`"x1" [label="GitHub (140.82.121.3)", shape=note];`,
+		},
+		"mermaid": {
+			"flowchart LR",
+			`subgraph s1_net["10.0.0.0/24 [lan]"]`,
+			`subgraph m2_host["web01"]`,
+			`m3["front#quot;end (docker)"]`,
+			`m1 -.-|"10.0.0.10"| s1`,
+			`m2 -->|"tcp/443"| x1`,
+		},
+	}
+	for format, fragments := range expected {
+		var out strings.Builder
+		if err := Render(&out, testTopology(), format); err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		for _, f := range fragments {
+			if !strings.Contains(out.String(), f) {
+				t.Errorf("%s: %q not found in\n%s", format, f, out.String())
+			}
+		}
+	}
+
+	var out strings.Builder
+	if err := Render(&out, testTopology(), "cytoscape"); err != nil {
+		t.Fatal(err)
+	}
+	doc := struct {
+		Elements cytoscapeElements `json:"elements"`
+	}{}
+	if err := json.Unmarshal([]byte(out.String()), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Elements.Nodes) != 5 || len(doc.Elements.Edges) != 4 {
+		t.Errorf("unexpected elements: %+v", doc.Elements)
+	}
+	parents := make(map[string]string)
+	for _, n := range doc.Elements.Nodes {
+		parents[n.Data.ID] = n.Data.Parent
+	}
+	if parents["m1"] != "s1" || parents["m3"] != "m2" || parents["x1"] != "" {
+		t.Errorf("unexpected compound nodes: %v", parents)
+	}
+
+	if err := Render(&strings.Builder{}, testTopology(), "png"); err == nil {
+		t.Error("expected an error for an unsupported format")
+	}
+}
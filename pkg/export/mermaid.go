@@ -0,0 +1,62 @@
+package export
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/situation-sh/situation/pkg/store"
+)
+
+var mermaidEscaper = strings.NewReplacer(`"`, "#quot;", "\n", "<br>")
+
+func mermaidQuote(s string) string {
+	return `"` + mermaidEscaper.Replace(s) + `"`
+}
+
+// renderMermaid writes a mermaid flowchart: subnets and hosts of
+// containers are subgraphs
+func renderMermaid(w io.Writer, g *graph) error {
+	b := bufio.NewWriter(w)
+	fmt.Fprintln(b, "flowchart LR")
+
+	var machine func(m *store.TopologyMachine, indent string)
+	machine = func(m *store.TopologyMachine, indent string) {
+		children := g.children[m.ID]
+		if len(children) == 0 {
+			fmt.Fprintf(b, "%s%s[%s]\n", indent, machineID(m.ID), mermaidQuote(machineLabel(m)))
+			return
+		}
+		fmt.Fprintf(b, "%ssubgraph %s_host[%s]\n", indent, machineID(m.ID), mermaidQuote(m.Name))
+		fmt.Fprintf(b, "%s  %s[%s]\n", indent, machineID(m.ID), mermaidQuote(machineLabel(m)))
+		for _, c := range children {
+			machine(c, indent+"  ")
+		}
+		fmt.Fprintf(b, "%send\n", indent)
+	}
+
+	for _, s := range g.Subnets {
+		fmt.Fprintf(b, "  subgraph %s_net[%s]\n", subnetID(s.ID), mermaidQuote(subnetLabel(s)))
+		fmt.Fprintf(b, "    %s((%s))\n", subnetID(s.ID), mermaidQuote(s.CIDR))
+		for _, m := range g.clusters[s.ID] {
+			machine(m, "    ")
+		}
+		fmt.Fprintln(b, "  end")
+	}
+	for _, m := range g.clusters[0] {
+		machine(m, "  ")
+	}
+	for _, x := range g.externals {
+		fmt.Fprintf(b, "  %s>%s]\n", x.id, mermaidQuote(x.label))
+	}
+
+	for _, l := range g.Links {
+		fmt.Fprintf(b, "  %s -.-|%s| %s\n", machineID(l.MachineID), mermaidQuote(l.IP), subnetID(l.SubnetID))
+	}
+	for _, f := range g.Flows {
+		src, dst := g.ends(f)
+		fmt.Fprintf(b, "  %s -->|%s| %s\n", src, mermaidQuote(flowLabel(f)), dst)
+	}
+	return b.Flush()
+}
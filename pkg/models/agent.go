@@ -0,0 +1,83 @@
+package models
+
+import (
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+const (
+	AgentStatusRunning = "running"
+	AgentStatusSuccess = "success"
+	AgentStatusPartial = "partial"
+	AgentStatusFailure = "failure"
+)
+
+// Agent is the registry entry of a deployed agent. It is
+// updated at the start and at the end of every run.
+type Agent struct {
+	bun.BaseModel `bun:"table:agents,alias:agent"`
+
+	ID        int64     `bun:"id,pk,autoincrement"`
+	CreatedAt time.Time `bun:"created_at,nullzero,notnull,default:current_timestamp"`
+	UpdatedAt time.Time `bun:"updated_at,nullzero,notnull,default:current_timestamp"`
+
+	Agent    string `bun:"agent,unique,notnull" json:"agent" jsonschema:"description=collector identifier,example=fc097e65503cb3ad9eb8e10f5a617611"`
+	Version  string `bun:"version" json:"version,omitempty" jsonschema:"description=agent version,example=0.20.1"`
+	Commit   string `bun:"commit" json:"commit,omitempty" jsonschema:"description=commit hash the agent has been built from"`
+	Platform string `bun:"platform" json:"platform,omitempty" jsonschema:"description=platform the agent runs on,example=linux,example=windows"`
+	Arch     string `bun:"arch" json:"arch,omitempty" jsonschema:"description=architecture the agent has been built for,example=amd64"`
+
+	LastSeen        time.Time      `bun:"last_seen,nullzero" json:"last_seen" jsonschema:"description=last time the agent reported to the database"`
+	LastRunStart    time.Time      `bun:"last_run_start,nullzero" json:"last_run_start" jsonschema:"description=start time of the last run"`
+	LastRunDuration time.Duration  `bun:"last_run_duration" json:"last_run_duration,omitempty" jsonschema:"description=duration of the last run in nanoseconds,example=2010899300"`
+	LastStatus      string         `bun:"last_status" json:"last_status,omitempty" jsonschema:"description=status of the last run,enum=running,enum=success,enum=partial,enum=failure"`
+	LastError       string         `bun:"last_error" json:"last_error,omitempty" jsonschema:"description=error that stopped the last run"`
+	ModuleErrors    []*ModuleError `bun:"module_errors,type:json" json:"module_errors,omitempty" jsonschema:"description=errors returned by the modules during the last run"`
+
+	MachineID int64    `bun:"machine_id,nullzero" json:"machine_id,omitempty" jsonschema:"description=ID of the machine the agent runs on"`
+	Machine   *Machine `bun:"rel:belongs-to,join:machine_id=id,on_delete:set null" json:"machine,omitempty" jsonschema:"description=machine the agent runs on"`
+}
+
+const (
+	AgentConfigTargetAll     = "all"
+	AgentConfigTargetSubnet  = "subnet"
+	AgentConfigTargetMachine = "machine"
+	AgentConfigTargetAgent   = "agent"
+)
+
+// AgentConfig is a configuration document managed centrally.
+// It targets either all the agents, the agents connected to subnets
+// with a given tag, the agents running on machines with a given tag or
+// a single agent (through its identifier).
+type AgentConfig struct {
+	bun.BaseModel `bun:"table:agent_configs,alias:agent_config"`
+
+	ID        int64     `bun:"id,pk,autoincrement"`
+	CreatedAt time.Time `bun:"created_at,nullzero,notnull,default:current_timestamp"`
+	UpdatedAt time.Time `bun:"updated_at,nullzero,notnull,default:current_timestamp"`
+
+	Name       string         `bun:"name" json:"name,omitempty" jsonschema:"description=human readable name of the document,example=disable tcp-scan on OT"`
+	TargetType string         `bun:"target_type,notnull" json:"target_type" jsonschema:"description=kind of target,enum=all,enum=subnet,enum=machine,enum=agent"`
+	Target     string         `bun:"target" json:"target,omitempty" jsonschema:"description=agent identifier, subnet tag or machine tag (ignored when target_type is all),example=ot,example=fc097e65503cb3ad9eb8e10f5a617611"`
+	Priority   int            `bun:"priority,notnull,default:0" json:"priority" jsonschema:"description=documents with higher priority are applied last within the same target type"`
+	Disabled   bool           `bun:"disabled,notnull,default:false" json:"disabled,omitempty" jsonschema:"description=ignore this document"`
+	Config     map[string]any `bun:"config,type:json" json:"config" jsonschema:"description=configuration document (same format as the output of the defaults command)"`
+}
+
+// Rank returns the order in which the documents must be merged:
+// the more specific the target, the later it is applied.
+func (c *AgentConfig) Rank() int {
+	switch c.TargetType {
+	case AgentConfigTargetAll:
+		return 0
+	case AgentConfigTargetSubnet:
+		return 1
+	case AgentConfigTargetMachine:
+		return 2
+	case AgentConfigTargetAgent:
+		return 3
+	default:
+		return -1
+	}
+}
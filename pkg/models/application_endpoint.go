@@ -26,8 +26,18 @@ type JA4 struct {
 	JA4X string `json:"ja4x,omitempty" jsonschema:"description=JA4X TLS cert fingerprint,example=2bab15409345_af684594efb4_000000000000"`
 }
 
+type HTTP struct {
+	Status          int               `json:"status,omitempty" jsonschema:"description=status code of the response to /,example=200,example=401"`
+	Title           string            `json:"title,omitempty" jsonschema:"description=title of the HTML page,example=Grafana,example=Dashboard [Jenkins]"`
+	Server          string            `json:"server,omitempty" jsonschema:"description=Server header,example=nginx/1.24.0"`
+	Redirects       []string          `json:"redirects,omitempty" jsonschema:"description=URLs of the redirect chain,example=[\"http://10.0.0.3:3000/login\"]"`
+	FaviconHash     int32             `json:"favicon_hash,omitempty" jsonschema:"description=MurmurHash3 of the base64 encoded favicon (Shodan format),example=81586312"`
+	SecurityHeaders map[string]string `json:"security_headers,omitempty" jsonschema:"description=security headers of the response,example={\"X-Frame-Options\":\"DENY\"}"`
+}
+
 type Fingerprints struct {
-	JA4 *JA4 `json:"ja4,omitempty" jsonschema:"description=JA4 fingerprints"`
+	JA4  *JA4  `json:"ja4,omitempty" jsonschema:"description=JA4 fingerprints"`
+	HTTP *HTTP `json:"http,omitempty" jsonschema:"description=HTTP fingerprint"`
 }
 
 // ApplicationEndpoint is a structure used by Application
@@ -141,3 +141,51 @@ func (m *UserApplication) BeforeAppendModel(ctx context.Context, query bun.Query
 	}
 	return nil
 }
+
+var _ bun.BeforeAppendModelHook = (*Agent)(nil)
+
+func (m *Agent) BeforeAppendModel(ctx context.Context, query bun.Query) error {
+	switch query.(type) {
+	case *bun.InsertQuery:
+		m.CreatedAt = time.Now()
+	case *bun.UpdateQuery:
+		m.UpdatedAt = time.Now()
+	}
+	return nil
+}
+
+var _ bun.BeforeAppendModelHook = (*AgentConfig)(nil)
+
+func (m *AgentConfig) BeforeAppendModel(ctx context.Context, query bun.Query) error {
+	switch query.(type) {
+	case *bun.InsertQuery:
+		m.CreatedAt = time.Now()
+	case *bun.UpdateQuery:
+		m.UpdatedAt = time.Now()
+	}
+	return nil
+}
+
+var _ bun.BeforeAppendModelHook = (*Run)(nil)
+
+func (m *Run) BeforeAppendModel(ctx context.Context, query bun.Query) error {
+	switch query.(type) {
+	case *bun.InsertQuery:
+		m.CreatedAt = time.Now()
+	case *bun.UpdateQuery:
+		m.UpdatedAt = time.Now()
+	}
+	return nil
+}
+
+var _ bun.BeforeAppendModelHook = (*SweepCursor)(nil)
+
+func (m *SweepCursor) BeforeAppendModel(ctx context.Context, query bun.Query) error {
+	switch query.(type) {
+	case *bun.InsertQuery:
+		m.CreatedAt = time.Now()
+	case *bun.UpdateQuery:
+		m.UpdatedAt = time.Now()
+	}
+	return nil
+}
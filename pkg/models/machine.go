@@ -31,6 +31,12 @@ type Machine struct {
 
 	CPE     string `json:"cpe,omitempty" jsonschema:"description=OS CPE uri,example=cpe:2.3:o:microsoft:windows_server_2022:-:*:*:*:datacenter:*:x64:*"`
 	Chassis string `json:"chassis,omitempty" jsonschema:"description=machine kind,example=vm,example=laptop"`
+	Tag     string `bun:"tag,nullzero" json:"tag,omitempty" jsonschema:"description=Extra tag to group machines (used to target central configuration),example=ot,example=dmz"`
+
+	Manufacturer string `bun:"manufacturer" json:"manufacturer,omitempty" jsonschema:"description=device manufacturer (UPnP),example=NETGEAR,example=Samsung Electronics"`
+	Model        string `bun:"model" json:"model,omitempty" jsonschema:"description=device model (UPnP),example=R7000,example=Samsung TU7000"`
+	SerialNumber string `bun:"serial_number" json:"serial_number,omitempty" jsonschema:"description=device serial number (UPnP),example=4A12345B00123"`
+	DeviceType   string `bun:"device_type" json:"device_type,omitempty" jsonschema:"description=UPnP device type,example=InternetGatewayDevice,example=MediaRenderer"`
 
 	// Has-one relationship
 	ParentMachineID int64    `bun:"parent_machine_id,nullzero" json:"parent_machine,omitempty" jsonschema:"description=internal reference of the parent machine (docker or VM cases especially),example=53127"`
@@ -0,0 +1,60 @@
+package models
+
+import (
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// Run is an entry of the run history. It is recorded at the end of
+// every run with a snapshot of the inventory, so that the state of
+// the graph can be compared between two points in time.
+type Run struct {
+	bun.BaseModel `bun:"table:runs,alias:run"`
+
+	ID        int64     `bun:"id,pk,autoincrement"`
+	CreatedAt time.Time `bun:"created_at,nullzero,notnull,default:current_timestamp"`
+	UpdatedAt time.Time `bun:"updated_at,nullzero,notnull,default:current_timestamp"`
+
+	Agent      string    `bun:"agent,notnull" json:"agent" jsonschema:"description=identifier of the agent that ran,example=fc097e65503cb3ad9eb8e10f5a617611"`
+	StartedAt  time.Time `bun:"started_at,nullzero" json:"started_at" jsonschema:"description=start time of the run"`
+	FinishedAt time.Time `bun:"finished_at,nullzero,notnull" json:"finished_at" jsonschema:"description=end time of the run (time of the snapshot)"`
+	Status     string    `bun:"status" json:"status,omitempty" jsonschema:"description=status of the run,enum=success,enum=partial,enum=failure"`
+	Snapshot   *Snapshot `bun:"snapshot,type:json" json:"snapshot,omitempty" jsonschema:"description=inventory at the end of the run"`
+}
+
+// Snapshot is a compact copy of the inventory: the machines with
+// their addresses, open ports and packages, and the flows between them
+type Snapshot struct {
+	Machines []*SnapshotMachine `json:"machines"`
+	Flows    []*SnapshotFlow    `json:"flows,omitempty"`
+}
+
+type SnapshotMachine struct {
+	ID       int64          `json:"id"`
+	Hostname string         `json:"hostname,omitempty"`
+	NICS     []*SnapshotNIC `json:"nics,omitempty"`
+	// open ports like tcp/22
+	Ports []string `json:"ports,omitempty"`
+	// package name -> version (versions are joined when
+	// several of them are installed)
+	Packages map[string]string `json:"packages,omitempty"`
+}
+
+type SnapshotNIC struct {
+	Name string   `json:"name,omitempty"`
+	MAC  string   `json:"mac,omitempty"`
+	IP   []string `json:"ip,omitempty"`
+}
+
+// SnapshotFlow is a flow from a machine (or an address) to an endpoint.
+// SrcMachineID and DstMachineID are 0 when the machine is unknown.
+type SnapshotFlow struct {
+	SrcMachineID int64  `json:"src_machine_id,omitempty"`
+	SrcAddr      string `json:"src_addr"`
+	Application  string `json:"application,omitempty"`
+	DstMachineID int64  `json:"dst_machine_id,omitempty"`
+	DstAddr      string `json:"dst_addr"`
+	Protocol     string `json:"protocol"`
+	Port         uint16 `json:"port"`
+}
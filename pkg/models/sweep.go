@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// SweepCursor records how far an agent has gone in the discovery of a
+// subnetwork too large to be swept in a single run. The next run of the
+// agent resumes the sweep from Position.
+type SweepCursor struct {
+	bun.BaseModel `bun:"table:sweep_cursors,alias:sweep_cursor"`
+
+	ID        int64     `bun:"id,pk,autoincrement"`
+	CreatedAt time.Time `bun:"created_at,nullzero,notnull,default:current_timestamp"`
+	UpdatedAt time.Time `bun:"updated_at,nullzero,notnull,default:current_timestamp"`
+
+	Agent    string `bun:"agent,notnull,unique:agent_subnetwork" json:"agent" jsonschema:"description=identifier of the agent that sweeps the subnetwork,example=fc097e65503cb3ad9eb8e10f5a617611"`
+	Position int64  `bun:"position" json:"position" jsonschema:"description=index (within the subnetwork) of the next address to probe,example=4097"`
+	Passes   int    `bun:"passes" json:"passes,omitempty" jsonschema:"description=number of complete sweeps of the subnetwork,example=2"`
+
+	SubnetworkID int64       `bun:"subnetwork_id,notnull,unique:agent_subnetwork" json:"subnetwork_id" jsonschema:"description=ID of the swept subnetwork"`
+	Subnetwork   *Subnetwork `bun:"rel:belongs-to,join:subnetwork_id=id,on_delete:cascade" json:"subnetwork,omitempty"`
+}
@@ -24,6 +24,10 @@ func init() {
 // On Linux, it uses the Netlink API with the [netlink] library.
 // On Windows, it calls `GetIpNetTable2`.
 //
+// The IPv6 neighbors (NDP entries) are read the same way. Their
+// addresses are attached to the NIC that already has the same MAC
+// (found from its IPv4 side) so that dual-stack hosts are not split.
+//
 // [Ping]: ping.md
 //
 // [netlink]: https://github.com/vishvananda/netlink1
@@ -58,6 +62,11 @@ func (m *ARPModule) Run(ctx context.Context) error {
 	newNICS := make([]*models.NetworkInterface, 0)
 	toupdateNICS := make([]*models.NetworkInterface, 0)
 	nicSubnetMapper := make(map[string]int64) // key: mac+subnetID, value: nicID
+	// a NIC may show up on several subnetworks (IPv4 and IPv6), so the
+	// same object is shared by all its entries
+	updated := make(map[int64]*models.NetworkInterface)
+	created := make(map[string]*models.NetworkInterface) // key: mac
+	links := make([]models.NetworkInterfaceSubnet, 0)
 	// fmt.Println(storage.GetMachineNICs(ctx, hostID))
 
 	// for every nic, we first find the neighbors (or we create them)
@@ -121,18 +130,47 @@ func (m *ARPModule) Run(ctx context.Context) error {
 						Debug("no candidate found")
 				}
 
+				// NDP entry of a neighbor that may be known from its
+				// IPv4 side: the address is attached to the NIC with
+				// the same MAC
+				if obj == nil && utils.IPVersion(entry.IP) == 6 {
+					if nics := storage.GetNICsByMAC(ctx, mac); len(nics) > 0 {
+						obj = nics[0]
+						links = append(links, models.NetworkInterfaceSubnet{
+							NetworkInterfaceID: obj.ID,
+							SubnetworkID:       network.ID,
+							IP:                 ip,
+							MACSubnet:          fmt.Sprintf("%s/%d", mac, network.ID),
+						})
+					}
+				}
+
 				// already exists
 				if obj != nil {
+					if prev, ok := updated[obj.ID]; ok {
+						obj = prev
+					} else {
+						updated[obj.ID] = obj
+						toupdateNICS = append(toupdateNICS, obj)
+					}
 					if obj.MAC != mac {
 						obj.MAC = mac
 					}
 					if !utils.Includes(obj.IP, ip) {
 						obj.IP = append(obj.IP, ip)
 					}
-					toupdateNICS = append(toupdateNICS, obj)
 					// here the nic is already in the right subnetwork
 				} else {
+					key := fmt.Sprintf("%v,%v", mac, ip)
+					nicSubnetMapper[key] = network.ID
+
 					// here we do not have the nic yet
+					if nic, ok := created[mac]; ok {
+						if !utils.Includes(nic.IP, ip) {
+							nic.IP = append(nic.IP, ip)
+						}
+						continue
+					}
 					nic := models.NetworkInterface{
 						MAC:   mac,
 						IP:    []string{ip},
@@ -140,9 +178,7 @@ func (m *ARPModule) Run(ctx context.Context) error {
 					}
 
 					newNICS = append(newNICS, &nic)
-
-					key := fmt.Sprintf("%v,%v", mac, ip)
-					nicSubnetMapper[key] = network.ID
+					created[mac] = &nic
 
 					logger.WithField("mac", entry.MAC).
 						WithField("ip", entry.IP).
@@ -194,16 +230,14 @@ func (m *ARPModule) Run(ctx context.Context) error {
 		}
 
 		// create links between NICs and subnetworks
-		links := make([]models.NetworkInterfaceSubnet, 0)
 		for _, nic := range newNICS {
-			// fmt.Println(nic.MAC, nic.IP)
 			for _, ip := range nic.IP {
 				key := fmt.Sprintf("%v,%v", nic.MAC, ip)
-				// fmt.Println("key1:", key)
 				if subnetID, ok := nicSubnetMapper[key]; ok {
 					link := models.NetworkInterfaceSubnet{
 						NetworkInterfaceID: nic.ID,
 						SubnetworkID:       subnetID,
+						IP:                 ip,
 						MACSubnet:          fmt.Sprintf("%s/%d", nic.MAC, subnetID),
 					}
 					links = append(links, link)
@@ -211,31 +245,34 @@ func (m *ARPModule) Run(ctx context.Context) error {
 			}
 
 		}
-		// fmt.Println("LINKS:", links)
-		if len(links) == 0 {
+	} else {
+		logger.Info("No new NICs found from ARP table")
+	}
+
+	if len(links) == 0 {
+		if len(newNICS) > 0 {
 			logger.Warn("No NIC <-> subnetwork links to insert")
-			return nil
+		} else {
+			logger.Debug("No NIC <-> subnetwork links to insert")
 		}
+		return nil
+	}
 
-		_, err = storage.DB().
-			NewInsert().
-			Model(&links).
-			On("CONFLICT DO NOTHING").
-			Exec(ctx)
-		if err != nil {
-			logger.WithError(err).
-				WithField("links", len(links)).
-				Error("Cannot insert new NIC <-> subnetwork links")
-			return err
-		}
-		logger.
-			WithField("nics", len(newNICS)).
+	_, err = storage.DB().
+		NewInsert().
+		Model(&links).
+		On("CONFLICT DO NOTHING").
+		Exec(ctx)
+	if err != nil {
+		logger.WithError(err).
 			WithField("links", len(links)).
-			Info("Inserted NIC <-> subnetwork links")
-
-	} else {
-		logger.Info("No new NICs found from ARP table")
+			Error("Cannot insert new NIC <-> subnetwork links")
+		return err
 	}
+	logger.
+		WithField("nics", len(newNICS)).
+		WithField("links", len(links)).
+		Info("Inserted NIC <-> subnetwork links")
 
 	return nil
 }
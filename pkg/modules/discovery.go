@@ -0,0 +1,173 @@
+package modules
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+
+	"github.com/sirupsen/logrus"
+	"github.com/situation-sh/situation/pkg/models"
+	"github.com/situation-sh/situation/pkg/store"
+	"github.com/situation-sh/situation/pkg/utils"
+	"golang.org/x/net/ipv4"
+)
+
+// Helpers of the modules that discover the neighbors through the
+// announcements of their services (mdns, ssdp)
+
+// multicastInterfaces returns the interfaces that can send IPv4
+// multicast
+func multicastInterfaces() []net.Interface {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+	out := make([]net.Interface, 0)
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagMulticast == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		if slices.ContainsFunc(addrs, func(addr net.Addr) bool {
+			ipnet, ok := addr.(*net.IPNet)
+			return ok && ipnet.IP.To4() != nil
+		}) {
+			out = append(out, iface)
+		}
+	}
+	return out
+}
+
+// multicastSender returns a function that sends a message to the group
+// on every interface. It fails only if the message has not been sent at
+// all.
+func multicastSender(conn *net.UDPConn, ifaces []net.Interface, group *net.UDPAddr) func(msg []byte) error {
+	pc := ipv4.NewPacketConn(conn)
+	return func(msg []byte) error {
+		var errs error
+		sent := 0
+		for _, iface := range ifaces {
+			if err := pc.SetMulticastInterface(&iface); err != nil {
+				errs = errors.Join(errs, err)
+				continue
+			}
+			if _, err := conn.WriteTo(msg, group); err != nil {
+				errs = errors.Join(errs, err)
+				continue
+			}
+			sent++
+		}
+		if sent == 0 {
+			return errs
+		}
+		return nil
+	}
+}
+
+// discoveredNIC returns the NIC that has the addresses. The NIC and its
+// machine are created if they do not exist, the machine gets the
+// hostname if it has none.
+func discoveredNIC(ctx context.Context, storage *store.BunStorage, ips []string, hostname string, logger logrus.FieldLogger) (*models.NetworkInterface, error) {
+	nics, err := storage.GetNICsByIPs(ctx, ips)
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve NICs: %w", err)
+	}
+	var nic *models.NetworkInterface
+	if len(nics) > 0 {
+		nic = &nics[0]
+		missing := make([]string, 0)
+		for _, ip := range ips {
+			if !utils.Includes(nic.IP, ip) {
+				missing = append(missing, ip)
+			}
+		}
+		if len(missing) > 0 {
+			nic.IP = append(nic.IP, missing...)
+			if _, err := storage.DB().NewUpdate().Model(nic).Column("ip").WherePK().Exec(ctx); err != nil {
+				return nil, fmt.Errorf("failed to update NIC: %w", err)
+			}
+		}
+	} else {
+		nic = &models.NetworkInterface{IP: ips, Flags: models.NetworkInterfaceFlags{Up: true}}
+		if _, err := storage.DB().NewInsert().Model(nic).Exec(ctx); err != nil {
+			return nil, fmt.Errorf("failed to insert NIC: %w", err)
+		}
+		logger.WithField("ip", ips).Info("NIC created")
+	}
+
+	switch {
+	case nic.MachineID == 0:
+		machine := &models.Machine{Hostname: hostname}
+		if _, err := storage.DB().NewInsert().Model(machine).Exec(ctx); err != nil {
+			return nil, fmt.Errorf("failed to insert machine: %w", err)
+		}
+		nic.MachineID = machine.ID
+		nic.Machine = machine
+		if _, err := storage.DB().NewUpdate().Model(nic).Column("machine_id").WherePK().Exec(ctx); err != nil {
+			return nil, fmt.Errorf("failed to update NIC: %w", err)
+		}
+		logger.WithField("ip", ips).WithField("hostname", hostname).Info("Machine created")
+	case nic.Machine != nil && nic.Machine.Hostname == "" && hostname != "":
+		nic.Machine.Hostname = hostname
+		if _, err := storage.DB().NewUpdate().Model(nic.Machine).Column("hostname").WherePK().Exec(ctx); err != nil {
+			return nil, fmt.Errorf("failed to update machine: %w", err)
+		}
+	}
+	return nic, nil
+}
+
+// saveDiscoveredEndpoints inserts the endpoints. The existing ones get
+// the application and the application protocols if they have none.
+func saveDiscoveredEndpoints(ctx context.Context, storage *store.BunStorage, endpoints []*models.ApplicationEndpoint, logger logrus.FieldLogger) error {
+	if len(endpoints) == 0 {
+		return nil
+	}
+	// the IDs given by the insert cannot be trusted: the slice is
+	// truncated to the inserted rows
+	found := slices.Clone(endpoints)
+	_, err := storage.DB().
+		NewInsert().
+		Model(&endpoints).
+		On("CONFLICT DO NOTHING").
+		Exec(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to insert endpoints: %w", err)
+	}
+
+	for _, endpoint := range found {
+		if endpoint.ApplicationID != 0 {
+			_, err := storage.DB().
+				NewUpdate().
+				Model((*models.ApplicationEndpoint)(nil)).
+				Set("application_id = ?", endpoint.ApplicationID).
+				Where("protocol = ?", endpoint.Protocol).
+				Where("port = ?", endpoint.Port).
+				Where("addr = ?", endpoint.Addr).
+				Where("network_interface_id = ?", endpoint.NetworkInterfaceID).
+				Where("application_id IS NULL").
+				Exec(ctx)
+			if err != nil {
+				logger.WithError(err).Warn("Cannot update endpoint application")
+			}
+		}
+		_, err := storage.DB().
+			NewUpdate().
+			Model(endpoint).
+			Column("application_protocols").
+			Where("protocol = ?", endpoint.Protocol).
+			Where("port = ?", endpoint.Port).
+			Where("addr = ?", endpoint.Addr).
+			Where("network_interface_id = ?", endpoint.NetworkInterfaceID).
+			Where("application_protocols IS NULL").
+			Exec(ctx)
+		if err != nil {
+			logger.WithError(err).Warn("Cannot update endpoint protocols")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,252 @@
+// LINUX(HTTPModule) ok
+// WINDOWS(HTTPModule) ok
+// MACOS(HTTPModule) ?
+// ROOT(HTTPModule) no
+package modules
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/asiffer/puzzle"
+	"github.com/situation-sh/situation/pkg/models"
+	"github.com/situation-sh/situation/pkg/modules/httpfp"
+	"github.com/situation-sh/situation/pkg/utils"
+	"github.com/uptrace/bun"
+)
+
+func init() {
+	registerModule(&HTTPModule{
+		Timeout:    5 * time.Second,
+		Rules:      "",
+		MaxSockets: 16,
+	})
+}
+
+// ports that usually serve HTTP or HTTPS
+var httpPorts = []uint16{80, 443, 631, 3000, 5000, 8000, 8006, 8080, 8081, 8443, 8888, 9000, 9090}
+
+// HTTPModule fingerprints the web applications behind the HTTP and
+// HTTPS endpoints.
+//
+// The module only uses the Go standard library.
+//
+// It requests `/` (following the redirects that stay on the same host),
+// the few well-known paths the rules look at (like `/api/health`) and
+// `/favicon.ico` on the endpoints that speak HTTP or TLS (or that listen
+// on a usual web port). It records the status, the page title, the
+// `Server` header, the redirect chain, the favicon hash (Shodan format)
+// and the security headers in the endpoint fingerprints.
+//
+// The site is then matched against a bundled rule set that names
+// products such as Grafana, Jenkins, Proxmox, GitLab, router admin
+// pages and printers. The rules given in the `rules` JSON file are
+// tried first (see the bundled [rules.json](https://github.com/situation-sh/situation/blob/main/pkg/modules/httpfp/rules.json)
+// for the format). The recognized application is attached to the
+// endpoint, unless the endpoint already belongs to a running process.
+//
+// The endpoints of the excluded hosts (see `--scope-exclude`) are skipped.
+type HTTPModule struct {
+	BaseModule
+	Timeout    time.Duration
+	Rules      string
+	MaxSockets int
+}
+
+func (m *HTTPModule) Bind(config *puzzle.Config) error {
+	if err := setDefault(config, m, "timeout", &m.Timeout, "Timeout of the HTTP requests"); err != nil {
+		return err
+	}
+	if err := setDefault(config, m, "rules", &m.Rules, "JSON file of additional fingerprinting rules"); err != nil {
+		return err
+	}
+	return setDefault(config, m, "max-sockets", &m.MaxSockets, "Maximum number of sites fingerprinted at the same time")
+}
+
+func (m *HTTPModule) Name() string {
+	return "http"
+}
+
+func (m *HTTPModule) Dependencies() []string {
+	// ja4 also updates the fingerprints, service-probe may attach a less
+	// specific application (like the reverse proxy)
+	return []string{"tls", "ja4", "service-probe"}
+}
+
+// httpResult is the fingerprint of an endpoint
+type httpResult struct {
+	endpoint *models.ApplicationEndpoint
+	scheme   string
+	site     *httpfp.Site
+	app      *httpfp.Application
+}
+
+func (m *HTTPModule) Run(ctx context.Context) error {
+	logger := getLogger(ctx, m)
+	storage := getStorage(ctx)
+
+	rules := httpfp.BundledRules()
+	if m.Rules != "" {
+		custom, err := httpfp.LoadRules(m.Rules)
+		if err != nil {
+			return fmt.Errorf("failed to load HTTP rules: %w", err)
+		}
+		rules = append(custom, rules...)
+	}
+	paths := httpfp.Paths(rules)
+
+	endpoints := make([]*models.ApplicationEndpoint, 0)
+	err := storage.DB().
+		NewSelect().
+		Model(&endpoints).
+		Relation("NetworkInterface").
+		Relation("Application").
+		Where("application_endpoint.protocol = ?", "tcp").
+		WhereGroup(" AND ", func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.
+				Where("application_endpoint.tls IS NOT NULL").
+				WhereOr(storage.JSONANY("application_endpoint.application_protocols"), "http").
+				WhereOr(storage.JSONANY("application_endpoint.application_protocols"), "https").
+				WhereOr("application_endpoint.port IN (?)", bun.In(httpPorts))
+		}).
+		Scan(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to query HTTP endpoints: %w", err)
+	}
+	endpoints = scope.exclusions(ctx, storage, logger).FilterEndpoints(endpoints)
+	if len(endpoints) == 0 {
+		logger.Info("No HTTP endpoint to fingerprint")
+		return nil
+	}
+
+	logger.WithField("endpoints", len(endpoints)).Info("Fingerprinting web applications")
+
+	client := httpfp.NewClient(m.Timeout)
+	var mutex sync.Mutex
+	results := make([]*httpResult, 0)
+	pool := utils.NewWorkerPool(uint(max(m.MaxSockets, 1)), func(e *models.ApplicationEndpoint) error {
+		host := net.JoinHostPort(e.Addr, strconv.Itoa(int(e.Port)))
+		for _, scheme := range httpSchemes(e) {
+			base := &url.URL{Scheme: scheme, Host: host}
+			site, err := client.Fingerprint(ctx, base, paths)
+			if err != nil || plainToTLS(site) {
+				continue
+			}
+			r := &httpResult{endpoint: e, scheme: scheme, site: site, app: httpfp.Match(rules, site)}
+			logger.WithField("url", base).
+				WithField("status", site.Pages["/"].Status).
+				WithField("title", site.Pages["/"].Title).
+				Debug("Site fingerprinted")
+			mutex.Lock()
+			defer mutex.Unlock()
+			results = append(results, r)
+			return nil
+		}
+		return nil
+	})
+	if err := pool.Run(endpoints); err != nil {
+		logger.WithError(err).Debug("Errors during HTTP fingerprinting")
+	}
+
+	if len(results) == 0 {
+		logger.Info("No web application found")
+		return nil
+	}
+
+	// an application per product and machine
+	apps := make([]*models.Application, 0)
+	appOf := make(map[string]*models.Application)
+	key := func(r *httpResult) string {
+		if r.app == nil || r.endpoint.NetworkInterface == nil || r.endpoint.NetworkInterface.MachineID == 0 {
+			return ""
+		}
+		if r.endpoint.Application != nil && r.endpoint.Application.PID != 0 {
+			// the endpoint belongs to a running process
+			return ""
+		}
+		return fmt.Sprintf("%d/%s", r.endpoint.NetworkInterface.MachineID, r.app.Name)
+	}
+	for _, r := range results {
+		k := key(r)
+		if _, exists := appOf[k]; k == "" || exists {
+			continue
+		}
+		app := &models.Application{
+			Name:      r.app.Name,
+			Version:   r.app.Version,
+			Protocol:  r.scheme,
+			CPE:       r.app.CPE,
+			MachineID: r.endpoint.NetworkInterface.MachineID,
+		}
+		appOf[k] = app
+		apps = append(apps, app)
+	}
+	if len(apps) > 0 {
+		err = storage.DB().NewInsert().Model(&apps).
+			On("CONFLICT (machine_id, name, pid) DO UPDATE").
+			Set("version = EXCLUDED.version").
+			Set("protocol = EXCLUDED.protocol").
+			Set("cpe = EXCLUDED.cpe").
+			Set("updated_at = CURRENT_TIMESTAMP").
+			Scan(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to insert applications: %w", err)
+		}
+	}
+
+	toUpdate := make([]*models.ApplicationEndpoint, 0, len(results))
+	for _, r := range results {
+		e := r.endpoint
+		if e.Fingerprints == nil {
+			e.Fingerprints = &models.Fingerprints{}
+		}
+		e.Fingerprints.HTTP = r.site.HTTP()
+		if !slices.Contains(e.ApplicationProtocols, r.scheme) {
+			e.ApplicationProtocols = append(e.ApplicationProtocols, r.scheme)
+		}
+		if app, exists := appOf[key(r)]; exists {
+			e.ApplicationID = app.ID
+		}
+		toUpdate = append(toUpdate, e)
+	}
+	_, err = storage.DB().
+		NewUpdate().
+		Model(&toUpdate).
+		Column("fingerprints", "application_protocols", "application_id").
+		Bulk().
+		Exec(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to update HTTP endpoints: %w", err)
+	}
+
+	logger.WithField("endpoints", len(toUpdate)).
+		WithField("applications", len(apps)).
+		Info("Web applications fingerprinted")
+	return nil
+}
+
+// httpSchemes returns the schemes to try on an endpoint
+func httpSchemes(e *models.ApplicationEndpoint) []string {
+	if e.TLS != nil || slices.Contains(e.ApplicationProtocols, "https") {
+		return []string{"https"}
+	}
+	if slices.Contains(e.ApplicationProtocols, "http") {
+		return []string{"http"}
+	}
+	return []string{"http", "https"}
+}
+
+// plainToTLS tells whether the server has rejected a plain HTTP
+// request sent to its TLS port
+func plainToTLS(site *httpfp.Site) bool {
+	root := site.Pages["/"]
+	return root.Status == http.StatusBadRequest && bytes.Contains(bytes.ToUpper(root.Body), []byte("HTTPS"))
+}
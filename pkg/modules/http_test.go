@@ -0,0 +1,78 @@
+package modules
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/situation-sh/situation/pkg/models"
+)
+
+func TestHTTP(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Jenkins", "2.440.1")
+		w.Header().Set("Strict-Transport-Security", "max-age=31536000")
+		w.WriteHeader(http.StatusForbidden)
+		_, _ = w.Write([]byte("<title>Sign in [Jenkins]</title>"))
+	}))
+	defer server.Close()
+	port := uint16(server.Listener.Addr().(*net.TCPAddr).Port)
+
+	ctx := context.Background()
+	storage := NewTestingBunStorage(t)
+	if err := storage.Migrate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	remote := &models.Machine{Hostname: "ci"}
+	local := &models.Machine{Hostname: "host"}
+	if _, err := storage.DB().NewInsert().Model(&[]*models.Machine{remote, local}).Exec(ctx); err != nil {
+		t.Fatal(err)
+	}
+	nics := []*models.NetworkInterface{
+		{IP: []string{"127.0.0.1"}, MachineID: remote.ID},
+		{IP: []string{"127.0.0.2"}, MachineID: local.ID},
+	}
+	if _, err := storage.DB().NewInsert().Model(&nics).Exec(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// the local endpoint belongs to a process
+	process := &models.Application{Name: "/usr/bin/java", PID: 1234, MachineID: local.ID}
+	if _, err := storage.DB().NewInsert().Model(process).Exec(ctx); err != nil {
+		t.Fatal(err)
+	}
+	endpoints := []*models.ApplicationEndpoint{
+		{Addr: "127.0.0.1", Port: port, Protocol: "tcp", ApplicationProtocols: []string{"http"}, NetworkInterfaceID: nics[0].ID},
+		{Addr: "127.0.0.1", Port: port, Protocol: "tcp", ApplicationProtocols: []string{"http"}, NetworkInterfaceID: nics[1].ID, ApplicationID: process.ID},
+	}
+	if _, err := storage.DB().NewInsert().Model(&endpoints).Exec(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	m := &HTTPModule{Timeout: time.Second, MaxSockets: 2}
+	if err := m.Run(SituationContext(ctx, "test", storage, logrus.New())); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, e := range endpoints {
+		if err := storage.DB().NewSelect().Model(e).WherePK().Relation("Application").Scan(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if e.Fingerprints == nil || e.Fingerprints.HTTP == nil {
+			t.Fatalf("expected a HTTP fingerprint on %d", e.ID)
+		}
+		fp := e.Fingerprints.HTTP
+		if fp.Status != http.StatusForbidden || fp.Title != "Sign in [Jenkins]" || fp.SecurityHeaders["Strict-Transport-Security"] == "" {
+			t.Errorf("unexpected fingerprint: %+v", fp)
+		}
+	}
+	if app := endpoints[0].Application; app == nil || app.Name != "Jenkins" || app.Version != "2.440.1" || app.MachineID != remote.ID {
+		t.Errorf("expected Jenkins on the remote machine, got %+v", app)
+	}
+	if app := endpoints[1].Application; app == nil || app.ID != process.ID {
+		t.Errorf("expected the process to be kept, got %+v", app)
+	}
+}
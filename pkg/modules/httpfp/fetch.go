@@ -0,0 +1,176 @@
+// Package httpfp fingerprints the web applications: it requests a few
+// pages of a site and matches them against a rule set.
+package httpfp
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/situation-sh/situation/pkg/models"
+)
+
+// maximum size of the body that is read
+const maxBodySize = 512 * 1024
+
+// maximum number of redirects followed
+const maxRedirects = 5
+
+// SecurityHeaders are the headers recorded in the fingerprint
+var SecurityHeaders = []string{
+	"Strict-Transport-Security",
+	"Content-Security-Policy",
+	"X-Frame-Options",
+	"X-Content-Type-Options",
+	"Referrer-Policy",
+	"Permissions-Policy",
+}
+
+// Page is the response to a request, after the redirects
+type Page struct {
+	Path   string
+	URL    string
+	Status int
+	Header http.Header
+	Title  string
+	Body   []byte
+	// Redirects are the URLs the request has been redirected to
+	Redirects []string
+}
+
+// Client fetches the pages of the sites
+type Client struct {
+	client *http.Client
+}
+
+// NewClient returns a client that does not verify the certificates
+// (most of the admin pages are self-signed) and does not follow the
+// redirects itself
+func NewClient(timeout time.Duration) *Client {
+	transport := &http.Transport{
+		TLSClientConfig: &tls.Config{
+			InsecureSkipVerify: true, // #nosec G402 - skip certificate verification for scanning
+		},
+		DisableKeepAlives: true,
+	}
+	return &Client{client: &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}}
+}
+
+// Fetch requests the path of the site (base is like https://10.0.0.1:8443).
+// The redirects are followed as long as they stay on the same host.
+func (c *Client) Fetch(ctx context.Context, base *url.URL, path string) (*Page, error) {
+	target := base.ResolveReference(&url.URL{Path: path})
+	page := &Page{Path: path, Redirects: make([]string, 0)}
+	for {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("User-Agent", "situation")
+		resp, err := c.client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		body, err := io.ReadAll(io.LimitReader(resp.Body, maxBodySize))
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		page.URL = target.String()
+		page.Status = resp.StatusCode
+		page.Header = resp.Header
+		page.Body = body
+
+		location, err := resp.Location()
+		if err != nil || len(page.Redirects) >= maxRedirects {
+			break
+		}
+		page.Redirects = append(page.Redirects, location.String())
+		if location.Hostname() != base.Hostname() {
+			// do not leave the host (SSO...)
+			break
+		}
+		target = location
+	}
+	page.Title = Title(page.Body)
+	return page, nil
+}
+
+// Favicon returns the favicon of the site
+func (c *Client) Favicon(ctx context.Context, base *url.URL) ([]byte, error) {
+	page, err := c.Fetch(ctx, base, "/favicon.ico")
+	if err != nil {
+		return nil, err
+	}
+	if page.Status != http.StatusOK || len(page.Body) == 0 {
+		return nil, fmt.Errorf("no favicon (status %d)", page.Status)
+	}
+	return page.Body, nil
+}
+
+var titleRegexp = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+
+// Title returns the title of an HTML page
+func Title(body []byte) string {
+	match := titleRegexp.FindSubmatch(body)
+	if match == nil {
+		return ""
+	}
+	return strings.Join(strings.Fields(html.UnescapeString(string(match[1]))), " ")
+}
+
+// Fingerprint fetches the pages of a site and its favicon. It fails
+// only if the root page cannot be fetched.
+func (c *Client) Fingerprint(ctx context.Context, base *url.URL, paths []string) (*Site, error) {
+	root, err := c.Fetch(ctx, base, "/")
+	if err != nil {
+		return nil, err
+	}
+	site := &Site{Pages: map[string]*Page{"/": root}}
+	for _, path := range paths {
+		if _, exists := site.Pages[path]; exists {
+			continue
+		}
+		if page, err := c.Fetch(ctx, base, path); err == nil {
+			site.Pages[path] = page
+		}
+	}
+	if favicon, err := c.Favicon(ctx, base); err == nil {
+		site.FaviconHash = FaviconHash(favicon)
+	}
+	return site, nil
+}
+
+// HTTP returns the fingerprint of the site (from its root page)
+func (s *Site) HTTP() *models.HTTP {
+	root := s.Pages["/"]
+	fp := &models.HTTP{
+		Status:      root.Status,
+		Title:       root.Title,
+		Server:      root.Header.Get("Server"),
+		Redirects:   root.Redirects,
+		FaviconHash: s.FaviconHash,
+	}
+	for _, header := range SecurityHeaders {
+		if value := root.Header.Get(header); value != "" {
+			if fp.SecurityHeaders == nil {
+				fp.SecurityHeaders = make(map[string]string)
+			}
+			fp.SecurityHeaders[header] = value
+		}
+	}
+	return fp
+}
@@ -0,0 +1,137 @@
+package httpfp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestMurmur3(t *testing.T) {
+	for input, expected := range map[string]int32{
+		"":      0,
+		"foo":   -156908512,
+		"hello": 613153351,
+	} {
+		if h := int32(murmur3([]byte(input), 0)); h != expected {
+			t.Errorf("%q: expected %d, got %d", input, expected, h)
+		}
+	}
+}
+
+func TestParseRules(t *testing.T) {
+	rules := BundledRules()
+	if len(rules) == 0 {
+		t.Fatal("no bundled rules")
+	}
+	if paths := Paths(rules); len(paths) < 2 || paths[0] != "/" {
+		t.Errorf("unexpected paths: %v", paths)
+	}
+	for _, data := range []string{
+		`[{"name": "bad", "title": "("}]`,
+		`[{"title": "x"}]`,
+		`{}`,
+	} {
+		if _, err := ParseRules([]byte(data)); err == nil {
+			t.Errorf("%s: expected an error", data)
+		}
+	}
+}
+
+// grafana mimics a Grafana instance
+func grafana() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/login", http.StatusFound)
+	})
+	mux.HandleFunc("/login", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Frame-Options", "deny")
+		w.Header().Set("Server", "nginx")
+		_, _ = w.Write([]byte("<html><head><title>\n  Grafana\n</title></head></html>"))
+	})
+	mux.HandleFunc("/api/health", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"commit": "b6e2c6b", "database": "ok", "version": "10.2.3"}`))
+	})
+	mux.HandleFunc("/favicon.ico", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("icon"))
+	})
+	return mux
+}
+
+func TestFingerprint(t *testing.T) {
+	ctx := context.Background()
+	client := NewClient(time.Second)
+	rules := BundledRules()
+
+	for _, server := range []*httptest.Server{httptest.NewServer(grafana()), httptest.NewTLSServer(grafana())} {
+		defer server.Close()
+		base, _ := url.Parse(server.URL)
+		site, err := client.Fingerprint(ctx, base, Paths(rules))
+		if err != nil {
+			t.Fatal(err)
+		}
+		fp := site.HTTP()
+		if fp.Status != 200 || fp.Title != "Grafana" || fp.Server != "nginx" {
+			t.Errorf("unexpected fingerprint: %+v", fp)
+		}
+		if len(fp.Redirects) != 1 || fp.Redirects[0] != server.URL+"/login" {
+			t.Errorf("unexpected redirects: %v", fp.Redirects)
+		}
+		if fp.SecurityHeaders["X-Frame-Options"] != "deny" || len(fp.SecurityHeaders) != 1 {
+			t.Errorf("unexpected security headers: %v", fp.SecurityHeaders)
+		}
+		if fp.FaviconHash != FaviconHash([]byte("icon")) || fp.FaviconHash == 0 {
+			t.Errorf("unexpected favicon hash: %d", fp.FaviconHash)
+		}
+
+		app := Match(rules, site)
+		if app == nil || app.Name != "Grafana" || app.Version != "10.2.3" || app.CPE != "cpe:2.3:a:grafana:grafana:10.2.3:*:*:*:*:*:*:*" {
+			t.Errorf("expected Grafana 10.2.3, got %+v", app)
+		}
+	}
+}
+
+func TestRuleMatch(t *testing.T) {
+	rules, err := ParseRules([]byte(`[
+		{"name": "Jenkins", "product": "jenkins:jenkins", "headers": {"x-jenkins": "^([\\d.]+)"}, "status": 403},
+		{"name": "Printer", "favicon": [42], "title": "^Home$"}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := &Page{Status: 403, Header: http.Header{"X-Jenkins": []string{"2.440.1"}}}
+	site := &Site{Pages: map[string]*Page{"/": page}, FaviconHash: 42}
+	if app := Match(rules, site); app == nil || app.Name != "Jenkins" || app.Version != "2.440.1" {
+		t.Errorf("expected Jenkins 2.440.1, got %+v", app)
+	}
+	page.Status = 200
+	if app := Match(rules, site); app != nil {
+		t.Errorf("unexpected match: %+v", app)
+	}
+	page.Title = "Home"
+	if app := Match(rules, site); app == nil || app.Name != "Printer" || app.CPE != "" {
+		t.Errorf("expected the printer, got %+v", app)
+	}
+	site.FaviconHash = 0
+	if app := Match(rules, site); app != nil {
+		t.Errorf("unexpected match: %+v", app)
+	}
+}
+
+func TestFetchRedirects(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "https://sso.example.com/auth", http.StatusFound)
+	}))
+	defer server.Close()
+	base, _ := url.Parse(server.URL)
+	page, err := NewClient(time.Second).Fetch(context.Background(), base, "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the redirect to another host is recorded but not followed
+	if page.Status != http.StatusFound || len(page.Redirects) != 1 || page.Redirects[0] != "https://sso.example.com/auth" {
+		t.Errorf("unexpected page: %d %v", page.Status, page.Redirects)
+	}
+}
@@ -0,0 +1,176 @@
+package httpfp
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+
+	"github.com/situation-sh/situation/pkg/utils"
+)
+
+//go:embed rules.json
+var bundledRules []byte
+
+// Rule recognizes a web application. All the given conditions must
+// hold. The regular expressions may capture the version of the
+// application (the first group).
+type Rule struct {
+	// Name is the application name
+	Name string `json:"name"`
+	// Product is the vendor:product part of the CPE (no CPE if empty)
+	Product string `json:"product,omitempty"`
+	// Path is the page the rule looks at (/ by default)
+	Path    string            `json:"path,omitempty"`
+	Status  int               `json:"status,omitempty"`
+	Title   string            `json:"title,omitempty"`
+	Body    string            `json:"body,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	// Favicon lists the hashes of the favicons (see FaviconHash)
+	Favicon []int32 `json:"favicon,omitempty"`
+
+	title   *regexp.Regexp
+	body    *regexp.Regexp
+	headers map[string]*regexp.Regexp
+}
+
+// Site gathers the pages fetched on a site
+type Site struct {
+	Pages       map[string]*Page
+	FaviconHash int32
+}
+
+// Application is the application recognized behind a site
+type Application struct {
+	Name    string
+	Version string
+	CPE     string
+}
+
+// ParseRules reads a JSON list of rules
+func ParseRules(data []byte) ([]*Rule, error) {
+	rules := make([]*Rule, 0)
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, err
+	}
+	for _, r := range rules {
+		if err := r.compile(); err != nil {
+			return nil, fmt.Errorf("rule %s: %w", r.Name, err)
+		}
+	}
+	return rules, nil
+}
+
+// LoadRules reads a JSON file of rules
+func LoadRules(file string) ([]*Rule, error) {
+	data, err := os.ReadFile(file) // #nosec G304 - the file is given by the user
+	if err != nil {
+		return nil, err
+	}
+	return ParseRules(data)
+}
+
+// BundledRules returns the rules shipped with the agent
+func BundledRules() []*Rule {
+	rules, err := ParseRules(bundledRules)
+	if err != nil {
+		panic(fmt.Sprintf("invalid bundled HTTP rules: %v", err))
+	}
+	return rules
+}
+
+// Paths returns the pages the rules look at
+func Paths(rules []*Rule) []string {
+	paths := []string{"/"}
+	for _, r := range rules {
+		if r.Path != "" && !slices.Contains(paths, r.Path) {
+			paths = append(paths, r.Path)
+		}
+	}
+	return paths
+}
+
+func (r *Rule) compile() error {
+	var err error
+	if r.Name == "" {
+		return fmt.Errorf("missing name")
+	}
+	if r.Path == "" {
+		r.Path = "/"
+	}
+	if r.Title != "" {
+		if r.title, err = regexp.Compile(r.Title); err != nil {
+			return err
+		}
+	}
+	if r.Body != "" {
+		if r.body, err = regexp.Compile(r.Body); err != nil {
+			return err
+		}
+	}
+	r.headers = make(map[string]*regexp.Regexp)
+	for header, pattern := range r.Headers {
+		if r.headers[http.CanonicalHeaderKey(header)], err = regexp.Compile(pattern); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Match returns the application if the rule matches the site, nil
+// otherwise
+func (r *Rule) Match(site *Site) *Application {
+	page := site.Pages[r.Path]
+	if page == nil {
+		return nil
+	}
+	if r.Status != 0 && page.Status != r.Status {
+		return nil
+	}
+	if len(r.Favicon) > 0 && !slices.Contains(r.Favicon, site.FaviconHash) {
+		return nil
+	}
+
+	version := ""
+	match := func(re *regexp.Regexp, value string) bool {
+		submatches := re.FindStringSubmatch(value)
+		if submatches == nil {
+			return false
+		}
+		if version == "" && len(submatches) > 1 {
+			version = submatches[1]
+		}
+		return true
+	}
+	if r.title != nil && !match(r.title, page.Title) {
+		return nil
+	}
+	for header, re := range r.headers {
+		values, exists := page.Header[header]
+		if !exists || !slices.ContainsFunc(values, func(v string) bool { return match(re, v) }) {
+			return nil
+		}
+	}
+	if r.body != nil && !match(r.body, string(page.Body)) {
+		return nil
+	}
+
+	app := &Application{Name: r.Name, Version: version}
+	if r.Product != "" {
+		app.CPE = utils.ApplicationCPE(r.Product, version)
+	}
+	return app
+}
+
+// Match returns the application recognized by the first matching rule
+func Match(rules []*Rule, site *Site) *Application {
+	for _, r := range rules {
+		if app := r.Match(site); app != nil {
+			return app
+		}
+	}
+	return nil
+}
@@ -27,6 +27,8 @@ func init() {
 // For technical details you look at https://github.com/FoxIO-LLC/ja4/blob/main/technical_details/README.md
 // It first look at TLS endpoints (given by the [TLS module](./tls.md)) and then tries to connect to them,
 // collecting then JA4, JA4S and JA4X fingerprints.
+//
+// The endpoints of the excluded hosts (see `--scope-exclude`) are skipped.
 type JA4Module struct {
 	BaseModule
 }
@@ -53,6 +55,7 @@ func (m *JA4Module) Run(ctx context.Context) error {
 	if err != nil {
 		return fmt.Errorf("ja4: failed to retrieve TLS endpoints: %w", err)
 	}
+	endpoints = scope.exclusions(ctx, storage, logger).FilterEndpoints(endpoints)
 
 	toUpdate := make([]*models.ApplicationEndpoint, 0)
 
@@ -0,0 +1,200 @@
+// LINUX(MDNSModule) ok
+// WINDOWS(MDNSModule) ok
+// MACOS(MDNSModule) ?
+// ROOT(MDNSModule) no
+package modules
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/asiffer/puzzle"
+	"github.com/sirupsen/logrus"
+	"github.com/situation-sh/situation/pkg/models"
+	"github.com/situation-sh/situation/pkg/modules/mdns"
+	"github.com/situation-sh/situation/pkg/utils"
+)
+
+func init() {
+	registerModule(&MDNSModule{Timeout: 1 * time.Second})
+}
+
+// MDNSModule discovers the services announced through mDNS/DNS-SD.
+//
+// It uses the [golang.org/x/net] library to send the queries on every
+// IPv4 multicast interface.
+//
+// Printers, Chromecasts, NAS and macOS hosts announce their services
+// on the local link. The module browses `_services._dns-sd._udp.local`
+// to list the service types, then their instances, and resolves them to
+// a hostname, IP addresses, a port and TXT records. The queries are sent
+// from an ephemeral port so that the responders reply in unicast (the
+// port 5353 may be held by Avahi or Bonjour).
+//
+// The machines (and their NICs) are created if they are unknown, and
+// get the announced hostname when they have none. Every instance gives
+// an endpoint with its service type as application protocol and an
+// application named after the instance, with the TXT records in its
+// config.
+//
+// The responses are awaited for `timeout` after every query round (4
+// rounds at most).
+//
+// [golang.org/x/net]: https://pkg.go.dev/golang.org/x/net/ipv4
+type MDNSModule struct {
+	BaseModule
+	Timeout time.Duration
+}
+
+func (m *MDNSModule) Bind(config *puzzle.Config) error {
+	return setDefault(config, m, "timeout", &m.Timeout, "Time to wait for the responses of every query round")
+}
+
+func (m *MDNSModule) Name() string {
+	return "mdns"
+}
+
+func (m *MDNSModule) Dependencies() []string {
+	return []string{"arp"}
+}
+
+func (m *MDNSModule) Run(ctx context.Context) error {
+	logger := getLogger(ctx, m)
+
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4zero})
+	if err != nil {
+		return fmt.Errorf("cannot open mDNS socket: %w", err)
+	}
+	defer conn.Close()
+
+	ifaces := multicastInterfaces()
+	if len(ifaces) == 0 {
+		logger.Warn("No multicast interface")
+		return nil
+	}
+	send := multicastSender(conn, ifaces, mdns.Addr)
+
+	logger.WithField("interfaces", len(ifaces)).Info("Browsing mDNS services")
+	instances, err := mdns.Browse(ctx, conn, send, m.Timeout)
+	if err != nil {
+		return fmt.Errorf("failed to browse mDNS services: %w", err)
+	}
+	if len(instances) == 0 {
+		logger.Info("No mDNS service found")
+		return nil
+	}
+	return m.save(ctx, instances, logger)
+}
+
+// save creates or enriches the machines, the NICs, the applications
+// and the endpoints of the instances
+func (m *MDNSModule) save(ctx context.Context, instances []*mdns.Instance, logger logrus.FieldLogger) error {
+	storage := getStorage(ctx)
+	hostID := storage.GetHostID(ctx)
+
+	// instances of every host
+	hosts := make(map[string][]*mdns.Instance)
+	order := make([]string, 0)
+	for _, instance := range instances {
+		if len(instance.IPs) == 0 {
+			logger.WithField("instance", instance.Name).Debug("Unresolved mDNS instance")
+			continue
+		}
+		key := instance.Host
+		if key == "" {
+			key = instance.IPs[0].String()
+		}
+		if _, exists := hosts[key]; !exists {
+			order = append(order, key)
+		}
+		hosts[key] = append(hosts[key], instance)
+	}
+
+	apps := make([]*models.Application, 0)
+	appOf := make(map[string]*models.Application)
+	endpoints := make([]*models.ApplicationEndpoint, 0)
+	appOfEndpoint := make(map[*models.ApplicationEndpoint]string)
+	for _, key := range order {
+		nic, err := discoveredNIC(ctx, storage, hostIPs(hosts[key]), hosts[key][0].Hostname(), logger)
+		if err != nil {
+			return err
+		}
+		if nic.MachineID == hostID {
+			// the services of the host are given by netstat
+			continue
+		}
+		for _, instance := range hosts[key] {
+			transport := instance.Transport()
+			if instance.Port == 0 || (transport != "tcp" && transport != "udp") {
+				continue
+			}
+			appKey := fmt.Sprintf("%d/%s", nic.MachineID, instance.Name)
+			if _, exists := appOf[appKey]; !exists {
+				app := &models.Application{
+					Name:      instance.Name,
+					Protocol:  instance.Protocol(),
+					MachineID: nic.MachineID,
+					Config:    map[string]any{"service": instance.Service, "txt": instance.TXT},
+				}
+				appOf[appKey] = app
+				apps = append(apps, app)
+			}
+			for _, ip := range instance.IPs {
+				endpoint := &models.ApplicationEndpoint{
+					Addr:                 ip.String(),
+					Port:                 instance.Port,
+					Protocol:             transport,
+					ApplicationProtocols: []string{instance.Protocol()},
+					NetworkInterfaceID:   nic.ID,
+				}
+				endpoints = append(endpoints, endpoint)
+				appOfEndpoint[endpoint] = appKey
+			}
+			logger.WithField("instance", instance.Name).
+				WithField("service", instance.Service).
+				WithField("host", instance.Host).
+				WithField("port", instance.Port).
+				Debug("mDNS instance found")
+		}
+	}
+
+	if len(apps) > 0 {
+		err := storage.DB().NewInsert().Model(&apps).
+			On("CONFLICT (machine_id, name, pid) DO UPDATE").
+			Set("protocol = EXCLUDED.protocol").
+			Set("config = EXCLUDED.config").
+			Set("updated_at = CURRENT_TIMESTAMP").
+			Scan(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to insert applications: %w", err)
+		}
+	}
+
+	for _, endpoint := range endpoints {
+		endpoint.ApplicationID = appOf[appOfEndpoint[endpoint]].ID
+	}
+	if err := saveDiscoveredEndpoints(ctx, storage, endpoints, logger); err != nil {
+		return err
+	}
+
+	logger.WithField("hosts", len(order)).
+		WithField("applications", len(apps)).
+		WithField("endpoints", len(endpoints)).
+		Info("mDNS services found")
+	return nil
+}
+
+// hostIPs returns the addresses of the host announcing the instances
+func hostIPs(instances []*mdns.Instance) []string {
+	ips := make([]string, 0)
+	for _, instance := range instances {
+		for _, ip := range instance.IPs {
+			if !utils.Includes(ips, ip.String()) {
+				ips = append(ips, ip.String())
+			}
+		}
+	}
+	return ips
+}
@@ -0,0 +1,287 @@
+// Package mdns browses the services announced through mDNS/DNS-SD
+// (RFC 6762 and RFC 6763). The queries are sent from an ephemeral port
+// ("one-shot" queries) so that the responders reply in unicast and the
+// port 5353 does not need to be free.
+package mdns
+
+import (
+	"context"
+	"errors"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// Addr is the IPv4 mDNS group
+var Addr = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+
+// ServicesName is the name that lists the service types of the link
+const ServicesName = "_services._dns-sd._udp.local."
+
+// Instance is a service instance announced by a host
+type Instance struct {
+	// Name is the instance name (like "Office Printer")
+	Name string
+	// Service is the service type (like "_ipp._tcp")
+	Service string
+	// Host is the target host (like "printer.local.")
+	Host string
+	Port uint16
+	IPs  []net.IP
+	TXT  map[string]string
+}
+
+// Transport returns the transport protocol of the instance (tcp or
+// udp)
+func (i *Instance) Transport() string {
+	_, transport, _ := strings.Cut(i.Service, "._")
+	return transport
+}
+
+// Protocol returns the application protocol of the instance (like ipp)
+func (i *Instance) Protocol() string {
+	protocol, _, _ := strings.Cut(strings.TrimPrefix(i.Service, "_"), "._")
+	return protocol
+}
+
+// Hostname returns the host name without the .local domain
+func (i *Instance) Hostname() string {
+	return strings.TrimSuffix(strings.TrimSuffix(i.Host, "."), ".local")
+}
+
+// browser gathers the records received from the responders
+type browser struct {
+	conn    net.PacketConn
+	send    func(msg []byte) error
+	wait    time.Duration
+	ptr     map[string][]string
+	srv     map[string]dnsmessage.SRVResource
+	txt     map[string][]string
+	addrs   map[string][]net.IP
+	sources map[string]net.IP
+}
+
+// Browse lists the service types, then their instances and resolves
+// them (SRV, TXT, A and AAAA records). The queries are given to send,
+// the responses are read from conn for wait after every query round.
+func Browse(ctx context.Context, conn net.PacketConn, send func(msg []byte) error, wait time.Duration) ([]*Instance, error) {
+	b := &browser{
+		conn:    conn,
+		send:    send,
+		wait:    wait,
+		ptr:     make(map[string][]string),
+		srv:     make(map[string]dnsmessage.SRVResource),
+		txt:     make(map[string][]string),
+		addrs:   make(map[string][]net.IP),
+		sources: make(map[string]net.IP),
+	}
+
+	// service types
+	if err := b.round(ctx, []dnsmessage.Question{question(ServicesName, dnsmessage.TypePTR)}); err != nil {
+		return nil, err
+	}
+	// instances
+	questions := make([]dnsmessage.Question, 0)
+	for _, service := range b.ptr[ServicesName] {
+		questions = append(questions, question(service, dnsmessage.TypePTR))
+	}
+	if err := b.round(ctx, questions); err != nil {
+		return nil, err
+	}
+	// the responders usually give the SRV, TXT and address records
+	// along with the PTR ones, the missing ones are queried
+	questions = questions[:0]
+	for _, service := range b.ptr[ServicesName] {
+		for _, instance := range b.ptr[service] {
+			if _, exists := b.srv[instance]; !exists {
+				questions = append(questions, question(instance, dnsmessage.TypeSRV))
+			}
+			if _, exists := b.txt[instance]; !exists {
+				questions = append(questions, question(instance, dnsmessage.TypeTXT))
+			}
+		}
+	}
+	if err := b.round(ctx, questions); err != nil {
+		return nil, err
+	}
+	questions = questions[:0]
+	for _, srv := range b.srv {
+		host := srv.Target.String()
+		if _, exists := b.addrs[host]; !exists && !slices.ContainsFunc(questions, func(q dnsmessage.Question) bool { return q.Name.String() == host }) {
+			questions = append(questions, question(host, dnsmessage.TypeA), question(host, dnsmessage.TypeAAAA))
+		}
+	}
+	if err := b.round(ctx, questions); err != nil {
+		return nil, err
+	}
+
+	return b.instances(), nil
+}
+
+func question(name string, qtype dnsmessage.Type) dnsmessage.Question {
+	return dnsmessage.Question{Name: dnsmessage.MustNewName(name), Type: qtype, Class: dnsmessage.ClassINET}
+}
+
+// round sends the questions and reads the responses
+func (b *browser) round(ctx context.Context, questions []dnsmessage.Question) error {
+	if len(questions) == 0 {
+		return nil
+	}
+	builder := dnsmessage.NewBuilder(nil, dnsmessage.Header{})
+	if err := builder.StartQuestions(); err != nil {
+		return err
+	}
+	for _, q := range questions {
+		if err := builder.Question(q); err != nil {
+			return err
+		}
+	}
+	msg, err := builder.Finish()
+	if err != nil {
+		return err
+	}
+	if err := b.send(msg); err != nil {
+		return err
+	}
+
+	deadline := time.Now().Add(b.wait)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if err := b.conn.SetReadDeadline(deadline); err != nil {
+		return err
+	}
+	buffer := make([]byte, 9000)
+	for ctx.Err() == nil {
+		n, src, err := b.conn.ReadFrom(buffer)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				return nil
+			}
+			return err
+		}
+		var ip net.IP
+		if addr, ok := src.(*net.UDPAddr); ok {
+			ip = addr.IP
+		}
+		b.parse(buffer[:n], ip)
+	}
+	return ctx.Err()
+}
+
+// parse stores the records of a response
+func (b *browser) parse(msg []byte, src net.IP) {
+	var p dnsmessage.Parser
+	header, err := p.Start(msg)
+	if err != nil || !header.Response {
+		return
+	}
+	if err := p.SkipAllQuestions(); err != nil {
+		return
+	}
+	sections := []struct {
+		next func() (dnsmessage.ResourceHeader, error)
+		skip func() error
+	}{
+		{p.AnswerHeader, p.SkipAnswer},
+		{p.AuthorityHeader, p.SkipAuthority},
+		{p.AdditionalHeader, p.SkipAdditional},
+	}
+	for _, section := range sections {
+		for {
+			h, err := section.next()
+			if err != nil {
+				// end of the section (or malformed message)
+				break
+			}
+			if err := b.record(&p, h, src, section.skip); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// record stores a resource record (skip skips the other ones)
+func (b *browser) record(p *dnsmessage.Parser, h dnsmessage.ResourceHeader, src net.IP, skip func() error) error {
+	name := h.Name.String()
+	switch h.Type {
+	case dnsmessage.TypePTR:
+		r, err := p.PTRResource()
+		if err != nil {
+			return err
+		}
+		if target := r.PTR.String(); !slices.Contains(b.ptr[name], target) {
+			b.ptr[name] = append(b.ptr[name], target)
+		}
+	case dnsmessage.TypeSRV:
+		r, err := p.SRVResource()
+		if err != nil {
+			return err
+		}
+		b.srv[name] = r
+	case dnsmessage.TypeTXT:
+		r, err := p.TXTResource()
+		if err != nil {
+			return err
+		}
+		b.txt[name] = r.TXT
+	case dnsmessage.TypeA:
+		r, err := p.AResource()
+		if err != nil {
+			return err
+		}
+		b.addIP(name, net.IP(r.A[:]))
+	case dnsmessage.TypeAAAA:
+		r, err := p.AAAAResource()
+		if err != nil {
+			return err
+		}
+		b.addIP(name, net.IP(r.AAAA[:]))
+	default:
+		return skip()
+	}
+	if src != nil {
+		b.sources[name] = src
+	}
+	return nil
+}
+
+func (b *browser) addIP(name string, ip net.IP) {
+	if !slices.ContainsFunc(b.addrs[name], ip.Equal) {
+		b.addrs[name] = append(b.addrs[name], ip)
+	}
+}
+
+// instances resolves the instances from the gathered records
+func (b *browser) instances() []*Instance {
+	instances := make([]*Instance, 0)
+	for _, service := range b.ptr[ServicesName] {
+		for _, name := range b.ptr[service] {
+			instance := &Instance{
+				Name:    strings.TrimSuffix(name, "."+service),
+				Service: strings.TrimSuffix(service, ".local."),
+				TXT:     make(map[string]string),
+			}
+			if srv, exists := b.srv[name]; exists {
+				instance.Host = srv.Target.String()
+				instance.Port = srv.Port
+				instance.IPs = b.addrs[instance.Host]
+			}
+			if len(instance.IPs) == 0 && b.sources[name] != nil {
+				// the responder is the host
+				instance.IPs = []net.IP{b.sources[name]}
+			}
+			for _, entry := range b.txt[name] {
+				if key, value, _ := strings.Cut(entry, "="); key != "" {
+					instance.TXT[key] = value
+				}
+			}
+			instances = append(instances, instance)
+		}
+	}
+	return instances
+}
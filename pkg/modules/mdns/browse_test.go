@@ -0,0 +1,126 @@
+package mdns
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func header(name string, rtype dnsmessage.Type) dnsmessage.ResourceHeader {
+	return dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName(name), Type: rtype, Class: dnsmessage.ClassINET, TTL: 120}
+}
+
+// records of the responder: a printer that gives all the records at
+// once and a Chromecast that has to be asked for each of them
+var records = map[string][]dnsmessage.Resource{
+	ServicesName + "/PTR": {
+		{Header: header(ServicesName, dnsmessage.TypePTR), Body: &dnsmessage.PTRResource{PTR: dnsmessage.MustNewName("_ipp._tcp.local.")}},
+		{Header: header(ServicesName, dnsmessage.TypePTR), Body: &dnsmessage.PTRResource{PTR: dnsmessage.MustNewName("_googlecast._tcp.local.")}},
+	},
+	"_ipp._tcp.local./PTR": {
+		{Header: header("_ipp._tcp.local.", dnsmessage.TypePTR), Body: &dnsmessage.PTRResource{PTR: dnsmessage.MustNewName("Office Printer._ipp._tcp.local.")}},
+		{Header: header("Office Printer._ipp._tcp.local.", dnsmessage.TypeSRV), Body: &dnsmessage.SRVResource{Target: dnsmessage.MustNewName("printer.local."), Port: 631}},
+		{Header: header("Office Printer._ipp._tcp.local.", dnsmessage.TypeTXT), Body: &dnsmessage.TXTResource{TXT: []string{"txtvers=1", "ty=HP LaserJet 400", "color"}}},
+		{Header: header("printer.local.", dnsmessage.TypeA), Body: &dnsmessage.AResource{A: [4]byte{192, 168, 1, 20}}},
+	},
+	"_googlecast._tcp.local./PTR": {
+		{Header: header("_googlecast._tcp.local.", dnsmessage.TypePTR), Body: &dnsmessage.PTRResource{PTR: dnsmessage.MustNewName("Living Room._googlecast._tcp.local.")}},
+	},
+	"Living Room._googlecast._tcp.local./SRV": {
+		{Header: header("Living Room._googlecast._tcp.local.", dnsmessage.TypeSRV), Body: &dnsmessage.SRVResource{Target: dnsmessage.MustNewName("chromecast.local."), Port: 8009}},
+	},
+	"Living Room._googlecast._tcp.local./TXT": {
+		{Header: header("Living Room._googlecast._tcp.local.", dnsmessage.TypeTXT), Body: &dnsmessage.TXTResource{TXT: []string{"md=Chromecast"}}},
+	},
+}
+
+// respond builds the response to a query
+func respond(query []byte) []byte {
+	var p dnsmessage.Parser
+	if _, err := p.Start(query); err != nil {
+		return nil
+	}
+	questions, err := p.AllQuestions()
+	if err != nil {
+		return nil
+	}
+	response := dnsmessage.Message{Header: dnsmessage.Header{Response: true, Authoritative: true}}
+	for _, q := range questions {
+		response.Answers = append(response.Answers, records[q.Name.String()+"/"+q.Type.String()[4:]]...)
+	}
+	if len(response.Answers) == 0 {
+		return nil
+	}
+	msg, err := response.Pack()
+	if err != nil {
+		return nil
+	}
+	return msg
+}
+
+func TestBrowse(t *testing.T) {
+	responder, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer responder.Close()
+	go func() {
+		buffer := make([]byte, 9000)
+		for {
+			n, peer, err := responder.ReadFromUDP(buffer)
+			if err != nil {
+				return
+			}
+			if msg := respond(buffer[:n]); msg != nil {
+				_, _ = responder.WriteToUDP(msg, peer)
+			}
+		}
+	}()
+
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	send := func(msg []byte) error {
+		_, err := conn.WriteTo(msg, responder.LocalAddr())
+		return err
+	}
+
+	instances, err := Browse(context.Background(), conn, send, 200*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(instances) != 2 {
+		t.Fatalf("expected 2 instances, got %d", len(instances))
+	}
+
+	printer := instances[0]
+	if printer.Name != "Office Printer" || printer.Service != "_ipp._tcp" || printer.Host != "printer.local." || printer.Port != 631 {
+		t.Errorf("unexpected printer: %+v", printer)
+	}
+	if printer.Transport() != "tcp" || printer.Protocol() != "ipp" || printer.Hostname() != "printer" {
+		t.Errorf("unexpected printer protocols: %s %s %s", printer.Transport(), printer.Protocol(), printer.Hostname())
+	}
+	if len(printer.IPs) != 1 || printer.IPs[0].String() != "192.168.1.20" {
+		t.Errorf("unexpected printer IPs: %v", printer.IPs)
+	}
+	if printer.TXT["ty"] != "HP LaserJet 400" || printer.TXT["txtvers"] != "1" {
+		t.Errorf("unexpected printer TXT: %v", printer.TXT)
+	}
+	if _, exists := printer.TXT["color"]; !exists {
+		t.Errorf("expected the boolean attribute, got %v", printer.TXT)
+	}
+
+	// the address of the Chromecast is not given: it is the responder
+	chromecast := instances[1]
+	if chromecast.Name != "Living Room" || chromecast.Port != 8009 || chromecast.TXT["md"] != "Chromecast" {
+		t.Errorf("unexpected chromecast: %+v", chromecast)
+	}
+	if len(chromecast.IPs) != 1 || !chromecast.IPs[0].Equal(net.IPv4(127, 0, 0, 1)) {
+		t.Errorf("unexpected chromecast IPs: %v", chromecast.IPs)
+	}
+}
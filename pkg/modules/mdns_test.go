@@ -0,0 +1,116 @@
+package modules
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/situation-sh/situation/pkg/models"
+	"github.com/situation-sh/situation/pkg/modules/mdns"
+)
+
+func TestMDNSSave(t *testing.T) {
+	ctx := context.Background()
+	storage := NewTestingBunStorage(t)
+	if err := storage.Migrate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// the printer is known (through ARP for instance) but has no name
+	printer := &models.Machine{}
+	if _, err := storage.DB().NewInsert().Model(printer).Exec(ctx); err != nil {
+		t.Fatal(err)
+	}
+	nic := &models.NetworkInterface{IP: []string{"192.168.1.20"}, MachineID: printer.ID}
+	if _, err := storage.DB().NewInsert().Model(nic).Exec(ctx); err != nil {
+		t.Fatal(err)
+	}
+	existing := &models.ApplicationEndpoint{Addr: "192.168.1.20", Port: 631, Protocol: "tcp", NetworkInterfaceID: nic.ID}
+	if _, err := storage.DB().NewInsert().Model(existing).Exec(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	instances := []*mdns.Instance{
+		{
+			Name:    "Office Printer",
+			Service: "_ipp._tcp",
+			Host:    "printer.local.",
+			Port:    631,
+			IPs:     []net.IP{net.IPv4(192, 168, 1, 20)},
+			TXT:     map[string]string{"ty": "HP LaserJet 400"},
+		},
+		{
+			Name:    "Office Printer",
+			Service: "_http._tcp",
+			Host:    "printer.local.",
+			Port:    80,
+			IPs:     []net.IP{net.IPv4(192, 168, 1, 20)},
+			TXT:     map[string]string{},
+		},
+		{
+			Name:    "Living Room",
+			Service: "_googlecast._tcp",
+			Host:    "chromecast.local.",
+			Port:    8009,
+			IPs:     []net.IP{net.IPv4(192, 168, 1, 30)},
+			TXT:     map[string]string{"md": "Chromecast"},
+		},
+		// unresolved instances are ignored
+		{Name: "Lost", Service: "_ipp._tcp", Port: 631},
+	}
+
+	m := &MDNSModule{}
+	ctx = SituationContext(ctx, "test", storage, logrus.New())
+	if err := m.save(ctx, instances, logrus.New()); err != nil {
+		t.Fatal(err)
+	}
+	// a second run must not duplicate anything
+	if err := m.save(ctx, instances, logrus.New()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := storage.DB().NewSelect().Model(printer).WherePK().Scan(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if printer.Hostname != "printer" {
+		t.Errorf("expected the printer hostname, got %q", printer.Hostname)
+	}
+
+	machines := make([]*models.Machine, 0)
+	if err := storage.DB().NewSelect().Model(&machines).Scan(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(machines) != 2 || machines[1].Hostname != "chromecast" {
+		t.Errorf("expected the chromecast machine to be created, got %+v", machines)
+	}
+
+	apps := make([]*models.Application, 0)
+	if err := storage.DB().NewSelect().Model(&apps).Order("id").Scan(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(apps) != 2 {
+		t.Fatalf("expected 2 applications, got %d", len(apps))
+	}
+	if apps[0].Name != "Office Printer" || apps[0].MachineID != printer.ID {
+		t.Errorf("unexpected printer application: %+v", apps[0])
+	}
+
+	endpoints := make([]*models.ApplicationEndpoint, 0)
+	if err := storage.DB().NewSelect().Model(&endpoints).Relation("Application").Order("application_endpoint.id").Scan(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(endpoints) != 3 {
+		t.Fatalf("expected 3 endpoints, got %d", len(endpoints))
+	}
+	for _, e := range endpoints {
+		if e.Application == nil || len(e.ApplicationProtocols) != 1 {
+			t.Errorf("expected the endpoint %s:%d to be identified, got %+v", e.Addr, e.Port, e)
+		}
+	}
+	if endpoints[0].ID != existing.ID || endpoints[0].ApplicationProtocols[0] != "ipp" || endpoints[0].Application.ID != apps[0].ID {
+		t.Errorf("expected the existing endpoint to be updated, got %+v", endpoints[0])
+	}
+	if endpoints[2].Port != 8009 || endpoints[2].ApplicationProtocols[0] != "googlecast" || endpoints[2].Application.Name != "Living Room" {
+		t.Errorf("unexpected chromecast endpoint: %+v", endpoints[2])
+	}
+}
@@ -6,8 +6,11 @@ package modules
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
+	"slices"
+	"sync"
 	"time"
 
 	"github.com/asiffer/puzzle"
@@ -20,7 +23,13 @@ import (
 
 func init() {
 	registerModule(&PingModule{
-		Timeout: 300 * time.Millisecond,
+		Timeout:     300 * time.Millisecond,
+		IPv6:        true,
+		MaxProbes:   4096,
+		Rate:        500,
+		Batch:       256,
+		DHCPRanges:  []string{},
+		TCPFallback: false,
 	})
 }
 
@@ -29,19 +38,74 @@ func init() {
 // The module relies on [pro-bing] library.
 //
 // A single ping attempt is made on every host of the local networks
-// (the host may belong to several networks). Only IPv4 networks with
-// prefix length >=20 are treated.
-// The ping timeout is hardset to 300ms.
+// (the host may belong to several networks) with prefix length >=20.
+// The ping timeout is hardset to 1s.
+//
+// Wider IPv4 networks (up to /8) are swept over several runs: every run
+// sends at most `max-probes` echo requests, shared between these
+// networks. The addresses close to the gateway and to the known hosts,
+// and the `dhcp-ranges`, are probed first, then the sweep continues
+// from where the previous run of the agent stopped (the cursor is
+// stored in the database). Probes are sent by batches paced at `rate`
+// probes per second, and a batch is halved when the socket cannot keep
+// up. Replies are awaited for `timeout`.
+//
+// IPv6 networks cannot be swept: a single ICMPv6 echo request is sent
+// to the all-nodes multicast group (ff02::1) of every link that bears
+// an IPv6 subnetwork. The neighbors that reply are pinged back so that
+// their addresses land in the neighbor (NDP) cache, which is then read
+// by the [ARP] module.
+//
+// Many hosts (Windows ones, firewalled appliances) drop ICMP. When
+// `tcp-fallback` is enabled (it is disabled by default), the addresses
+// that do not reply are probed through TCP connections to a few common
+// ports (22, 80, 135, 443, 445 and 3389): a host that accepts (SYN-ACK)
+// or resets (RST) a connection is alive. These attempts also fill the
+// ARP cache of the host, so that the [ARP] module can find the MAC
+// addresses of these hosts. On the wide networks, these connections
+// count in the `rate` of probes.
+//
+// The networks listed in the scope targets (`--scope-targets`) are
+// stored and probed like the local ones. The address ranges of the
+// targets are probed entirely (at most `max-probes` addresses) when
+// a known network contains them. The excluded addresses
+// (`--scope-exclude`) are never probed.
+//
+// [ARP]: arp.md
 //
 // [pro-bing]: https://github.com/prometheus-community/pro-bing
 type PingModule struct {
 	BaseModule
 
-	Timeout time.Duration
+	Timeout     time.Duration
+	IPv6        bool
+	MaxProbes   int
+	Rate        int
+	Batch       int
+	DHCPRanges  []string
+	TCPFallback bool
 }
 
 func (m *PingModule) Bind(config *puzzle.Config) error {
-	return setDefault(config, m, "timeout", &m.Timeout, "Ping timeout")
+	if err := setDefault(config, m, "timeout", &m.Timeout, "Ping timeout"); err != nil {
+		return err
+	}
+	if err := setDefault(config, m, "ipv6", &m.IPv6, "Ping the all-nodes group of the IPv6 links"); err != nil {
+		return err
+	}
+	if err := setDefault(config, m, "max-probes", &m.MaxProbes, "Maximum number of probes sent to the networks wider than /20 per run"); err != nil {
+		return err
+	}
+	if err := setDefault(config, m, "rate", &m.Rate, "Maximum number of probes per second on the networks wider than /20"); err != nil {
+		return err
+	}
+	if err := setDefault(config, m, "batch", &m.Batch, "Maximum number of probes sent at once on the networks wider than /20"); err != nil {
+		return err
+	}
+	if err := setDefault(config, m, "dhcp-ranges", &m.DHCPRanges, "Address ranges probed first on the networks wider than /20 (e.g. 10.1.0.100-10.1.3.250)"); err != nil {
+		return err
+	}
+	return setDefault(config, m, "tcp-fallback", &m.TCPFallback, "Probe common TCP ports of the hosts that do not reply to ICMP")
 }
 
 func (m *PingModule) Name() string {
@@ -52,11 +116,11 @@ func (m *PingModule) Dependencies() []string {
 	return []string{"host-network"}
 }
 
-func pingSubnetwork(ctx context.Context, network *net.IPNet, subnetID int64, source net.IP, logger logrus.FieldLogger, s *store.BunStorage) error {
+func (m *PingModule) pingSubnetwork(ctx context.Context, network *net.IPNet, subnetID int64, source net.IP, excluded *Exclusions, logger logrus.FieldLogger, s *store.BunStorage) error {
 	// better context
 	logger = logger.WithField("subnet", network)
 
-	ips := utils.ListIPs(network)
+	ips := excluded.FilterIPs(utils.ListIPs(network))
 
 	ipChan := make(chan net.IP, len(ips))
 
@@ -77,7 +141,14 @@ func pingSubnetwork(ctx context.Context, network *net.IPNet, subnetID int64, sou
 	for ip := range ipChan {
 		discoveredIPs = append(discoveredIPs, ip.String())
 	}
+	alive, _ := m.fallback(ctx, ips, discoveredIPs, logger)
+	discoveredIPs = append(discoveredIPs, alive...)
+	return saveDiscoveredIPs(ctx, discoveredIPs, network, subnetID, logger, s)
+}
 
+// saveDiscoveredIPs creates a NIC (linked to the subnetwork) for every
+// discovered IP that is not known yet
+func saveDiscoveredIPs(ctx context.Context, discoveredIPs []string, network *net.IPNet, subnetID int64, logger logrus.FieldLogger, s *store.BunStorage) error {
 	if len(discoveredIPs) == 0 {
 		return nil
 	}
@@ -164,6 +235,21 @@ func (m *PingModule) Run(ctx context.Context) error {
 	logger := getLogger(ctx, m)
 	storage := getStorage(ctx)
 
+	excluded := scope.exclusions(ctx, storage, logger)
+	// the target networks are stored so that they are probed
+	// like the local ones, the ranges are probed afterwards
+	ranges := make([]scopeTarget, 0)
+	for _, target := range scope.targets(logger) {
+		if target.Network == nil {
+			ranges = append(ranges, target)
+		} else if storage.GetOrCreateSubnetwork(ctx, target.Network.String()) == nil {
+			logger.WithField("subnet", target.Network).Warn("unable to store target network")
+		}
+	}
+
+	// networks wider than /20
+	wide := make([]models.Subnetwork, 0)
+
 	// host := store.GetHost()
 	// try to ping all networks
 	for _, network := range storage.GetAllIPv4Networks(ctx) {
@@ -183,10 +269,14 @@ func (m *PingModule) Run(ctx context.Context) error {
 		_, zeros := ipnet.Mask.Size()
 
 		switch ones := network.MaskSize; {
-		case ones < 20:
-			// ignore to large network (here /20 at most)
+		case ones < 8:
+			// ignore to large network (here /8 at most)
 			logger.WithField("subnet", ipnet).Warn("Ignoring network (too wide)")
 			continue
+		case ones < 20:
+			// swept over several runs
+			wide = append(wide, network)
+			continue
 		case ones > 24:
 			// if the network is restricted. We try to
 			// send pings in a wider one. It may appear
@@ -199,7 +289,7 @@ func (m *PingModule) Run(ctx context.Context) error {
 		}
 
 		logger.WithField("subnet", ipnet).Info("Pinging subnet")
-		if err := pingSubnetwork(ctx, ipnet, network.ID, nil, logger, storage); err != nil {
+		if err := m.pingSubnetwork(ctx, ipnet, network.ID, nil, excluded, logger, storage); err != nil {
 			logger.
 				WithField("network", network).
 				WithError(err).
@@ -208,5 +298,285 @@ func (m *PingModule) Run(ctx context.Context) error {
 		// }
 	}
 
+	if len(ranges) > 0 {
+		m.pingRanges(ctx, ranges, excluded, logger, storage)
+	}
+
+	if len(wide) > 0 {
+		m.sweepNetworks(ctx, wide, excluded, logger, storage)
+	}
+
+	if m.IPv6 {
+		pingLinks6(ctx, excluded, logger, storage)
+	}
+
 	return nil
 }
+
+// pingRanges probes the address ranges of the scope targets. The
+// discovered hosts are linked to the narrowest known network that
+// contains the range.
+func (m *PingModule) pingRanges(ctx context.Context, ranges []scopeTarget, excluded *Exclusions, logger logrus.FieldLogger, s *store.BunStorage) {
+	networks := s.GetAllIPv4Networks(ctx)
+	for _, r := range ranges {
+		logger := logger.WithField("range", fmt.Sprintf("%s-%s", r.First, r.Last))
+		if r.First.To4() == nil {
+			logger.Warn("Ignoring IPv6 range")
+			continue
+		}
+		first, last := utils.IPv4ToUint32(r.First), utils.IPv4ToUint32(r.Last)
+		if int64(last)-int64(first) >= int64(m.MaxProbes) {
+			logger.WithField("max-probes", m.MaxProbes).Warn("Ignoring range (too wide)")
+			continue
+		}
+
+		var network *models.Subnetwork
+		var ipnet *net.IPNet
+		for i := range networks {
+			n, err := networks[i].IPNet()
+			if err != nil || !n.Contains(r.First) || !n.Contains(r.Last) {
+				continue
+			}
+			if network == nil || networks[i].MaskSize > network.MaskSize {
+				network, ipnet = &networks[i], n
+			}
+		}
+		if network == nil {
+			logger.Warn("No known network contains the range, add its CIDR to the targets")
+			continue
+		}
+
+		targets := make([]net.IP, 0, last-first+1)
+		for u := first; u <= last && u >= first; u++ {
+			targets = append(targets, utils.Uint32ToIPv4(u))
+		}
+		logger.WithField("subnet", ipnet).Info("Pinging range")
+		discoveredIPs := m.probe(ctx, excluded.FilterIPs(targets), logger)
+		if err := saveDiscoveredIPs(ctx, discoveredIPs, ipnet, network.ID, logger, s); err != nil {
+			logger.WithError(err).Error("error while pinging range")
+		}
+	}
+}
+
+// sweepNetworks probes a part of every wide network and stores the
+// position the sweep of each network must resume from
+func (m *PingModule) sweepNetworks(ctx context.Context, networks []models.Subnetwork, excluded *Exclusions, logger logrus.FieldLogger, s *store.BunStorage) {
+	ranges := make([][2]net.IP, 0, len(m.DHCPRanges))
+	for _, r := range m.DHCPRanges {
+		first, last, err := utils.ParseIPRange(r)
+		if err != nil {
+			logger.WithField("range", r).WithError(err).Warn("Ignoring DHCP range")
+			continue
+		}
+		ranges = append(ranges, [2]net.IP{first, last})
+	}
+
+	// the probes of the run are shared between the networks
+	budget := m.MaxProbes / len(networks)
+	for _, network := range networks {
+		if ctx.Err() != nil {
+			return
+		}
+		ipnet, err := network.IPNet()
+		if err != nil {
+			continue
+		}
+		logger := logger.WithField("subnet", ipnet)
+
+		cursor, err := s.GetSweepCursor(ctx, network.ID)
+		if err != nil {
+			logger.WithError(err).Warn("unable to read the sweep cursor")
+			continue
+		}
+		// hosts are likely to be found around the gateway and the known hosts
+		anchors := make([]net.IP, 0)
+		if gateway := net.ParseIP(network.Gateway); gateway != nil {
+			anchors = append(anchors, gateway)
+		}
+		for _, ip := range s.GetSubnetworkIPs(ctx, network.ID) {
+			if addr := net.ParseIP(ip); addr != nil {
+				anchors = append(anchors, addr)
+			}
+		}
+
+		sweep := ping.Sweep{Network: ipnet, Anchors: anchors, Ranges: ranges}
+		targets, next, wrapped := sweep.Targets(uint64(cursor.Position), budget)
+		logger.
+			WithField("probes", len(targets)).
+			WithField("position", cursor.Position).
+			WithField("size", sweep.Size()).
+			Info("Sweeping wide subnet")
+
+		discoveredIPs := m.probe(ctx, excluded.FilterIPs(targets), logger)
+		if err := saveDiscoveredIPs(ctx, discoveredIPs, ipnet, network.ID, logger, s); err != nil {
+			logger.WithError(err).Error("error while sweeping subnetwork")
+		}
+		if ctx.Err() != nil {
+			// the sweep has not reached next
+			return
+		}
+
+		cursor.Position = int64(next)
+		if wrapped {
+			cursor.Passes++
+		}
+		if err := s.SaveSweepCursor(ctx, cursor); err != nil {
+			logger.WithError(err).Warn("unable to save the sweep cursor")
+		}
+	}
+}
+
+// probe pings the targets by batches. A batch is halved when the socket
+// cannot send all its requests and grows back afterwards. Batches are
+// paced so that no more than Rate probes (echo requests and fallback
+// TCP connections) are sent per second.
+func (m *PingModule) probe(ctx context.Context, targets []net.IP, logger logrus.FieldLogger) []string {
+	var mutex sync.Mutex
+	discoveredIPs := make([]string, 0)
+	onRecv := func(addr net.IP) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		discoveredIPs = append(discoveredIPs, addr.String())
+		logger.WithField("ip", addr).Debug("Host found")
+	}
+
+	batch := max(m.Batch, 1)
+	for len(targets) > 0 && ctx.Err() == nil {
+		n := min(batch, len(targets))
+		start := time.Now()
+		before := len(discoveredIPs)
+		err := ping.PingSubnet4(targets[:n], nil, m.Timeout, onRecv)
+		mutex.Lock()
+		found := slices.Clone(discoveredIPs[before:])
+		mutex.Unlock()
+		alive, connects := m.fallback(ctx, targets[:n], found, logger)
+		for _, ip := range alive {
+			onRecv(net.ParseIP(ip))
+		}
+		targets = targets[n:]
+
+		switch {
+		case errors.Is(err, ping.ErrPartialSend):
+			batch = max(batch/2, 1)
+			logger.WithError(err).WithField("batch", batch).Debug("Reducing batch size")
+		case err != nil:
+			logger.WithError(err).Warn("error while pinging subnetwork")
+			return discoveredIPs
+		case batch < m.Batch:
+			batch = min(2*batch, m.Batch)
+		}
+
+		if pace := m.pace(n + connects); pace > 0 {
+			select {
+			case <-ctx.Done():
+			case <-time.After(pace - time.Since(start)):
+			}
+		}
+	}
+	return discoveredIPs
+}
+
+// pace returns the time the probes take at Rate (0 when the rate is
+// not limited)
+func (m *PingModule) pace(probes int) time.Duration {
+	if m.Rate <= 0 {
+		return 0
+	}
+	return time.Duration(probes) * time.Second / time.Duration(m.Rate)
+}
+
+// fallback probes common TCP ports of the targets that have not
+// replied to ICMP (see TCPFallback). It returns the ones that are alive
+// and the number of connections attempted.
+func (m *PingModule) fallback(ctx context.Context, targets []net.IP, found []string, logger logrus.FieldLogger) ([]string, int) {
+	if !m.TCPFallback {
+		return nil, 0
+	}
+	replied := make(map[string]bool, len(found))
+	for _, ip := range found {
+		replied[ip] = true
+	}
+	silent := make([]net.IP, 0, len(targets))
+	for _, ip := range targets {
+		if !replied[ip.String()] {
+			silent = append(silent, ip)
+		}
+	}
+	if len(silent) == 0 {
+		return nil, 0
+	}
+
+	var mutex sync.Mutex
+	alive := make([]string, 0)
+	// 64 hosts at once keep the number of sockets well below the
+	// usual limit of open files (a socket per port)
+	ping.PingTCP(ctx, silent, ping.DefaultTCPPorts, m.Timeout, 64, func(addr net.IP) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		alive = append(alive, addr.String())
+		logger.WithField("ip", addr).Debug("Host found (TCP)")
+	})
+	if len(alive) > 0 {
+		logger.WithField("hosts", len(alive)).Info("Hosts found through TCP")
+	}
+	// every port of a silent target is tried
+	return alive, len(silent) * len(ping.DefaultTCPPorts)
+}
+
+// pingLinks6 pings the all-nodes group of every host NIC that is
+// attached to an IPv6 subnetwork. The neighbors are not stored here
+// (their MAC is not known yet), the ARP module picks them up from the
+// neighbor cache. The excluded neighbors are not pinged back.
+func pingLinks6(ctx context.Context, excluded *Exclusions, logger logrus.FieldLogger, s *store.BunStorage) {
+	for _, nic := range s.GetHostNICs(ctx) {
+		if nic.Name == "" || nic.Flags.Loopback {
+			continue
+		}
+		for _, network := range nic.Subnetworks {
+			if network == nil || network.IPVersion != 6 {
+				continue
+			}
+			ipnet, err := network.IPNet()
+			if err != nil {
+				logger.
+					WithField("network", network.NetworkCIDR).
+					WithError(err).
+					Warn("unable to parse network CIDR")
+				continue
+			}
+			// the source address drives the address the neighbors reply from
+			var source net.IP
+			for _, ip := range nic.IPs() {
+				if ipnet.Contains(ip) {
+					source = ip
+					break
+				}
+			}
+			if source == nil {
+				continue
+			}
+
+			found := 0
+			onRecv := func(addr net.IP) bool {
+				if !ipnet.Contains(addr) || addr.Equal(source) {
+					return false
+				}
+				found++
+				logger.WithField("ip", addr).Debug("Host found")
+				return !excluded.IP(addr)
+			}
+			logger.
+				WithField("interface", nic.Name).
+				WithField("subnet", ipnet).
+				Info("Pinging IPv6 all-nodes group")
+			if err := ping.PingAllNodes6(nic.Name, source, 1000*time.Millisecond, onRecv); err != nil {
+				logger.
+					WithField("interface", nic.Name).
+					WithError(err).
+					Warn("error while pinging IPv6 link")
+				continue
+			}
+			logger.WithField("subnet", ipnet).WithField("hosts", found).Info("IPv6 neighbors found")
+		}
+	}
+}
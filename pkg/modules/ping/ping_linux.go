@@ -10,6 +10,7 @@ import (
 
 	"golang.org/x/net/icmp"
 	"golang.org/x/net/ipv4"
+	"golang.org/x/net/ipv6"
 )
 
 // PingSubnet4 pings all provided IPs using a single ICMP socket.
@@ -54,6 +55,7 @@ func PingSubnet4(targets []net.IP, source net.IP, timeout time.Duration, onRecv
 	pid := os.Getpid() & 0xffff
 
 	// Send all pings
+	sent, failed := 0, 0
 	for _, target := range targets {
 		if target[len(target)-1] == 0xff {
 			continue // skip broadcast
@@ -81,7 +83,11 @@ func PingSubnet4(targets []net.IP, source net.IP, timeout time.Duration, onRecv
 			continue
 		}
 
-		_, _ = conn.WriteTo(msgBytes, dest)
+		sent++
+		if _, err := conn.WriteTo(msgBytes, dest); err != nil {
+			// the socket buffer is likely full
+			failed++
+		}
 	}
 
 	// Set read deadline for the entire receive phase
@@ -143,6 +149,9 @@ func PingSubnet4(targets []net.IP, source net.IP, timeout time.Duration, onRecv
 		}
 	}
 
+	if failed > 0 {
+		return fmt.Errorf("%w: %d/%d echo requests", ErrPartialSend, failed, sent)
+	}
 	return nil
 }
 
@@ -151,3 +160,109 @@ func PingSubnet4(targets []net.IP, source net.IP, timeout time.Duration, onRecv
 func Ping4(target net.IP, source net.IP, timeout time.Duration, onRecv func(net.IP)) error {
 	return PingSubnet4([]net.IP{target}, source, timeout, onRecv)
 }
+
+// PingAllNodes6 sends an ICMPv6 echo request to the all-nodes multicast
+// group (ff02::1) of the given interface and calls onRecv for every
+// neighbor that replies before the timeout. Replies come from an address
+// chosen according to the source, so a global source gathers global
+// addresses. Every responder for which onRecv returns true is then
+// pinged back in unicast so that the kernel resolves (and caches) its
+// link-layer address.
+func PingAllNodes6(iface string, source net.IP, timeout time.Duration, onRecv func(net.IP) bool) error {
+	src := "::"
+	if source != nil {
+		src = source.String()
+	}
+	if source == nil || source.IsLinkLocalUnicast() {
+		src += "%" + iface
+	}
+
+	// Try privileged mode first (most reliable)
+	protocol := "ip6:ipv6-icmp"
+	conn, err := icmp.ListenPacket(protocol, src)
+	if err != nil {
+		// Fall back to unprivileged (the kernel sets the echo ID)
+		protocol = "udp6"
+		conn, err = icmp.ListenPacket(protocol, src)
+		if err != nil {
+			return fmt.Errorf("cannot create ICMPv6 socket: %w", err)
+		}
+	}
+	defer conn.Close()
+
+	pid := os.Getpid() & 0xffff
+	msg := icmp.Message{
+		Type: ipv6.ICMPTypeEchoRequest,
+		Code: 0,
+		Body: &icmp.Echo{
+			ID:   pid,
+			Seq:  1,
+			Data: []byte("situation"),
+		},
+	}
+	// the checksum is computed by the kernel
+	msgBytes, err := msg.Marshal(nil)
+	if err != nil {
+		return err
+	}
+
+	send := func(ip net.IP, zone string) error {
+		var dest net.Addr
+		if protocol == "ip6:ipv6-icmp" {
+			dest = &net.IPAddr{IP: ip, Zone: zone}
+		} else {
+			dest = &net.UDPAddr{IP: ip, Zone: zone}
+		}
+		_, err := conn.WriteTo(msgBytes, dest)
+		return err
+	}
+
+	if err := send(net.IPv6linklocalallnodes, iface); err != nil {
+		return fmt.Errorf("cannot reach the all-nodes group on %s: %w", iface, err)
+	}
+
+	if err := conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return err
+	}
+
+	seen := make(map[string]bool)
+	reply := make([]byte, 1500)
+	for {
+		n, peer, err := conn.ReadFrom(reply)
+		if err != nil {
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				break // timeout, we're done
+			}
+			return err
+		}
+
+		var srcIP net.IP
+		var zone string
+		switch p := peer.(type) {
+		case *net.IPAddr:
+			srcIP, zone = p.IP, p.Zone
+		case *net.UDPAddr:
+			srcIP, zone = p.IP, p.Zone
+		}
+		if srcIP == nil || srcIP.To4() != nil || seen[srcIP.String()] {
+			continue
+		}
+
+		rm, err := icmp.ParseMessage(ipv6.ICMPTypeEchoReply.Protocol(), reply[:n])
+		if err != nil || rm.Type != ipv6.ICMPTypeEchoReply {
+			continue
+		}
+		echo, ok := rm.Body.(*icmp.Echo)
+		if !ok || echo.Seq != 1 || (protocol == "ip6:ipv6-icmp" && echo.ID != pid) {
+			continue
+		}
+
+		seen[srcIP.String()] = true
+		if onRecv(srcIP) {
+			// the reply to this one is ignored (already seen)
+			_ = send(srcIP, zone)
+		}
+	}
+
+	return nil
+}
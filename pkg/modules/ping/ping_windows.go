@@ -258,3 +258,10 @@ func PingSubnet4(targets []net.IP, source net.IP, timeout time.Duration, onRecv
 	wg.Wait()
 	return nil
 }
+
+// PingAllNodes6 is not implemented on Windows: the ICMP API sends
+// unicast echo requests only. The neighbors that have already talked
+// to the host remain in the neighbor cache (GetIpNetTable2).
+func PingAllNodes6(iface string, source net.IP, timeout time.Duration, onRecv func(net.IP) bool) error {
+	return fmt.Errorf("ICMPv6 all-nodes ping is not supported on windows")
+}
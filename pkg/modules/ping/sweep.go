@@ -0,0 +1,115 @@
+package ping
+
+import (
+	"errors"
+	"net"
+
+	"github.com/situation-sh/situation/pkg/utils"
+)
+
+// ErrPartialSend is returned when some echo requests could not be
+// sent (the batch is too large for the socket buffer)
+var ErrPartialSend = errors.New("some echo requests could not be sent")
+
+// DefaultSweepWindow is the number of addresses probed on each side of
+// an anchor (known host or gateway)
+const DefaultSweepWindow = 16
+
+// Sweep plans the discovery of an IPv4 network too large to be pinged
+// in a single run. Every run first probes the addresses close to the
+// anchors (the gateway, the known hosts) and the priority ranges (DHCP
+// ranges typically), then continues a sequential sweep of the network
+// from a cursor, so that the whole network is covered over several runs.
+type Sweep struct {
+	Network *net.IPNet
+	// Anchors are the addresses around which hosts are likely to be
+	// found, by order of priority
+	Anchors []net.IP
+	// Ranges are probed entirely (first and last addresses)
+	Ranges [][2]net.IP
+	// Window is the number of addresses probed on each side of the
+	// anchors (DefaultSweepWindow if not positive)
+	Window int
+}
+
+// Size returns the number of addresses in the network
+func (sw *Sweep) Size() uint64 {
+	ones, bits := sw.Network.Mask.Size()
+	return uint64(1) << (bits - ones)
+}
+
+// Targets returns at most max addresses to probe. The priority addresses
+// take at most half of them, the sequential sweep resumes at position
+// (an index within the network) and returns the position to resume from
+// at the next run. wrapped is true when the sweep has gone through the
+// end of the network.
+func (sw *Sweep) Targets(position uint64, max int) (targets []net.IP, next uint64, wrapped bool) {
+	targets = make([]net.IP, 0)
+	size := sw.Size()
+	if sw.Network.IP.To4() == nil || size < 4 || max <= 0 {
+		return targets, position, false
+	}
+	base := utils.IPv4ToUint32(sw.Network.IP.Mask(sw.Network.Mask))
+	// the network and broadcast addresses are not probed
+	first, last := uint64(1), size-2
+
+	picked := make(map[uint64]bool)
+	pick := func(index uint64) bool {
+		if index < first || index > last || picked[index] {
+			return false
+		}
+		picked[index] = true
+		targets = append(targets, utils.Uint32ToIPv4(base+uint32(index)))
+		return true
+	}
+	indexOf := func(ip net.IP) (uint64, bool) {
+		if !sw.Network.Contains(ip) || ip.To4() == nil {
+			return 0, false
+		}
+		return uint64(utils.IPv4ToUint32(ip) - base), true
+	}
+
+	window := sw.Window
+	if window <= 0 {
+		window = DefaultSweepWindow
+	}
+	budget := max / 2
+	for _, anchor := range sw.Anchors {
+		center, ok := indexOf(anchor)
+		if !ok {
+			continue
+		}
+		// the closest addresses first
+		for d := 1; d <= window && len(targets) < budget; d++ {
+			pick(center + uint64(d))
+			if center >= uint64(d) {
+				pick(center - uint64(d))
+			}
+		}
+	}
+	for _, r := range sw.Ranges {
+		start, ok1 := indexOf(r[0])
+		end, ok2 := indexOf(r[1])
+		if !ok1 || !ok2 {
+			continue
+		}
+		for i := start; i <= end && len(targets) < budget; i++ {
+			pick(i)
+		}
+	}
+
+	// sequential sweep
+	next = position
+	if next < first || next > last {
+		next = first
+	}
+	for visited := uint64(0); visited < last && len(targets) < max; visited++ {
+		pick(next)
+		next++
+		if next > last {
+			next = first
+			wrapped = true
+		}
+	}
+	return targets, next, wrapped
+}
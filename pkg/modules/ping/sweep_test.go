@@ -0,0 +1,50 @@
+package ping
+
+import (
+	"net"
+	"testing"
+)
+
+func TestSweepTargets(t *testing.T) {
+	_, network, _ := net.ParseCIDR("10.1.0.0/16")
+	sw := Sweep{
+		Network: network,
+		Anchors: []net.IP{net.ParseIP("10.1.0.1"), net.ParseIP("172.16.0.1")},
+		Ranges:  [][2]net.IP{{net.ParseIP("10.1.200.10"), net.ParseIP("10.1.200.12")}},
+		Window:  2,
+	}
+	if sw.Size() != 65536 {
+		t.Fatalf("bad size: %d", sw.Size())
+	}
+
+	targets, next, wrapped := sw.Targets(0, 100)
+	if len(targets) != 100 || wrapped {
+		t.Fatalf("expected 100 targets, got %d (wrapped: %v)", len(targets), wrapped)
+	}
+	// neighbours of the gateway (10.1.0.0 is the network address),
+	// then the range and the sequential sweep (skipping what has
+	// already been picked)
+	expected := []string{"10.1.0.2", "10.1.0.3", "10.1.200.10", "10.1.200.11", "10.1.200.12", "10.1.0.1", "10.1.0.4"}
+	for i, e := range expected {
+		if targets[i].String() != e {
+			t.Errorf("target %d: expected %s, got %s", i, e, targets[i])
+		}
+	}
+	if next != 98 {
+		t.Errorf("expected next position 98, got %d", next)
+	}
+
+	// the end of the network
+	targets, next, wrapped = sw.Targets(65530, 10)
+	if !wrapped || next != 1 || targets[len(targets)-1].String() != "10.1.255.254" {
+		t.Errorf("unexpected wrap: next=%d wrapped=%v targets=%v", next, wrapped, targets)
+	}
+
+	// a whole (small) network is probed once at most
+	_, small, _ := net.ParseCIDR("192.168.0.0/29")
+	sw = Sweep{Network: small}
+	targets, _, wrapped = sw.Targets(3, 100)
+	if len(targets) != 6 || !wrapped || targets[0].String() != "192.168.0.3" {
+		t.Errorf("unexpected targets: %v (wrapped: %v)", targets, wrapped)
+	}
+}
@@ -0,0 +1,75 @@
+package ping
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// DefaultTCPPorts are the ports probed to find the hosts that drop
+// ICMP (ssh, http, msrpc, https, smb and rdp)
+var DefaultTCPPorts = []uint16{22, 80, 135, 443, 445, 3389}
+
+// PingTCP tries TCP connections to the given ports of every target and
+// calls onRecv for every target that answers on one port at least,
+// either with a SYN-ACK (open port) or a RST (closed port). The other
+// ports of a target are not probed once it has answered. At most
+// concurrency targets are probed at the same time.
+func PingTCP(ctx context.Context, targets []net.IP, ports []uint16, timeout time.Duration, concurrency int, onRecv func(net.IP)) {
+	sem := make(chan struct{}, max(concurrency, 1))
+	var wg sync.WaitGroup
+	for _, target := range targets {
+		select {
+		case <-ctx.Done():
+		case sem <- struct{}{}:
+			wg.Add(1)
+			go func(ip net.IP) {
+				defer wg.Done()
+				defer func() { <-sem }()
+				if tcpAlive(ctx, ip, ports, timeout) {
+					onRecv(ip)
+				}
+			}(target)
+			continue
+		}
+		break
+	}
+	wg.Wait()
+}
+
+// tcpAlive probes the ports concurrently and returns as soon as one
+// of them answers
+func tcpAlive(ctx context.Context, ip net.IP, ports []uint16, timeout time.Duration) bool {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	alive := make(chan bool, len(ports))
+	dialer := net.Dialer{Timeout: timeout}
+	for _, port := range ports {
+		go func(port uint16) {
+			address := net.JoinHostPort(ip.String(), fmt.Sprint(port))
+			conn, err := dialer.DialContext(ctx, "tcp", address)
+			if err == nil {
+				conn.Close()
+			}
+			alive <- err == nil || isRefused(err)
+		}(port)
+	}
+	for range ports {
+		if <-alive {
+			return true
+		}
+	}
+	return false
+}
+
+// isRefused returns whether the connection has been reset by the
+// remote host (the errno differs on windows, hence the message check)
+func isRefused(err error) bool {
+	return errors.Is(err, syscall.ECONNREFUSED) || strings.Contains(err.Error(), "refused")
+}
@@ -0,0 +1,55 @@
+package ping
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPingTCP(t *testing.T) {
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	open := uint16(listener.Addr().(*net.TCPAddr).Port)
+
+	// a port that has just been released is closed
+	closing, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed := uint16(closing.Addr().(*net.TCPAddr).Port)
+	closing.Close()
+	defer listener.Close()
+
+	ping := func(ports ...uint16) []net.IP {
+		var mutex sync.Mutex
+		found := make([]net.IP, 0)
+		PingTCP(context.Background(), []net.IP{net.ParseIP("127.0.0.1")}, ports, 500*time.Millisecond, 4, func(ip net.IP) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			found = append(found, ip)
+		})
+		return found
+	}
+
+	if found := ping(open); len(found) != 1 {
+		t.Errorf("expected the host to be found through an open port, got %v", found)
+	}
+	if found := ping(closed); len(found) != 1 {
+		t.Errorf("expected the host to be found through a closed port, got %v", found)
+	}
+	if found := ping(); len(found) != 0 {
+		t.Errorf("expected no host without ports, got %v", found)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	called := false
+	PingTCP(ctx, []net.IP{net.ParseIP("127.0.0.1")}, []uint16{open}, time.Second, 1, func(net.IP) { called = true })
+	if called {
+		t.Error("expected no probe once the context is done")
+	}
+}
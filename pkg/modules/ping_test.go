@@ -0,0 +1,47 @@
+package modules
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/situation-sh/situation/pkg/modules/ping"
+)
+
+func TestPingPace(t *testing.T) {
+	m := &PingModule{Rate: 100, Timeout: 500 * time.Millisecond}
+	if pace := m.pace(50); pace != 500*time.Millisecond {
+		t.Errorf("expected 500ms for 50 probes at 100/s, got %s", pace)
+	}
+	if pace := (&PingModule{}).pace(50); pace != 0 {
+		t.Errorf("expected no pacing without rate, got %s", pace)
+	}
+
+	// 127.0.0.1 has replied to ICMP, 127.0.0.2 is silent
+	targets := []net.IP{net.ParseIP("127.0.0.1"), net.ParseIP("127.0.0.2")}
+	found := []string{"127.0.0.1"}
+	ctx := context.Background()
+	logger := logrus.New()
+
+	alive, connects := m.fallback(ctx, targets, found, logger)
+	if alive != nil || connects != 0 {
+		t.Errorf("expected no connection when the fallback is disabled, got %v (%d)", alive, connects)
+	}
+
+	m.TCPFallback = true
+	alive, connects = m.fallback(ctx, targets, found, logger)
+	// the loopback accepts or resets the connections
+	if len(alive) != 1 || alive[0] != "127.0.0.2" {
+		t.Errorf("expected the silent target to be found, got %v", alive)
+	}
+	if connects != len(ping.DefaultTCPPorts) {
+		t.Errorf("expected %d connections, got %d", len(ping.DefaultTCPPorts), connects)
+	}
+	// the batch of 2 echo requests is paced with the connections
+	expected := time.Duration(2+len(ping.DefaultTCPPorts)) * time.Second / 100
+	if pace := m.pace(len(targets) + connects); pace != expected {
+		t.Errorf("expected %s, got %s", expected, pace)
+	}
+}
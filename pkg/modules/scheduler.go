@@ -15,6 +15,19 @@ type Scheduler struct {
 	ignoreMissingDeps bool
 	supervisor        SchedulerSupervisor
 	failfast          bool
+	progress          func(Progress)
+}
+
+// Progress describes the state of the run when
+// a module starts or finishes
+type Progress struct {
+	Module string `json:"module"`
+	// position of the module in the run (starting from 1)
+	Index int  `json:"index"`
+	Total int  `json:"total"`
+	Done  bool `json:"done"`
+	// error returned by the module (when done)
+	Err error `json:"-"`
 }
 
 type SchedulerSupervisor interface {
@@ -52,6 +65,14 @@ func WithSupervisor(supervisor SchedulerSupervisor) SchedulerOptions {
 	}
 }
 
+// WithProgress calls f when a module starts and when it finishes.
+// f is called from the goroutine that runs the scheduler.
+func WithProgress(f func(Progress)) SchedulerOptions {
+	return func(s *Scheduler) {
+		s.progress = f
+	}
+}
+
 func FailFast() SchedulerOptions {
 	return func(s *Scheduler) {
 		s.failfast = true
@@ -66,6 +87,7 @@ func NewScheduler(modules []Module, options ...SchedulerOptions) *Scheduler {
 		ignoreMissingDeps: false,
 		supervisor:        &DummySchedulerSupervisor{},
 		failfast:          false,
+		progress:          func(Progress) {},
 	}
 	for _, m := range modules {
 		s.modules[m.Name()] = m
@@ -199,12 +221,17 @@ func (s *Scheduler) Run(ctx context.Context) error {
 	// set all the module status to nil
 	resetStatus()
 
-	for _, t := range tasks {
+	for i, t := range tasks {
 		span := s.supervisor.StartChild(t.Name())
+		progress := Progress{Module: t.Name(), Index: i + 1, Total: len(tasks)}
+		s.progress(progress)
 		// run the module
 		s.logger.Infof("Running module %s", t.Name())
 
 		err := t.Run(ctx)
+		progress.Done = true
+		progress.Err = err
+		s.progress(progress)
 		if err != nil {
 			if s.failfast {
 				return err
@@ -215,7 +242,7 @@ func (s *Scheduler) Run(ctx context.Context) error {
 				Error("Module failed")
 		}
 		span.SetStatus(err)
-		// moduleStatus[t.Name()] = t.Run(ctx)
+		moduleStatus[t.Name()] = err
 		span.Finish()
 	}
 
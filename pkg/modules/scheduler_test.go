@@ -2,7 +2,11 @@ package modules
 
 import (
 	"context"
+	"errors"
+	"io"
 	"testing"
+
+	"github.com/sirupsen/logrus"
 )
 
 // func TestNewScheduler(t *testing.T) {
@@ -43,3 +47,47 @@ func TestSingleRun(t *testing.T) {
 		t.Error(err)
 	}
 }
+
+// fakeModule is a module that only returns err
+type fakeModule struct {
+	name string
+	deps []string
+	err  error
+}
+
+func (m *fakeModule) Name() string                  { return m.name }
+func (m *fakeModule) Dependencies() []string        { return m.deps }
+func (m *fakeModule) Run(ctx context.Context) error { return m.err }
+
+func TestProgress(t *testing.T) {
+	errFake := errors.New("fake error")
+	events := make([]Progress, 0)
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	s := NewScheduler(
+		[]Module{
+			&fakeModule{name: "second", deps: []string{"first"}, err: errFake},
+			&fakeModule{name: "first"},
+		},
+		WithLogger(logger),
+		WithProgress(func(p Progress) { events = append(events, p) }),
+	)
+	if err := s.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Progress{
+		{Module: "first", Index: 1, Total: 2},
+		{Module: "first", Index: 1, Total: 2, Done: true},
+		{Module: "second", Index: 2, Total: 2},
+		{Module: "second", Index: 2, Total: 2, Done: true, Err: errFake},
+	}
+	if len(events) != len(expected) {
+		t.Fatalf("expected %d events, got %d", len(expected), len(events))
+	}
+	for i, e := range events {
+		if e != expected[i] {
+			t.Errorf("event %d: expected %+v, got %+v", i, expected[i], e)
+		}
+	}
+}
@@ -0,0 +1,259 @@
+package modules
+
+import (
+	"context"
+	"net"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/asiffer/puzzle"
+	"github.com/sirupsen/logrus"
+	"github.com/situation-sh/situation/pkg/models"
+	"github.com/situation-sh/situation/pkg/store"
+	"github.com/situation-sh/situation/pkg/utils"
+)
+
+// scope is shared by all the modules
+var scope = &Scope{Targets: []string{}, Exclude: []string{}}
+
+// GetScope returns the scope of the modules that probe other hosts
+func GetScope() *Scope {
+	return scope
+}
+
+// Scope restricts the modules that send packets to other hosts (ping,
+// tcp-scan, udp-scan, snmp, tls, ja4, service-probe, http and ssdp).
+// The targets (networks in CIDR notation or address ranges) are probed
+// in addition to the networks of the host, while the excluded hosts
+// (networks, address ranges, MAC addresses or hostnames) are never
+// probed.
+type Scope struct {
+	Targets []string
+	Exclude []string
+}
+
+func (sc *Scope) Bind(config *puzzle.Config) error {
+	if err := puzzle.DefineVar(config, "scope.targets", &sc.Targets,
+		puzzle.WithDescription("Extra networks (CIDR) or address ranges to probe (e.g. 10.8.0.0/16 or 10.9.0.10-10.9.0.50)"),
+		puzzle.WithFlagName("scope-targets")); err != nil {
+		return err
+	}
+	return puzzle.DefineVar(config, "scope.exclude", &sc.Exclude,
+		puzzle.WithDescription("Networks, address ranges, MAC addresses or hostnames (* wildcards allowed) that must never be probed"),
+		puzzle.WithFlagName("scope-exclude"))
+}
+
+// scopeTarget is a parsed target. Network is nil when the target is a
+// range of addresses.
+type scopeTarget struct {
+	First   net.IP
+	Last    net.IP
+	Network *net.IPNet
+}
+
+// targets parses the targets (invalid ones are skipped)
+func (sc *Scope) targets(logger logrus.FieldLogger) []scopeTarget {
+	out := make([]scopeTarget, 0, len(sc.Targets))
+	for _, t := range sc.Targets {
+		first, last, err := utils.ParseIPRange(t)
+		if err != nil {
+			logger.WithField("target", t).WithError(err).Warn("Ignoring target")
+			continue
+		}
+		target := scopeTarget{First: first, Last: last}
+		if _, ipnet, err := net.ParseCIDR(strings.TrimSpace(t)); err == nil {
+			target.Network = ipnet
+		}
+		out = append(out, target)
+	}
+	return out
+}
+
+// targetRanges returns the first and last addresses of the targets
+func (sc *Scope) targetRanges(logger logrus.FieldLogger) [][2]net.IP {
+	targets := sc.targets(logger)
+	out := make([][2]net.IP, len(targets))
+	for i, t := range targets {
+		out[i] = [2]net.IP{t.First, t.Last}
+	}
+	return out
+}
+
+// Exclusions is the exclusion list of the scope, resolved for a run
+type Exclusions struct {
+	ranges    [][2]net.IP
+	macs      map[string]bool
+	hostnames []string
+	// addresses and machines resolved from the MAC addresses and
+	// the hostnames
+	ips      map[string]bool
+	machines map[int64]bool
+}
+
+// exclusions parses the exclusion list. The MAC addresses and the
+// hostnames are resolved to the addresses already known by the storage
+// (and to the DNS for the hostnames).
+func (sc *Scope) exclusions(ctx context.Context, s *store.BunStorage, logger logrus.FieldLogger) *Exclusions {
+	e := &Exclusions{
+		ranges:    make([][2]net.IP, 0),
+		macs:      make(map[string]bool),
+		hostnames: make([]string, 0),
+		ips:       make(map[string]bool),
+		machines:  make(map[int64]bool),
+	}
+	for _, raw := range sc.Exclude {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		if first, last, err := utils.ParseIPRange(raw); err == nil {
+			e.ranges = append(e.ranges, [2]net.IP{first, last})
+		} else if mac, err := net.ParseMAC(raw); err == nil {
+			e.macs[mac.String()] = true
+		} else {
+			e.hostnames = append(e.hostnames, strings.ToLower(raw))
+		}
+	}
+
+	for mac := range e.macs {
+		for _, nic := range s.GetNICsByMAC(ctx, mac) {
+			e.addNIC(nic)
+		}
+	}
+	for _, hostname := range e.hostnames {
+		// ListMachines does a substring match without wildcard
+		machines, err := s.ListMachines(ctx, store.MachineFilter{Hostname: hostname, Limit: 10000})
+		if err != nil {
+			logger.WithField("hostname", hostname).WithError(err).Warn("Cannot resolve excluded hostname")
+		}
+		for _, machine := range machines {
+			if !matchHostname(hostname, machine.Hostname) {
+				continue
+			}
+			e.machines[machine.ID] = true
+			for _, nic := range machine.NICS {
+				e.addNIC(nic)
+			}
+		}
+		if !strings.Contains(hostname, "*") {
+			lookupCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+			addrs, _ := net.DefaultResolver.LookupHost(lookupCtx, hostname)
+			cancel()
+			for _, addr := range addrs {
+				if ip := net.ParseIP(addr); ip != nil {
+					e.ips[ip.String()] = true
+				}
+			}
+		}
+	}
+	return e
+}
+
+// matchHostname returns whether the hostname matches the (lowercase)
+// pattern, where * matches any sequence of characters
+func matchHostname(pattern string, hostname string) bool {
+	if hostname == "" {
+		return false
+	}
+	ok, _ := path.Match(pattern, strings.ToLower(hostname))
+	return ok
+}
+
+func (e *Exclusions) addNIC(nic *models.NetworkInterface) {
+	for _, ip := range nic.IPs() {
+		e.ips[ip.String()] = true
+	}
+}
+
+// IP returns whether the address must not be probed
+func (e *Exclusions) IP(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	if e.ips[ip.String()] {
+		return true
+	}
+	for _, r := range e.ranges {
+		if utils.IPInRange(ip, r[0], r[1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// Addr is like IP for an address in text form
+func (e *Exclusions) Addr(addr string) bool {
+	return e.IP(net.ParseIP(addr))
+}
+
+// NIC returns whether the network interface must not be probed (any
+// of its addresses, its MAC or its machine is excluded)
+func (e *Exclusions) NIC(nic *models.NetworkInterface) bool {
+	if e.macs[strings.ToLower(nic.MAC)] || e.machines[nic.MachineID] {
+		return true
+	}
+	if nic.Machine != nil {
+		for _, pattern := range e.hostnames {
+			if matchHostname(pattern, nic.Machine.Hostname) {
+				return true
+			}
+		}
+	}
+	for _, ip := range nic.IPs() {
+		if e.IP(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// FilterIPs removes the excluded addresses
+func (e *Exclusions) FilterIPs(ips []net.IP) []net.IP {
+	out := make([]net.IP, 0, len(ips))
+	for _, ip := range ips {
+		if !e.IP(ip) {
+			out = append(out, ip)
+		}
+	}
+	return out
+}
+
+// FilterEndpoints removes the endpoints listening on an excluded address
+func (e *Exclusions) FilterEndpoints(endpoints []*models.ApplicationEndpoint) []*models.ApplicationEndpoint {
+	out := make([]*models.ApplicationEndpoint, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		if !e.Addr(endpoint.Addr) {
+			out = append(out, endpoint)
+		}
+	}
+	return out
+}
+
+// scanNICs returns the network interfaces to probe: the neighbors of
+// the host and the interfaces within the targets of the scope, except
+// the excluded ones
+func scanNICs(ctx context.Context, s *store.BunStorage, excluded *Exclusions, logger logrus.FieldLogger) ([]*models.NetworkInterface, error) {
+	nics, err := s.GetNeighorNICS(ctx)
+	if err != nil {
+		return nil, err
+	}
+	others, err := s.GetNICsInRanges(ctx, scope.targetRanges(logger))
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[int64]bool)
+	out := make([]*models.NetworkInterface, 0, len(nics)+len(others))
+	for _, nic := range append(nics, others...) {
+		if seen[nic.ID] {
+			continue
+		}
+		seen[nic.ID] = true
+		if excluded.NIC(nic) {
+			logger.WithField("ip", nic.IP).WithField("mac", nic.MAC).Debug("Excluded NIC")
+			continue
+		}
+		out = append(out, nic)
+	}
+	return out, nil
+}
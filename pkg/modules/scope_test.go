@@ -0,0 +1,76 @@
+package modules
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/situation-sh/situation/pkg/models"
+)
+
+func TestScope(t *testing.T) {
+	ctx := context.Background()
+	storage := NewTestingBunStorage(t)
+	if err := storage.Migrate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	printer := &models.Machine{Hostname: "Printer-01"}
+	if _, err := storage.DB().NewInsert().Model(printer).Exec(ctx); err != nil {
+		t.Fatal(err)
+	}
+	nic := &models.NetworkInterface{MAC: "AA:BB:CC:00:00:01", IP: []string{"172.16.0.9"}, MachineID: printer.ID}
+	if _, err := storage.DB().NewInsert().Model(nic).Exec(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	sc := &Scope{
+		Targets: []string{"10.8.0.0/16", "10.9.0.10-50", "nope"},
+		Exclude: []string{"10.1.0.0/24", "10.2.0.5-10", "aa:bb:cc:dd:ee:ff", "printer-*"},
+	}
+	logger := logrus.New()
+
+	targets := sc.targets(logger)
+	if len(targets) != 2 {
+		t.Fatalf("expected 2 targets, got %v", targets)
+	}
+	if targets[0].Network == nil || targets[0].Network.String() != "10.8.0.0/16" {
+		t.Errorf("expected a network target, got %+v", targets[0])
+	}
+	if targets[1].Network != nil || targets[1].Last.String() != "10.9.0.50" {
+		t.Errorf("expected a range target, got %+v", targets[1])
+	}
+
+	excluded := sc.exclusions(ctx, storage, logger)
+	for ip, expected := range map[string]bool{
+		"10.1.0.200": true,
+		"10.2.0.7":   true,
+		"10.2.0.11":  false,
+		"172.16.0.9": true, // resolved from the hostname
+		"172.16.0.8": false,
+	} {
+		if excluded.IP(net.ParseIP(ip)) != expected {
+			t.Errorf("%s: expected excluded=%v", ip, expected)
+		}
+	}
+
+	for _, c := range []struct {
+		nic      *models.NetworkInterface
+		expected bool
+	}{
+		{&models.NetworkInterface{MAC: "AA:BB:CC:DD:EE:FF", IP: []string{"192.168.0.2"}}, true},
+		{&models.NetworkInterface{IP: []string{"192.168.0.3"}, Machine: &models.Machine{Hostname: "printer-02"}}, true},
+		{&models.NetworkInterface{IP: []string{"192.168.0.4", "10.1.0.4"}}, true},
+		{&models.NetworkInterface{MachineID: printer.ID}, true},
+		{&models.NetworkInterface{IP: []string{"192.168.0.5"}, Machine: &models.Machine{Hostname: "laptop"}}, false},
+	} {
+		if excluded.NIC(c.nic) != c.expected {
+			t.Errorf("%v: expected excluded=%v", c.nic.IP, c.expected)
+		}
+	}
+
+	endpoints := excluded.FilterEndpoints([]*models.ApplicationEndpoint{{Addr: "10.1.0.1"}, {Addr: "10.3.0.1"}})
+	if len(endpoints) != 1 || endpoints[0].Addr != "10.3.0.1" {
+		t.Errorf("unexpected endpoints: %v", endpoints)
+	}
+}
@@ -0,0 +1,249 @@
+// LINUX(ServiceProbeModule) ok
+// WINDOWS(ServiceProbeModule) ok
+// MACOS(ServiceProbeModule) ?
+// ROOT(ServiceProbeModule) no
+package modules
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/asiffer/puzzle"
+	"github.com/situation-sh/situation/pkg/models"
+	"github.com/situation-sh/situation/pkg/modules/serviceprobe"
+	"github.com/situation-sh/situation/pkg/store"
+)
+
+func init() {
+	registerModule(&ServiceProbeModule{
+		Timeout:    2 * time.Second,
+		MaxSockets: 64,
+	})
+}
+
+// ServiceProbeModule identifies the applications behind the remote TCP
+// endpoints.
+//
+// The module only uses the Go standard library.
+//
+// It connects to the TCP endpoints found on other machines (the ones
+// that are not attached to an application yet) and reads the banner
+// the service sends on connection (SSH, SMTP, FTP, POP3, IMAP, MySQL).
+// When the service remains silent, it elicits a response with a
+// request of its protocol: HTTP `GET /` (the `Server` header is read),
+// Redis `INFO server` and PostgreSQL `SSLRequest`.
+//
+// The response is matched against a rule set that gives the
+// application protocol, the product name, its version and its CPE. An
+// application is then created on the remote machine (the machine is
+// created if the host has none yet) and attached to the endpoint. When
+// only the protocol is recognized, it replaces the one guessed from the
+// port number.
+//
+// TLS services are not probed (see the [TLS module](./tls.md)) and the
+// endpoints of the excluded hosts (see `--scope-exclude`) are skipped.
+type ServiceProbeModule struct {
+	BaseModule
+	Timeout    time.Duration
+	MaxSockets int
+}
+
+func (m *ServiceProbeModule) Bind(config *puzzle.Config) error {
+	if err := setDefault(config, m, "timeout", &m.Timeout, "Time to wait for the response of a service"); err != nil {
+		return err
+	}
+	return setDefault(config, m, "max-sockets", &m.MaxSockets, "Maximum number of concurrent connections")
+}
+
+func (m *ServiceProbeModule) Name() string {
+	return "service-probe"
+}
+
+func (m *ServiceProbeModule) Dependencies() []string {
+	// reverse-lookup attaches the hostnames (and the machines) first
+	return []string{"tcp-scan", "tls", "reverse-lookup"}
+}
+
+func (m *ServiceProbeModule) Run(ctx context.Context) error {
+	logger := getLogger(ctx, m)
+	storage := getStorage(ctx)
+
+	endpoints := make([]*models.ApplicationEndpoint, 0)
+	err := storage.DB().
+		NewSelect().
+		Model(&endpoints).
+		Relation("NetworkInterface").
+		Where("application_endpoint.protocol = ?", "tcp").
+		Where("application_endpoint.application_id IS NULL").
+		Where("application_endpoint.network_interface_id IS NOT NULL").
+		Where("application_endpoint.tls IS NULL").
+		Scan(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to query remote endpoints: %w", err)
+	}
+	endpoints = scope.exclusions(ctx, storage, logger).FilterEndpoints(endpoints)
+	if len(endpoints) == 0 {
+		logger.Info("No endpoint to probe")
+		return nil
+	}
+
+	logger.WithField("endpoints", len(endpoints)).Info("Probing services")
+
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	sem := make(chan struct{}, max(m.MaxSockets, 1))
+	services := make(map[*models.ApplicationEndpoint]*serviceprobe.Service)
+	for _, endpoint := range endpoints {
+		if endpoint.NetworkInterface == nil {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return ctx.Err()
+		case sem <- struct{}{}:
+		}
+		wg.Add(1)
+		go func(e *models.ApplicationEndpoint) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			addr := net.JoinHostPort(e.Addr, strconv.Itoa(int(e.Port)))
+			s, err := serviceprobe.Identify(ctx, addr, e.Port, m.Timeout)
+			if err != nil || s == nil {
+				logger.WithError(err).
+					WithField("addr", addr).
+					Debug("Unknown service")
+				return
+			}
+			logger.WithField("addr", addr).
+				WithField("proto", s.Protocol).
+				WithField("name", s.Name).
+				WithField("version", s.Version).
+				Debug("Service identified")
+			mutex.Lock()
+			defer mutex.Unlock()
+			services[e] = s
+		}(endpoint)
+	}
+	wg.Wait()
+
+	if len(services) == 0 {
+		logger.Info("No service identified")
+		return nil
+	}
+
+	// the hosts found by ping, arp or tcp-scan may have no machine yet
+	identified := make([]*models.ApplicationEndpoint, 0, len(services))
+	for endpoint := range services {
+		identified = append(identified, endpoint)
+	}
+	if err := attachOrphanNICs(ctx, storage, identified); err != nil {
+		return fmt.Errorf("failed to attach machines: %w", err)
+	}
+
+	// an application per product and machine
+	apps := make([]*models.Application, 0)
+	appOf := make(map[string]*models.Application)
+	for endpoint, s := range services {
+		if s.Name == "" {
+			continue
+		}
+		machineID := endpoint.NetworkInterface.MachineID
+		key := fmt.Sprintf("%d/%s", machineID, s.Name)
+		if _, exists := appOf[key]; !exists {
+			app := &models.Application{
+				Name:      s.Name,
+				Version:   s.Version,
+				Protocol:  s.Protocol,
+				CPE:       s.CPE,
+				MachineID: machineID,
+			}
+			appOf[key] = app
+			apps = append(apps, app)
+		}
+	}
+	if len(apps) > 0 {
+		err = storage.DB().NewInsert().Model(&apps).
+			On("CONFLICT (machine_id, name, pid) DO UPDATE").
+			Set("version = EXCLUDED.version").
+			Set("protocol = EXCLUDED.protocol").
+			Set("cpe = EXCLUDED.cpe").
+			Set("updated_at = CURRENT_TIMESTAMP").
+			Scan(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to insert applications: %w", err)
+		}
+	}
+
+	toUpdate := make([]*models.ApplicationEndpoint, 0, len(services))
+	for endpoint, s := range services {
+		if app, exists := appOf[fmt.Sprintf("%d/%s", endpoint.NetworkInterface.MachineID, s.Name)]; exists {
+			endpoint.ApplicationID = app.ID
+		}
+		endpoint.ApplicationProtocols = []string{s.Protocol}
+		toUpdate = append(toUpdate, endpoint)
+	}
+	_, err = storage.DB().
+		NewUpdate().
+		Model(&toUpdate).
+		Column("application_id", "application_protocols").
+		Bulk().
+		Exec(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to update endpoints: %w", err)
+	}
+
+	logger.WithField("endpoints", len(toUpdate)).
+		WithField("applications", len(apps)).
+		Info("Services identified")
+	return nil
+}
+
+// attachOrphanNICs creates a machine for every network interface of
+// the endpoints that has none
+func attachOrphanNICs(ctx context.Context, storage *store.BunStorage, endpoints []*models.ApplicationEndpoint) error {
+	machineOf := make(map[int64]*models.Machine)
+	machines := make([]*models.Machine, 0)
+	nics := make([]*models.NetworkInterface, 0)
+	for _, e := range endpoints {
+		nic := e.NetworkInterface
+		if nic.MachineID != 0 {
+			continue
+		}
+		if _, exists := machineOf[nic.ID]; !exists {
+			machine := &models.Machine{}
+			machineOf[nic.ID] = machine
+			machines = append(machines, machine)
+			nics = append(nics, nic)
+		}
+	}
+	if len(machines) == 0 {
+		return nil
+	}
+	if _, err := storage.DB().NewInsert().Model(&machines).Exec(ctx); err != nil {
+		return err
+	}
+	for _, nic := range nics {
+		nic.MachineID = machineOf[nic.ID].ID
+	}
+	_, err := storage.DB().
+		NewUpdate().
+		Model(&nics).
+		Column("machine_id").
+		Bulk().
+		Exec(ctx)
+	if err != nil {
+		return err
+	}
+	// the endpoints of a NIC do not share the same struct
+	for _, e := range endpoints {
+		if machine, exists := machineOf[e.NetworkInterface.ID]; exists {
+			e.NetworkInterface.MachineID = machine.ID
+		}
+	}
+	return nil
+}
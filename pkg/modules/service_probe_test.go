@@ -0,0 +1,131 @@
+package modules
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/situation-sh/situation/pkg/models"
+)
+
+func TestServiceProbe(t *testing.T) {
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			_, _ = conn.Write([]byte("SSH-2.0-OpenSSH_9.6p1 Ubuntu-3ubuntu13\r\n"))
+			conn.Close()
+		}
+	}()
+
+	ctx := context.Background()
+	storage := NewTestingBunStorage(t)
+	if err := storage.Migrate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	machine := &models.Machine{Hostname: "remote"}
+	if _, err := storage.DB().NewInsert().Model(machine).Exec(ctx); err != nil {
+		t.Fatal(err)
+	}
+	nic := &models.NetworkInterface{IP: []string{"127.0.0.1"}, MachineID: machine.ID}
+	if _, err := storage.DB().NewInsert().Model(nic).Exec(ctx); err != nil {
+		t.Fatal(err)
+	}
+	endpoint := &models.ApplicationEndpoint{
+		Addr:                 "127.0.0.1",
+		Port:                 uint16(listener.Addr().(*net.TCPAddr).Port),
+		Protocol:             "tcp",
+		ApplicationProtocols: []string{"unknown"},
+		NetworkInterfaceID:   nic.ID,
+	}
+	if _, err := storage.DB().NewInsert().Model(endpoint).Exec(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	m := &ServiceProbeModule{Timeout: time.Second, MaxSockets: 4}
+	if err := m.Run(SituationContext(ctx, "test", storage, logrus.New())); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := storage.DB().NewSelect().Model(endpoint).WherePK().Relation("Application").Scan(ctx); err != nil {
+		t.Fatal(err)
+	}
+	app := endpoint.Application
+	if app == nil || app.Name != "OpenSSH" || app.Version != "9.6p1" || app.MachineID != machine.ID {
+		t.Fatalf("expected an OpenSSH application on the remote machine, got %+v", app)
+	}
+	if app.CPE != "cpe:2.3:a:openbsd:openssh:9.6p1:*:*:*:*:*:*:*" {
+		t.Errorf("unexpected CPE: %s", app.CPE)
+	}
+	if len(endpoint.ApplicationProtocols) != 1 || endpoint.ApplicationProtocols[0] != "ssh" {
+		t.Errorf("expected the ssh protocol, got %v", endpoint.ApplicationProtocols)
+	}
+}
+
+func TestServiceProbeOrphanNIC(t *testing.T) {
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			_, _ = conn.Write([]byte("220 mail.example.com ESMTP Postfix (Debian/GNU)\r\n"))
+			conn.Close()
+		}
+	}()
+
+	ctx := context.Background()
+	storage := NewTestingBunStorage(t)
+	if err := storage.Migrate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// the host has only been seen by ping/arp/tcp-scan
+	nic := &models.NetworkInterface{IP: []string{"127.0.0.1"}, MAC: "00:11:22:33:44:55"}
+	if _, err := storage.DB().NewInsert().Model(nic).Exec(ctx); err != nil {
+		t.Fatal(err)
+	}
+	endpoint := &models.ApplicationEndpoint{
+		Addr:               "127.0.0.1",
+		Port:               uint16(listener.Addr().(*net.TCPAddr).Port),
+		Protocol:           "tcp",
+		NetworkInterfaceID: nic.ID,
+	}
+	if _, err := storage.DB().NewInsert().Model(endpoint).Exec(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	m := &ServiceProbeModule{Timeout: time.Second, MaxSockets: 4}
+	if err := m.Run(SituationContext(ctx, "test", storage, logrus.New())); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := storage.DB().NewSelect().Model(nic).WherePK().Scan(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if nic.MachineID == 0 {
+		t.Fatal("expected a machine to be attached to the NIC")
+	}
+	if err := storage.DB().NewSelect().Model(endpoint).WherePK().Relation("Application").Scan(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if app := endpoint.Application; app == nil || app.Name != "Postfix" || app.MachineID != nic.MachineID {
+		t.Fatalf("expected a Postfix application on the new machine, got %+v", app)
+	}
+	if len(endpoint.ApplicationProtocols) != 1 || endpoint.ApplicationProtocols[0] != "smtp" {
+		t.Errorf("expected the smtp protocol, got %v", endpoint.ApplicationProtocols)
+	}
+}
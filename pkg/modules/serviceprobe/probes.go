@@ -0,0 +1,142 @@
+// Package serviceprobe identifies the services listening on TCP
+// endpoints. It reads the banner the service sends on connection or
+// elicits a response with a request of its protocol, then matches the
+// response against a rule set.
+package serviceprobe
+
+import (
+	"context"
+	"errors"
+	"net"
+	"slices"
+	"time"
+)
+
+// Probe is a request sent to a TCP service
+type Probe struct {
+	Name string
+	// Ports are the ports where the probe is sent first
+	Ports []uint16
+	// Fallback tells whether the probe is also sent to the other ports
+	Fallback bool
+	// Payload returns the request (nil only waits for the banner)
+	Payload func(addr string) []byte
+}
+
+// Probes are the supported probes
+var Probes = []Probe{
+	// the services that talk first (SSH, SMTP, FTP, POP, IMAP, MySQL)
+	{Name: "null", Fallback: true},
+	{
+		Name:     "http",
+		Ports:    []uint16{80, 81, 591, 3000, 5000, 8000, 8008, 8080, 8081, 8088, 8888, 9000},
+		Fallback: true,
+		Payload: func(addr string) []byte {
+			return []byte("GET / HTTP/1.0\r\nHost: " + addr + "\r\nUser-Agent: situation\r\nAccept: */*\r\n\r\n")
+		},
+	},
+	{
+		Name:  "redis",
+		Ports: []uint16{6379, 6380},
+		Payload: func(string) []byte {
+			return []byte("*2\r\n$4\r\nINFO\r\n$6\r\nserver\r\n")
+		},
+	},
+	{
+		Name:  "postgresql",
+		Ports: []uint16{5432, 5433},
+		Payload: func(string) []byte {
+			// SSLRequest: length (8) and code (80877103)
+			return []byte{0x00, 0x00, 0x00, 0x08, 0x04, 0xd2, 0x16, 0x2f}
+		},
+	},
+}
+
+// ProbesFor returns the probes to send to a port: the probes dedicated
+// to this port first, then the fallback ones
+func ProbesFor(port uint16) []*Probe {
+	probes := make([]*Probe, 0, len(Probes))
+	for i := range Probes {
+		if slices.Contains(Probes[i].Ports, port) {
+			probes = append(probes, &Probes[i])
+		}
+	}
+	for i := range Probes {
+		if Probes[i].Fallback && !slices.Contains(probes, &Probes[i]) {
+			probes = append(probes, &Probes[i])
+		}
+	}
+	return probes
+}
+
+// after the first bytes, the rest of the response is awaited for
+// this duration only
+const moreTimeout = 100 * time.Millisecond
+
+// Send connects to addr, sends the probe and returns the response
+// (at most 4096 bytes) received before the timeout
+func Send(ctx context.Context, addr string, probe *Probe, timeout time.Duration) ([]byte, error) {
+	dialer := net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, err
+	}
+	if probe.Payload != nil {
+		if _, err := conn.Write(probe.Payload(addr)); err != nil {
+			return nil, err
+		}
+	}
+
+	response := make([]byte, 0, 4096)
+	buffer := make([]byte, 4096)
+	for len(response) < cap(response) {
+		n, err := conn.Read(buffer[:cap(response)-len(response)])
+		response = append(response, buffer[:n]...)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				break
+			}
+			if len(response) > 0 {
+				// the server may close the connection after its reply
+				break
+			}
+			return nil, err
+		}
+		if n > 0 {
+			if err := conn.SetReadDeadline(time.Now().Add(moreTimeout)); err != nil {
+				break
+			}
+		}
+	}
+	return response, nil
+}
+
+// Identify sends the probes of the port to addr until a rule
+// recognizes the response. It returns nil if the service remains
+// unknown.
+func Identify(ctx context.Context, addr string, port uint16, timeout time.Duration) (*Service, error) {
+	for _, probe := range ProbesFor(port) {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		response, err := Send(ctx, addr, probe, timeout)
+		if err != nil {
+			var opErr *net.OpError
+			if errors.As(err, &opErr) && opErr.Op == "dial" {
+				// the endpoint is not reachable
+				return nil, err
+			}
+			continue
+		}
+		if s := Match(probe.Name, response); s != nil {
+			return s, nil
+		}
+	}
+	return nil, nil
+}
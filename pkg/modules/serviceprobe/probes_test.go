@@ -0,0 +1,142 @@
+package serviceprobe
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestMatch(t *testing.T) {
+	cases := []struct {
+		probe    string
+		response string
+		expected Service
+	}{
+		{"null", "SSH-2.0-OpenSSH_9.6p1 Ubuntu-3ubuntu13\r\n", Service{"ssh", "OpenSSH", "9.6p1", "cpe:2.3:a:openbsd:openssh:9.6p1:*:*:*:*:*:*:*"}},
+		{"null", "SSH-2.0-Go\r\n", Service{"ssh", "Go", "", ""}},
+		{"null", "220 mail.example.com ESMTP Postfix (Debian/GNU)\r\n", Service{"smtp", "Postfix", "", "cpe:2.3:a:postfix:postfix:*:*:*:*:*:*:*:*"}},
+		{"null", "220 (vsFTPd 3.0.5)\r\n", Service{"ftp", "vsftpd", "3.0.5", "cpe:2.3:a:beasts:vsftpd:3.0.5:*:*:*:*:*:*:*"}},
+		{"null", "220 mx.example.com SMTP ready\r\n", Service{"smtp", "", "", ""}},
+		{"null", "+OK Dovecot (Ubuntu) ready.\r\n", Service{"pop3", "Dovecot", "", "cpe:2.3:a:dovecot:dovecot:*:*:*:*:*:*:*:*"}},
+		{"null", "* OK [CAPABILITY IMAP4rev1] Dovecot ready.\r\n", Service{"imap", "Dovecot", "", "cpe:2.3:a:dovecot:dovecot:*:*:*:*:*:*:*:*"}},
+		{"null", "J\x00\x00\x00\x0a8.0.36-0ubuntu0.22.04.1\x00\x08\x00\x00\x00", Service{"mysql", "MySQL", "8.0.36", "cpe:2.3:a:oracle:mysql:8.0.36:*:*:*:*:*:*:*"}},
+		{"null", "Z\x00\x00\x00\x0a5.5.5-10.11.6-MariaDB-0+deb12u1\x00", Service{"mysql", "MariaDB", "10.11.6", "cpe:2.3:a:mariadb:mariadb:10.11.6:*:*:*:*:*:*:*"}},
+		{"http", "HTTP/1.1 200 OK\r\nServer: nginx/1.24.0\r\n\r\n", Service{"http", "nginx", "1.24.0", "cpe:2.3:a:f5:nginx:1.24.0:*:*:*:*:*:*:*"}},
+		{"http", "HTTP/1.1 404 Not Found\r\nserver: Jetty(9.4.z)\r\n\r\n", Service{"http", "Jetty(9.4.z)", "", ""}},
+		{"http", "HTTP/1.0 200 OK\r\nContent-Length: 0\r\n\r\n", Service{"http", "", "", ""}},
+		{"redis", "$100\r\n# Server\r\nredis_version:7.2.4\r\nredis_mode:standalone\r\n", Service{"redis", "Redis", "7.2.4", "cpe:2.3:a:redis:redis:7.2.4:*:*:*:*:*:*:*"}},
+		{"redis", "-NOAUTH Authentication required.\r\n", Service{"redis", "Redis", "", "cpe:2.3:a:redis:redis:*:*:*:*:*:*:*:*"}},
+		{"postgresql", "N", Service{"postgresql", "PostgreSQL", "", "cpe:2.3:a:postgresql:postgresql:*:*:*:*:*:*:*:*"}},
+	}
+	for _, c := range cases {
+		s := Match(c.probe, []byte(c.response))
+		if s == nil {
+			t.Errorf("%q: no match", c.response)
+			continue
+		}
+		if *s != c.expected {
+			t.Errorf("%q: expected %+v, got %+v", c.response, c.expected, *s)
+		}
+	}
+
+	// rules only apply to the response of their probe
+	if s := Match("http", []byte("N")); s != nil {
+		t.Errorf("unexpected match: %+v", s)
+	}
+	if s := Match("null", []byte("hello")); s != nil {
+		t.Errorf("unexpected match: %+v", s)
+	}
+}
+
+func TestProbesFor(t *testing.T) {
+	names := func(port uint16) string {
+		s := ""
+		for _, p := range ProbesFor(port) {
+			s += p.Name + " "
+		}
+		return s
+	}
+	for port, expected := range map[uint16]string{
+		22:   "null http ",
+		8080: "http null ",
+		6379: "redis null http ",
+		5432: "postgresql null http ",
+	} {
+		if got := names(port); got != expected {
+			t.Errorf("%d: expected %q, got %q", port, expected, got)
+		}
+	}
+}
+
+// serve starts a local TCP service that calls handle on every
+// connection
+func serve(t *testing.T, handle func(conn net.Conn)) (string, uint16) {
+	t.Helper()
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				handle(conn)
+			}()
+		}
+	}()
+	return listener.Addr().String(), uint16(listener.Addr().(*net.TCPAddr).Port)
+}
+
+func TestIdentify(t *testing.T) {
+	ctx := context.Background()
+
+	// banner
+	addr, port := serve(t, func(conn net.Conn) {
+		_, _ = conn.Write([]byte("SSH-2.0-OpenSSH_8.9p1\r\n"))
+		time.Sleep(time.Second)
+	})
+	s, err := Identify(ctx, addr, port, time.Second)
+	if err != nil || s == nil || s.Name != "OpenSSH" || s.Version != "8.9p1" {
+		t.Errorf("expected OpenSSH 8.9p1, got %+v (%v)", s, err)
+	}
+
+	// request (after the null probe)
+	addr, port = serve(t, func(conn net.Conn) {
+		buffer := make([]byte, 1024)
+		_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, _ := conn.Read(buffer)
+		if bytes.HasPrefix(buffer[:n], []byte("GET / HTTP/1.0\r\n")) {
+			_, _ = conn.Write([]byte("HTTP/1.1 200 OK\r\nServer: Apache/2.4.58 (Ubuntu)\r\n\r\n"))
+		}
+	})
+	s, err = Identify(ctx, addr, port, 200*time.Millisecond)
+	if err != nil || s == nil || s.Protocol != "http" || s.Name != "Apache HTTP Server" || s.Version != "2.4.58" {
+		t.Errorf("expected Apache 2.4.58, got %+v (%v)", s, err)
+	}
+
+	// unknown service
+	addr, port = serve(t, func(conn net.Conn) {
+		_, _ = conn.Write([]byte("hello\n"))
+	})
+	if s, err := Identify(ctx, addr, port, 200*time.Millisecond); s != nil || err != nil {
+		t.Errorf("expected an unknown service, got %+v (%v)", s, err)
+	}
+
+	// closed port
+	listener, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closed := listener.Addr().(*net.TCPAddr)
+	listener.Close()
+	if _, err := Identify(ctx, closed.String(), uint16(closed.Port), 200*time.Millisecond); err == nil {
+		t.Error("expected an error on a closed port")
+	}
+}
@@ -0,0 +1,120 @@
+package serviceprobe
+
+import (
+	"regexp"
+
+	"github.com/situation-sh/situation/pkg/utils"
+)
+
+// Service is the application recognized behind an endpoint
+type Service struct {
+	// Protocol is the application protocol (ssh, http...)
+	Protocol string
+	// Name is the product name, it may be empty when only the protocol
+	// has been recognized
+	Name    string
+	Version string
+	CPE     string
+}
+
+// Rule recognizes the response of a service to a probe. Name and
+// Version are templates that may refer to the submatches of the
+// pattern ($1, ${2}...).
+type Rule struct {
+	Probe    string
+	Protocol string
+	Pattern  *regexp.Regexp
+	Name     string
+	Version  string
+	// Product is the vendor:product part of the CPE (no CPE if empty)
+	Product string
+}
+
+func rule(probe string, protocol string, pattern string, name string, version string, product string) Rule {
+	return Rule{
+		Probe:    probe,
+		Protocol: protocol,
+		Pattern:  regexp.MustCompile(pattern),
+		Name:     name,
+		Version:  version,
+		Product:  product,
+	}
+}
+
+// Rules are the built-in rules, the first matching rule wins so the
+// generic rules come after the product ones
+var Rules = []Rule{
+	// banners
+	rule("null", "ssh", `^SSH-[\d.]+-OpenSSH_([\w.]+)`, "OpenSSH", "$1", "openbsd:openssh"),
+	rule("null", "ssh", `^SSH-[\d.]+-dropbear_([\w.]+)`, "Dropbear SSH", "$1", "dropbear_ssh_project:dropbear_ssh"),
+	rule("null", "ssh", `^SSH-[\d.]+-([^\s_]+)(?:_([\w.]+))?`, "$1", "$2", ""),
+	rule("null", "ftp", `^220[- ].*ProFTPD ([\w.]+)`, "ProFTPD", "$1", "proftpd:proftpd"),
+	rule("null", "ftp", `^220[- ].*\(vsFTPd ([\w.]+)\)`, "vsftpd", "$1", "beasts:vsftpd"),
+	rule("null", "ftp", `^220[- ].*FileZilla Server(?: version)? ([\w.]+)`, "FileZilla Server", "$1", "filezilla-project:filezilla_server"),
+	rule("null", "ftp", `^220[- ].*Pure-FTPd`, "Pure-FTPd", "", "pureftpd:pure-ftpd"),
+	rule("null", "ftp", `^220[- ].*Microsoft FTP Service`, "Microsoft FTP Service", "", "microsoft:internet_information_services"),
+	rule("null", "smtp", `^220[- ]\S+ ESMTP Postfix`, "Postfix", "", "postfix:postfix"),
+	rule("null", "smtp", `^220[- ]\S+ ESMTP Exim ([\w.]+)`, "Exim", "$1", "exim:exim"),
+	rule("null", "smtp", `^220[- ]\S+ ESMTP Sendmail ([\w.]+)`, "Sendmail", "$1", "sendmail:sendmail"),
+	rule("null", "smtp", `^220[- ]\S+ Microsoft ESMTP MAIL Service`, "Microsoft Exchange Server", "", "microsoft:exchange_server"),
+	rule("null", "smtp", `^220[- ].*\bE?SMTP\b`, "", "", ""),
+	rule("null", "ftp", `^220[- ].*\bFTP\b`, "", "", ""),
+	rule("null", "pop3", `^\+OK.*Dovecot`, "Dovecot", "", "dovecot:dovecot"),
+	rule("null", "pop3", `^\+OK`, "", "", ""),
+	rule("null", "imap", `^\* OK.*Dovecot`, "Dovecot", "", "dovecot:dovecot"),
+	rule("null", "imap", `^\* OK.*Cyrus IMAP.*v([\d.]+)`, "Cyrus IMAP", "$1", "cmu:cyrus_imap_server"),
+	rule("null", "imap", `^\* OK`, "", "", ""),
+	// MySQL handshake: packet length (3 bytes), sequence number (0),
+	// protocol version (10) and the server version
+	rule("null", "mysql", `(?s)^.{3}\x00\x0a(?:5\.5\.5-)?([\d.]+)-MariaDB`, "MariaDB", "$1", "mariadb:mariadb"),
+	rule("null", "mysql", `(?s)^.{3}\x00\x0a(\d[\w.]*)`, "MySQL", "$1", "oracle:mysql"),
+	rule("null", "mysql", `(?s)^.{3}\x00\xff.{2}Host .* is not allowed to connect to this (MySQL|MariaDB) server`, "$1", "", ""),
+	// HTTP
+	rule("http", "http", `(?mi)^Server: nginx(?:/([\d.]+))?`, "nginx", "$1", "f5:nginx"),
+	rule("http", "http", `(?mi)^Server: Apache(?:/([\d.]+))?`, "Apache HTTP Server", "$1", "apache:http_server"),
+	rule("http", "http", `(?mi)^Server: Microsoft-IIS/([\d.]+)`, "Microsoft IIS", "$1", "microsoft:internet_information_services"),
+	rule("http", "http", `(?mi)^Server: lighttpd(?:/([\d.]+))?`, "lighttpd", "$1", "lighttpd:lighttpd"),
+	rule("http", "http", `(?mi)^Server: Caddy`, "Caddy", "", "caddyserver:caddy"),
+	rule("http", "http", `(?mi)^Server: ([^/\s]+)(?:/([\w.]+))?`, "$1", "$2", ""),
+	rule("http", "http", `^HTTP/\d(?:\.\d)? \d{3}`, "", "", ""),
+	// Redis
+	rule("redis", "redis", `(?m)^redis_version:([\w.]+)`, "Redis", "$1", "redis:redis"),
+	rule("redis", "redis", `^-(?:NOAUTH|DENIED) `, "Redis", "", "redis:redis"),
+	// PostgreSQL replies to a SSLRequest with a single byte
+	rule("postgresql", "postgresql", `^[SN]$`, "PostgreSQL", "", "postgresql:postgresql"),
+}
+
+// Match returns the service described by the response of the probe,
+// nil if no rule matches
+func Match(probe string, response []byte) *Service {
+	for i := range Rules {
+		if s := Rules[i].Match(probe, response); s != nil {
+			return s
+		}
+	}
+	return nil
+}
+
+// Match returns the service described by the response if the rule
+// matches it, nil otherwise
+func (r *Rule) Match(probe string, response []byte) *Service {
+	if r.Probe != probe {
+		return nil
+	}
+	submatches := r.Pattern.FindSubmatchIndex(response)
+	if submatches == nil {
+		return nil
+	}
+	expand := func(template string) string {
+		return string(r.Pattern.Expand(nil, []byte(template), response, submatches))
+	}
+	s := &Service{
+		Protocol: r.Protocol,
+		Name:     expand(r.Name),
+		Version:  expand(r.Version),
+	}
+	if r.Product != "" {
+		s.CPE = utils.ApplicationCPE(r.Product, s.Version)
+	}
+	return s
+}
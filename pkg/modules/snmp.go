@@ -18,6 +18,7 @@ import (
 	"github.com/situation-sh/situation/pkg/models"
 	"github.com/situation-sh/situation/pkg/modules/snmp"
 	"github.com/situation-sh/situation/pkg/store"
+	"github.com/situation-sh/situation/pkg/utils"
 
 	"github.com/sirupsen/logrus"
 )
@@ -40,6 +41,9 @@ func init() {
 // ```
 // view systemonly included .1.3.6.1.2.1
 // ```
+//
+// The neighbors and the hosts within the scope targets are queried,
+// except the excluded ones.
 type SNMPModule struct {
 	BaseModule
 	Version   uint8
@@ -81,7 +85,8 @@ func (m *SNMPModule) Run(ctx context.Context) error {
 	logger := getLogger(ctx, m)
 	storage := getStorage(ctx)
 
-	nics, err := storage.GetNeighorNICS(ctx)
+	excluded := scope.exclusions(ctx, storage, logger)
+	nics, err := scanNICs(ctx, storage, excluded, logger)
 	if err != nil {
 		return fmt.Errorf("cannot retrieve neighbor NICs: %w", err)
 	}
@@ -111,10 +116,16 @@ func (m *SNMPModule) Run(ctx context.Context) error {
 		if nic.MachineID == 0 {
 			continue
 		}
+		// the same agent answers on all the addresses of the NIC,
+		// IPv6 is only used for IPv6-only neighbors
+		ipv4 := utils.AnyIPv4(nic.IP)
 		for _, ip := range nic.IPs() {
 			if ip.IsLoopback() || ip.IsMulticast() {
 				continue
 			}
+			if ipv4 && utils.IPVersion(ip) == 6 {
+				continue
+			}
 			wg.Add(1)
 			go func(targetNIC *models.NetworkInterface, targetIP net.IP) {
 				defer wg.Done()
@@ -0,0 +1,315 @@
+// LINUX(SSDPModule) ok
+// WINDOWS(SSDPModule) ok
+// MACOS(SSDPModule) ?
+// ROOT(SSDPModule) no
+package modules
+
+import (
+	"cmp"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/asiffer/puzzle"
+	"github.com/sirupsen/logrus"
+	"github.com/situation-sh/situation/pkg/models"
+	"github.com/situation-sh/situation/pkg/modules/ssdp"
+	"github.com/situation-sh/situation/pkg/utils"
+)
+
+func init() {
+	registerModule(&SSDPModule{Timeout: 2 * time.Second})
+}
+
+// SSDPModule discovers the UPnP devices through SSDP and reads their
+// description.
+//
+// The module only uses the Go standard library (and [golang.org/x/net]
+// to send the requests on every IPv4 multicast interface).
+//
+// Smart TVs, IoT hubs, media servers and home routers answer the
+// `ssdp:all` M-SEARCH requests with the location of their device
+// description (an XML document served over HTTP). The module fetches
+// it and records the manufacturer, the model, the serial number and the
+// device type (like `MediaRenderer` or `InternetGatewayDevice`) on the
+// machine, which is created if it is unknown.
+//
+// The device gets an application (named after its friendly name, with
+// its UPnP services in its config) and the endpoints it listens on: the
+// SSDP one (udp/1900) and the HTTP ones of its description and of its
+// services.
+//
+// The responses are awaited for `timeout`, which is also the timeout of
+// the description requests. The excluded hosts (see `--scope-exclude`)
+// are skipped.
+//
+// [golang.org/x/net]: https://pkg.go.dev/golang.org/x/net/ipv4
+type SSDPModule struct {
+	BaseModule
+	Timeout time.Duration
+}
+
+func (m *SSDPModule) Bind(config *puzzle.Config) error {
+	return setDefault(config, m, "timeout", &m.Timeout, "Time to wait for the SSDP responses and timeout of the description requests")
+}
+
+func (m *SSDPModule) Name() string {
+	return "ssdp"
+}
+
+func (m *SSDPModule) Dependencies() []string {
+	return []string{"arp"}
+}
+
+// upnpDevice is a device that has answered and its description
+type upnpDevice struct {
+	response    *ssdp.Response
+	description *ssdp.Description
+}
+
+func (m *SSDPModule) Run(ctx context.Context) error {
+	logger := getLogger(ctx, m)
+	storage := getStorage(ctx)
+
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4zero})
+	if err != nil {
+		return fmt.Errorf("cannot open SSDP socket: %w", err)
+	}
+	defer conn.Close()
+
+	ifaces := multicastInterfaces()
+	if len(ifaces) == 0 {
+		logger.Warn("No multicast interface")
+		return nil
+	}
+
+	logger.WithField("interfaces", len(ifaces)).Info("Searching UPnP devices")
+	responses, err := ssdp.Search(ctx, conn, multicastSender(conn, ifaces, ssdp.Addr), ssdp.SearchAll, m.Timeout)
+	if err != nil {
+		return fmt.Errorf("failed to search UPnP devices: %w", err)
+	}
+
+	excluded := scope.exclusions(ctx, storage, logger)
+	client := &http.Client{
+		Timeout: m.Timeout,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+		// the description must be served by the device itself
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	var mutex sync.Mutex
+	devices := make([]*upnpDevice, 0)
+	pool := utils.NewWorkerPool(8, func(r *ssdp.Response) error {
+		u, err := url.Parse(r.Location)
+		if err != nil || r.Addr == nil || !net.ParseIP(u.Hostname()).Equal(r.Addr) {
+			// do not follow a device to another host
+			logger.WithField("location", r.Location).WithField("ip", r.Addr).Debug("Skipping foreign location")
+			return nil
+		}
+		if excluded.IP(r.Addr) {
+			return nil
+		}
+		description, err := ssdp.Fetch(ctx, client, r.Location)
+		if err != nil {
+			logger.WithError(err).WithField("location", r.Location).Debug("Cannot fetch device description")
+			return nil
+		}
+		mutex.Lock()
+		defer mutex.Unlock()
+		devices = append(devices, &upnpDevice{response: r, description: description})
+		return nil
+	})
+	if err := pool.Run(responses); err != nil {
+		logger.WithError(err).Debug("Errors while fetching device descriptions")
+	}
+
+	if len(devices) == 0 {
+		logger.Info("No UPnP device found")
+		return nil
+	}
+	return m.save(ctx, devices, logger)
+}
+
+// save records the devices on their machines and creates their
+// applications and endpoints
+func (m *SSDPModule) save(ctx context.Context, devices []*upnpDevice, logger logrus.FieldLogger) error {
+	storage := getStorage(ctx)
+	hostID := storage.GetHostID(ctx)
+
+	// devices of every address (a host may give several root devices)
+	hosts := make(map[string][]*upnpDevice)
+	order := make([]string, 0)
+	for _, d := range devices {
+		ip := d.response.Addr.String()
+		if _, exists := hosts[ip]; !exists {
+			order = append(order, ip)
+		}
+		hosts[ip] = append(hosts[ip], d)
+	}
+
+	apps := make([]*models.Application, 0)
+	endpoints := make([]*models.ApplicationEndpoint, 0)
+	appOfEndpoint := make(map[*models.ApplicationEndpoint]*models.Application)
+	machines := 0
+	for _, ip := range order {
+		nic, err := discoveredNIC(ctx, storage, []string{ip}, "", logger)
+		if err != nil {
+			return err
+		}
+		if nic.MachineID == hostID {
+			// the services of the host are given by netstat
+			continue
+		}
+		if nic.Machine != nil && updateDeviceInfo(nic.Machine, hosts[ip]) {
+			_, err := storage.DB().
+				NewUpdate().
+				Model(nic.Machine).
+				Column("manufacturer", "model", "serial_number", "device_type").
+				Set("updated_at = CURRENT_TIMESTAMP").
+				WherePK().
+				Exec(ctx)
+			if err != nil {
+				return fmt.Errorf("failed to update machine: %w", err)
+			}
+			machines++
+			logger.WithField("ip", ip).
+				WithField("manufacturer", nic.Machine.Manufacturer).
+				WithField("model", nic.Machine.Model).
+				WithField("device_type", nic.Machine.DeviceType).
+				Debug("UPnP device found")
+		}
+
+		for _, d := range hosts[ip] {
+			root := d.description.Device
+			app := &models.Application{
+				Name:      root.FriendlyName,
+				Version:   root.ModelNumber,
+				Protocol:  "upnp",
+				MachineID: nic.MachineID,
+				Config: map[string]any{
+					"device_type":  root.DeviceType,
+					"udn":          root.UDN,
+					"manufacturer": root.Manufacturer,
+					"model":        root.ModelName,
+					"location":     d.response.Location,
+					"server":       d.response.Server,
+					"services":     d.description.ServiceTypes(),
+				},
+			}
+			if app.Name == "" {
+				app.Name = cmp.Or(root.ModelName, ssdp.Kind(root.DeviceType), "upnp")
+			}
+			if slices.ContainsFunc(apps, func(a *models.Application) bool { return a.MachineID == app.MachineID && a.Name == app.Name }) {
+				continue
+			}
+			apps = append(apps, app)
+
+			ssdpEndpoint := &models.ApplicationEndpoint{
+				Addr:                 ip,
+				Port:                 uint16(ssdp.Addr.Port),
+				Protocol:             "udp",
+				ApplicationProtocols: []string{"ssdp"},
+				NetworkInterfaceID:   nic.ID,
+			}
+			if !slices.ContainsFunc(endpoints, func(e *models.ApplicationEndpoint) bool { return sameEndpoint(e, ssdpEndpoint) }) {
+				endpoints = append(endpoints, ssdpEndpoint)
+				appOfEndpoint[ssdpEndpoint] = app
+			}
+			for _, u := range d.description.URLs(d.response.Location) {
+				port, err := strconv.ParseUint(u.Port(), 10, 16)
+				if u.Port() == "" {
+					port, err = 80, nil
+					if u.Scheme == "https" {
+						port = 443
+					}
+				}
+				if err != nil || !net.ParseIP(u.Hostname()).Equal(d.response.Addr) {
+					continue
+				}
+				endpoint := &models.ApplicationEndpoint{
+					Addr:                 ip,
+					Port:                 uint16(port),
+					Protocol:             "tcp",
+					ApplicationProtocols: []string{u.Scheme, "upnp"},
+					NetworkInterfaceID:   nic.ID,
+				}
+				if !slices.ContainsFunc(endpoints, func(e *models.ApplicationEndpoint) bool { return sameEndpoint(e, endpoint) }) {
+					endpoints = append(endpoints, endpoint)
+					appOfEndpoint[endpoint] = app
+				}
+			}
+		}
+	}
+
+	if len(apps) > 0 {
+		err := storage.DB().NewInsert().Model(&apps).
+			On("CONFLICT (machine_id, name, pid) DO UPDATE").
+			Set("version = EXCLUDED.version").
+			Set("protocol = EXCLUDED.protocol").
+			Set("config = EXCLUDED.config").
+			Set("updated_at = CURRENT_TIMESTAMP").
+			Scan(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to insert applications: %w", err)
+		}
+	}
+	for _, endpoint := range endpoints {
+		endpoint.ApplicationID = appOfEndpoint[endpoint].ID
+	}
+	if err := saveDiscoveredEndpoints(ctx, storage, endpoints, logger); err != nil {
+		return err
+	}
+
+	logger.WithField("machines", machines).
+		WithField("applications", len(apps)).
+		WithField("endpoints", len(endpoints)).
+		Info("UPnP devices found")
+	return nil
+}
+
+// updateDeviceInfo fills the machine with the description of its root
+// devices (the first one that gives a field wins). It returns whether
+// the machine has changed.
+func updateDeviceInfo(machine *models.Machine, devices []*upnpDevice) bool {
+	manufacturer, model, serial, deviceType := "", "", "", ""
+	for _, d := range devices {
+		root := d.description.Device
+		manufacturer = cmp.Or(manufacturer, root.Manufacturer)
+		model = cmp.Or(model, root.ModelName)
+		serial = cmp.Or(serial, root.SerialNumber)
+		if root.DeviceType != "" {
+			deviceType = cmp.Or(deviceType, ssdp.Kind(root.DeviceType))
+		}
+	}
+	changed := false
+	for _, field := range []struct {
+		value *string
+		found string
+	}{
+		{&machine.Manufacturer, manufacturer},
+		{&machine.Model, model},
+		{&machine.SerialNumber, serial},
+		{&machine.DeviceType, deviceType},
+	} {
+		if field.found != "" && *field.value != field.found {
+			*field.value = field.found
+			changed = true
+		}
+	}
+	return changed
+}
+
+// sameEndpoint tells whether the endpoints have the same unique key
+func sameEndpoint(a, b *models.ApplicationEndpoint) bool {
+	return a.Addr == b.Addr && a.Port == b.Port && a.Protocol == b.Protocol && a.NetworkInterfaceID == b.NetworkInterfaceID
+}
@@ -0,0 +1,139 @@
+package ssdp
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// maxDescriptionSize is the maximum size of a device description
+const maxDescriptionSize = 1 << 20
+
+// Description is the UPnP device description given at the location of
+// a device
+type Description struct {
+	URLBase string `xml:"URLBase"`
+	Device  Device `xml:"device"`
+}
+
+// Device is a UPnP device, it may embed other devices
+type Device struct {
+	DeviceType       string    `xml:"deviceType"`
+	FriendlyName     string    `xml:"friendlyName"`
+	Manufacturer     string    `xml:"manufacturer"`
+	ModelName        string    `xml:"modelName"`
+	ModelNumber      string    `xml:"modelNumber"`
+	ModelDescription string    `xml:"modelDescription"`
+	SerialNumber     string    `xml:"serialNumber"`
+	UDN              string    `xml:"UDN"`
+	PresentationURL  string    `xml:"presentationURL"`
+	Services         []Service `xml:"serviceList>service"`
+	Devices          []Device  `xml:"deviceList>device"`
+}
+
+// Service is a service of a UPnP device
+type Service struct {
+	ServiceType string `xml:"serviceType"`
+	ServiceID   string `xml:"serviceId"`
+	SCPDURL     string `xml:"SCPDURL"`
+	ControlURL  string `xml:"controlURL"`
+	EventSubURL string `xml:"eventSubURL"`
+}
+
+// ParseDescription parses a device description
+func ParseDescription(r io.Reader) (*Description, error) {
+	d := &Description{}
+	if err := xml.NewDecoder(r).Decode(d); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// Fetch downloads the device description
+func Fetch(ctx context.Context, client *http.Client, location string) (*Description, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, location, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	return ParseDescription(io.LimitReader(resp.Body, maxDescriptionSize))
+}
+
+// Kind returns the short name of a device or service type (like
+// MediaRenderer for urn:schemas-upnp-org:device:MediaRenderer:1)
+func Kind(urn string) string {
+	parts := strings.Split(urn, ":")
+	if len(parts) == 5 && parts[0] == "urn" {
+		return parts[3]
+	}
+	return urn
+}
+
+// Walk calls fun on the device and its embedded devices
+func (d *Device) Walk(fun func(*Device)) {
+	fun(d)
+	for i := range d.Devices {
+		d.Devices[i].Walk(fun)
+	}
+}
+
+// ServiceTypes returns the service types of the device and its embedded
+// devices
+func (d *Description) ServiceTypes() []string {
+	types := make([]string, 0)
+	d.Device.Walk(func(device *Device) {
+		for _, s := range device.Services {
+			types = append(types, s.ServiceType)
+		}
+	})
+	return types
+}
+
+// URLs returns the URLs the device listens on: the location and the
+// control, event and presentation URLs of its services (one per host
+// and port)
+func (d *Description) URLs(location string) []*url.URL {
+	base, err := url.Parse(location)
+	if err != nil {
+		return nil
+	}
+	urls := []*url.URL{base}
+	if d.URLBase != "" {
+		if u, err := url.Parse(d.URLBase); err == nil {
+			base = u
+		}
+	}
+	hosts := map[string]bool{urls[0].Host: true}
+	add := func(ref string) {
+		if ref == "" {
+			return
+		}
+		u, err := base.Parse(ref)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || hosts[u.Host] {
+			return
+		}
+		hosts[u.Host] = true
+		urls = append(urls, u)
+	}
+	add(d.URLBase)
+	d.Device.Walk(func(device *Device) {
+		add(device.PresentationURL)
+		for _, s := range device.Services {
+			add(s.ControlURL)
+			add(s.EventSubURL)
+			add(s.SCPDURL)
+		}
+	})
+	return urls
+}
@@ -0,0 +1,105 @@
+// Package ssdp discovers the UPnP devices through SSDP (UDP/1900) and
+// reads their device description. The M-SEARCH requests are sent from
+// an ephemeral port, the devices reply in unicast.
+package ssdp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+// Addr is the IPv4 SSDP group
+var Addr = &net.UDPAddr{IP: net.IPv4(239, 255, 255, 250), Port: 1900}
+
+// SearchAll is the search target of all the devices and services
+const SearchAll = "ssdp:all"
+
+// Request returns a M-SEARCH request. The devices wait up to mx seconds
+// before replying (1 to 5).
+func Request(target string, mx int) []byte {
+	return fmt.Appendf(nil, "M-SEARCH * HTTP/1.1\r\n"+
+		"HOST: %s\r\n"+
+		"MAN: \"ssdp:discover\"\r\n"+
+		"MX: %d\r\n"+
+		"ST: %s\r\n\r\n", Addr, min(max(mx, 1), 5), target)
+}
+
+// Response is the reply of a device to a M-SEARCH request
+type Response struct {
+	// Addr is the address of the device
+	Addr net.IP
+	// Location is the URL of the device description
+	Location string
+	Server   string
+	// ST is the search target the reply matches (like upnp:rootdevice)
+	ST  string
+	USN string
+}
+
+// ParseResponse parses the reply of a device
+func ParseResponse(msg []byte) (*Response, error) {
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(msg)), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	r := &Response{
+		Location: resp.Header.Get("Location"),
+		Server:   resp.Header.Get("Server"),
+		ST:       resp.Header.Get("ST"),
+		USN:      resp.Header.Get("USN"),
+	}
+	if r.Location == "" {
+		return nil, errors.New("no location")
+	}
+	return r, nil
+}
+
+// Search sends a M-SEARCH request for the target through send and reads
+// the replies from conn for wait. A device gives a response per
+// description (the replies to the same location are merged).
+func Search(ctx context.Context, conn net.PacketConn, send func(msg []byte) error, target string, wait time.Duration) ([]*Response, error) {
+	if err := send(Request(target, int(wait.Seconds()))); err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(wait)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if err := conn.SetReadDeadline(deadline); err != nil {
+		return nil, err
+	}
+	responses := make([]*Response, 0)
+	locations := make(map[string]bool)
+	buffer := make([]byte, 9000)
+	for ctx.Err() == nil {
+		n, src, err := conn.ReadFrom(buffer)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				return responses, nil
+			}
+			return responses, err
+		}
+		r, err := ParseResponse(buffer[:n])
+		if err != nil || locations[r.Location] {
+			continue
+		}
+		if addr, ok := src.(*net.UDPAddr); ok {
+			r.Addr = addr.IP
+		}
+		locations[r.Location] = true
+		responses = append(responses, r)
+	}
+	return responses, ctx.Err()
+}
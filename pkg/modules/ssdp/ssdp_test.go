@@ -0,0 +1,136 @@
+package ssdp
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const description = `<?xml version="1.0"?>
+<root xmlns="urn:schemas-upnp-org:device-1-0">
+  <specVersion><major>1</major><minor>0</minor></specVersion>
+  <device>
+    <deviceType>urn:schemas-upnp-org:device:InternetGatewayDevice:1</deviceType>
+    <friendlyName>Home Router</friendlyName>
+    <manufacturer>NETGEAR, Inc.</manufacturer>
+    <modelName>R7000</modelName>
+    <modelNumber>V1.0.11</modelNumber>
+    <serialNumber>4A12345B00123</serialNumber>
+    <UDN>uuid:824ff22b-8c7d-41c5-a131-44f534e12555</UDN>
+    <presentationURL>http://192.168.1.1:80/</presentationURL>
+    <deviceList>
+      <device>
+        <deviceType>urn:schemas-upnp-org:device:WANDevice:1</deviceType>
+        <serviceList>
+          <service>
+            <serviceType>urn:schemas-upnp-org:service:WANIPConnection:1</serviceType>
+            <serviceId>urn:upnp-org:serviceId:WANIPConn1</serviceId>
+            <SCPDURL>/WANIPCn.xml</SCPDURL>
+            <controlURL>/ctl/IPConn</controlURL>
+            <eventSubURL>/evt/IPConn</eventSubURL>
+          </service>
+        </serviceList>
+      </device>
+    </deviceList>
+  </device>
+</root>`
+
+func TestKind(t *testing.T) {
+	for urn, kind := range map[string]string{
+		"urn:schemas-upnp-org:device:MediaRenderer:1":    "MediaRenderer",
+		"urn:dial-multiscreen-org:service:dial:1":        "dial",
+		"urn:schemas-upnp-org:service:WANIPConnection:2": "WANIPConnection",
+		"upnp:rootdevice": "upnp:rootdevice",
+	} {
+		if got := Kind(urn); got != kind {
+			t.Errorf("Kind(%q) = %q, expected %q", urn, got, kind)
+		}
+	}
+}
+
+func TestSearch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/rootDesc.xml" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/xml")
+		_, _ = w.Write([]byte(description))
+	}))
+	defer server.Close()
+	location := server.URL + "/rootDesc.xml"
+
+	responder, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer responder.Close()
+	go func() {
+		buffer := make([]byte, 9000)
+		for {
+			n, peer, err := responder.ReadFromUDP(buffer)
+			if err != nil {
+				return
+			}
+			if !bytes.HasPrefix(buffer[:n], []byte("M-SEARCH * HTTP/1.1\r\n")) || !bytes.Contains(buffer[:n], []byte("ST: ssdp:all\r\n")) {
+				continue
+			}
+			// a reply per device and service, with the same location
+			for _, st := range []string{"upnp:rootdevice", "urn:schemas-upnp-org:service:WANIPConnection:1"} {
+				reply := fmt.Sprintf("HTTP/1.1 200 OK\r\nCACHE-CONTROL: max-age=120\r\nST: %s\r\nUSN: uuid:824ff22b::%s\r\nEXT:\r\nSERVER: Linux UPnP/1.0 MiniUPnPd/1.8\r\nLOCATION: %s\r\n\r\n", st, st, location)
+				_, _ = responder.WriteToUDP([]byte(reply), peer)
+			}
+		}
+	}()
+
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	send := func(msg []byte) error {
+		_, err := conn.WriteTo(msg, responder.LocalAddr())
+		return err
+	}
+
+	ctx := context.Background()
+	responses, err := Search(ctx, conn, send, SearchAll, 200*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(responses) != 1 {
+		t.Fatalf("expected 1 response, got %d", len(responses))
+	}
+	r := responses[0]
+	if r.Location != location || r.Server != "Linux UPnP/1.0 MiniUPnPd/1.8" || r.ST != "upnp:rootdevice" || !r.Addr.Equal(net.IPv4(127, 0, 0, 1)) {
+		t.Errorf("unexpected response: %+v", r)
+	}
+
+	d, err := Fetch(ctx, server.Client(), r.Location)
+	if err != nil {
+		t.Fatal(err)
+	}
+	device := d.Device
+	if device.Manufacturer != "NETGEAR, Inc." || device.ModelName != "R7000" || device.SerialNumber != "4A12345B00123" || Kind(device.DeviceType) != "InternetGatewayDevice" {
+		t.Errorf("unexpected device: %+v", device)
+	}
+	if types := d.ServiceTypes(); len(types) != 1 || types[0] != "urn:schemas-upnp-org:service:WANIPConnection:1" {
+		t.Errorf("unexpected service types: %v", types)
+	}
+
+	// the services listen on the location, the presentation page on
+	// another port
+	urls := d.URLs(r.Location)
+	if len(urls) != 2 || urls[0].String() != location || urls[1].Host != "192.168.1.1:80" {
+		t.Errorf("unexpected URLs: %v", urls)
+	}
+
+	if _, err := Fetch(ctx, server.Client(), server.URL+"/missing.xml"); err == nil {
+		t.Error("expected an error on a missing description")
+	}
+}
@@ -0,0 +1,122 @@
+package modules
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/situation-sh/situation/pkg/models"
+	"github.com/situation-sh/situation/pkg/modules/ssdp"
+)
+
+func TestSSDPSave(t *testing.T) {
+	ctx := context.Background()
+	storage := NewTestingBunStorage(t)
+	if err := storage.Migrate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// the router is known (through ARP for instance)
+	router := &models.Machine{Hostname: "gateway"}
+	if _, err := storage.DB().NewInsert().Model(router).Exec(ctx); err != nil {
+		t.Fatal(err)
+	}
+	nic := &models.NetworkInterface{IP: []string{"192.168.1.1"}, MACVendor: "NETGEAR", MachineID: router.ID}
+	if _, err := storage.DB().NewInsert().Model(nic).Exec(ctx); err != nil {
+		t.Fatal(err)
+	}
+	existing := &models.ApplicationEndpoint{Addr: "192.168.1.1", Port: 1900, Protocol: "udp", ApplicationProtocols: []string{"ssdp"}, NetworkInterfaceID: nic.ID}
+	if _, err := storage.DB().NewInsert().Model(existing).Exec(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	devices := []*upnpDevice{
+		{
+			response: &ssdp.Response{Addr: net.IPv4(192, 168, 1, 1), Location: "http://192.168.1.1:5000/rootDesc.xml"},
+			description: &ssdp.Description{Device: ssdp.Device{
+				DeviceType:      "urn:schemas-upnp-org:device:InternetGatewayDevice:1",
+				FriendlyName:    "Home Router",
+				Manufacturer:    "NETGEAR, Inc.",
+				ModelName:       "R7000",
+				ModelNumber:     "V1.0.11",
+				SerialNumber:    "4A12345B00123",
+				PresentationURL: "http://192.168.1.1/",
+				Devices: []ssdp.Device{{
+					DeviceType: "urn:schemas-upnp-org:device:WANDevice:1",
+					Services: []ssdp.Service{{
+						ServiceType: "urn:schemas-upnp-org:service:WANIPConnection:1",
+						ControlURL:  "/ctl/IPConn",
+					}},
+				}},
+			}},
+		},
+		{
+			response: &ssdp.Response{Addr: net.IPv4(192, 168, 1, 40), Location: "http://192.168.1.40:9197/dmr"},
+			description: &ssdp.Description{Device: ssdp.Device{
+				DeviceType:   "urn:schemas-upnp-org:device:MediaRenderer:1",
+				FriendlyName: "[TV] Samsung 7 Series (55)",
+				Manufacturer: "Samsung Electronics",
+				ModelName:    "UE55TU7000",
+			}},
+		},
+	}
+
+	m := &SSDPModule{}
+	ctx = SituationContext(ctx, "test", storage, logrus.New())
+	if err := m.save(ctx, devices, logrus.New()); err != nil {
+		t.Fatal(err)
+	}
+	// a second run must not duplicate anything
+	if err := m.save(ctx, devices, logrus.New()); err != nil {
+		t.Fatal(err)
+	}
+
+	machines := make([]*models.Machine, 0)
+	if err := storage.DB().NewSelect().Model(&machines).Order("id").Scan(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(machines) != 2 {
+		t.Fatalf("expected 2 machines, got %d", len(machines))
+	}
+	if r := machines[0]; r.Hostname != "gateway" || r.Manufacturer != "NETGEAR, Inc." || r.Model != "R7000" || r.SerialNumber != "4A12345B00123" || r.DeviceType != "InternetGatewayDevice" {
+		t.Errorf("unexpected router: %+v", r)
+	}
+	if tv := machines[1]; tv.Manufacturer != "Samsung Electronics" || tv.Model != "UE55TU7000" || tv.DeviceType != "MediaRenderer" {
+		t.Errorf("unexpected TV: %+v", tv)
+	}
+
+	apps := make([]*models.Application, 0)
+	if err := storage.DB().NewSelect().Model(&apps).Order("id").Scan(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(apps) != 2 {
+		t.Fatalf("expected 2 applications, got %d", len(apps))
+	}
+	if apps[0].Name != "Home Router" || apps[0].Version != "V1.0.11" || apps[0].Protocol != "upnp" || apps[0].MachineID != router.ID {
+		t.Errorf("unexpected router application: %+v", apps[0])
+	}
+
+	endpoints := make([]*models.ApplicationEndpoint, 0)
+	if err := storage.DB().NewSelect().Model(&endpoints).Relation("Application").Order("application_endpoint.id").Scan(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// router: ssdp, description (and services), presentation page; TV:
+	// ssdp, description
+	if len(endpoints) != 5 {
+		t.Fatalf("expected 5 endpoints, got %d", len(endpoints))
+	}
+	for _, e := range endpoints {
+		if e.Application == nil {
+			t.Errorf("expected the endpoint %s/%d to have an application", e.Protocol, e.Port)
+		}
+	}
+	if endpoints[0].ID != existing.ID || endpoints[0].Application.ID != apps[0].ID {
+		t.Errorf("expected the existing endpoint to get the router application, got %+v", endpoints[0])
+	}
+	if e := endpoints[1]; e.Addr != "192.168.1.1" || e.Port != 5000 || e.Protocol != "tcp" || len(e.ApplicationProtocols) != 2 || e.ApplicationProtocols[1] != "upnp" {
+		t.Errorf("unexpected description endpoint: %+v", e)
+	}
+	if e := endpoints[2]; e.Port != 80 || e.ApplicationProtocols[0] != "http" {
+		t.Errorf("unexpected presentation endpoint: %+v", e)
+	}
+}
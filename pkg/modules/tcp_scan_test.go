@@ -0,0 +1,48 @@
+package modules
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/situation-sh/situation/pkg/models"
+	"github.com/situation-sh/situation/pkg/modules/tcpscan"
+)
+
+func TestTCPScanPlan(t *testing.T) {
+	m := &TCPScanModule{Profiles: []string{"branch=custom:22", "10.0.0.2=custom:22,80,443", "bad"}}
+	rules := m.rules(logrus.New())
+	if len(rules) != 2 {
+		t.Fatalf("expected 2 rules, got %d", len(rules))
+	}
+
+	branch := &models.NetworkInterface{ID: 1, IP: []string{"10.1.0.1"}, Subnetworks: []*models.Subnetwork{{Tag: "branch"}}}
+	server := &models.NetworkInterface{ID: 2, IP: []string{"10.0.0.2"}}
+	other := &models.NetworkInterface{ID: 3, IP: []string{"10.0.0.3"}}
+	if ports := portsOf(branch, rules, tcpscan.Top100); len(ports) != 1 {
+		t.Errorf("expected the branch profile, got %v", ports)
+	}
+	if ports := portsOf(other, rules, tcpscan.Top100); len(ports) != 100 {
+		t.Errorf("expected the default profile, got %d ports", len(ports))
+	}
+
+	plan := scanPlan{hosts: []scanHost{
+		{nic: branch, ips: branch.IPs(), ports: portsOf(branch, rules, nil)},
+		{nic: server, ips: server.IPs(), ports: portsOf(server, rules, nil)},
+	}}
+	got := ""
+	for chunk := plan.next(2); len(chunk) > 0; chunk = plan.next(2) {
+		for _, target := range chunk {
+			got += fmt.Sprintf("%s:%d ", target.IP, target.Port)
+		}
+		got += "| "
+	}
+	// ports are interleaved between the hosts
+	expected := "10.1.0.1:22 10.0.0.2:22 | 10.0.0.2:80 10.0.0.2:443 | "
+	if got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+	if chunk := plan.next(2); len(chunk) != 0 {
+		t.Errorf("expected no more targets, got %v", chunk)
+	}
+}
@@ -0,0 +1,84 @@
+package tcpscan
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Limiter spaces events so that no more than rate events occur
+// per second. A nil Limiter does not limit anything.
+type Limiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+// NewLimiter returns a limiter allowing rate events per second, or nil
+// if rate is not positive
+func NewLimiter(rate int) *Limiter {
+	if rate <= 0 {
+		return nil
+	}
+	return &Limiter{interval: time.Second / time.Duration(rate)}
+}
+
+// Wait blocks until the next event is allowed or the context is done
+func (l *Limiter) Wait(ctx context.Context) error {
+	if l == nil {
+		return ctx.Err()
+	}
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	at := l.next
+	l.next = l.next.Add(l.interval)
+	l.mu.Unlock()
+
+	delay := time.Until(at)
+	if delay <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// HostLimiter is a set of limiters, one per host
+type HostLimiter struct {
+	mu    sync.Mutex
+	rate  int
+	hosts map[string]*Limiter
+}
+
+// NewHostLimiter returns a limiter allowing rate events per second
+// to every host, or nil if rate is not positive
+func NewHostLimiter(rate int) *HostLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	return &HostLimiter{rate: rate, hosts: make(map[string]*Limiter)}
+}
+
+// Wait blocks until the next event to host is allowed or the context
+// is done
+func (h *HostLimiter) Wait(ctx context.Context, host string) error {
+	if h == nil {
+		return ctx.Err()
+	}
+	h.mu.Lock()
+	limiter, ok := h.hosts[host]
+	if !ok {
+		limiter = NewLimiter(h.rate)
+		h.hosts[host] = limiter
+	}
+	h.mu.Unlock()
+	return limiter.Wait(ctx)
+}
@@ -0,0 +1,114 @@
+// Package tcpscan gathers the port profiles and the rate limits of
+// the TCP scan
+package tcpscan
+
+import (
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/situation-sh/situation/pkg/utils"
+)
+
+// ProfilePorts returns the ports of a profile: top100, top1000, all
+// or custom:<ports> where ports is a list of ports and port ranges
+// (e.g. custom:22,80,443,5000-5100). The separator can be a comma or
+// a semicolon.
+func ProfilePorts(profile string) ([]uint16, error) {
+	profile = strings.ToLower(strings.TrimSpace(profile))
+	switch profile {
+	case "top100":
+		return Top100, nil
+	case "top1000", "":
+		return Top1000, nil
+	case "all":
+		ports := make([]uint16, 0, 65535)
+		for p := 1; p <= 65535; p++ {
+			ports = append(ports, uint16(p))
+		}
+		return ports, nil
+	}
+
+	spec, ok := strings.CutPrefix(profile, "custom:")
+	if !ok {
+		return nil, fmt.Errorf("unknown port profile: %s", profile)
+	}
+	ports := make([]uint16, 0)
+	for _, item := range strings.FieldsFunc(spec, func(r rune) bool { return r == ',' || r == ';' }) {
+		item = strings.TrimSpace(item)
+		first, last, isRange := strings.Cut(item, "-")
+		start, err := parsePort(first)
+		if err != nil {
+			return nil, err
+		}
+		end := start
+		if isRange {
+			if end, err = parsePort(last); err != nil {
+				return nil, err
+			}
+			if end < start {
+				return nil, fmt.Errorf("invalid port range: %s", item)
+			}
+		}
+		for p := int(start); p <= int(end); p++ {
+			ports = append(ports, uint16(p))
+		}
+	}
+	if len(ports) == 0 {
+		return nil, fmt.Errorf("no port in profile: %s", profile)
+	}
+	slices.Sort(ports)
+	return slices.Compact(ports), nil
+}
+
+func parsePort(s string) (uint16, error) {
+	p, err := strconv.ParseUint(strings.TrimSpace(s), 10, 16)
+	if err != nil || p == 0 {
+		return 0, fmt.Errorf("invalid port: %s", s)
+	}
+	return uint16(p), nil
+}
+
+// Rule assigns a port profile to the hosts of a subnetwork tag or of a
+// target group (network in CIDR notation or address range)
+type Rule struct {
+	Tag     string
+	First   net.IP
+	Last    net.IP
+	Profile string
+	Ports   []uint16
+}
+
+// ParseRule parses a rule written as <tag or target>=<profile>, like
+// branch=top100 or 10.20.0.0/16=all
+func ParseRule(s string) (*Rule, error) {
+	selector, profile, ok := strings.Cut(s, "=")
+	selector = strings.TrimSpace(selector)
+	if !ok || selector == "" {
+		return nil, fmt.Errorf("invalid profile rule (<tag or target>=<profile> expected): %s", s)
+	}
+	ports, err := ProfilePorts(profile)
+	if err != nil {
+		return nil, err
+	}
+	rule := Rule{Profile: strings.TrimSpace(profile), Ports: ports}
+	if first, last, err := utils.ParseIPRange(selector); err == nil {
+		rule.First, rule.Last = first, last
+	} else {
+		rule.Tag = selector
+	}
+	return &rule, nil
+}
+
+// Match returns whether the rule applies to a host having the given
+// addresses and attached to subnetworks with the given tags
+func (r *Rule) Match(ips []net.IP, tags []string) bool {
+	if r.Tag != "" {
+		return slices.Contains(tags, r.Tag)
+	}
+	return slices.ContainsFunc(ips, func(ip net.IP) bool {
+		return utils.IPInRange(ip, r.First, r.Last)
+	})
+}
@@ -0,0 +1,92 @@
+package tcpscan
+
+import (
+	"context"
+	"net"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestProfilePorts(t *testing.T) {
+	for profile, size := range map[string]int{"top100": 100, "TOP1000": 1000, "": 1000, "all": 65535} {
+		ports, err := ProfilePorts(profile)
+		if err != nil || len(ports) != size {
+			t.Errorf("%s: expected %d ports, got %d (%v)", profile, size, len(ports), err)
+		}
+	}
+
+	ports, err := ProfilePorts("custom:443,22;80, 5000-5003,22")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(ports, []uint16{22, 80, 443, 5000, 5001, 5002, 5003}) {
+		t.Errorf("unexpected ports: %v", ports)
+	}
+
+	for _, profile := range []string{"top10", "custom:", "custom:0", "custom:80-22", "custom:70000", "custom:http"} {
+		if _, err := ProfilePorts(profile); err == nil {
+			t.Errorf("%s: expected an error", profile)
+		}
+	}
+}
+
+func TestRule(t *testing.T) {
+	rule, err := ParseRule("branch=top100")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rule.Tag != "branch" || len(rule.Ports) != 100 {
+		t.Errorf("unexpected rule: %+v", rule)
+	}
+	if !rule.Match(nil, []string{"lan", "branch"}) || rule.Match(nil, []string{"lan"}) {
+		t.Error("bad tag matching")
+	}
+
+	rule, err = ParseRule("10.20.0.0/16=custom:22,3389")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ips := []net.IP{net.ParseIP("192.168.1.2"), net.ParseIP("10.20.3.4")}
+	if rule.Tag != "" || !rule.Match(ips, nil) || rule.Match(ips[:1], []string{"10.20.0.0/16"}) {
+		t.Errorf("bad target matching: %+v", rule)
+	}
+
+	for _, raw := range []string{"branch", "=top100", "branch=top5"} {
+		if _, err := ParseRule(raw); err == nil {
+			t.Errorf("%s: expected an error", raw)
+		}
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	ctx := context.Background()
+	if NewLimiter(0) != nil || NewHostLimiter(-1) != nil {
+		t.Error("expected no limiter")
+	}
+	// a nil limiter does not wait
+	var none *Limiter
+	if err := none.Wait(ctx); err != nil {
+		t.Error(err)
+	}
+
+	limiter := NewHostLimiter(100)
+	start := time.Now()
+	for i := 0; i < 6; i++ {
+		for _, host := range []string{"10.0.0.1", "10.0.0.2"} {
+			if err := limiter.Wait(ctx, host); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	// 6 events per host at 100/s: the last one occurs after 50ms
+	if elapsed := time.Since(start); elapsed < 45*time.Millisecond || elapsed > time.Second {
+		t.Errorf("unexpected duration: %v", elapsed)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := NewLimiter(1).Wait(cancelled); err == nil {
+		t.Error("expected the context error")
+	}
+}
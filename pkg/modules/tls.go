@@ -53,6 +53,8 @@ func init() {
 // signature and public key algorithms, SHA-1/SHA-256 fingerprints, and DNS names.
 //
 // The module only uses the Go standard library. Currently it only supports TLS over TCP.
+//
+// The endpoints of the excluded hosts (see `--scope-exclude`) are skipped.
 type TLSModule struct {
 	BaseModule
 	Ports []uint16
@@ -78,6 +80,7 @@ func (m *TLSModule) Run(ctx context.Context) error {
 		Scan(ctx); err != nil {
 		return fmt.Errorf("failed to query TLS endpoints: %w", err)
 	}
+	tlsEndpoints = scope.exclusions(ctx, storage, logger).FilterEndpoints(tlsEndpoints)
 
 	toUpdate := make([]*models.ApplicationEndpoint, 0)
 	for _, endpoint := range tlsEndpoints {
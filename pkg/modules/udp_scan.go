@@ -0,0 +1,182 @@
+// LINUX(UDPScanModule) ok
+// WINDOWS(UDPScanModule) ok
+// MACOS(UDPScanModule) ?
+// ROOT(UDPScanModule) no
+package modules
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/asiffer/puzzle"
+	"github.com/situation-sh/situation/pkg/models"
+	"github.com/situation-sh/situation/pkg/modules/udpscan"
+)
+
+func init() {
+	protocols := make([]string, len(udpscan.Probes))
+	for i, probe := range udpscan.Probes {
+		protocols[i] = probe.Protocol
+	}
+	registerModule(&UDPScanModule{
+		Timeout:    1 * time.Second,
+		Protocols:  protocols,
+		MaxSockets: 256,
+	})
+}
+
+// UDPScanModule sends protocol-aware probes to neighbor UDP services.
+//
+// The module only uses the Go standard library.
+//
+// A UDP service only answers to a valid request of its protocol, so
+// every probe carries a payload of its protocol: DNS (53), TFTP (69),
+// NTP (123), NetBIOS-NS (137), SNMP (161, public community), IPMI/RMCP
+// (623), SSDP (1900), SIP (5060), mDNS (5353) and Memcached (11211).
+// An endpoint (`protocol=udp`) is created for every reply that matches
+// the protocol of the probe, with this protocol as application protocol.
+//
+// The probes are sent to the hosts previously found (and to the hosts
+// within the scope targets, except the excluded ones). At most
+// `max-sockets` probes are pending at the same time, and the replies
+// are awaited for `timeout`.
+type UDPScanModule struct {
+	BaseModule
+	Timeout    time.Duration
+	Protocols  []string
+	MaxSockets int
+}
+
+func (m *UDPScanModule) Bind(config *puzzle.Config) error {
+	if err := setDefault(config, m, "timeout", &m.Timeout, "Time to wait for a UDP reply"); err != nil {
+		return err
+	}
+	if err := setDefault(config, m, "protocols", &m.Protocols, "Protocols to probe (dns, tftp, ntp, netbios-ns, snmp, ipmi, ssdp, sip, mdns, memcached)"); err != nil {
+		return err
+	}
+	return setDefault(config, m, "max-sockets", &m.MaxSockets, "Maximum number of concurrent probes")
+}
+
+func (m *UDPScanModule) Name() string {
+	return "udp-scan"
+}
+
+func (m *UDPScanModule) Dependencies() []string {
+	return []string{"arp"}
+}
+
+func (m *UDPScanModule) Run(ctx context.Context) error {
+	logger := getLogger(ctx, m)
+	storage := getStorage(ctx)
+
+	probes := make([]*udpscan.Probe, 0, len(m.Protocols))
+	for _, protocol := range m.Protocols {
+		probe := udpscan.GetProbe(protocol)
+		if probe == nil {
+			logger.WithField("protocol", protocol).Warn("Unknown UDP protocol")
+			continue
+		}
+		probes = append(probes, probe)
+	}
+
+	excluded := scope.exclusions(ctx, storage, logger)
+	nics, err := scanNICs(ctx, storage, excluded, logger)
+	if err != nil {
+		logger.
+			WithError(err).
+			Error("Cannot retrieve neighbor network interfaces")
+		return err
+	}
+
+	// Build targets list (avoid duplicate IPs)
+	targets := make([]udpscan.Target, 0)
+	nicOf := make(map[string]int64)
+	for _, nic := range nics {
+		for _, ip := range nic.IPs() {
+			if _, ok := nicOf[ip.String()]; ok {
+				continue
+			}
+			nicOf[ip.String()] = nic.ID
+			zone := ""
+			if ip.To4() == nil && ip.IsLinkLocalUnicast() {
+				// Link-local IPv6 addresses need the interface zone
+				zone = nic.Name
+			}
+			for _, probe := range probes {
+				targets = append(targets, udpscan.Target{IP: ip, Zone: zone, Probe: probe})
+			}
+		}
+	}
+
+	if len(targets) == 0 {
+		logger.Warn("No targets to scan")
+		return nil
+	}
+
+	logger.WithField("hosts", len(nicOf)).
+		WithField("protocols", len(probes)).
+		Info("Starting UDP scan")
+
+	var mutex sync.Mutex
+	endpoints := make([]*models.ApplicationEndpoint, 0)
+	err = udpscan.Scan(ctx, targets, m.Timeout, m.MaxSockets, func(r udpscan.Result) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		endpoints = append(endpoints, &models.ApplicationEndpoint{
+			Port:                 r.Port,
+			Protocol:             "udp",
+			Addr:                 r.IP.String(),
+			ApplicationProtocols: []string{r.Protocol},
+			NetworkInterfaceID:   nicOf[r.IP.String()],
+		})
+		logger.WithField("ip", r.IP).
+			WithField("port", r.Port).
+			WithField("proto", r.Protocol).
+			Debug("Endpoint found")
+	})
+	if err != nil {
+		logger.WithError(err).Debug("Errors during UDP scan")
+	}
+
+	if len(endpoints) == 0 {
+		logger.Info("No UDP service found")
+		return nil
+	}
+
+	// the slice is truncated to the inserted rows
+	found := slices.Clone(endpoints)
+
+	// Insert endpoints, ignoring conflicts (already existing endpoints)
+	_, err = storage.DB().
+		NewInsert().
+		Model(&endpoints).
+		On("CONFLICT DO NOTHING").
+		Exec(ctx)
+	if err != nil {
+		logger.WithError(err).Error("Cannot create endpoints")
+		return err
+	}
+
+	// the existing endpoints get the detected protocol
+	for _, endpoint := range found {
+		_, err := storage.DB().
+			NewUpdate().
+			Model(endpoint).
+			Column("application_protocols").
+			Where("protocol = ?", endpoint.Protocol).
+			Where("port = ?", endpoint.Port).
+			Where("addr = ?", endpoint.Addr).
+			Where("application_protocols IS NULL").
+			Exec(ctx)
+		if err != nil {
+			logger.WithError(err).Warn("Cannot update endpoint protocols")
+		}
+	}
+
+	logger.WithField("endpoints", len(found)).
+		WithField("new", len(endpoints)).
+		Info("UDP services found")
+	return nil
+}
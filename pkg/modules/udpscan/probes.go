@@ -0,0 +1,202 @@
+// Package udpscan sends protocol-aware probes to UDP services. Unlike
+// TCP, a UDP service only answers to a valid request, so every probe
+// carries a payload of its protocol and checks that the reply belongs
+// to it.
+package udpscan
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+)
+
+// Probe is a request to a UDP service and the way to recognize its
+// reply
+type Probe struct {
+	// Protocol is the application protocol of the service
+	Protocol string
+	Port     uint16
+	Payload  []byte
+	// Match returns whether the reply comes from the service
+	Match func(reply []byte) bool
+}
+
+// transaction ID of the requests (DNS, NetBIOS, memcached)
+const txID = 0x5354
+
+// Probes are the supported probes
+var Probes = []Probe{
+	{Protocol: "dns", Port: 53, Payload: dnsQuery("version.bind", 16, 3, true), Match: dnsReply},
+	{Protocol: "tftp", Port: 69, Payload: tftpRequest, Match: tftpReply},
+	{Protocol: "ntp", Port: 123, Payload: ntpRequest, Match: ntpReply},
+	{Protocol: "netbios-ns", Port: 137, Payload: netbiosRequest, Match: dnsReply},
+	{Protocol: "snmp", Port: 161, Payload: snmpRequest, Match: snmpReply},
+	{Protocol: "ipmi", Port: 623, Payload: ipmiRequest, Match: ipmiReply},
+	{Protocol: "ssdp", Port: 1900, Payload: ssdpRequest, Match: ssdpReply},
+	{Protocol: "sip", Port: 5060, Payload: sipRequest, Match: sipReply},
+	{Protocol: "mdns", Port: 5353, Payload: dnsQuery("_services._dns-sd._udp.local", 12, 1, false), Match: dnsReply},
+	{Protocol: "memcached", Port: 11211, Payload: memcachedRequest, Match: memcachedReply},
+}
+
+// GetProbe returns the probe of a protocol (nil if it does not exist)
+func GetProbe(protocol string) *Probe {
+	for i := range Probes {
+		if Probes[i].Protocol == protocol {
+			return &Probes[i]
+		}
+	}
+	return nil
+}
+
+// dnsQuery builds a DNS query with a single question
+func dnsQuery(name string, qtype uint16, qclass uint16, recursion bool) []byte {
+	flags := uint16(0)
+	if recursion {
+		flags = 0x0100 // RD
+	}
+	query := binary.BigEndian.AppendUint16(nil, txID)
+	query = binary.BigEndian.AppendUint16(query, flags)
+	// one question, no record
+	query = append(query, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00)
+	for _, label := range strings.Split(name, ".") {
+		query = append(query, byte(len(label)))
+		query = append(query, label...)
+	}
+	query = append(query, 0x00)
+	query = binary.BigEndian.AppendUint16(query, qtype)
+	return binary.BigEndian.AppendUint16(query, qclass)
+}
+
+// dnsReply checks the transaction ID and the QR (response) bit, it
+// also suits NetBIOS-NS and the legacy unicast mDNS replies
+func dnsReply(reply []byte) bool {
+	return len(reply) >= 12 && binary.BigEndian.Uint16(reply) == txID && reply[2]&0x80 != 0
+}
+
+// netbiosRequest is a NBSTAT query of the wildcard name (*)
+var netbiosRequest = append([]byte{
+	0x53, 0x54, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0x20, 'C', 'K'},
+	append(bytes.Repeat([]byte{'A'}, 30), 0x00, 0x00, 0x21, 0x00, 0x01)...)
+
+// tftpRequest is a read request of a file that should not exist, the
+// server replies with an error (or the file)
+var tftpRequest = []byte("\x00\x01situation.probe\x00octet\x00")
+
+func tftpReply(reply []byte) bool {
+	// DATA or ERROR
+	return len(reply) >= 4 && reply[0] == 0 && (reply[1] == 3 || reply[1] == 5)
+}
+
+// ntpRequest is a client request (LI=3, VN=4, Mode=3)
+var ntpRequest = append([]byte{0xe3}, make([]byte, 47)...)
+
+func ntpReply(reply []byte) bool {
+	// server mode
+	return len(reply) >= 48 && reply[0]&0x07 == 4
+}
+
+// snmpRequest is a SNMPv2c get-request of sysDescr.0 with the public
+// community
+var snmpRequest = []byte{
+	0x30, 0x26, // message
+	0x02, 0x01, 0x01, // version (v2c)
+	0x04, 0x06, 'p', 'u', 'b', 'l', 'i', 'c', // community
+	0xa0, 0x19, // get-request
+	0x02, 0x01, 0x01, // request-id
+	0x02, 0x01, 0x00, // error-status
+	0x02, 0x01, 0x00, // error-index
+	0x30, 0x0e, 0x30, 0x0c, // variable bindings
+	0x06, 0x08, 0x2b, 0x06, 0x01, 0x02, 0x01, 0x01, 0x01, 0x00, // sysDescr.0
+	0x05, 0x00, // null
+}
+
+// snmpReply checks that the reply is a SNMP message holding a response
+// PDU
+func snmpReply(reply []byte) bool {
+	tag, body, _, ok := readTLV(reply)
+	if !ok || tag != 0x30 {
+		return false
+	}
+	// version
+	tag, _, body, ok = readTLV(body)
+	if !ok || tag != 0x02 {
+		return false
+	}
+	// community
+	tag, _, body, ok = readTLV(body)
+	if !ok || tag != 0x04 {
+		return false
+	}
+	tag, _, _, ok = readTLV(body)
+	return ok && tag == 0xa2
+}
+
+// readTLV reads a BER element and returns its tag, its value and the
+// data that follows it
+func readTLV(data []byte) (tag byte, value []byte, rest []byte, ok bool) {
+	if len(data) < 2 {
+		return 0, nil, nil, false
+	}
+	tag, length, offset := data[0], int(data[1]), 2
+	if length&0x80 != 0 {
+		n := length & 0x7f
+		if n == 0 || n > 4 || len(data) < 2+n {
+			return 0, nil, nil, false
+		}
+		length = 0
+		for _, b := range data[2 : 2+n] {
+			length = length<<8 | int(b)
+		}
+		offset += n
+	}
+	if len(data) < offset+length {
+		return 0, nil, nil, false
+	}
+	return tag, data[offset : offset+length], data[offset+length:], true
+}
+
+// ipmiRequest is a RMCP/IPMI v1.5 Get Channel Authentication
+// Capabilities request
+var ipmiRequest = []byte{
+	0x06, 0x00, 0xff, 0x07, // RMCP (class IPMI)
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x09, // session
+	0x20, 0x18, 0xc8, 0x81, 0x00, 0x38, 0x8e, 0x04, 0xb5, // message
+}
+
+func ipmiReply(reply []byte) bool {
+	// RMCP v1.0 with the IPMI class, or an ASF presence pong
+	return len(reply) >= 9 && reply[0] == 0x06 && (reply[3]&0x1f == 0x07 || (reply[3] == 0x06 && reply[8] == 0x40))
+}
+
+var ssdpRequest = []byte("M-SEARCH * HTTP/1.1\r\n" +
+	"HOST: 239.255.255.250:1900\r\n" +
+	"MAN: \"ssdp:discover\"\r\n" +
+	"MX: 1\r\n" +
+	"ST: ssdp:all\r\n\r\n")
+
+func ssdpReply(reply []byte) bool {
+	return bytes.HasPrefix(bytes.ToUpper(reply), []byte("HTTP/1.1 200"))
+}
+
+var sipRequest = []byte("OPTIONS sip:probe@situation SIP/2.0\r\n" +
+	"Via: SIP/2.0/UDP situation;branch=z9hG4bK-situation;rport\r\n" +
+	"Max-Forwards: 70\r\n" +
+	"From: <sip:probe@situation>;tag=situation\r\n" +
+	"To: <sip:probe@situation>\r\n" +
+	"Call-ID: situation-probe\r\n" +
+	"CSeq: 1 OPTIONS\r\n" +
+	"Accept: application/sdp\r\n" +
+	"Content-Length: 0\r\n\r\n")
+
+func sipReply(reply []byte) bool {
+	return bytes.HasPrefix(reply, []byte("SIP/2.0 "))
+}
+
+// memcachedRequest is a version command preceded by the UDP frame
+// header (request ID, sequence number, number of datagrams, reserved)
+var memcachedRequest = []byte("\x53\x54\x00\x00\x00\x01\x00\x00version\r\n")
+
+func memcachedReply(reply []byte) bool {
+	return len(reply) > 8 && binary.BigEndian.Uint16(reply) == txID && bytes.HasPrefix(reply[8:], []byte("VERSION "))
+}
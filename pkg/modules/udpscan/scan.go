@@ -0,0 +1,101 @@
+package udpscan
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// Target is a host to probe with a probe
+type Target struct {
+	IP net.IP
+	// Zone is the interface of the link-local IPv6 addresses
+	Zone  string
+	Probe *Probe
+}
+
+// Result is a service that has replied to a probe
+type Result struct {
+	IP       net.IP
+	Port     uint16
+	Protocol string
+}
+
+// Send sends the probe to addr and returns whether a reply matching the
+// probe has been received from the host before the timeout. The reply
+// may come from another port (TFTP servers reply from a new one).
+func Send(ctx context.Context, addr *net.UDPAddr, probe *Probe, timeout time.Duration) (bool, error) {
+	network := "udp4"
+	if addr.IP.To4() == nil {
+		network = "udp6"
+	}
+	conn, err := net.ListenUDP(network, nil)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	deadline := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		return false, err
+	}
+	if _, err := conn.WriteToUDP(probe.Payload, addr); err != nil {
+		return false, err
+	}
+
+	buffer := make([]byte, 4096)
+	for ctx.Err() == nil {
+		n, peer, err := conn.ReadFromUDP(buffer)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				return false, nil
+			}
+			return false, err
+		}
+		if peer.IP.Equal(addr.IP) && probe.Match(buffer[:n]) {
+			return true, nil
+		}
+	}
+	return false, ctx.Err()
+}
+
+// Scan sends the probes to the targets (at most concurrency at the same
+// time) and calls onResult for every service that replies
+func Scan(ctx context.Context, targets []Target, timeout time.Duration, concurrency int, onResult func(Result)) error {
+	sem := make(chan struct{}, max(concurrency, 1))
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	var errs error
+	for _, target := range targets {
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return errors.Join(errs, ctx.Err())
+		case sem <- struct{}{}:
+		}
+		wg.Add(1)
+		go func(t Target) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			addr := &net.UDPAddr{IP: t.IP, Port: int(t.Probe.Port), Zone: t.Zone}
+			ok, err := Send(ctx, addr, t.Probe, timeout)
+			if err != nil {
+				mutex.Lock()
+				errs = errors.Join(errs, err)
+				mutex.Unlock()
+				return
+			}
+			if ok {
+				onResult(Result{IP: t.IP, Port: t.Probe.Port, Protocol: t.Probe.Protocol})
+			}
+		}(target)
+	}
+	wg.Wait()
+	return errs
+}
@@ -0,0 +1,158 @@
+package udpscan
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// responders check the request and build the reply of a service
+var responders = map[string]func(request []byte) []byte{
+	"dns":        dnsResponder,
+	"mdns":       dnsResponder,
+	"netbios-ns": dnsResponder,
+	"tftp": func(request []byte) []byte {
+		if !bytes.HasPrefix(request, []byte{0x00, 0x01}) {
+			return nil
+		}
+		return []byte("\x00\x05\x00\x01File not found\x00")
+	},
+	"ntp": func(request []byte) []byte {
+		if len(request) != 48 || request[0]&0x07 != 3 {
+			return nil
+		}
+		reply := make([]byte, 48)
+		reply[0] = 0x24 // VN=4, Mode=4
+		return reply
+	},
+	"snmp": func(request []byte) []byte {
+		if len(request) < 15 || request[13] != 0xa0 {
+			return nil
+		}
+		return []byte{0x30, 0x82, 0x00, 0x10, 0x02, 0x01, 0x01, 0x04, 0x06, 'p', 'u', 'b', 'l', 'i', 'c', 0xa2, 0x03, 0x02, 0x01, 0x01}
+	},
+	"ipmi": func(request []byte) []byte {
+		if len(request) < 4 || request[3] != 0x07 {
+			return nil
+		}
+		return append([]byte{0x06, 0x00, 0xff, 0x07}, make([]byte, 26)...)
+	},
+	"ssdp": func(request []byte) []byte {
+		if !bytes.HasPrefix(request, []byte("M-SEARCH * HTTP/1.1")) {
+			return nil
+		}
+		return []byte("HTTP/1.1 200 OK\r\nST: upnp:rootdevice\r\n\r\n")
+	},
+	"sip": func(request []byte) []byte {
+		if !bytes.HasPrefix(request, []byte("OPTIONS ")) {
+			return nil
+		}
+		return []byte("SIP/2.0 200 OK\r\nCSeq: 1 OPTIONS\r\n\r\n")
+	},
+	"memcached": func(request []byte) []byte {
+		if !bytes.HasSuffix(request, []byte("version\r\n")) {
+			return nil
+		}
+		return append(request[:8:8], "VERSION 1.6.21\r\n"...)
+	},
+}
+
+func dnsResponder(request []byte) []byte {
+	if len(request) < 12 || request[2]&0x80 != 0 {
+		return nil
+	}
+	reply := bytes.Clone(request)
+	reply[2] |= 0x80
+	return reply
+}
+
+// listen starts a local UDP service that replies (from another port if
+// newPort is set) with the output of respond
+func listen(t *testing.T, respond func([]byte) []byte, newPort bool) uint16 {
+	t.Helper()
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	go func() {
+		buffer := make([]byte, 2048)
+		for {
+			n, peer, err := conn.ReadFromUDP(buffer)
+			if err != nil {
+				return
+			}
+			reply := respond(buffer[:n])
+			if reply == nil {
+				continue
+			}
+			if !newPort {
+				_, _ = conn.WriteToUDP(reply, peer)
+				continue
+			}
+			sender, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+			if err != nil {
+				return
+			}
+			_, _ = sender.WriteToUDP(reply, peer)
+			sender.Close()
+		}
+	}()
+	return uint16(conn.LocalAddr().(*net.UDPAddr).Port)
+}
+
+func TestProbes(t *testing.T) {
+	ctx := context.Background()
+	localhost := net.ParseIP("127.0.0.1")
+	for _, probe := range Probes {
+		respond, ok := responders[probe.Protocol]
+		if !ok {
+			t.Errorf("%s: no responder", probe.Protocol)
+			continue
+		}
+		port := listen(t, respond, probe.Protocol == "tftp")
+		addr := &net.UDPAddr{IP: localhost, Port: int(port)}
+		if ok, err := Send(ctx, addr, &probe, time.Second); !ok || err != nil {
+			t.Errorf("%s: expected a reply (%v)", probe.Protocol, err)
+		}
+
+		// a service of another protocol
+		other := listen(t, func([]byte) []byte { return []byte("HELLO WORLD, THIS IS NOT THE SERVICE YOU ARE LOOKING FOR") }, false)
+		addr.Port = int(other)
+		if ok, err := Send(ctx, addr, &probe, 100*time.Millisecond); ok || err != nil {
+			t.Errorf("%s: expected no reply (%v)", probe.Protocol, err)
+		}
+	}
+}
+
+func TestScan(t *testing.T) {
+	ntp := *GetProbe("ntp")
+	ntp.Port = listen(t, responders["ntp"], false)
+	sip := *GetProbe("sip")
+	// nobody listens there
+	sip.Port = listen(t, func([]byte) []byte { return nil }, false)
+	if GetProbe("quic") != nil {
+		t.Error("unexpected probe")
+	}
+
+	var mutex sync.Mutex
+	results := make([]Result, 0)
+	targets := []Target{
+		{IP: net.ParseIP("127.0.0.1"), Probe: &ntp},
+		{IP: net.ParseIP("127.0.0.1"), Probe: &sip},
+	}
+	err := Scan(context.Background(), targets, 200*time.Millisecond, 2, func(r Result) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		results = append(results, r)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 1 || results[0].Protocol != "ntp" || results[0].Port != ntp.Port {
+		t.Errorf("unexpected results: %v", results)
+	}
+}
@@ -0,0 +1,17 @@
+package report
+
+import (
+	_ "embed"
+	"html/template"
+	"io"
+)
+
+//go:embed report.html.tmpl
+var htmlTemplate string
+
+var reportTemplate = template.Must(template.New("report").Parse(htmlTemplate))
+
+// renderHTML writes a single HTML file (styles are inlined)
+func renderHTML(w io.Writer, doc *Document) error {
+	return reportTemplate.Execute(w, doc)
+}
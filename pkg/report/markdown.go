@@ -0,0 +1,45 @@
+package report
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// markdownCell escapes the characters that would break a table
+func markdownCell(s string) string {
+	s = strings.ReplaceAll(s, "|", `\|`)
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func markdownRow(cells []string) string {
+	escaped := make([]string, len(cells))
+	for i, c := range cells {
+		escaped[i] = markdownCell(c)
+	}
+	return "| " + strings.Join(escaped, " | ") + " |"
+}
+
+func renderMarkdown(w io.Writer, doc *Document) error {
+	lines := []string{"# " + doc.Title, "", doc.Subtitle}
+	for _, s := range doc.Sections {
+		lines = append(lines, "", "## "+s.Title, "")
+		if s.Note != "" {
+			lines = append(lines, s.Note, "")
+		}
+		if len(s.Rows) == 0 {
+			lines = append(lines, "_None_")
+			continue
+		}
+		separator := make([]string, len(s.Headers))
+		for i := range separator {
+			separator[i] = "---"
+		}
+		lines = append(lines, markdownRow(s.Headers), markdownRow(separator))
+		for _, row := range s.Rows {
+			lines = append(lines, markdownRow(row))
+		}
+	}
+	_, err := fmt.Fprintln(w, strings.Join(lines, "\n"))
+	return err
+}
@@ -0,0 +1,185 @@
+// Package report renders the inventory report (see store.BuildReport)
+// as a self-contained file that does not need a terminal.
+package report
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/situation-sh/situation/pkg/store"
+)
+
+// Formats lists the supported output formats
+var Formats = []string{"html", "svg", "md"}
+
+// Section is a titled table of the report
+type Section struct {
+	Title   string
+	Note    string
+	Headers []string
+	Rows    [][]string
+}
+
+// Document is the format-neutral version of the report
+type Document struct {
+	Title    string
+	Subtitle string
+	Sections []*Section
+}
+
+// Render writes the report in the given format
+func Render(w io.Writer, r *store.Report, format string) error {
+	doc := NewDocument(r)
+	switch format {
+	case "html":
+		return renderHTML(w, doc)
+	case "svg":
+		return renderSVG(w, doc)
+	case "md":
+		return renderMarkdown(w, doc)
+	default:
+		return fmt.Errorf("unsupported format: %s (choose from %v)", format, Formats)
+	}
+}
+
+func count(n int, word string) string {
+	if n == 1 {
+		return fmt.Sprintf("%d %s", n, word)
+	}
+	return fmt.Sprintf("%d %ss", n, word)
+}
+
+// expiry returns when the certificate expires relatively to now
+func expiry(notAfter time.Time, now time.Time) string {
+	days := int(notAfter.Sub(now).Hours() / 24)
+	switch {
+	case notAfter.Before(now):
+		return "expired"
+	case days == 0:
+		return "today"
+	default:
+		return "in " + count(days, "day")
+	}
+}
+
+// NewDocument lays the report out in sections
+func NewDocument(r *store.Report) *Document {
+	hosts := 0
+	for _, s := range r.Subnets {
+		hosts += len(s.Hosts)
+	}
+	doc := &Document{
+		Title: "Situation report",
+		Subtitle: fmt.Sprintf("Generated on %s - %s, %s, %s",
+			r.GeneratedAt.Local().Format(time.DateTime),
+			count(len(r.Subnets), "subnet"),
+			count(hosts, "host"),
+			count(len(r.Services), "exposed service"),
+		),
+		Sections: make([]*Section, 0),
+	}
+
+	for _, s := range r.Subnets {
+		title := "Subnet " + s.CIDR
+		if s.Tag != "" {
+			title += " (" + s.Tag + ")"
+		}
+		section := &Section{
+			Title:   title,
+			Note:    count(len(s.Hosts), "host"),
+			Headers: []string{"Hostname", "IP", "MAC", "Vendor", "OS", "Ports"},
+		}
+		for _, h := range s.Hosts {
+			section.Rows = append(section.Rows, []string{h.Hostname, h.IP, h.MAC, h.Vendor, h.OS, strings.Join(h.Ports, " ")})
+		}
+		doc.Sections = append(doc.Sections, section)
+	}
+
+	services := &Section{
+		Title:   "Exposed services",
+		Note:    "Endpoints that are not bound to a loopback address",
+		Headers: []string{"Host", "Address", "Port", "Protocols", "Application"},
+	}
+	for _, s := range r.Services {
+		services.Rows = append(services.Rows, []string{s.Host, s.Addr, s.Port, strings.Join(s.Protocols, ", "), path.Base(s.Application)})
+	}
+	doc.Sections = append(doc.Sections, services)
+
+	certs := &Section{
+		Title:   "TLS certificates near expiry",
+		Note:    "Certificates expired or expiring before " + r.CertificateDeadline.Local().Format(time.DateOnly),
+		Headers: []string{"Host", "Endpoint", "Subject", "Issuer", "Not after", "Expires"},
+	}
+	for _, c := range r.Certificates {
+		certs.Rows = append(certs.Rows, []string{
+			c.Host,
+			c.Endpoint,
+			c.Subject,
+			c.Issuer,
+			c.NotAfter.Local().Format(time.DateOnly),
+			expiry(c.NotAfter, r.GeneratedAt),
+		})
+	}
+	doc.Sections = append(doc.Sections, certs)
+
+	saas := &Section{
+		Title:   "SaaS usage",
+		Headers: []string{"SaaS", "Endpoints", "Flows", "Machines"},
+	}
+	for _, s := range r.SaaS {
+		saas.Rows = append(saas.Rows, []string{s.Name, fmt.Sprint(s.Endpoints), fmt.Sprint(s.Flows), fmt.Sprint(s.Machines)})
+	}
+	doc.Sections = append(doc.Sections, saas)
+
+	packages := &Section{
+		Title:   "Packages",
+		Headers: []string{"Manager", "Packages", "Machines"},
+	}
+	for _, p := range r.Packages {
+		manager := p.Manager
+		if manager == "" {
+			manager = "unknown"
+		}
+		packages.Rows = append(packages.Rows, []string{manager, fmt.Sprint(p.Packages), fmt.Sprint(p.Machines)})
+	}
+	doc.Sections = append(doc.Sections, packages)
+
+	runs := &Section{
+		Title:   "Last runs",
+		Headers: []string{"Agent", "Host", "Version", "Started", "Duration", "Status"},
+	}
+	for _, a := range r.Runs {
+		host := ""
+		if a.Machine != nil {
+			host = a.Machine.Hostname
+		}
+		started := ""
+		if !a.LastRunStart.IsZero() {
+			started = a.LastRunStart.Local().Format(time.DateTime)
+		}
+		runs.Rows = append(runs.Rows, []string{
+			a.Agent,
+			host,
+			a.Version,
+			started,
+			a.LastRunDuration.Truncate(time.Millisecond).String(),
+			a.LastStatus,
+		})
+	}
+	doc.Sections = append(doc.Sections, runs)
+
+	errors := &Section{
+		Title:   "Module errors",
+		Note:    "Errors returned by the modules during the last run of every agent",
+		Headers: []string{"Agent", "Host", "Module", "Message"},
+	}
+	for _, e := range r.Errors {
+		errors.Rows = append(errors.Rows, []string{e.Agent, e.Host, e.Module, e.Message})
+	}
+	doc.Sections = append(doc.Sections, errors)
+
+	return doc
+}
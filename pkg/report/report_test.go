@@ -0,0 +1,55 @@
+package report
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/situation-sh/situation/pkg/models"
+	"github.com/situation-sh/situation/pkg/store"
+)
+
+func testReport() *store.Report {
+	now := time.Now()
+	return &store.Report{
+		GeneratedAt:         now,
+		CertificateDeadline: now.Add(store.DefaultCertificateWindow),
+		Subnets: []*store.ReportSubnet{
+			{CIDR: "10.0.0.0/24", Hosts: []*store.ReportHost{
+				{Hostname: "db01", IP: "10.0.0.10", Ports: []string{"tcp/22", "tcp/5432"}},
+			}},
+		},
+		Services: []*store.ReportService{
+			{Host: "db01", Addr: "0.0.0.0", Port: "tcp/5432", Application: "/usr/bin/<postgres>"},
+		},
+		Certificates: []*store.ReportCert{
+			{Host: "web01", Endpoint: "10.0.0.20:443", Subject: "CN=web01", NotAfter: now.Add(-time.Hour)},
+		},
+		Packages: []*store.PackageCount{{Manager: "dpkg", Packages: 10, Machines: 1}},
+		Runs:     []*models.Agent{{Agent: "agent", LastStatus: models.AgentStatusPartial}},
+		Errors:   []*store.ReportModuleErr{{Agent: "agent", Module: "docker", Message: "pipe | broken"}},
+	}
+}
+
+func TestRender(t *testing.T) {
+	r := testReport()
+	expected := map[string][]string{
+		"md":   {"# Situation report", "## Subnet 10.0.0.0/24", `pipe \| broken`, "| web01 | 10.0.0.20:443 |", "expired"},
+		"html": {"<h2>Subnet 10.0.0.0/24</h2>", "<td>&lt;postgres&gt;</td>", "<td>pipe | broken</td>"},
+		"svg":  {"<svg ", "&lt;postgres&gt;", "Module errors"},
+	}
+	for format, fragments := range expected {
+		var out strings.Builder
+		if err := Render(&out, r, format); err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		for _, f := range fragments {
+			if !strings.Contains(out.String(), f) {
+				t.Errorf("%s: %q not found in\n%s", format, f, out.String())
+			}
+		}
+	}
+	if err := Render(&strings.Builder{}, r, "pdf"); err == nil {
+		t.Error("expected an error for an unsupported format")
+	}
+}
@@ -0,0 +1,73 @@
+package report
+
+import (
+	"io"
+	"strings"
+
+	"charm.land/lipgloss/v2"
+	"charm.land/lipgloss/v2/table"
+	"github.com/situation-sh/situation/pkg/tui"
+)
+
+// maximum width of a cell in the SVG output (the image would be
+// unreadable with long messages)
+const svgCellWidth = 48
+
+var (
+	svgTitleStyle   = lipgloss.NewStyle().Bold(true).Foreground(tui.AccentColor)
+	svgSectionStyle = lipgloss.NewStyle().Bold(true).MarginTop(1)
+	svgFaintStyle   = lipgloss.NewStyle().Faint(true)
+	svgCellStyle    = lipgloss.NewStyle().Padding(0, 1)
+)
+
+func svgCell(s string) string {
+	r := []rune(strings.Join(strings.Fields(s), " "))
+	if len(r) <= svgCellWidth {
+		return string(r)
+	}
+	return string(r[:svgCellWidth-1]) + "…"
+}
+
+// renderText renders the document like a terminal would
+func renderText(doc *Document) string {
+	blocks := []string{svgTitleStyle.Render(doc.Title), svgFaintStyle.Render(doc.Subtitle)}
+	for _, s := range doc.Sections {
+		blocks = append(blocks, svgSectionStyle.Render(s.Title))
+		if s.Note != "" {
+			blocks = append(blocks, svgFaintStyle.Render(s.Note))
+		}
+		if len(s.Rows) == 0 {
+			blocks = append(blocks, svgFaintStyle.Render("None"))
+			continue
+		}
+		rows := make([][]string, 0, len(s.Rows))
+		for _, row := range s.Rows {
+			cells := make([]string, len(row))
+			for i, c := range row {
+				cells[i] = svgCell(c)
+			}
+			rows = append(rows, cells)
+		}
+		t := table.New().
+			Border(lipgloss.RoundedBorder()).
+			StyleFunc(func(row, col int) lipgloss.Style {
+				if row == table.HeaderRow {
+					return svgCellStyle.Bold(true)
+				}
+				return svgCellStyle
+			}).
+			Headers(s.Headers...).
+			Rows(rows...)
+		blocks = append(blocks, t.String())
+	}
+	return lipgloss.JoinVertical(lipgloss.Left, blocks...)
+}
+
+func renderSVG(w io.Writer, doc *Document) error {
+	svg, err := tui.ANSIToSVG(renderText(doc))
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, svg)
+	return err
+}
@@ -270,6 +270,59 @@ func (s *BunStorage) ANY(attr string) string {
 	}
 }
 
+// ANYLIKE is like ANY but matches the elements of the array
+// against a LIKE pattern (case-insensitive).
+func (s *BunStorage) ANYLIKE(attr string) string {
+	switch s.db.Dialect().Name() {
+	case dialect.SQLite:
+		return fmt.Sprintf("EXISTS (SELECT 1 FROM json_each(%s) WHERE LOWER(value) LIKE ?)", attr)
+	case dialect.PG:
+		return fmt.Sprintf("EXISTS (SELECT 1 FROM unnest(%s) AS v WHERE LOWER(v) LIKE ?)", attr)
+	default:
+		return ""
+	}
+}
+
+// JSONANY is like ANY but for the columns that are stored as JSON arrays
+// in both dialects (for instance application_endpoints.application_protocols).
+func (s *BunStorage) JSONANY(attr string) string {
+	switch s.db.Dialect().Name() {
+	case dialect.SQLite:
+		return fmt.Sprintf("EXISTS (SELECT 1 FROM json_each(%s) WHERE value = ?)", attr)
+	case dialect.PG:
+		return fmt.Sprintf("%s::jsonb @> jsonb_build_array(?::text)", attr)
+	default:
+		return ""
+	}
+}
+
+// JSONTEXT generates a dialect-specific expression that extracts
+// a field of a JSON object column as text (e.g. JSONTEXT("tls", "subject")).
+// The key must not come from the user.
+func (s *BunStorage) JSONTEXT(attr string, key string) string {
+	switch s.db.Dialect().Name() {
+	case dialect.SQLite:
+		return fmt.Sprintf("json_extract(%s, '$.%s')", attr, key)
+	case dialect.PG:
+		return fmt.Sprintf("(%s->>'%s')", attr, key)
+	default:
+		return ""
+	}
+}
+
+// TIMESTAMP generates a dialect-specific expression that converts a text
+// timestamp (RFC3339 or SQL format with a time zone) to a comparable value.
+func (s *BunStorage) TIMESTAMP(expr string) string {
+	switch s.db.Dialect().Name() {
+	case dialect.SQLite:
+		return fmt.Sprintf("datetime(%s)", expr)
+	case dialect.PG:
+		return fmt.Sprintf("CAST(%s AS timestamptz)", expr)
+	default:
+		return ""
+	}
+}
+
 // OVERLAP generates a dialect-specific array overlap expression for checking if any value
 // from an array matches any value in a JSON array column.
 // Use with ARRAY() to format the values: Where(s.OVERLAP("ip"), s.ARRAY(ips))
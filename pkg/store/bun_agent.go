@@ -0,0 +1,142 @@
+package store
+
+import (
+	"context"
+	"runtime"
+	"sort"
+	"time"
+
+	"github.com/situation-sh/situation/pkg/models"
+	"github.com/uptrace/bun"
+)
+
+// AgentStarted registers (or refreshes) the current agent in the agents
+// table and marks its last run as running.
+func (s *BunStorage) AgentStarted(ctx context.Context, version string, commit string) (*models.Agent, error) {
+	now := time.Now()
+	agent := models.Agent{
+		Agent:        s.agent,
+		Version:      version,
+		Commit:       commit,
+		Platform:     runtime.GOOS,
+		Arch:         runtime.GOARCH,
+		LastSeen:     now,
+		LastRunStart: now,
+		LastStatus:   models.AgentStatusRunning,
+	}
+	_, err := s.db.NewInsert().
+		Model(&agent).
+		On("CONFLICT (agent) DO UPDATE").
+		Set("updated_at = CURRENT_TIMESTAMP").
+		Set("version = EXCLUDED.version").
+		Set(`"commit" = EXCLUDED."commit"`).
+		Set("platform = EXCLUDED.platform").
+		Set("arch = EXCLUDED.arch").
+		Set("last_seen = EXCLUDED.last_seen").
+		Set("last_run_start = EXCLUDED.last_run_start").
+		Set("last_status = EXCLUDED.last_status").
+		Set("last_error = NULL").
+		Set("module_errors = NULL").
+		Returning("*").
+		Exec(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &agent, nil
+}
+
+// AgentFinished records the outcome of the run started with AgentStarted.
+// runErr is the error that stopped the run (if any) while moduleErrors
+// gathers the errors returned by the modules themselves.
+func (s *BunStorage) AgentFinished(ctx context.Context, agent *models.Agent, runErr error, moduleErrors []*models.ModuleError) error {
+	now := time.Now()
+	agent.LastSeen = now
+	agent.LastRunDuration = now.Sub(agent.LastRunStart)
+	agent.ModuleErrors = moduleErrors
+	agent.LastError = ""
+	switch {
+	case runErr != nil:
+		agent.LastStatus = models.AgentStatusFailure
+		agent.LastError = runErr.Error()
+	case len(moduleErrors) > 0:
+		agent.LastStatus = models.AgentStatusPartial
+	default:
+		agent.LastStatus = models.AgentStatusSuccess
+	}
+
+	columns := []string{"last_seen", "last_run_duration", "last_status", "last_error", "module_errors"}
+	// the host may have been created (or claimed) during the run
+	if hostID := s.cache.HostID; hostID > 0 {
+		agent.MachineID = hostID
+		columns = append(columns, "machine_id")
+	}
+
+	_, err := s.db.NewUpdate().
+		Model(agent).
+		Column(columns...).
+		Set("updated_at = CURRENT_TIMESTAMP").
+		Where("agent = ?", agent.Agent).
+		Exec(ctx)
+	return err
+}
+
+// GetAgents returns all the registered agents along with
+// the machine they run on.
+func (s *BunStorage) GetAgents(ctx context.Context) ([]*models.Agent, error) {
+	agents := make([]*models.Agent, 0)
+	err := s.db.NewSelect().
+		Model(&agents).
+		Relation("Machine").
+		Order("agent.last_seen DESC").
+		Scan(ctx)
+	return agents, err
+}
+
+// GetAgentConfigs returns the enabled central configuration documents
+// that target the current agent, in the order they must be merged:
+// all < subnet tag < machine tag < agent, then by priority.
+func (s *BunStorage) GetAgentConfigs(ctx context.Context) ([]*models.AgentConfig, error) {
+	// tags of the machine running the agent
+	machineTags := s.db.NewSelect().
+		TableExpr("machines AS m").
+		Column("m.tag").
+		Where("m.agent = ?", s.agent).
+		Where("m.tag IS NOT NULL")
+
+	// tags of the subnets the machine running the agent is connected to
+	subnetTags := s.db.NewSelect().
+		TableExpr("subnetworks AS sub").
+		Column("sub.tag").
+		Join("JOIN network_interface_subnets AS nis ON nis.subnetwork_id = sub.id").
+		Join("JOIN network_interfaces AS ni ON ni.id = nis.network_interface_id").
+		Join("JOIN machines AS m ON m.id = ni.machine_id").
+		Where("m.agent = ?", s.agent).
+		Where("sub.tag IS NOT NULL")
+
+	configs := make([]*models.AgentConfig, 0)
+	err := s.db.NewSelect().
+		Model(&configs).
+		Where("disabled = ?", false).
+		WhereGroup(" AND ", func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.
+				Where("target_type = ?", models.AgentConfigTargetAll).
+				WhereOr("target_type = ? AND target = ?", models.AgentConfigTargetAgent, s.agent).
+				WhereOr("target_type = ? AND target IN (?)", models.AgentConfigTargetMachine, machineTags).
+				WhereOr("target_type = ? AND target IN (?)", models.AgentConfigTargetSubnet, subnetTags)
+		}).
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(configs, func(i, j int) bool {
+		if configs[i].Rank() != configs[j].Rank() {
+			return configs[i].Rank() < configs[j].Rank()
+		}
+		if configs[i].Priority != configs[j].Priority {
+			return configs[i].Priority < configs[j].Priority
+		}
+		return configs[i].ID < configs[j].ID
+	})
+	return configs, nil
+}
@@ -0,0 +1,118 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/uptrace/bun"
+)
+
+// CannedQuery is a predefined read-only query. It is built with the
+// dialect helpers so the same query runs on sqlite and postgres.
+type CannedQuery struct {
+	Name        string
+	Description string
+	// Window is the default period the query looks at (the age of the
+	// stale machines, the expiry horizon of the certificates...)
+	Window time.Duration
+
+	build func(s *BunStorage, now time.Time, window time.Duration) *bun.SelectQuery
+}
+
+// CannedQueries lists the queries available by name
+var CannedQueries = []*CannedQuery{
+	{
+		Name:        "exposed-services",
+		Description: "Endpoints of the inventoried machines listening on a non-loopback address",
+		build:       exposedServicesQuery,
+	},
+	{
+		Name:        "stale-machines",
+		Description: "Machines that have not been updated within the window",
+		Window:      7 * 24 * time.Hour,
+		build:       staleMachinesQuery,
+	},
+	{
+		Name:        "expiring-certs",
+		Description: "TLS certificates that expire within the window (or have expired)",
+		Window:      DefaultCertificateWindow,
+		build:       expiringCertsQuery,
+	},
+}
+
+// GetCannedQuery returns the canned query with the given name (nil if
+// it does not exist)
+func GetCannedQuery(name string) *CannedQuery {
+	for _, q := range CannedQueries {
+		if q.Name == name {
+			return q
+		}
+	}
+	return nil
+}
+
+// CannedSQL returns the SQL of the canned query for the dialect of the
+// storage. The default window of the query is used if window is zero.
+func (s *BunStorage) CannedSQL(q *CannedQuery, window time.Duration) string {
+	if window <= 0 {
+		window = q.Window
+	}
+	return q.build(s, time.Now().UTC(), window).String()
+}
+
+// RunCannedQuery runs the canned query with the given name through SafeQuery
+func (s *BunStorage) RunCannedQuery(ctx context.Context, name string, window time.Duration, opts QueryOptions) (*QueryResult, error) {
+	q := GetCannedQuery(name)
+	if q == nil {
+		return nil, fmt.Errorf("unknown canned query: %s", name)
+	}
+	return s.SafeQuery(ctx, s.CannedSQL(q, window), opts)
+}
+
+// endpointMachineJoin attaches the endpoints (ae) to their machine (m),
+// through their application, their network interface or, as a last
+// resort, the network interface owning their address
+func (s *BunStorage) endpointMachineJoin(q *bun.SelectQuery) *bun.SelectQuery {
+	return q.
+		Join("LEFT JOIN applications AS a ON a.id = ae.application_id").
+		Join("LEFT JOIN network_interfaces AS n ON n.id = ae.network_interface_id").
+		Join("LEFT JOIN machines AS m ON m.id = COALESCE(a.machine_id, n.machine_id, "+
+			"(SELECT ni.machine_id FROM network_interfaces AS ni WHERE "+s.ANY("ni.ip")+" LIMIT 1))",
+			bun.Ident("ae.addr"))
+}
+
+func exposedServicesQuery(s *BunStorage, _ time.Time, _ time.Duration) *bun.SelectQuery {
+	q := s.db.NewSelect().TableExpr("application_endpoints AS ae")
+	return s.endpointMachineJoin(q).
+		ColumnExpr("m.id AS machine_id, m.hostname").
+		ColumnExpr("ae.addr, ae.protocol, ae.port").
+		ColumnExpr("a.name AS application, ae.application_protocols").
+		Where("m.id IS NOT NULL").
+		Where("ae.addr NOT LIKE '127.%'").
+		Where("ae.addr <> '::1'").
+		Order("m.hostname", "ae.addr", "ae.protocol", "ae.port")
+}
+
+func staleMachinesQuery(s *BunStorage, now time.Time, window time.Duration) *bun.SelectQuery {
+	return s.db.NewSelect().
+		TableExpr("machines AS m").
+		ColumnExpr("m.id, m.hostname, m.platform, m.distribution, m.agent, m.updated_at").
+		Where(s.TIMESTAMP("m.updated_at")+" < "+s.TIMESTAMP("?"), now.Add(-window)).
+		Order("m.updated_at", "m.id")
+}
+
+func expiringCertsQuery(s *BunStorage, now time.Time, window time.Duration) *bun.SelectQuery {
+	notAfter := s.TIMESTAMP(s.JSONTEXT("ae.tls", "not_after"))
+	q := s.db.NewSelect().TableExpr("application_endpoints AS ae")
+	return s.endpointMachineJoin(q).
+		ColumnExpr("m.hostname, ae.addr, ae.port").
+		ColumnExpr(s.JSONTEXT("ae.tls", "subject")+" AS subject").
+		ColumnExpr(s.JSONTEXT("ae.tls", "issuer")+" AS issuer").
+		ColumnExpr(s.JSONTEXT("ae.tls", "not_after")+" AS not_after").
+		Where("ae.tls IS NOT NULL").
+		// zero dates mean that the certificate could not be read
+		Where(notAfter+" > "+s.TIMESTAMP("?"), time.Unix(0, 0).UTC()).
+		Where(notAfter+" < "+s.TIMESTAMP("?"), now.Add(window)).
+		OrderExpr(notAfter)
+}
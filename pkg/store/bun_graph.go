@@ -0,0 +1,446 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/situation-sh/situation/pkg/models"
+	"github.com/uptrace/bun"
+)
+
+// DefaultGraphDepth bounds the walks through the inventory graph
+// (machine -> nic -> subnet -> nic -> machine is 4 hops)
+const DefaultGraphDepth = 12
+
+// ErrNoPath is returned by ShortestPath when the nodes are not connected
+var ErrNoPath = errors.New("no path between the nodes")
+
+// NodeKind is the type of a node of the inventory graph
+type NodeKind string
+
+const (
+	NodeMachine     NodeKind = "machine"
+	NodeNIC         NodeKind = "nic"
+	NodeSubnet      NodeKind = "subnet"
+	NodeEndpoint    NodeKind = "endpoint"
+	NodeApplication NodeKind = "application"
+	NodePackage     NodeKind = "package"
+	NodeUser        NodeKind = "user"
+)
+
+// NodeKinds lists the kinds of node
+var NodeKinds = []NodeKind{NodeMachine, NodeNIC, NodeSubnet, NodeEndpoint, NodeApplication, NodePackage, NodeUser}
+
+// EdgeKind is the type of a relationship between two nodes
+type EdgeKind string
+
+const (
+	EdgeHas      EdgeKind = "has"      // machine -> nic, application, package, user
+	EdgeHosts    EdgeKind = "hosts"    // machine -> child machine (container, VM)
+	EdgeMember   EdgeKind = "member"   // nic -> subnet
+	EdgeListens  EdgeKind = "listens"  // application -> endpoint
+	EdgeBinds    EdgeKind = "binds"    // nic -> endpoint
+	EdgeProvides EdgeKind = "provides" // package -> application
+	EdgeRuns     EdgeKind = "runs"     // user -> application
+	EdgeFlow     EdgeKind = "flow"     // application (or nic) -> endpoint
+)
+
+// Node is a row of the inventory seen as a graph node
+type Node struct {
+	Kind  NodeKind `json:"kind"`
+	ID    int64    `json:"id"`
+	Label string   `json:"label,omitempty"`
+}
+
+func (n Node) String() string {
+	return fmt.Sprintf("%s:%d", n.Kind, n.ID)
+}
+
+func (n Node) is(other Node) bool {
+	return n.Kind == other.Kind && n.ID == other.ID
+}
+
+// ParseNode parses the kind:id notation (e.g. machine:12)
+func ParseNode(s string) (Node, error) {
+	kind, id, found := strings.Cut(s, ":")
+	if !found {
+		return Node{}, fmt.Errorf("invalid node %q (expected kind:id)", s)
+	}
+	if !slices.Contains(NodeKinds, NodeKind(kind)) {
+		return Node{}, fmt.Errorf("invalid node kind %q (choose from %v)", kind, NodeKinds)
+	}
+	n, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return Node{}, fmt.Errorf("invalid node id %q: %w", id, err)
+	}
+	return Node{Kind: NodeKind(kind), ID: n}, nil
+}
+
+// Edge is a directed relationship between two nodes
+type Edge struct {
+	From Node     `json:"from"`
+	To   Node     `json:"to"`
+	Kind EdgeKind `json:"kind"`
+}
+
+func (e *Edge) String() string {
+	return fmt.Sprintf("%s -%s-> %s", e.From, e.Kind, e.To)
+}
+
+// Reached is a node found by a walk, Depth hops away from the start
+type Reached struct {
+	Node
+	Depth int `json:"depth"`
+}
+
+// graphEdge is a kind of edge along with the query that lists
+// its (src, dst) ids
+type graphEdge struct {
+	kind     EdgeKind
+	from, to NodeKind
+	query    string
+	reversed bool
+}
+
+// reverse returns the same edge walked backwards
+func (e graphEdge) reverse() graphEdge {
+	e.from, e.to = e.to, e.from
+	e.reversed = !e.reversed
+	return e
+}
+
+// graphEdges returns the definition of all the edges of the graph. The
+// endpoints that are attached neither to an application nor to a
+// network interface are bound to the network interface owning
+// their address.
+func (s *BunStorage) graphEdges() []graphEdge {
+	unbound := s.db.QueryGen().FormatQuery(`SELECT ni.id AS src, ae.id AS dst
+		FROM application_endpoints AS ae
+		JOIN network_interfaces AS ni ON `+s.ANY("ni.ip")+`
+		WHERE ae.application_id IS NULL AND ae.network_interface_id IS NULL`, bun.Ident("ae.addr"))
+	return []graphEdge{
+		{EdgeHas, NodeMachine, NodeNIC, "SELECT machine_id AS src, id AS dst FROM network_interfaces WHERE machine_id IS NOT NULL", false},
+		{EdgeHas, NodeMachine, NodeApplication, "SELECT machine_id AS src, id AS dst FROM applications", false},
+		{EdgeHas, NodeMachine, NodePackage, "SELECT machine_id AS src, id AS dst FROM packages", false},
+		{EdgeHas, NodeMachine, NodeUser, "SELECT machine_id AS src, id AS dst FROM users", false},
+		{EdgeHosts, NodeMachine, NodeMachine, "SELECT parent_machine_id AS src, id AS dst FROM machines WHERE parent_machine_id IS NOT NULL", false},
+		{EdgeMember, NodeNIC, NodeSubnet, "SELECT network_interface_id AS src, subnetwork_id AS dst FROM network_interface_subnets", false},
+		{EdgeListens, NodeApplication, NodeEndpoint, "SELECT application_id AS src, id AS dst FROM application_endpoints WHERE application_id IS NOT NULL", false},
+		{EdgeBinds, NodeNIC, NodeEndpoint, "SELECT network_interface_id AS src, id AS dst FROM application_endpoints WHERE network_interface_id IS NOT NULL", false},
+		{EdgeBinds, NodeNIC, NodeEndpoint, unbound, false},
+		{EdgeProvides, NodePackage, NodeApplication, "SELECT package_id AS src, id AS dst FROM applications WHERE package_id IS NOT NULL", false},
+		{EdgeRuns, NodeUser, NodeApplication, "SELECT user_id AS src, application_id AS dst FROM user_applications", false},
+		{EdgeFlow, NodeApplication, NodeEndpoint, "SELECT src_application_id AS src, dst_endpoint_id AS dst FROM flows WHERE src_application_id IS NOT NULL AND dst_endpoint_id IS NOT NULL", false},
+		{EdgeFlow, NodeNIC, NodeEndpoint, "SELECT src_network_interface_id AS src, dst_endpoint_id AS dst FROM flows WHERE src_application_id IS NULL AND src_network_interface_id IS NOT NULL AND dst_endpoint_id IS NOT NULL", false},
+	}
+}
+
+// networkEdges are the edges walked by ShortestPath and ReachableFrom:
+// the machines, their network interfaces and applications, the subnets
+// (both ways) and the flows (from the client to the server only)
+func (s *BunStorage) networkEdges() []graphEdge {
+	out := make([]graphEdge, 0)
+	for _, e := range s.graphEdges() {
+		switch {
+		case e.kind == EdgeFlow:
+			out = append(out, e)
+		case e.kind == EdgeHas && (e.to == NodeNIC || e.to == NodeApplication),
+			e.kind == EdgeHosts, e.kind == EdgeMember, e.kind == EdgeListens, e.kind == EdgeBinds:
+			out = append(out, e, e.reverse())
+		}
+	}
+	return out
+}
+
+// blastEdges are the edges walked by BlastRadius: from an endpoint to
+// its clients, from the clients to their own endpoints and to the
+// machines hosting them
+func (s *BunStorage) blastEdges() []graphEdge {
+	out := make([]graphEdge, 0)
+	for _, e := range s.graphEdges() {
+		switch {
+		case e.kind == EdgeFlow, e.kind == EdgeHas && (e.to == NodeNIC || e.to == NodeApplication):
+			out = append(out, e.reverse())
+		case e.kind == EdgeListens:
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// edgesCTE returns the body of a CTE with the columns
+// (src_kind, src_id, dst_kind, dst_id, kind, rev), rev being 1 for
+// the edges walked backwards
+func edgesCTE(edges []graphEdge) string {
+	parts := make([]string, len(edges))
+	for i, e := range edges {
+		src, dst, rev := "g.src", "g.dst", 0
+		if e.reversed {
+			src, dst, rev = dst, src, 1
+		}
+		parts[i] = fmt.Sprintf(
+			"SELECT CAST('%s' AS TEXT) AS src_kind, %s AS src_id, CAST('%s' AS TEXT) AS dst_kind, %s AS dst_id, CAST('%s' AS TEXT) AS kind, %d AS rev FROM (%s) AS g",
+			e.from, src, e.to, dst, e.kind, rev, e.query)
+	}
+	return strings.Join(parts, "\nUNION ALL\n")
+}
+
+type graphRow struct {
+	SrcKind string `bun:"src_kind"`
+	SrcID   int64  `bun:"src_id"`
+	DstKind string `bun:"dst_kind"`
+	DstID   int64  `bun:"dst_id"`
+	Kind    string `bun:"kind"`
+	Rev     int    `bun:"rev"`
+	Depth   int    `bun:"depth"`
+}
+
+// walk runs a breadth-first search from the start node with a recursive
+// CTE. It returns the minimal depth of every reached node and the edge
+// through which it has been reached first.
+func (s *BunStorage) walk(ctx context.Context, start Node, edges []graphEdge, maxDepth int) (map[Node]*graphRow, error) {
+	if maxDepth <= 0 {
+		maxDepth = DefaultGraphDepth
+	}
+	query := `WITH RECURSIVE edges AS MATERIALIZED (` + edgesCTE(edges) + `),
+walk(src_kind, src_id, dst_kind, dst_id, kind, rev, depth) AS (
+	SELECT CAST(NULL AS TEXT), CAST(NULL AS BIGINT), CAST(? AS TEXT), CAST(? AS BIGINT), CAST(NULL AS TEXT), 0, 0
+	UNION
+	SELECT e.src_kind, e.src_id, e.dst_kind, e.dst_id, e.kind, e.rev, w.depth + 1
+	FROM walk AS w
+	JOIN edges AS e ON e.src_kind = w.dst_kind AND e.src_id = w.dst_id
+	WHERE w.depth < ?
+)
+SELECT src_kind, src_id, dst_kind, dst_id, kind, rev, depth FROM walk ORDER BY depth, src_kind, src_id, kind`
+
+	rows := make([]*graphRow, 0)
+	if err := s.db.NewRaw(query, string(start.Kind), start.ID, maxDepth).Scan(ctx, &rows); err != nil {
+		return nil, err
+	}
+	reached := make(map[Node]*graphRow)
+	for _, r := range rows {
+		n := Node{Kind: NodeKind(r.DstKind), ID: r.DstID}
+		if _, exists := reached[n]; !exists {
+			reached[n] = r
+		}
+	}
+	return reached, nil
+}
+
+// reachedNodes sorts the reached nodes (but the start) by depth
+func (s *BunStorage) reachedNodes(ctx context.Context, start Node, reached map[Node]*graphRow) ([]*Reached, error) {
+	out := make([]*Reached, 0, len(reached))
+	for n, r := range reached {
+		if !n.is(start) {
+			out = append(out, &Reached{Node: n, Depth: r.Depth})
+		}
+	}
+	slices.SortFunc(out, func(a, b *Reached) int {
+		if a.Depth != b.Depth {
+			return a.Depth - b.Depth
+		}
+		if a.Kind != b.Kind {
+			return strings.Compare(string(a.Kind), string(b.Kind))
+		}
+		return int(a.ID - b.ID)
+	})
+	nodes := make([]*Node, len(out))
+	for i, r := range out {
+		nodes[i] = &r.Node
+	}
+	if err := s.labelNodes(ctx, nodes...); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// Neighbors returns the edges (in both directions) of the node
+func (s *BunStorage) Neighbors(ctx context.Context, n Node) ([]*Edge, error) {
+	query := `WITH edges AS (` + edgesCTE(s.graphEdges()) + `)
+SELECT src_kind, src_id, dst_kind, dst_id, kind, rev FROM edges
+WHERE (src_kind = ? AND src_id = ?) OR (dst_kind = ? AND dst_id = ?)
+ORDER BY kind, src_kind, src_id, dst_kind, dst_id`
+
+	rows := make([]*graphRow, 0)
+	if err := s.db.NewRaw(query, string(n.Kind), n.ID, string(n.Kind), n.ID).Scan(ctx, &rows); err != nil {
+		return nil, err
+	}
+	edges := make([]*Edge, len(rows))
+	for i, r := range rows {
+		edges[i] = r.edge()
+	}
+	return edges, s.labelEdges(ctx, edges...)
+}
+
+// ShortestPath returns the edges of a shortest path from a to b through
+// the machines, their network interfaces and applications, the subnets
+// and the flows (walked from the client to the server). Edges walked
+// backwards (e.g. from a nic to its machine) are returned as is, so
+// To is not always the next node. It returns ErrNoPath if b cannot be
+// reached within maxDepth hops.
+func (s *BunStorage) ShortestPath(ctx context.Context, a, b Node, maxDepth int) ([]*Edge, error) {
+	reached, err := s.walk(ctx, a, s.networkEdges(), maxDepth)
+	if err != nil {
+		return nil, err
+	}
+	if _, exists := reached[b]; !exists {
+		return nil, ErrNoPath
+	}
+	path := make([]*Edge, 0)
+	for n := b; !n.is(a); {
+		r := reached[n]
+		path = append(path, r.edge())
+		n = Node{Kind: NodeKind(r.SrcKind), ID: r.SrcID}
+	}
+	slices.Reverse(path)
+	return path, s.labelEdges(ctx, path...)
+}
+
+// ReachableFrom returns the nodes reachable from the machine through its
+// network interfaces and applications, the subnets and the flows
+func (s *BunStorage) ReachableFrom(ctx context.Context, machineID int64, maxDepth int) ([]*Reached, error) {
+	start := Node{Kind: NodeMachine, ID: machineID}
+	reached, err := s.walk(ctx, start, s.networkEdges(), maxDepth)
+	if err != nil {
+		return nil, err
+	}
+	return s.reachedNodes(ctx, start, reached)
+}
+
+// BlastRadius returns the nodes impacted by the loss of the endpoint:
+// the clients of the endpoint (applications or network interfaces) and
+// their machines, then the clients of the endpoints of these
+// applications and so on.
+func (s *BunStorage) BlastRadius(ctx context.Context, endpointID int64, maxDepth int) ([]*Reached, error) {
+	start := Node{Kind: NodeEndpoint, ID: endpointID}
+	reached, err := s.walk(ctx, start, s.blastEdges(), maxDepth)
+	if err != nil {
+		return nil, err
+	}
+	return s.reachedNodes(ctx, start, reached)
+}
+
+// edge returns the edge in its original direction
+func (r *graphRow) edge() *Edge {
+	e := &Edge{
+		From: Node{Kind: NodeKind(r.SrcKind), ID: r.SrcID},
+		To:   Node{Kind: NodeKind(r.DstKind), ID: r.DstID},
+		Kind: EdgeKind(r.Kind),
+	}
+	if r.Rev != 0 {
+		e.From, e.To = e.To, e.From
+	}
+	return e
+}
+
+func (s *BunStorage) labelEdges(ctx context.Context, edges ...*Edge) error {
+	nodes := make([]*Node, 0, 2*len(edges))
+	for _, e := range edges {
+		nodes = append(nodes, &e.From, &e.To)
+	}
+	return s.labelNodes(ctx, nodes...)
+}
+
+// labelNodes fills the label of the nodes (hostname, address...)
+func (s *BunStorage) labelNodes(ctx context.Context, nodes ...*Node) error {
+	ids := make(map[NodeKind][]int64)
+	for _, n := range nodes {
+		ids[n.Kind] = append(ids[n.Kind], n.ID)
+	}
+	labels := make(map[Node]string)
+	for kind, list := range ids {
+		slices.Sort(list)
+		list = slices.Compact(list)
+		if err := s.nodeLabels(ctx, kind, list, labels); err != nil {
+			return err
+		}
+	}
+	for _, n := range nodes {
+		n.Label = labels[Node{Kind: n.Kind, ID: n.ID}]
+	}
+	return nil
+}
+
+func (s *BunStorage) nodeLabels(ctx context.Context, kind NodeKind, ids []int64, labels map[Node]string) error {
+	set := func(id int64, label string) {
+		labels[Node{Kind: kind, ID: id}] = label
+	}
+	switch kind {
+	case NodeMachine:
+		machines := make([]*models.Machine, 0)
+		if err := s.db.NewSelect().Model(&machines).Column("id", "hostname").Where("id IN (?)", bun.In(ids)).Scan(ctx); err != nil {
+			return err
+		}
+		for _, m := range machines {
+			set(m.ID, machineName(m))
+		}
+	case NodeNIC:
+		nics := make([]*models.NetworkInterface, 0)
+		if err := s.db.NewSelect().Model(&nics).Column("id", "name", "mac", "ip").Where("id IN (?)", bun.In(ids)).Scan(ctx); err != nil {
+			return err
+		}
+		for _, n := range nics {
+			label := n.Name
+			if label == "" {
+				label = n.MAC
+			}
+			if len(n.IP) > 0 {
+				label = strings.TrimSpace(label + " " + n.IP[0])
+			}
+			set(n.ID, label)
+		}
+	case NodeSubnet:
+		subnets := make([]*models.Subnetwork, 0)
+		if err := s.db.NewSelect().Model(&subnets).Column("id", "network_cidr").Where("id IN (?)", bun.In(ids)).Scan(ctx); err != nil {
+			return err
+		}
+		for _, sub := range subnets {
+			set(sub.ID, sub.NetworkCIDR)
+		}
+	case NodeEndpoint:
+		endpoints := make([]*models.ApplicationEndpoint, 0)
+		if err := s.db.NewSelect().Model(&endpoints).Column("id", "addr", "port", "protocol").Where("id IN (?)", bun.In(ids)).Scan(ctx); err != nil {
+			return err
+		}
+		for _, e := range endpoints {
+			set(e.ID, net.JoinHostPort(e.Addr, strconv.Itoa(int(e.Port)))+"/"+e.Protocol)
+		}
+	case NodeApplication:
+		apps := make([]*models.Application, 0)
+		if err := s.db.NewSelect().Model(&apps).Column("id", "name").Where("id IN (?)", bun.In(ids)).Scan(ctx); err != nil {
+			return err
+		}
+		for _, a := range apps {
+			set(a.ID, a.Name)
+		}
+	case NodePackage:
+		packages := make([]*models.Package, 0)
+		if err := s.db.NewSelect().Model(&packages).Column("id", "name", "version").Where("id IN (?)", bun.In(ids)).Scan(ctx); err != nil {
+			return err
+		}
+		for _, p := range packages {
+			set(p.ID, strings.TrimSpace(p.Name+" "+p.Version))
+		}
+	case NodeUser:
+		users := make([]*models.User, 0)
+		if err := s.db.NewSelect().Model(&users).Column("id", "username", "name", "uid").Where("id IN (?)", bun.In(ids)).Scan(ctx); err != nil {
+			return err
+		}
+		for _, u := range users {
+			label := u.Username
+			if label == "" {
+				label = u.Name
+			}
+			if label == "" {
+				label = u.UID
+			}
+			set(u.ID, label)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,308 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/situation-sh/situation/pkg/models"
+	"github.com/uptrace/bun"
+)
+
+// DefaultRunHistory is the default number of runs kept in the history
+const DefaultRunHistory = 100
+
+// agentMachines selects the machines an agent collects: its host, the
+// children of its host (containers, VMs) and the machines of the
+// subnetworks the host is attached to or that the agent sweeps
+func (s *BunStorage) agentMachines(agent string) *bun.SelectQuery {
+	hostSubnets := s.db.NewSelect().
+		TableExpr("network_interface_subnets AS hnis").
+		Join("JOIN network_interfaces AS hn ON hn.id = hnis.network_interface_id").
+		Join("JOIN machines AS hm ON hm.id = hn.machine_id").
+		Column("hnis.subnetwork_id").
+		Where("hm.agent = ?", agent)
+	sweptSubnets := s.db.NewSelect().
+		TableExpr("sweep_cursors").
+		Column("subnetwork_id").
+		Where("agent = ?", agent)
+	neighbours := s.db.NewSelect().
+		TableExpr("network_interfaces AS an").
+		Join("JOIN network_interface_subnets AS anis ON anis.network_interface_id = an.id").
+		Column("an.machine_id").
+		Where("anis.subnetwork_id IN (?)", hostSubnets).
+		WhereOr("anis.subnetwork_id IN (?)", sweptSubnets)
+	return s.db.NewSelect().
+		TableExpr("machines AS am").
+		Column("am.id").
+		Where("am.agent = ?", agent).
+		WhereOr("am.parent_machine_id IN (?)", s.db.NewSelect().
+			TableExpr("machines").
+			Column("id").
+			Where("agent = ?", agent)).
+		WhereOr("am.id IN (?)", neighbours)
+}
+
+// TakeSnapshot returns a compact copy of the current inventory. When
+// agent is not empty, only the machines it collects are kept (see
+// agentMachines), along with their flows.
+func (s *BunStorage) TakeSnapshot(ctx context.Context, agent string) (*models.Snapshot, error) {
+	// scope restricts a query to the machines of the agent
+	scope := func(q *bun.SelectQuery, column string) *bun.SelectQuery {
+		if agent == "" {
+			return q
+		}
+		return q.Where(column+" IN (?)", s.agentMachines(agent))
+	}
+
+	machines := make([]*models.Machine, 0)
+	err := scope(s.db.NewSelect().
+		Model(&machines).
+		Column("machine.id", "machine.hostname").
+		Relation("NICS").
+		Order("machine.id"), "machine.id").
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	snapshot := &models.Snapshot{
+		Machines: make([]*models.SnapshotMachine, 0, len(machines)),
+		Flows:    make([]*models.SnapshotFlow, 0),
+	}
+	byID := make(map[int64]*models.SnapshotMachine, len(machines))
+	for _, m := range machines {
+		sm := &models.SnapshotMachine{ID: m.ID, Hostname: m.Hostname}
+		for _, nic := range m.NICS {
+			sm.NICS = append(sm.NICS, &models.SnapshotNIC{Name: nic.Name, MAC: nic.MAC, IP: nic.IP})
+		}
+		snapshot.Machines = append(snapshot.Machines, sm)
+		byID[m.ID] = sm
+	}
+
+	// ports of the applications and of the network interfaces
+	ports := make([]struct {
+		MachineID int64
+		Protocol  string
+		Port      uint16
+	}, 0)
+	err = scope(s.db.NewSelect().
+		TableExpr("application_endpoints AS ae").
+		Join("LEFT JOIN applications AS a ON a.id = ae.application_id").
+		Join("LEFT JOIN network_interfaces AS n ON n.id = ae.network_interface_id").
+		ColumnExpr("COALESCE(a.machine_id, n.machine_id) AS machine_id").
+		ColumnExpr("ae.protocol, ae.port").
+		Where("COALESCE(a.machine_id, n.machine_id) IS NOT NULL").
+		Distinct(), "COALESCE(a.machine_id, n.machine_id)").
+		Scan(ctx, &ports)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range ports {
+		if sm, exists := byID[p.MachineID]; exists {
+			sm.Ports = append(sm.Ports, portString(p.Protocol, p.Port))
+		}
+	}
+
+	packages := make([]*models.Package, 0)
+	err = scope(s.db.NewSelect().
+		Model(&packages).
+		Column("machine_id", "name", "version").
+		Order("machine_id", "name", "version"), "machine_id").
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range packages {
+		sm, exists := byID[p.MachineID]
+		if !exists {
+			continue
+		}
+		if sm.Packages == nil {
+			sm.Packages = make(map[string]string)
+		}
+		if v, exists := sm.Packages[p.Name]; exists {
+			sm.Packages[p.Name] = v + ", " + p.Version
+		} else {
+			sm.Packages[p.Name] = p.Version
+		}
+	}
+
+	flows := s.db.NewSelect().
+		TableExpr("flows AS f").
+		Join("JOIN application_endpoints AS e ON e.id = f.dst_endpoint_id").
+		Join("LEFT JOIN applications AS sa ON sa.id = f.src_application_id").
+		Join("LEFT JOIN network_interfaces AS sn ON sn.id = f.src_network_interface_id").
+		Join("LEFT JOIN applications AS da ON da.id = e.application_id").
+		Join("LEFT JOIN network_interfaces AS dn ON dn.id = e.network_interface_id").
+		ColumnExpr("COALESCE(sa.machine_id, sn.machine_id) AS src_machine_id").
+		ColumnExpr("f.src_addr").
+		ColumnExpr("sa.name AS application").
+		ColumnExpr("COALESCE(da.machine_id, dn.machine_id) AS dst_machine_id").
+		ColumnExpr("e.addr AS dst_addr, e.protocol, e.port").
+		Order("f.id")
+	if agent != "" {
+		// flows from or to the machines of the agent
+		flows = flows.WhereGroup(" AND ", func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.
+				WhereOr("COALESCE(sa.machine_id, sn.machine_id) IN (?)", s.agentMachines(agent)).
+				WhereOr("COALESCE(da.machine_id, dn.machine_id) IN (?)", s.agentMachines(agent))
+		})
+	}
+	err = flows.Scan(ctx, &snapshot.Flows)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, sm := range snapshot.Machines {
+		slices.Sort(sm.Ports)
+		sm.Ports = slices.Compact(sm.Ports)
+	}
+	return snapshot, nil
+}
+
+// RecordRun adds the run of the agent (once it has finished) to the
+// history along with a snapshot of the machines it collects. Only the
+// keep most recent runs of the agent are kept (all of them if keep is
+// not positive), so that the agents sharing a database do not prune
+// the history of each other.
+func (s *BunStorage) RecordRun(ctx context.Context, agent *models.Agent, keep int) (*models.Run, error) {
+	snapshot, err := s.TakeSnapshot(ctx, agent.Agent)
+	if err != nil {
+		return nil, err
+	}
+	run := &models.Run{
+		Agent:      agent.Agent,
+		StartedAt:  agent.LastRunStart,
+		FinishedAt: time.Now(),
+		Status:     agent.LastStatus,
+		Snapshot:   snapshot,
+	}
+	if _, err := s.db.NewInsert().Model(run).Exec(ctx); err != nil {
+		return nil, err
+	}
+	if keep > 0 {
+		_, err = s.db.NewDelete().
+			Model((*models.Run)(nil)).
+			Where("agent = ?", agent.Agent).
+			Where("id NOT IN (?)", s.db.NewSelect().
+				Model((*models.Run)(nil)).
+				Column("id").
+				Where("agent = ?", agent.Agent).
+				Order("id DESC").
+				Limit(keep)).
+			Exec(ctx)
+	}
+	return run, err
+}
+
+// ListRuns returns the most recent runs of the history
+// (without their snapshot)
+func (s *BunStorage) ListRuns(ctx context.Context, limit int) ([]*models.Run, error) {
+	runs := make([]*models.Run, 0)
+	err := s.db.NewSelect().
+		Model(&runs).
+		ExcludeColumn("snapshot").
+		Order("run.finished_at DESC", "run.id DESC").
+		Limit(limitOrDefault(limit)).
+		Scan(ctx)
+	return runs, err
+}
+
+// GetRun returns a run of the history with its snapshot
+func (s *BunStorage) GetRun(ctx context.Context, id int64) (*models.Run, error) {
+	run := new(models.Run)
+	err := s.db.NewSelect().
+		Model(run).
+		Where("run.id = ?", id).
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return run, nil
+}
+
+// GetRunAt returns the last run that finished before t
+// (it returns sql.ErrNoRows if there is none)
+func (s *BunStorage) GetRunAt(ctx context.Context, t time.Time) (*models.Run, error) {
+	run := new(models.Run)
+	err := s.db.NewSelect().
+		Model(run).
+		Where("run.finished_at <= ?", t).
+		Order("run.finished_at DESC", "run.id DESC").
+		Limit(1).
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return run, nil
+}
+
+// GetPreviousRun returns the run before the latest one of the same
+// agent, that is the state the latest run started from (or the latest
+// run if it is the only one). It returns sql.ErrNoRows if the history
+// is empty.
+func (s *BunStorage) GetPreviousRun(ctx context.Context) (*models.Run, error) {
+	ids := make([]int64, 0)
+	err := s.db.NewSelect().
+		Model((*models.Run)(nil)).
+		Column("id").
+		Where("agent = (?)", s.db.NewSelect().
+			Model((*models.Run)(nil)).
+			Column("agent").
+			Order("finished_at DESC", "id DESC").
+			Limit(1)).
+		Order("finished_at DESC", "id DESC").
+		Limit(2).
+		Scan(ctx, &ids)
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return s.GetRun(ctx, ids[len(ids)-1])
+}
+
+// portString returns the port as tcp/22
+func portString(protocol string, port uint16) string {
+	return fmt.Sprintf("%s/%d", strings.ToLower(protocol), port)
+}
+
+// DiffRuns compares two runs of the history. A nil run stands for the
+// current state of the inventory, restricted to the machines of the
+// agent of the other run. Runs of different agents cannot be compared
+// since their snapshots do not cover the same machines.
+func (s *BunStorage) DiffRuns(ctx context.Context, from *models.Run, to *models.Run) (*Diff, error) {
+	agent := ""
+	for _, run := range []*models.Run{from, to} {
+		if run == nil {
+			continue
+		}
+		if agent != "" && run.Agent != agent {
+			return nil, fmt.Errorf("cannot compare the runs of different agents (%s and %s)", agent, run.Agent)
+		}
+		agent = run.Agent
+	}
+	points := make([]DiffPoint, 2)
+	snapshots := make([]*models.Snapshot, 2)
+	for i, run := range []*models.Run{from, to} {
+		if run != nil {
+			points[i] = DiffPoint{RunID: run.ID, Time: run.FinishedAt}
+			snapshots[i] = run.Snapshot
+			continue
+		}
+		snapshot, err := s.TakeSnapshot(ctx, agent)
+		if err != nil {
+			return nil, err
+		}
+		points[i] = DiffPoint{Time: time.Now()}
+		snapshots[i] = snapshot
+	}
+	diff := DiffSnapshots(snapshots[0], snapshots[1])
+	diff.From, diff.To = points[0], points[1]
+	return diff, nil
+}
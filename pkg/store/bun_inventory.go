@@ -0,0 +1,437 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/situation-sh/situation/pkg/models"
+	"github.com/uptrace/bun"
+)
+
+// default number of rows returned by the inventory queries
+const defaultInventoryLimit = 100
+
+// MachineFilter gathers the optional criteria of ListMachines.
+// Empty fields are ignored. Hostname and Distribution accept * wildcards
+// (substring match otherwise) and Subnet is a CIDR.
+type MachineFilter struct {
+	Hostname     string
+	Platform     string
+	Distribution string
+	Subnet       string
+	Tag          string
+	Limit        int
+}
+
+// MachineDetails is a machine with all its relations
+// and the machines it hosts (containers, VMs)
+type MachineDetails struct {
+	*models.Machine
+	Children []*models.Machine `json:"children,omitempty"`
+}
+
+// SubnetDetails is a subnetwork with the machines connected to it
+// and the endpoints they expose
+type SubnetDetails struct {
+	*models.Subnetwork
+	Machines  []*models.Machine             `json:"machines"`
+	Endpoints []*models.ApplicationEndpoint `json:"endpoints"`
+}
+
+// RunSummary describes the latest run of an agent
+// and what it has created or updated
+type RunSummary struct {
+	Agent   *models.Agent `json:"agent"`
+	Changes *Changes      `json:"changes"`
+}
+
+// EndpointFilter gathers the optional criteria of FindEndpoints.
+// Protocol matches either the transport or an application protocol
+// and SaaS set to * matches all the SaaS endpoints.
+type EndpointFilter struct {
+	Port     uint16
+	Protocol string
+	SaaS     string
+	Limit    int
+}
+
+// Changes lists the objects created or updated since a given time
+type Changes struct {
+	Since        time.Time                     `json:"since"`
+	Machines     []*models.Machine             `json:"machines"`
+	NICs         []*models.NetworkInterface    `json:"nics"`
+	Applications []*models.Application         `json:"applications"`
+	Endpoints    []*models.ApplicationEndpoint `json:"endpoints"`
+	Packages     []*models.Package             `json:"packages"`
+	Flows        []*models.Flow                `json:"flows"`
+}
+
+func limitOrDefault(limit int) int {
+	if limit <= 0 {
+		return defaultInventoryLimit
+	}
+	return limit
+}
+
+// likePattern turns a user pattern with * wildcards into
+// a lowercase LIKE pattern (substring match if there is no wildcard)
+func likePattern(pattern string) string {
+	pattern = strings.ToLower(pattern)
+	if !strings.Contains(pattern, "*") {
+		return "%" + pattern + "%"
+	}
+	return strings.ReplaceAll(pattern, "*", "%")
+}
+
+// ListMachines returns the machines matching the filter along with their NICs
+func (s *BunStorage) ListMachines(ctx context.Context, filter MachineFilter) ([]*models.Machine, error) {
+	machines := make([]*models.Machine, 0)
+	q := s.db.NewSelect().
+		Model(&machines).
+		Relation("NICS").
+		Order("machine.id").
+		Limit(limitOrDefault(filter.Limit))
+	if filter.Hostname != "" {
+		q = q.Where("LOWER(machine.hostname) LIKE ?", likePattern(filter.Hostname))
+	}
+	if filter.Platform != "" {
+		q = q.Where("LOWER(machine.platform) = ?", strings.ToLower(filter.Platform))
+	}
+	if filter.Distribution != "" {
+		q = q.Where("LOWER(machine.distribution) LIKE ?", likePattern(filter.Distribution))
+	}
+	if filter.Tag != "" {
+		q = q.Where("machine.tag = ?", filter.Tag)
+	}
+	if filter.Subnet != "" {
+		q = q.Where(`EXISTS (SELECT 1 FROM network_interfaces AS ni
+			JOIN network_interface_subnets AS nis ON nis.network_interface_id = ni.id
+			JOIN subnetworks AS sub ON sub.id = nis.subnetwork_id
+			WHERE ni.machine_id = machine.id AND sub.network_cidr = ?)`, filter.Subnet)
+	}
+	err := q.Scan(ctx)
+	return machines, err
+}
+
+// ResolveMachine returns the ID of the machine referenced by an ID,
+// an IP address or a hostname (case insensitive).
+func (s *BunStorage) ResolveMachine(ctx context.Context, ref string) (int64, error) {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return 0, fmt.Errorf("empty machine reference")
+	}
+
+	var ids []int64
+	q := s.db.NewSelect().Model((*models.Machine)(nil)).Column("machine.id").Limit(2)
+	if id, err := strconv.ParseInt(ref, 10, 64); err == nil {
+		q = q.Where("machine.id = ?", id)
+	} else if ip := net.ParseIP(ref); ip != nil {
+		q = q.Where(`EXISTS (SELECT 1 FROM network_interfaces AS ni
+			WHERE ni.machine_id = machine.id AND `+s.ANY("ni.ip")+`)`, ip.String())
+	} else {
+		q = q.Where("LOWER(machine.hostname) = ?", strings.ToLower(ref))
+	}
+	if err := q.Scan(ctx, &ids); err != nil {
+		return 0, err
+	}
+	switch len(ids) {
+	case 0:
+		return 0, fmt.Errorf("no machine matches %q", ref)
+	case 1:
+		return ids[0], nil
+	default:
+		return 0, fmt.Errorf("several machines match %q, use its ID", ref)
+	}
+}
+
+// GetMachineDetails returns a machine with its hardware, NICs (and subnets),
+// applications (with endpoints and users), parent and children.
+// Packages are not included, see GetPackagesOn.
+func (s *BunStorage) GetMachineDetails(ctx context.Context, id int64) (*MachineDetails, error) {
+	machine := new(models.Machine)
+	err := s.db.NewSelect().
+		Model(machine).
+		Where("machine.id = ?", id).
+		Relation("ParentMachine").
+		Relation("CPU").
+		Relation("Disks").
+		Relation("GPUS").
+		Relation("NICS").
+		Relation("NICS.Subnetworks").
+		Relation("Applications").
+		Relation("Applications.Endpoints").
+		Relation("Applications.Users").
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	children := make([]*models.Machine, 0)
+	err = s.db.NewSelect().
+		Model(&children).
+		Where("parent_machine_id = ?", id).
+		Order("machine.id").
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &MachineDetails{Machine: machine, Children: children}, nil
+}
+
+// GetSubnetDetails returns the subnetwork with the given CIDR, the machines
+// (and their NICs) connected to it and the endpoints of these machines that
+// are reachable from the subnet (bound to an IP of the subnet or to all
+// addresses).
+func (s *BunStorage) GetSubnetDetails(ctx context.Context, cidr string) (*SubnetDetails, error) {
+	subnet := new(models.Subnetwork)
+	err := s.db.NewSelect().
+		Model(subnet).
+		Where("network_cidr = ?", cidr).
+		Limit(1).
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	machines := make([]*models.Machine, 0)
+	err = s.db.NewSelect().
+		Model(&machines).
+		Relation("NICS").
+		Where(`EXISTS (SELECT 1 FROM network_interfaces AS ni
+			JOIN network_interface_subnets AS nis ON nis.network_interface_id = ni.id
+			WHERE ni.machine_id = machine.id AND nis.subnetwork_id = ?)`, subnet.ID).
+		Order("machine.id").
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoints := make([]*models.ApplicationEndpoint, 0)
+	err = s.db.NewSelect().
+		Model(&endpoints).
+		Relation("Application").
+		Where(`application_endpoint.application_id IN (SELECT a.id FROM applications AS a
+			JOIN network_interfaces AS ni ON ni.machine_id = a.machine_id
+			JOIN network_interface_subnets AS nis ON nis.network_interface_id = ni.id
+			WHERE nis.subnetwork_id = ?)`, subnet.ID).
+		WhereGroup(" AND ", func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.
+				Where("application_endpoint.addr IN ('0.0.0.0', '::', '')").
+				WhereOr(`application_endpoint.addr IN (SELECT nis.ip FROM network_interface_subnets AS nis
+					WHERE nis.subnetwork_id = ?)`, subnet.ID)
+		}).
+		Order("application_endpoint.port").
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &SubnetDetails{Subnetwork: subnet, Machines: machines, Endpoints: endpoints}, nil
+}
+
+// GetLatestRun returns the agent that started a run most recently
+// and the objects created or updated since then
+func (s *BunStorage) GetLatestRun(ctx context.Context, limit int) (*RunSummary, error) {
+	agent := new(models.Agent)
+	err := s.db.NewSelect().
+		Model(agent).
+		Relation("Machine").
+		Where("agent.last_run_start IS NOT NULL").
+		Order("agent.last_run_start DESC").
+		Limit(1).
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	changes, err := s.GetChanges(ctx, agent.LastRunStart, limit)
+	if err != nil {
+		return nil, err
+	}
+	return &RunSummary{Agent: agent, Changes: changes}, nil
+}
+
+// FindEndpoints returns the endpoints matching the filter along
+// with the application, the machine and the NIC behind them
+func (s *BunStorage) FindEndpoints(ctx context.Context, filter EndpointFilter) ([]*models.ApplicationEndpoint, error) {
+	endpoints := make([]*models.ApplicationEndpoint, 0)
+	q := s.db.NewSelect().
+		Model(&endpoints).
+		Relation("Application").
+		Relation("Application.Machine").
+		Relation("NetworkInterface").
+		Order("application_endpoint.id").
+		Limit(limitOrDefault(filter.Limit))
+	if filter.Port > 0 {
+		q = q.Where("application_endpoint.port = ?", filter.Port)
+	}
+	if p := strings.ToLower(filter.Protocol); p != "" {
+		q = q.WhereGroup(" AND ", func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.
+				Where("LOWER(application_endpoint.protocol) = ?", p).
+				WhereOr(s.JSONANY("application_endpoint.application_protocols"), p)
+		})
+	}
+	switch filter.SaaS {
+	case "":
+	case "*":
+		q = q.Where("application_endpoint.saas IS NOT NULL")
+	default:
+		q = q.Where("LOWER(application_endpoint.saas) LIKE ?", likePattern(filter.SaaS))
+	}
+	err := q.Scan(ctx)
+	return endpoints, err
+}
+
+// flowFromMachine matches the flows that leave a machine
+// (through the source application or the source NIC)
+const flowFromMachine = `(flow.src_application_id IN (SELECT id FROM applications WHERE machine_id = ?)
+	OR flow.src_network_interface_id IN (SELECT id FROM network_interfaces WHERE machine_id = ?))`
+
+// flowToMachine matches the flows that reach one of the
+// endpoints of a machine
+const flowToMachine = `flow.dst_endpoint_id IN (SELECT ae.id FROM application_endpoints AS ae
+	LEFT JOIN applications AS a ON a.id = ae.application_id
+	LEFT JOIN network_interfaces AS ni ON ni.id = ae.network_interface_id
+	WHERE a.machine_id = ? OR ni.machine_id = ?)`
+
+// GetFlowsBetween returns the flows from machine a to machine b
+// and from machine b to machine a
+func (s *BunStorage) GetFlowsBetween(ctx context.Context, a int64, b int64) ([]*models.Flow, error) {
+	flows := make([]*models.Flow, 0)
+	err := s.db.NewSelect().
+		Model(&flows).
+		Relation("SrcApplication").
+		Relation("SrcNetworkInterface").
+		Relation("DstEndpoint").
+		Relation("DstEndpoint.Application").
+		WhereGroup(" AND ", func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.
+				Where(flowFromMachine+" AND "+flowToMachine, a, a, b, b).
+				WhereOr(flowFromMachine+" AND "+flowToMachine, b, b, a, a)
+		}).
+		Order("flow.id").
+		Scan(ctx)
+	return flows, err
+}
+
+// WhoListensOn returns the endpoints bound to ip:port, including the
+// wildcard endpoints (0.0.0.0, ::) of the machines that own ip
+func (s *BunStorage) WhoListensOn(ctx context.Context, ip string, port uint16) ([]*models.ApplicationEndpoint, error) {
+	endpoints := make([]*models.ApplicationEndpoint, 0)
+	err := s.db.NewSelect().
+		Model(&endpoints).
+		Relation("Application").
+		Relation("Application.Machine").
+		Relation("Application.Users").
+		Relation("NetworkInterface").
+		Where("application_endpoint.port = ?", port).
+		WhereGroup(" AND ", func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.
+				Where("application_endpoint.addr = ?", ip).
+				WhereOr(`application_endpoint.addr IN ('0.0.0.0', '::', '') AND EXISTS (
+					SELECT 1 FROM network_interfaces AS ni
+					JOIN applications AS a ON a.machine_id = ni.machine_id
+					WHERE a.id = application_endpoint.application_id AND `+s.ANY("ni.ip")+`)`, ip).
+				WhereOr(`EXISTS (SELECT 1 FROM network_interfaces AS ni
+					WHERE ni.id = application_endpoint.network_interface_id AND `+s.ANY("ni.ip")+`)`, ip)
+		}).
+		Order("application_endpoint.id").
+		Scan(ctx)
+	return endpoints, err
+}
+
+// GetPackagesOn returns the packages installed on a machine. The name
+// accepts * wildcards (substring match otherwise), empty means all.
+func (s *BunStorage) GetPackagesOn(ctx context.Context, machineID int64, name string, limit int) ([]*models.Package, error) {
+	pkgs := make([]*models.Package, 0)
+	q := s.db.NewSelect().
+		Model(&pkgs).
+		ExcludeColumn("files").
+		Where("machine_id = ?", machineID).
+		Order("name", "version").
+		Limit(limitOrDefault(limit))
+	if name != "" {
+		q = q.Where("LOWER(name) LIKE ?", likePattern(name))
+	}
+	err := q.Scan(ctx)
+	return pkgs, err
+}
+
+// GetChanges returns the objects created or updated since the given time.
+// limit applies to every kind of object.
+func (s *BunStorage) GetChanges(ctx context.Context, since time.Time, limit int) (*Changes, error) {
+	limit = limitOrDefault(limit)
+	changes := Changes{
+		Since:        since,
+		Machines:     make([]*models.Machine, 0),
+		NICs:         make([]*models.NetworkInterface, 0),
+		Applications: make([]*models.Application, 0),
+		Endpoints:    make([]*models.ApplicationEndpoint, 0),
+		Packages:     make([]*models.Package, 0),
+		Flows:        make([]*models.Flow, 0),
+	}
+	// timestamps are stored in UTC and CURRENT_TIMESTAMP
+	// has a one-second resolution in sqlite
+	since = since.UTC().Truncate(time.Second)
+
+	queries := []*bun.SelectQuery{
+		s.db.NewSelect().Model(&changes.Machines),
+		s.db.NewSelect().Model(&changes.NICs),
+		s.db.NewSelect().Model(&changes.Applications),
+		s.db.NewSelect().Model(&changes.Endpoints),
+		s.db.NewSelect().Model(&changes.Packages).ExcludeColumn("files"),
+		s.db.NewSelect().Model(&changes.Flows),
+	}
+	for _, q := range queries {
+		err := q.Where("?TableAlias.updated_at >= ?", since).
+			OrderExpr("?TableAlias.updated_at DESC").
+			Limit(limit).
+			Scan(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &changes, nil
+}
+
+// watchedTables are the tables whose updates are tracked by LastUpdate
+var watchedTables = []string{
+	"machines",
+	"network_interfaces",
+	"subnetworks",
+	"applications",
+	"application_endpoints",
+	"packages",
+	"flows",
+}
+
+// LastUpdate returns the most recent updated_at of the inventory tables.
+// It is a cheap watermark to detect that the data has changed (the zero
+// time is returned on an empty database).
+func (s *BunStorage) LastUpdate(ctx context.Context) (time.Time, error) {
+	var last time.Time
+	for _, table := range watchedTables {
+		var t time.Time
+		err := s.db.NewSelect().
+			Table(table).
+			Column("updated_at").
+			OrderExpr("updated_at DESC").
+			Limit(1).
+			Scan(ctx, &t)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return last, err
+		}
+		if t.After(last) {
+			last = t
+		}
+	}
+	return last, nil
+}
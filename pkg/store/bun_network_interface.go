@@ -3,8 +3,11 @@ package store
 import (
 	"context"
 	"fmt"
+	"net"
+	"slices"
 
 	"github.com/situation-sh/situation/pkg/models"
+	"github.com/situation-sh/situation/pkg/utils"
 )
 
 // GetMachineNICs returns all network interfaces for a given machine.
@@ -42,6 +45,24 @@ func (s *BunStorage) GetNICByMAC(ctx context.Context, mac string) *models.Networ
 	return &nic
 }
 
+// GetNICsByMAC returns the network interfaces with the given MAC address,
+// whatever their subnetwork (oldest first)
+func (s *BunStorage) GetNICsByMAC(ctx context.Context, mac string) []*models.NetworkInterface {
+	nics := make([]*models.NetworkInterface, 0)
+	err := s.db.
+		NewSelect().
+		Model(&nics).
+		Where("mac = ?", mac).
+		Relation("Subnetworks").
+		Order("network_interface.id").
+		Scan(ctx)
+	if err != nil {
+		s.onError(err)
+		return nil
+	}
+	return nics
+}
+
 // GetNICByMACOnSubnet returns a network interface by its MAC address on a specific subnet.
 func (s *BunStorage) GetNICByMACOnSubnet(ctx context.Context, mac string, subnetID int64) *models.NetworkInterface {
 	var nic models.NetworkInterface
@@ -201,7 +222,8 @@ func (s *BunStorage) EnsureNoOrphanNICs(ctx context.Context) error {
 }
 
 // GetNeighorNICS returns all NICs that share subnets with the host machine,
-// excluding the host's own NICs.
+// excluding the host's own NICs. The machines and the subnetworks of the
+// NICs are loaded.
 func (s *BunStorage) GetNeighorNICS(ctx context.Context) ([]*models.NetworkInterface, error) {
 	hostID := s.GetHostID(ctx)
 	nics := make([]*models.NetworkInterface, 0)
@@ -225,6 +247,7 @@ func (s *BunStorage) GetNeighorNICS(ctx context.Context) ([]*models.NetworkInter
 		Where("network_interface.id IN (?)", nicIDs).
 		Where("network_interface.machine_id IS NULL OR network_interface.machine_id <> ?", hostID).
 		Relation("Machine").
+		Relation("Subnetworks").
 		Scan(ctx)
 	return nics, err
 }
@@ -262,3 +285,36 @@ func (s *BunStorage) GetNICByMACAndIPs(ctx context.Context, mac string, ips []st
 	}
 	return nics
 }
+
+// GetNICsInRanges returns the network interfaces (except the host ones)
+// having an address within one of the ranges (first and last addresses)
+// along with their machine and subnetworks
+func (s *BunStorage) GetNICsInRanges(ctx context.Context, ranges [][2]net.IP) ([]*models.NetworkInterface, error) {
+	if len(ranges) == 0 {
+		return nil, nil
+	}
+	hostID := s.GetHostID(ctx)
+	nics := make([]*models.NetworkInterface, 0)
+	err := s.db.
+		NewSelect().
+		Model(&nics).
+		Where("network_interface.machine_id IS NULL OR network_interface.machine_id <> ?", hostID).
+		Relation("Machine").
+		Relation("Subnetworks").
+		Order("network_interface.id").
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*models.NetworkInterface, 0)
+	for _, nic := range nics {
+		if slices.ContainsFunc(nic.IPs(), func(ip net.IP) bool {
+			return slices.ContainsFunc(ranges, func(r [2]net.IP) bool {
+				return utils.IPInRange(ip, r[0], r[1])
+			})
+		}) {
+			out = append(out, nic)
+		}
+	}
+	return out, nil
+}
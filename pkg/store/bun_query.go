@@ -0,0 +1,429 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/uptrace/bun/dialect"
+)
+
+const (
+	DefaultQueryTimeout = 10 * time.Second
+	DefaultQueryMaxRows = 1000
+)
+
+// keywords that cannot appear in a read-only query (outside literals).
+// Some of them are harmless in a SELECT (FOR UPDATE, SELECT INTO) but
+// they either take locks or write data.
+var forbiddenSQLKeywords = map[string]bool{
+	"ALTER":          true,
+	"ANALYZE":        true,
+	"ATTACH":         true,
+	"CALL":           true,
+	"COPY":           true,
+	"CREATE":         true,
+	"DELETE":         true,
+	"DETACH":         true,
+	"DO":             true,
+	"DROP":           true,
+	"GRANT":          true,
+	"INSERT":         true,
+	"INTO":           true,
+	"LOAD_EXTENSION": true,
+	"LOCK":           true,
+	"MERGE":          true,
+	"NOTIFY":         true,
+	"PRAGMA":         true,
+	"REINDEX":        true,
+	"RESET":          true,
+	"REVOKE":         true,
+	"SET":            true,
+	"SET_CONFIG":     true,
+	"TRUNCATE":       true,
+	"UPDATE":         true,
+	"VACUUM":         true,
+}
+
+// QueryOptions bounds the execution of SafeQuery
+type QueryOptions struct {
+	Timeout time.Duration // statement timeout (DefaultQueryTimeout if zero)
+	MaxRows int           // maximum number of rows (DefaultQueryMaxRows if zero)
+}
+
+// QueryResult is the output of SafeQuery. Truncated is true when
+// the query returned more than MaxRows rows.
+type QueryResult struct {
+	Columns     []string         `json:"columns"`
+	ColumnTypes []string         `json:"column_types,omitempty"`
+	Rows        []map[string]any `json:"rows"`
+	RowCount    int              `json:"row_count"`
+	Truncated   bool             `json:"truncated"`
+	MaxRows     int              `json:"max_rows"`
+}
+
+// sqlWord is a bare word found in a statement (outside literals
+// and comments) along with its position
+type sqlWord struct {
+	word string
+	pos  int
+}
+
+// splitSQL walks through the query, skipping comments, string literals,
+// quoted identifiers and dollar-quoted strings. It returns the bare
+// words (upper case) and the position of the first statement separator
+// (-1 if none).
+func splitSQL(query string) ([]sqlWord, int, error) {
+	words := make([]sqlWord, 0)
+	n := len(query)
+	for i := 0; i < n; {
+		c := query[i]
+		switch {
+		case c == '-' && i+1 < n && query[i+1] == '-':
+			end := strings.IndexByte(query[i:], '\n')
+			if end < 0 {
+				return words, -1, nil
+			}
+			i += end + 1
+		case c == '/' && i+1 < n && query[i+1] == '*':
+			end := strings.Index(query[i+2:], "*/")
+			if end < 0 {
+				return nil, -1, fmt.Errorf("unterminated comment")
+			}
+			i += end + 4
+		case c == '\'' || c == '"' || c == '`':
+			// escaped quotes are doubled (E'' strings also accept backslashes)
+			escape := c == '\'' && isEscapePrefix(query, i)
+			j := i + 1
+			for ; j < n; j++ {
+				if escape && query[j] == '\\' {
+					j++
+					continue
+				}
+				if query[j] == c {
+					if j+1 < n && query[j+1] == c {
+						j++
+						continue
+					}
+					break
+				}
+			}
+			if j >= n {
+				return nil, -1, fmt.Errorf("unterminated literal at position %d", i)
+			}
+			i = j + 1
+		case c == '$' && i+1 < n && !unicode.IsDigit(rune(query[i+1])):
+			// postgres dollar quoting: $tag$ ... $tag$
+			end := strings.IndexByte(query[i+1:], '$')
+			if end < 0 {
+				i++
+				continue
+			}
+			tag := query[i : i+end+2]
+			if strings.IndexFunc(tag[1:len(tag)-1], func(r rune) bool {
+				return !(r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r))
+			}) >= 0 {
+				i++
+				continue
+			}
+			end = strings.Index(query[i+len(tag):], tag)
+			if end < 0 {
+				return nil, -1, fmt.Errorf("unterminated dollar-quoted string at position %d", i)
+			}
+			i += len(tag) + end + len(tag)
+		case c == ';':
+			return words, i, nil
+		case c == '_' || unicode.IsLetter(rune(c)):
+			j := i + 1
+			for j < n && isIdentByte(query[j]) {
+				j++
+			}
+			words = append(words, sqlWord{word: strings.ToUpper(query[i:j]), pos: i})
+			i = j
+		default:
+			i++
+		}
+	}
+	return words, -1, nil
+}
+
+// isEscapePrefix tells whether the literal starting at i is an escape
+// string, i.e. it is preceded by a standalone E (and not by the end of
+// a word like LIKE or WHERE)
+func isEscapePrefix(query string, i int) bool {
+	if i == 0 || (query[i-1] != 'E' && query[i-1] != 'e') {
+		return false
+	}
+	return i == 1 || !isIdentByte(query[i-2])
+}
+
+// isIdentByte tells whether c may be part of a bare word
+func isIdentByte(c byte) bool {
+	return c == '_' || c == '$' || unicode.IsLetter(rune(c)) || unicode.IsDigit(rune(c))
+}
+
+// CheckReadOnlySQL ensures that the query is a single SELECT (or WITH)
+// statement without any keyword that may modify the database. It returns
+// the statement without the trailing semicolon.
+func CheckReadOnlySQL(query string) (string, error) {
+	words, sep, err := splitSQL(query)
+	if err != nil {
+		return "", fmt.Errorf("invalid SQL: %w", err)
+	}
+	stmt := query
+	if sep >= 0 {
+		rest, _, err := splitSQL(query[sep+1:])
+		if err != nil {
+			return "", fmt.Errorf("invalid SQL: %w", err)
+		}
+		if len(rest) > 0 {
+			return "", fmt.Errorf("only a single statement is allowed")
+		}
+		stmt = query[:sep]
+	}
+
+	// only comments may precede the first keyword
+	if len(words) == 0 ||
+		(words[0].word != "SELECT" && words[0].word != "WITH") ||
+		strings.TrimSpace(stripSQLComments(query[:words[0].pos])) != "" {
+		return "", fmt.Errorf("only SELECT and WITH statements are allowed")
+	}
+	for _, w := range words {
+		if forbiddenSQLKeywords[w.word] {
+			return "", fmt.Errorf("forbidden keyword in read-only query: %s", w.word)
+		}
+	}
+	return strings.TrimSpace(stmt), nil
+}
+
+// stripSQLComments removes the -- and /* */ comments of a fragment
+// that does not contain any literal
+func stripSQLComments(fragment string) string {
+	var out strings.Builder
+	for i := 0; i < len(fragment); i++ {
+		switch {
+		case strings.HasPrefix(fragment[i:], "--"):
+			end := strings.IndexByte(fragment[i:], '\n')
+			if end < 0 {
+				return out.String()
+			}
+			i += end
+		case strings.HasPrefix(fragment[i:], "/*"):
+			end := strings.Index(fragment[i+2:], "*/")
+			if end < 0 {
+				return out.String()
+			}
+			i += end + 3
+		default:
+			out.WriteByte(fragment[i])
+		}
+	}
+	return out.String()
+}
+
+// decodeValue converts the raw value returned by the driver into
+// a JSON friendly one: JSON documents are kept as raw JSON, postgres
+// arrays become lists and text is returned as string.
+func decodeValue(v any, dbType string, d dialect.Name) any {
+	var raw []byte
+	switch x := v.(type) {
+	case []byte:
+		raw = x
+	case string:
+		raw = []byte(x)
+	default:
+		return v
+	}
+
+	isJSONType := strings.Contains(strings.ToUpper(dbType), "JSON")
+	trimmed := strings.TrimSpace(string(raw))
+	if (isJSONType || strings.HasPrefix(trimmed, "[") || strings.HasPrefix(trimmed, "{")) && json.Valid(raw) {
+		return json.RawMessage(raw)
+	}
+	if d == dialect.PG && strings.HasPrefix(trimmed, "{") && strings.HasSuffix(trimmed, "}") {
+		if arr, ok := parsePGArray(trimmed); ok {
+			return arr
+		}
+	}
+	if _, ok := v.([]byte); ok && !utf8.Valid(raw) {
+		// binary data (base64 encoded by encoding/json)
+		return raw
+	}
+	return string(raw)
+}
+
+// parsePGArray parses a one-dimensional postgres array literal
+// like {a,"b c",NULL}
+func parsePGArray(s string) ([]any, bool) {
+	body := s[1 : len(s)-1]
+	out := make([]any, 0)
+	if body == "" {
+		return out, true
+	}
+	var cur strings.Builder
+	quoted, wasQuoted := false, false
+	for i := 0; i < len(body); i++ {
+		c := body[i]
+		switch {
+		case quoted && c == '\\' && i+1 < len(body):
+			i++
+			cur.WriteByte(body[i])
+		case c == '"':
+			quoted = !quoted
+			wasQuoted = true
+		case !quoted && c == '{':
+			// multi-dimensional arrays are not supported
+			return nil, false
+		case !quoted && c == ',':
+			out = append(out, pgArrayItem(cur.String(), wasQuoted))
+			cur.Reset()
+			wasQuoted = false
+		default:
+			cur.WriteByte(c)
+		}
+	}
+	if quoted {
+		return nil, false
+	}
+	out = append(out, pgArrayItem(cur.String(), wasQuoted))
+	return out, true
+}
+
+func pgArrayItem(item string, quoted bool) any {
+	if !quoted && strings.EqualFold(item, "NULL") {
+		return nil
+	}
+	return item
+}
+
+// SafeQuery runs a user provided read-only query. The query must be a
+// single SELECT/WITH statement. It runs in a read-only session (query_only
+// pragma for sqlite, read-only transaction for postgres) with a statement
+// timeout, and at most opts.MaxRows rows are returned.
+//
+// Both drivers run every statement of a multi-statement string, so
+// the single statement is also enforced when the query is sent: it is
+// wrapped in a subquery for sqlite and prepared (extended protocol,
+// which accepts a single command) for postgres.
+func (s *BunStorage) SafeQuery(ctx context.Context, query string, opts QueryOptions) (*QueryResult, error) {
+	stmt, err := CheckReadOnlySQL(query)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultQueryTimeout
+	}
+	if opts.MaxRows <= 0 {
+		opts.MaxRows = DefaultQueryMaxRows
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+
+	// raw connection: bun would interpret the ? placeholders
+	conn, err := s.db.DB.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var rows *sql.Rows
+	switch s.dialect {
+	case dialect.SQLite:
+		if _, err := conn.ExecContext(ctx, "PRAGMA query_only = ON"); err != nil {
+			return nil, err
+		}
+		defer conn.ExecContext(context.Background(), "PRAGMA query_only = OFF")
+		// a separator missed by CheckReadOnlySQL is a syntax error here
+		rows, err = conn.QueryContext(ctx, fmt.Sprintf("SELECT * FROM (\n%s\n)", stmt))
+	case dialect.PG:
+		tx, txErr := conn.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+		if txErr != nil {
+			return nil, txErr
+		}
+		defer tx.Rollback()
+		timeout := fmt.Sprintf("SET LOCAL statement_timeout = %d", opts.Timeout.Milliseconds())
+		if _, err := tx.ExecContext(ctx, timeout); err != nil {
+			return nil, err
+		}
+		prepared, prepErr := tx.PrepareContext(ctx, stmt)
+		if prepErr != nil {
+			return nil, queryError(ctx, prepErr, opts.Timeout)
+		}
+		defer prepared.Close()
+		rows, err = prepared.QueryContext(ctx)
+	default:
+		return nil, fmt.Errorf("unsupported dialect: %v", s.dialect)
+	}
+	if err != nil {
+		return nil, queryError(ctx, err, opts.Timeout)
+	}
+	defer rows.Close()
+
+	result, err := s.scanQueryResult(rows, opts.MaxRows)
+	if err != nil {
+		return nil, queryError(ctx, err, opts.Timeout)
+	}
+	return result, nil
+}
+
+// queryError makes the timeout explicit
+func queryError(ctx context.Context, err error, timeout time.Duration) error {
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("query timed out after %v: %w", timeout, err)
+	}
+	return err
+}
+
+func (s *BunStorage) scanQueryResult(rows *sql.Rows, maxRows int) (*QueryResult, error) {
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	result := QueryResult{
+		Columns: cols,
+		Rows:    make([]map[string]any, 0),
+		MaxRows: maxRows,
+	}
+
+	dbTypes := make([]string, len(cols))
+	if types, err := rows.ColumnTypes(); err == nil {
+		for i, t := range types {
+			dbTypes[i] = t.DatabaseTypeName()
+		}
+		if strings.Join(dbTypes, "") != "" {
+			result.ColumnTypes = dbTypes
+		}
+	}
+
+	for rows.Next() {
+		if len(result.Rows) == maxRows {
+			result.Truncated = true
+			break
+		}
+		vals := make([]any, len(cols))
+		ptrs := make([]any, len(cols))
+		for i := range vals {
+			ptrs[i] = &vals[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, fmt.Errorf("failed to scan row %d: %w", len(result.Rows)+1, err)
+		}
+		row := make(map[string]any, len(cols))
+		for i, c := range cols {
+			row[c] = decodeValue(vals[i], dbTypes[i], s.dialect)
+		}
+		result.Rows = append(result.Rows, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	result.RowCount = len(result.Rows)
+	return &result, nil
+}
@@ -0,0 +1,361 @@
+package store
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/situation-sh/situation/pkg/models"
+	"github.com/uptrace/bun"
+)
+
+// DefaultCertificateWindow is the default period within which
+// a certificate is considered to expire soon
+const DefaultCertificateWindow = 30 * 24 * time.Hour
+
+// wildcardAddrs are the addresses of the endpoints bound to all
+// the addresses of a machine
+var wildcardAddrs = []string{"0.0.0.0", "::", ""}
+
+// ReportOptions tunes BuildReport
+type ReportOptions struct {
+	// certificates expiring within this period are reported
+	// (DefaultCertificateWindow if not positive)
+	CertificateWindow time.Duration
+}
+
+// Report is the inventory summary rendered by the report command
+type Report struct {
+	GeneratedAt  time.Time        `json:"generated_at"`
+	Subnets      []*ReportSubnet  `json:"subnets"`
+	Services     []*ReportService `json:"services"`
+	Certificates []*ReportCert    `json:"certificates"`
+	// certificates expiring before this time are reported
+	CertificateDeadline time.Time          `json:"certificate_deadline"`
+	SaaS                []*SaaSUsage       `json:"saas"`
+	Packages            []*PackageCount    `json:"packages"`
+	Runs                []*models.Agent    `json:"runs"`
+	Errors              []*ReportModuleErr `json:"errors"`
+}
+
+// ReportSubnet is a subnetwork with the hosts connected to it
+type ReportSubnet struct {
+	CIDR  string        `json:"cidr"`
+	Tag   string        `json:"tag,omitempty"`
+	Hosts []*ReportHost `json:"hosts"`
+}
+
+// ReportHost is a network interface of a subnet and its machine
+type ReportHost struct {
+	MachineID int64    `json:"machine_id,omitempty"`
+	Hostname  string   `json:"hostname,omitempty"`
+	IP        string   `json:"ip"`
+	MAC       string   `json:"mac,omitempty"`
+	Vendor    string   `json:"vendor,omitempty"`
+	OS        string   `json:"os,omitempty"`
+	Ports     []string `json:"ports,omitempty"`
+}
+
+// ReportService is an endpoint reachable from the network
+type ReportService struct {
+	Host        string   `json:"host"`
+	Addr        string   `json:"addr"`
+	Port        string   `json:"port"`
+	Protocols   []string `json:"protocols,omitempty"`
+	Application string   `json:"application,omitempty"`
+}
+
+// ReportCert is a certificate that has expired or expires soon
+type ReportCert struct {
+	Host     string    `json:"host"`
+	Endpoint string    `json:"endpoint"`
+	Subject  string    `json:"subject"`
+	Issuer   string    `json:"issuer,omitempty"`
+	NotAfter time.Time `json:"not_after"`
+}
+
+// SaaSUsage counts the endpoints of a SaaS, the flows
+// towards them and the machines these flows come from
+type SaaSUsage struct {
+	Name      string `json:"name"`
+	Endpoints int    `json:"endpoints"`
+	Flows     int    `json:"flows"`
+	Machines  int    `json:"machines"`
+}
+
+// PackageCount counts the packages installed by a package manager
+type PackageCount struct {
+	Manager  string `json:"manager"`
+	Packages int    `json:"packages"`
+	Machines int    `json:"machines"`
+}
+
+// ReportModuleErr is an error returned by a module
+// during the last run of an agent
+type ReportModuleErr struct {
+	Agent   string `json:"agent"`
+	Host    string `json:"host,omitempty"`
+	Module  string `json:"module"`
+	Message string `json:"message"`
+}
+
+// machineName returns the hostname of the machine
+// or its ID if the hostname is unknown
+func machineName(m *models.Machine) string {
+	if m == nil {
+		return ""
+	}
+	if m.Hostname != "" {
+		return m.Hostname
+	}
+	return fmt.Sprintf("#%d", m.ID)
+}
+
+// endpointMachine returns the machine that owns the endpoint (if known)
+func endpointMachine(e *models.ApplicationEndpoint) *models.Machine {
+	if e.Application != nil && e.Application.Machine != nil {
+		return e.Application.Machine
+	}
+	if e.NetworkInterface != nil && e.NetworkInterface.Machine != nil {
+		return e.NetworkInterface.Machine
+	}
+	return nil
+}
+
+func isLoopback(addr string) bool {
+	ip := net.ParseIP(addr)
+	return ip != nil && ip.IsLoopback()
+}
+
+// BuildReport gathers the data of the inventory report
+func (s *BunStorage) BuildReport(ctx context.Context, opts ReportOptions) (*Report, error) {
+	if opts.CertificateWindow <= 0 {
+		opts.CertificateWindow = DefaultCertificateWindow
+	}
+	now := time.Now()
+	report := &Report{
+		GeneratedAt:         now,
+		CertificateDeadline: now.Add(opts.CertificateWindow),
+		Subnets:             make([]*ReportSubnet, 0),
+		Services:            make([]*ReportService, 0),
+		Certificates:        make([]*ReportCert, 0),
+		SaaS:                make([]*SaaSUsage, 0),
+		Packages:            make([]*PackageCount, 0),
+		Errors:              make([]*ReportModuleErr, 0),
+	}
+	steps := []func(context.Context, *Report, ReportOptions) error{
+		s.reportSubnets,
+		s.reportEndpoints,
+		s.reportSaaS,
+		s.reportPackages,
+		s.reportRuns,
+	}
+	for _, step := range steps {
+		if err := step(ctx, report, opts); err != nil {
+			return nil, err
+		}
+	}
+	return report, nil
+}
+
+// reportSubnets lists the hosts of every subnet with the ports
+// open on their address (or on all the addresses of the machine)
+func (s *BunStorage) reportSubnets(ctx context.Context, report *Report, _ ReportOptions) error {
+	subnets := make([]*models.Subnetwork, 0)
+	if err := s.db.NewSelect().Model(&subnets).Order("network_cidr").Scan(ctx); err != nil {
+		return err
+	}
+
+	wildcards := make([]struct {
+		MachineID int64
+		Protocol  string
+		Port      uint16
+	}, 0)
+	err := s.db.NewSelect().
+		TableExpr("application_endpoints AS ae").
+		Join("JOIN applications AS a ON a.id = ae.application_id").
+		ColumnExpr("a.machine_id, ae.protocol, ae.port").
+		Where("ae.addr IN (?)", bun.List(wildcardAddrs)).
+		Distinct().
+		Scan(ctx, &wildcards)
+	if err != nil {
+		return err
+	}
+	machinePorts := make(map[int64][]string)
+	for _, w := range wildcards {
+		machinePorts[w.MachineID] = append(machinePorts[w.MachineID], portString(w.Protocol, w.Port))
+	}
+
+	for _, subnet := range subnets {
+		_, ipnet, _ := net.ParseCIDR(subnet.NetworkCIDR)
+		nics := make([]*models.NetworkInterface, 0)
+		err := s.db.NewSelect().
+			Model(&nics).
+			Relation("Machine").
+			Relation("Endpoints").
+			Where("network_interface.id IN (?)",
+				s.db.NewSelect().
+					Model((*models.NetworkInterfaceSubnet)(nil)).
+					Column("network_interface_id").
+					Where("subnetwork_id = ?", subnet.ID)).
+			Scan(ctx)
+		if err != nil {
+			return err
+		}
+
+		rs := &ReportSubnet{CIDR: subnet.NetworkCIDR, Tag: subnet.Tag, Hosts: make([]*ReportHost, 0, len(nics))}
+		for _, nic := range nics {
+			host := &ReportHost{MachineID: nic.MachineID, MAC: nic.MAC, Vendor: nic.MACVendor}
+			for _, ip := range nic.IP {
+				if parsed := net.ParseIP(ip); parsed != nil && ipnet != nil && ipnet.Contains(parsed) {
+					host.IP = ip
+					break
+				}
+			}
+			if m := nic.Machine; m != nil {
+				host.Hostname = m.Hostname
+				host.OS = strings.TrimSpace(m.Distribution + " " + m.DistributionVersion)
+				if host.OS == "" {
+					host.OS = m.Platform
+				}
+			}
+			ports := slices.Clone(machinePorts[nic.MachineID])
+			for _, e := range nic.Endpoints {
+				ports = append(ports, portString(e.Protocol, e.Port))
+			}
+			slices.Sort(ports)
+			host.Ports = slices.Compact(ports)
+			rs.Hosts = append(rs.Hosts, host)
+		}
+		slices.SortFunc(rs.Hosts, func(a, b *ReportHost) int {
+			return compareIP(a.IP, b.IP)
+		})
+		report.Subnets = append(report.Subnets, rs)
+	}
+	return nil
+}
+
+// compareIP sorts the addresses numerically (invalid ones last)
+func compareIP(a string, b string) int {
+	ipA, ipB := net.ParseIP(a), net.ParseIP(b)
+	switch {
+	case ipA == nil && ipB == nil:
+		return cmp.Compare(a, b)
+	case ipA == nil:
+		return 1
+	case ipB == nil:
+		return -1
+	}
+	return slices.Compare(ipA.To16(), ipB.To16())
+}
+
+// reportEndpoints lists the services reachable from the network and
+// the certificates that expire within the window
+func (s *BunStorage) reportEndpoints(ctx context.Context, report *Report, opts ReportOptions) error {
+	endpoints := make([]*models.ApplicationEndpoint, 0)
+	err := s.db.NewSelect().
+		Model(&endpoints).
+		Relation("Application").
+		Relation("Application.Machine").
+		Relation("NetworkInterface").
+		Relation("NetworkInterface.Machine").
+		WhereGroup(" AND ", func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.
+				Where("application_endpoint.application_id IS NOT NULL").
+				WhereOr("application_endpoint.network_interface_id IS NOT NULL").
+				WhereOr("application_endpoint.tls IS NOT NULL")
+		}).
+		Order("application_endpoint.port", "application_endpoint.id").
+		Scan(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range endpoints {
+		host := machineName(endpointMachine(e))
+		if host == "" {
+			host = e.Addr
+		}
+		if e.TLS != nil && !e.TLS.NotAfter.IsZero() && e.TLS.NotAfter.Before(report.CertificateDeadline) {
+			report.Certificates = append(report.Certificates, &ReportCert{
+				Host:     host,
+				Endpoint: fmt.Sprintf("%s:%d", e.Addr, e.Port),
+				Subject:  e.TLS.Subject,
+				Issuer:   e.TLS.Issuer,
+				NotAfter: e.TLS.NotAfter,
+			})
+		}
+		// local services and the remote ones (SaaS or unknown machines)
+		// are not exposed on the network
+		if isLoopback(e.Addr) || e.SaaS != "" || endpointMachine(e) == nil {
+			continue
+		}
+		app := ""
+		if e.Application != nil {
+			app = e.Application.Name
+		}
+		report.Services = append(report.Services, &ReportService{
+			Host:        host,
+			Addr:        e.Addr,
+			Port:        portString(e.Protocol, e.Port),
+			Protocols:   e.ApplicationProtocols,
+			Application: app,
+		})
+	}
+	slices.SortFunc(report.Certificates, func(a, b *ReportCert) int {
+		return a.NotAfter.Compare(b.NotAfter)
+	})
+	return nil
+}
+
+func (s *BunStorage) reportSaaS(ctx context.Context, report *Report, _ ReportOptions) error {
+	return s.db.NewSelect().
+		TableExpr("application_endpoints AS e").
+		Join("LEFT JOIN flows AS f ON f.dst_endpoint_id = e.id").
+		Join("LEFT JOIN applications AS sa ON sa.id = f.src_application_id").
+		Join("LEFT JOIN network_interfaces AS sn ON sn.id = f.src_network_interface_id").
+		ColumnExpr("e.saas AS name").
+		ColumnExpr("COUNT(DISTINCT e.id) AS endpoints").
+		ColumnExpr("COUNT(f.id) AS flows").
+		ColumnExpr("COUNT(DISTINCT COALESCE(sa.machine_id, sn.machine_id)) AS machines").
+		Where("e.saas IS NOT NULL").
+		Group("e.saas").
+		OrderExpr("flows DESC, name").
+		Scan(ctx, &report.SaaS)
+}
+
+func (s *BunStorage) reportPackages(ctx context.Context, report *Report, _ ReportOptions) error {
+	return s.db.NewSelect().
+		TableExpr("packages AS p").
+		ColumnExpr("p.manager").
+		ColumnExpr("COUNT(*) AS packages").
+		ColumnExpr("COUNT(DISTINCT p.machine_id) AS machines").
+		Group("p.manager").
+		OrderExpr("packages DESC, p.manager").
+		Scan(ctx, &report.Packages)
+}
+
+// reportRuns gathers the last run of every agent and
+// the errors returned by the modules during these runs
+func (s *BunStorage) reportRuns(ctx context.Context, report *Report, _ ReportOptions) error {
+	agents, err := s.GetAgents(ctx)
+	if err != nil {
+		return err
+	}
+	report.Runs = agents
+	for _, a := range agents {
+		for _, e := range a.ModuleErrors {
+			report.Errors = append(report.Errors, &ReportModuleErr{
+				Agent:   a.Agent,
+				Host:    machineName(a.Machine),
+				Module:  e.Module,
+				Message: e.Message,
+			})
+		}
+	}
+	return nil
+}
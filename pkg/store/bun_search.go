@@ -0,0 +1,157 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/situation-sh/situation/pkg/models"
+	"github.com/uptrace/bun"
+)
+
+// NICSearch gathers the criteria of a network interface search.
+// All the criteria must match. String criteria accept * wildcards
+// and are substring matches otherwise (case-insensitive).
+type NICSearch struct {
+	Host        string // hostname of the machine
+	IP          string
+	MAC         string
+	Vendor      string // MAC vendor
+	Port        uint16 // port open on the interface (or on all the addresses of the machine)
+	Package     string // package installed on the machine
+	Application string // application running on the machine
+	Text        string // matches the hostname, the IP, the MAC or the vendor
+	Limit       int
+}
+
+// searchKeys maps the keys of the query syntax to the criteria
+var searchKeys = map[string]func(s *NICSearch, value string) error{
+	"host":   func(s *NICSearch, v string) error { s.Host = v; return nil },
+	"ip":     func(s *NICSearch, v string) error { s.IP = v; return nil },
+	"mac":    func(s *NICSearch, v string) error { s.MAC = v; return nil },
+	"vendor": func(s *NICSearch, v string) error { s.Vendor = v; return nil },
+	"pkg":    func(s *NICSearch, v string) error { s.Package = v; return nil },
+	"app":    func(s *NICSearch, v string) error { s.Application = v; return nil },
+	"port": func(s *NICSearch, v string) error {
+		port, err := strconv.ParseUint(v, 10, 16)
+		if err != nil || port == 0 {
+			return fmt.Errorf("invalid port: %s", v)
+		}
+		s.Port = uint16(port)
+		return nil
+	},
+}
+
+// ParseNICSearch parses a query like "port:443 vendor:cisco host:db*".
+// Supported keys are host, ip, mac, vendor, port, pkg and app. Words
+// without key are matched against the hostname, the IP, the MAC and
+// the vendor.
+func ParseNICSearch(query string) (NICSearch, error) {
+	search := NICSearch{}
+	words := make([]string, 0)
+	for _, token := range strings.Fields(query) {
+		key, value, found := strings.Cut(token, ":")
+		setter, known := searchKeys[strings.ToLower(key)]
+		if !found || !known {
+			// IPv6 addresses and MAC addresses contain colons
+			words = append(words, token)
+			continue
+		}
+		if value == "" {
+			return search, fmt.Errorf("missing value for %s", key)
+		}
+		if err := setter(&search, value); err != nil {
+			return search, err
+		}
+	}
+	search.Text = strings.Join(words, " ")
+	return search, nil
+}
+
+// SearchNICs returns the network interfaces matching the search along
+// with their machine, their subnetworks, their endpoints and their flows
+// (like the TUI needs them). At most search.Limit interfaces are
+// returned, more tells whether other ones match.
+func (s *BunStorage) SearchNICs(ctx context.Context, search NICSearch) (nics []*models.NetworkInterface, more bool, err error) {
+	limit := limitOrDefault(search.Limit)
+	nics = make([]*models.NetworkInterface, 0)
+	q := s.db.NewSelect().
+		Model(&nics).
+		Relation("Machine").
+		Relation("Subnetworks").
+		Relation("Endpoints").
+		Relation("Endpoints.IncomingFlows").
+		Relation("OutgoingFlows").
+		Relation("OutgoingFlows.SrcApplication").
+		Relation("OutgoingFlows.DstEndpoint").
+		Order("network_interface.id").
+		// one more row tells whether the results are cut off
+		Limit(limit + 1)
+
+	machines := func(where string, args ...any) *bun.SelectQuery {
+		return s.db.NewSelect().Table("machines").Column("id").Where(where, args...)
+	}
+
+	if search.Host != "" {
+		q = q.Where("network_interface.machine_id IN (?)",
+			machines("LOWER(hostname) LIKE ?", likePattern(search.Host)))
+	}
+	if search.IP != "" {
+		q = q.Where(s.ANYLIKE("network_interface.ip"), likePattern(search.IP))
+	}
+	if search.MAC != "" {
+		q = q.Where("LOWER(network_interface.mac) LIKE ?", likePattern(search.MAC))
+	}
+	if search.Vendor != "" {
+		q = q.Where("LOWER(network_interface.mac_vendor) LIKE ?", likePattern(search.Vendor))
+	}
+	if search.Port != 0 {
+		q = q.WhereGroup(" AND ", func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.
+				Where("network_interface.id IN (?)",
+					s.db.NewSelect().
+						Table("application_endpoints").
+						Column("network_interface_id").
+						Where("port = ?", search.Port),
+				).
+				// endpoints bound to all the addresses of the machine
+				WhereOr("network_interface.machine_id IN (?)",
+					s.db.NewSelect().
+						TableExpr("application_endpoints AS ae").
+						Join("JOIN applications AS a ON a.id = ae.application_id").
+						Column("a.machine_id").
+						Where("ae.port = ?", search.Port).
+						Where("ae.addr IN (?)", bun.List([]string{"0.0.0.0", "::"})),
+				)
+		})
+	}
+	if search.Package != "" {
+		q = q.Where("network_interface.machine_id IN (?)",
+			s.db.NewSelect().Table("packages").Column("machine_id").
+				Where("LOWER(name) LIKE ?", likePattern(search.Package)))
+	}
+	if search.Application != "" {
+		q = q.Where("network_interface.machine_id IN (?)",
+			s.db.NewSelect().Table("applications").Column("machine_id").
+				Where("LOWER(name) LIKE ?", likePattern(search.Application)))
+	}
+	for _, word := range strings.Fields(search.Text) {
+		pattern := likePattern(word)
+		q = q.WhereGroup(" AND ", func(q *bun.SelectQuery) *bun.SelectQuery {
+			return q.
+				Where("network_interface.machine_id IN (?)", machines("LOWER(hostname) LIKE ?", pattern)).
+				WhereOr(s.ANYLIKE("network_interface.ip"), pattern).
+				WhereOr("LOWER(network_interface.mac) LIKE ?", pattern).
+				WhereOr("LOWER(network_interface.mac_vendor) LIKE ?", pattern)
+		})
+	}
+
+	if err := q.Scan(ctx); err != nil {
+		return nil, false, err
+	}
+	if len(nics) > limit {
+		return nics[:limit], true, nil
+	}
+	return nics, false, nil
+}
@@ -2,6 +2,7 @@ package store
 
 import (
 	"context"
+	"net"
 
 	"github.com/situation-sh/situation/pkg/models"
 	"github.com/situation-sh/situation/pkg/utils"
@@ -9,13 +10,20 @@ import (
 
 // GetOrCreateSubnetwork returns a subnetwork by its CIDR or creates it if it doesn't exist.
 func (s *BunStorage) GetOrCreateSubnetwork(ctx context.Context, cidr string) *models.Subnetwork {
+	_, ipnet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		s.onError(err)
+		return nil
+	}
 	subnet := new(models.Subnetwork)
-	subnet.NetworkCIDR = cidr
-	subnet.IPVersion = utils.IPVersionFromCIDR(cidr)
-	err := s.db.
+	subnet.NetworkCIDR = ipnet.String()
+	subnet.NetworkAddr = ipnet.IP.String()
+	subnet.MaskSize = utils.MaskSize(ipnet)
+	subnet.IPVersion = utils.IPVersionFromCIDR(subnet.NetworkCIDR)
+	err = s.db.
 		NewInsert().
 		Model(subnet).
-		On("CONFLICT (network_cidr) DO UPDATE").
+		On("CONFLICT (network_cidr, tag) DO UPDATE").
 		Set("updated_at = CURRENT_TIMESTAMP").
 		Scan(ctx, subnet)
 	if err != nil {
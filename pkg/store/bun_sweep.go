@@ -0,0 +1,61 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/situation-sh/situation/pkg/models"
+)
+
+// GetSweepCursor returns the cursor of the current agent on the
+// subnetwork. A new cursor (starting at the beginning of the
+// subnetwork) is returned if the agent has never swept it.
+func (s *BunStorage) GetSweepCursor(ctx context.Context, subnetID int64) (*models.SweepCursor, error) {
+	cursor := models.SweepCursor{Agent: s.agent, SubnetworkID: subnetID}
+	err := s.db.NewSelect().
+		Model(&cursor).
+		Where("agent = ?", s.agent).
+		Where("subnetwork_id = ?", subnetID).
+		Limit(1).
+		Scan(ctx)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	return &cursor, nil
+}
+
+// SaveSweepCursor inserts or updates the cursor
+func (s *BunStorage) SaveSweepCursor(ctx context.Context, cursor *models.SweepCursor) error {
+	cursor.Agent = s.agent
+	_, err := s.db.NewInsert().
+		Model(cursor).
+		On("CONFLICT (agent, subnetwork_id) DO UPDATE").
+		Set("updated_at = CURRENT_TIMESTAMP").
+		Set("position = EXCLUDED.position").
+		Set("passes = EXCLUDED.passes").
+		Returning("id").
+		Exec(ctx)
+	return err
+}
+
+// GetSubnetworkIPs returns the addresses of the network interfaces
+// attached to the subnetwork
+func (s *BunStorage) GetSubnetworkIPs(ctx context.Context, subnetID int64) []string {
+	nics := make([]*models.NetworkInterface, 0)
+	err := s.db.NewSelect().
+		Model(&nics).
+		Column("network_interface.id", "network_interface.ip").
+		Where("EXISTS (SELECT 1 FROM network_interface_subnets WHERE network_interface_id = network_interface.id AND subnetwork_id = ?)", subnetID).
+		Order("network_interface.id").
+		Scan(ctx)
+	if err != nil {
+		s.onError(err)
+		return nil
+	}
+	ips := make([]string, 0, len(nics))
+	for _, nic := range nics {
+		ips = append(ips, nic.IP...)
+	}
+	return ips
+}
@@ -2,8 +2,15 @@ package store
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"net"
+	"slices"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/situation-sh/situation/pkg/models"
 )
 
 func TestGenerateSchema(t *testing.T) {
@@ -57,3 +64,1116 @@ func TestQLiteCheckReadOnly(t *testing.T) {
 		t.Errorf("Expected read-only DSN to be '%s&mode=ro', got '%s'", dsn, rodsn)
 	}
 }
+
+func TestAgentRegistry(t *testing.T) {
+	ctx := context.Background()
+	storage, err := NewSQLiteBunStorage(":memory:",
+		WithAgent("test-agent"),
+		WithErrorHandler(func(err error) {
+			t.Errorf("Storage error: %v", err)
+		}),
+	)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	if err := storage.Migrate(ctx); err != nil {
+		t.Fatalf("failed to migrate tables: %v", err)
+	}
+
+	host := storage.GetOrCreateHost(ctx)
+	if host == nil {
+		t.Fatal("failed to create host")
+	}
+
+	agent, err := storage.AgentStarted(ctx, "0.20.1", "abcdef")
+	if err != nil {
+		t.Fatalf("failed to register agent: %v", err)
+	}
+	if agent.LastStatus != models.AgentStatusRunning {
+		t.Errorf("expected status %s, got %s", models.AgentStatusRunning, agent.LastStatus)
+	}
+
+	errs := []*models.ModuleError{{Module: "ping", Message: "boom"}}
+	if err := storage.AgentFinished(ctx, agent, nil, errs); err != nil {
+		t.Fatalf("failed to update agent: %v", err)
+	}
+
+	// a second run must not create another entry
+	if _, err := storage.AgentStarted(ctx, "0.21.0", "123456"); err != nil {
+		t.Fatalf("failed to register agent again: %v", err)
+	}
+
+	agents, err := storage.GetAgents(ctx)
+	if err != nil {
+		t.Fatalf("failed to list agents: %v", err)
+	}
+	if len(agents) != 1 {
+		t.Fatalf("expected 1 agent, got %d", len(agents))
+	}
+	a := agents[0]
+	if a.Version != "0.21.0" || a.LastStatus != models.AgentStatusRunning {
+		t.Errorf("unexpected agent state: version=%s status=%s", a.Version, a.LastStatus)
+	}
+	if a.MachineID != host.ID || a.Machine == nil {
+		t.Errorf("expected agent to be attached to machine %d, got %d", host.ID, a.MachineID)
+	}
+	if len(a.ModuleErrors) != 0 {
+		t.Errorf("expected module errors to be reset, got %v", a.ModuleErrors)
+	}
+
+	// the host is updated during the run
+	if _, err := storage.DB().NewUpdate().Model(host).Column("updated_at").WherePK().Exec(ctx); err != nil {
+		t.Fatalf("failed to update host: %v", err)
+	}
+	run, err := storage.GetLatestRun(ctx, 0)
+	if err != nil {
+		t.Fatalf("failed to get the latest run: %v", err)
+	}
+	if run.Agent.Agent != "test-agent" || len(run.Changes.Machines) != 1 {
+		t.Errorf("unexpected latest run: agent=%s machines=%d", run.Agent.Agent, len(run.Changes.Machines))
+	}
+}
+
+func TestGetAgentConfigs(t *testing.T) {
+	ctx := context.Background()
+	storage, err := NewSQLiteBunStorage(":memory:",
+		WithAgent("test-agent"),
+		WithErrorHandler(func(err error) {
+			t.Errorf("Storage error: %v", err)
+		}),
+	)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	if err := storage.Migrate(ctx); err != nil {
+		t.Fatalf("failed to migrate tables: %v", err)
+	}
+
+	host := storage.GetOrCreateHost(ctx)
+	host.Tag = "branch"
+	if _, err := storage.DB().NewUpdate().Model(host).Column("tag").WherePK().Exec(ctx); err != nil {
+		t.Fatalf("failed to tag host: %v", err)
+	}
+	subnet := &models.Subnetwork{NetworkCIDR: "10.0.0.0/24", NetworkAddr: "10.0.0.0", MaskSize: 24, IPVersion: 4, Tag: "ot"}
+	if _, err := storage.DB().NewInsert().Model(subnet).Exec(ctx); err != nil {
+		t.Fatalf("failed to insert subnet: %v", err)
+	}
+	nic := &models.NetworkInterface{Name: "eth0", IP: []string{"10.0.0.2"}, MachineID: host.ID}
+	if _, err := storage.DB().NewInsert().Model(nic).Exec(ctx); err != nil {
+		t.Fatalf("failed to insert nic: %v", err)
+	}
+	link := &models.NetworkInterfaceSubnet{NetworkInterfaceID: nic.ID, SubnetworkID: subnet.ID, IP: "10.0.0.2"}
+	if _, err := storage.DB().NewInsert().Model(link).Exec(ctx); err != nil {
+		t.Fatalf("failed to link nic: %v", err)
+	}
+
+	configs := []*models.AgentConfig{
+		{Name: "agent", TargetType: models.AgentConfigTargetAgent, Target: "test-agent"},
+		{Name: "other-agent", TargetType: models.AgentConfigTargetAgent, Target: "other-agent"},
+		{Name: "machine", TargetType: models.AgentConfigTargetMachine, Target: "branch"},
+		{Name: "subnet", TargetType: models.AgentConfigTargetSubnet, Target: "ot"},
+		{Name: "other-subnet", TargetType: models.AgentConfigTargetSubnet, Target: "dmz"},
+		{Name: "all-high", TargetType: models.AgentConfigTargetAll, Priority: 10},
+		{Name: "all-low", TargetType: models.AgentConfigTargetAll},
+		{Name: "disabled", TargetType: models.AgentConfigTargetAll, Disabled: true},
+	}
+	for _, c := range configs {
+		// no bulk insert: sqlite does not support DEFAULT in multi-row VALUES
+		if _, err := storage.DB().NewInsert().Model(c).Exec(ctx); err != nil {
+			t.Fatalf("failed to insert config: %v", err)
+		}
+	}
+
+	out, err := storage.GetAgentConfigs(ctx)
+	if err != nil {
+		t.Fatalf("failed to get configs: %v", err)
+	}
+	expected := []string{"all-low", "all-high", "subnet", "machine", "agent"}
+	if len(out) != len(expected) {
+		t.Fatalf("expected %d configs, got %d", len(expected), len(out))
+	}
+	for i, c := range out {
+		if c.Name != expected[i] {
+			t.Errorf("expected config %d to be %s, got %s", i, expected[i], c.Name)
+		}
+	}
+}
+
+// newTestStorage returns a migrated in-memory sqlite storage
+func newTestStorage(t *testing.T) *BunStorage {
+	t.Helper()
+	storage, err := NewSQLiteBunStorage(":memory:",
+		WithAgent("test-agent"),
+		WithErrorHandler(func(err error) {
+			t.Errorf("Storage error: %v", err)
+		}),
+	)
+	if err != nil {
+		t.Fatalf("failed to create storage: %v", err)
+	}
+	if err := storage.Migrate(context.Background()); err != nil {
+		t.Fatalf("failed to migrate tables: %v", err)
+	}
+	return storage
+}
+
+// inventory is a small dataset shared by the read-only tests
+type inventory struct {
+	lan       *models.Subnetwork
+	db        *models.Machine
+	web       *models.Machine
+	container *models.Machine
+	dbNIC     *models.NetworkInterface
+	webNIC    *models.NetworkInterface
+	postgres  *models.Application
+	nginx     *models.Application
+	pgEP      *models.ApplicationEndpoint
+	httpsEP   *models.ApplicationEndpoint
+	githubEP  *models.ApplicationEndpoint
+	flow      *models.Flow
+}
+
+// seedInventory fills the storage with two machines (db01 and web01)
+// on 10.0.0.0/24, a container hosted by web01, a flow from nginx to
+// postgres and a SaaS endpoint. Rows are inserted one by one
+// (sqlite does not support DEFAULT in multi-row VALUES).
+func seedInventory(t *testing.T, s *BunStorage) *inventory {
+	t.Helper()
+	ctx := context.Background()
+	insert := func(model any) {
+		t.Helper()
+		if _, err := s.DB().NewInsert().Model(model).Exec(ctx); err != nil {
+			t.Fatalf("failed to insert %T: %v", model, err)
+		}
+	}
+
+	inv := inventory{}
+	inv.lan = &models.Subnetwork{NetworkCIDR: "10.0.0.0/24", NetworkAddr: "10.0.0.0", MaskSize: 24, IPVersion: 4, Gateway: "10.0.0.1", Tag: "lan"}
+	insert(inv.lan)
+
+	inv.db = &models.Machine{Hostname: "db01", Platform: "linux", Distribution: "debian", Tag: "prod"}
+	insert(inv.db)
+	inv.web = &models.Machine{Hostname: "web01", Platform: "linux", Distribution: "ubuntu"}
+	insert(inv.web)
+	inv.container = &models.Machine{Hostname: "frontend", Platform: "docker", Distribution: "nginx", ParentMachineID: inv.web.ID}
+	insert(inv.container)
+
+	inv.dbNIC = &models.NetworkInterface{Name: "eth0", MAC: "AA:AA:AA:AA:AA:01", IP: []string{"10.0.0.10"}, MachineID: inv.db.ID}
+	insert(inv.dbNIC)
+	inv.webNIC = &models.NetworkInterface{Name: "eth0", MAC: "AA:AA:AA:AA:AA:02", IP: []string{"10.0.0.20"}, MachineID: inv.web.ID}
+	insert(inv.webNIC)
+	for _, nic := range []*models.NetworkInterface{inv.dbNIC, inv.webNIC} {
+		insert(&models.NetworkInterfaceSubnet{NetworkInterfaceID: nic.ID, SubnetworkID: inv.lan.ID, IP: nic.IP[0]})
+	}
+
+	inv.postgres = &models.Application{Name: "/usr/lib/postgresql/15/bin/postgres", PID: 100, MachineID: inv.db.ID}
+	insert(inv.postgres)
+	inv.nginx = &models.Application{Name: "/usr/sbin/nginx", PID: 200, MachineID: inv.web.ID}
+	insert(inv.nginx)
+
+	inv.pgEP = &models.ApplicationEndpoint{Port: 5432, Protocol: "tcp", Addr: "0.0.0.0", ApplicationProtocols: []string{"postgresql"}, ApplicationID: inv.postgres.ID}
+	insert(inv.pgEP)
+	inv.httpsEP = &models.ApplicationEndpoint{Port: 443, Protocol: "tcp", Addr: "10.0.0.20", ApplicationProtocols: []string{"http"}, ApplicationID: inv.nginx.ID, NetworkInterfaceID: inv.webNIC.ID}
+	insert(inv.httpsEP)
+	inv.githubEP = &models.ApplicationEndpoint{Port: 443, Protocol: "tcp", Addr: "140.82.121.3", SaaS: "GitHub"}
+	insert(inv.githubEP)
+
+	inv.flow = &models.Flow{SrcApplicationID: inv.nginx.ID, SrcNetworkInterfaceID: inv.webNIC.ID, SrcAddr: "10.0.0.20", DstEndpointID: inv.pgEP.ID}
+	insert(inv.flow)
+
+	for _, p := range []*models.Package{
+		{Name: "postgresql-15", Version: "15.4", Manager: "dpkg", MachineID: inv.db.ID},
+		{Name: "openssl", Version: "3.0.11", Manager: "dpkg", MachineID: inv.db.ID},
+		{Name: "nginx", Version: "1.24.0", Manager: "dpkg", MachineID: inv.web.ID},
+	} {
+		insert(p)
+	}
+	return &inv
+}
+
+func TestInventoryQueries(t *testing.T) {
+	ctx := context.Background()
+	storage := newTestStorage(t)
+	inv := seedInventory(t, storage)
+
+	machines, err := storage.ListMachines(ctx, MachineFilter{Subnet: "10.0.0.0/24", Hostname: "db*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(machines) != 1 || machines[0].ID != inv.db.ID {
+		t.Errorf("expected db01, got %v", machines)
+	}
+
+	for _, ref := range []string{fmt.Sprint(inv.web.ID), "WEB01", "10.0.0.20"} {
+		id, err := storage.ResolveMachine(ctx, ref)
+		if err != nil || id != inv.web.ID {
+			t.Errorf("failed to resolve %s: id=%d err=%v", ref, id, err)
+		}
+	}
+	for _, ref := range []string{"unknown", "999999"} {
+		if _, err := storage.ResolveMachine(ctx, ref); err == nil {
+			t.Errorf("expected an error for the unknown machine %s", ref)
+		}
+	}
+
+	details, err := storage.GetMachineDetails(ctx, inv.web.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(details.NICS) != 1 || len(details.NICS[0].Subnetworks) != 1 || len(details.Applications) != 1 {
+		t.Errorf("incomplete machine details: %+v", details.Machine)
+	}
+	if len(details.Children) != 1 || details.Children[0].ID != inv.container.ID {
+		t.Errorf("expected the container as child, got %v", details.Children)
+	}
+
+	endpoints, err := storage.FindEndpoints(ctx, EndpointFilter{Protocol: "postgresql"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(endpoints) != 1 || endpoints[0].ID != inv.pgEP.ID || endpoints[0].Application.Machine == nil {
+		t.Errorf("expected the postgres endpoint, got %v", endpoints)
+	}
+	endpoints, err = storage.FindEndpoints(ctx, EndpointFilter{Port: 443, SaaS: "*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(endpoints) != 1 || endpoints[0].ID != inv.githubEP.ID {
+		t.Errorf("expected the GitHub endpoint, got %v", endpoints)
+	}
+
+	for _, pair := range [][2]int64{{inv.web.ID, inv.db.ID}, {inv.db.ID, inv.web.ID}} {
+		flows, err := storage.GetFlowsBetween(ctx, pair[0], pair[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(flows) != 1 || flows[0].ID != inv.flow.ID {
+			t.Errorf("expected 1 flow between %v, got %v", pair, flows)
+		}
+	}
+
+	// wildcard endpoint of the machine owning the IP
+	endpoints, err = storage.WhoListensOn(ctx, "10.0.0.10", 5432)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(endpoints) != 1 || endpoints[0].ID != inv.pgEP.ID {
+		t.Errorf("expected postgres to listen on 10.0.0.10:5432, got %v", endpoints)
+	}
+	endpoints, err = storage.WhoListensOn(ctx, "10.0.0.10", 443)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(endpoints) != 0 {
+		t.Errorf("expected nobody on 10.0.0.10:443, got %v", endpoints)
+	}
+
+	pkgs, err := storage.GetPackagesOn(ctx, inv.db.ID, "postgres", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pkgs) != 1 || pkgs[0].Name != "postgresql-15" {
+		t.Errorf("expected postgresql-15, got %v", pkgs)
+	}
+
+	subnet, err := storage.GetSubnetDetails(ctx, "10.0.0.0/24")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(subnet.Machines) != 2 || len(subnet.Endpoints) != 2 {
+		t.Errorf("expected 2 machines and 2 endpoints on the subnet, got %d and %d",
+			len(subnet.Machines), len(subnet.Endpoints))
+	}
+	if _, err := storage.GetSubnetDetails(ctx, "192.168.0.0/24"); err == nil {
+		t.Error("expected an error for an unknown subnet")
+	}
+
+	changes, err := storage.GetChanges(ctx, time.Now().Add(-time.Hour), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes.Machines) != 3 || len(changes.Flows) != 1 || len(changes.Packages) != 3 {
+		t.Errorf("unexpected changes: %d machines, %d flows, %d packages",
+			len(changes.Machines), len(changes.Flows), len(changes.Packages))
+	}
+	changes, err = storage.GetChanges(ctx, time.Now().Add(time.Hour), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes.Machines) != 0 {
+		t.Errorf("expected no change in the future, got %d machines", len(changes.Machines))
+	}
+}
+
+func TestGetNICsByMAC(t *testing.T) {
+	ctx := context.Background()
+	storage := newTestStorage(t)
+	inv := seedInventory(t, storage)
+
+	nics := storage.GetNICsByMAC(ctx, inv.dbNIC.MAC)
+	if len(nics) != 1 || nics[0].ID != inv.dbNIC.ID || len(nics[0].Subnetworks) != 1 {
+		t.Errorf("expected the NIC of db01, got %v", nics)
+	}
+	if nics := storage.GetNICsByMAC(ctx, "AA:AA:AA:AA:AA:FF"); len(nics) != 0 {
+		t.Errorf("expected no NIC, got %v", nics)
+	}
+}
+
+func TestGetNICsInRanges(t *testing.T) {
+	ctx := context.Background()
+	storage := newTestStorage(t)
+	inv := seedInventory(t, storage)
+
+	nics, err := storage.GetNICsInRanges(ctx, [][2]net.IP{{net.ParseIP("10.0.0.15"), net.ParseIP("10.0.0.30")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nics) != 1 || nics[0].ID != inv.webNIC.ID || nics[0].Machine == nil || len(nics[0].Subnetworks) != 1 {
+		t.Errorf("expected the NIC of web01, got %v", nics)
+	}
+	if nics, err := storage.GetNICsInRanges(ctx, nil); err != nil || len(nics) != 0 {
+		t.Errorf("expected no NIC, got %v (%v)", nics, err)
+	}
+}
+
+func TestGetOrCreateSubnetwork(t *testing.T) {
+	ctx := context.Background()
+	storage := newTestStorage(t)
+
+	subnet := storage.GetOrCreateSubnetwork(ctx, "10.8.1.7/16")
+	if subnet == nil {
+		t.Fatal("subnetwork not created")
+	}
+	if subnet.NetworkCIDR != "10.8.0.0/16" || subnet.NetworkAddr != "10.8.0.0" || subnet.MaskSize != 16 || subnet.IPVersion != 4 {
+		t.Errorf("unexpected subnetwork: %+v", subnet)
+	}
+	again := storage.GetOrCreateSubnetwork(ctx, "10.8.0.0/16")
+	if again == nil || again.ID != subnet.ID {
+		t.Errorf("expected the same subnetwork, got %+v", again)
+	}
+}
+
+func TestSweepCursor(t *testing.T) {
+	ctx := context.Background()
+	storage := newTestStorage(t)
+	inv := seedInventory(t, storage)
+
+	cursor, err := storage.GetSweepCursor(ctx, inv.lan.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cursor.ID != 0 || cursor.Position != 0 {
+		t.Errorf("expected a new cursor, got %+v", cursor)
+	}
+	cursor.Position = 4097
+	if err := storage.SaveSweepCursor(ctx, cursor); err != nil {
+		t.Fatal(err)
+	}
+	cursor.Position = 8193
+	cursor.Passes = 1
+	if err := storage.SaveSweepCursor(ctx, cursor); err != nil {
+		t.Fatal(err)
+	}
+	cursor, err = storage.GetSweepCursor(ctx, inv.lan.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cursor.Agent != "test-agent" || cursor.Position != 8193 || cursor.Passes != 1 {
+		t.Errorf("cursor not updated: %+v", cursor)
+	}
+
+	ips := storage.GetSubnetworkIPs(ctx, inv.lan.ID)
+	if strings.Join(ips, ",") != "10.0.0.10,10.0.0.20" {
+		t.Errorf("unexpected subnetwork addresses: %v", ips)
+	}
+}
+
+func TestCheckReadOnlySQL(t *testing.T) {
+	valid := map[string]string{
+		"SELECT 1":                          "SELECT 1",
+		"  select * from machines ;  ":      "select * from machines",
+		"-- comment\nSELECT 1; -- trailing": "-- comment\nSELECT 1",
+		"WITH m AS (SELECT id FROM machines) SELECT * FROM m": "WITH m AS (SELECT id FROM machines) SELECT * FROM m",
+		"SELECT 'DROP TABLE machines; --'":                    "SELECT 'DROP TABLE machines; --'",
+		`SELECT "update" FROM t`:                              `SELECT "update" FROM t`,
+		"SELECT $$;DELETE$$":                                  "SELECT $$;DELETE$$",
+		"SELECT updated_at FROM machines":                     "SELECT updated_at FROM machines",
+		`SELECT E'it\'s; DROP'`:                               `SELECT E'it\'s; DROP'`,
+	}
+	for query, expected := range valid {
+		stmt, err := CheckReadOnlySQL(query)
+		if err != nil {
+			t.Errorf("%q must be accepted: %v", query, err)
+		} else if stmt != expected {
+			t.Errorf("%q: expected statement %q, got %q", query, expected, stmt)
+		}
+	}
+
+	invalid := []string{
+		"",
+		"-- only a comment",
+		"DELETE FROM machines",
+		"SELECT 1; DELETE FROM machines",
+		"SELECT 1; SELECT 2",
+		"WITH d AS (DELETE FROM machines RETURNING *) SELECT * FROM d",
+		"SELECT * INTO copy FROM machines",
+		"SELECT * FROM machines FOR UPDATE",
+		"PRAGMA query_only = OFF",
+		"'x' SELECT 1",
+		"SELECT 'unterminated",
+		"SELECT load_extension('evil')",
+		// keywords ending with E are not E'' prefixes
+		`SELECT 1 WHERE 'a' LIKE'\'; COMMIT; SET SESSION CHARACTERISTICS AS TRANSACTION READ WRITE; DELETE FROM machines; SELECT '`,
+		`SELECT 1 WHERE'\'; DELETE FROM machines; SELECT '`,
+		`SELECT CASE'\' WHEN 1 THEN 1 END; DELETE FROM machines; SELECT '`,
+	}
+	for _, query := range invalid {
+		if _, err := CheckReadOnlySQL(query); err == nil {
+			t.Errorf("%q must be rejected", query)
+		}
+	}
+}
+
+func TestParsePGArray(t *testing.T) {
+	arr, ok := parsePGArray(`{a,"b c",NULL,"NULL","d\"e"}`)
+	if !ok {
+		t.Fatal("failed to parse array")
+	}
+	expected := []any{"a", "b c", nil, "NULL", `d"e`}
+	if fmt.Sprint(arr) != fmt.Sprint(expected) {
+		t.Errorf("expected %v, got %v", expected, arr)
+	}
+	if _, ok := parsePGArray("{{1,2},{3,4}}"); ok {
+		t.Error("multi-dimensional arrays are not supported")
+	}
+}
+
+func TestSafeQuery(t *testing.T) {
+	ctx := context.Background()
+	storage := newTestStorage(t)
+	inv := seedInventory(t, storage)
+
+	result, err := storage.SafeQuery(ctx, "SELECT machines.id, hostname, ip FROM machines JOIN network_interfaces ON machine_id = machines.id ORDER BY machines.id", QueryOptions{MaxRows: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Truncated || result.RowCount != 1 || len(result.Columns) != 3 {
+		t.Errorf("unexpected result: %+v", result)
+	}
+	row := result.Rows[0]
+	if row["hostname"] != inv.db.Hostname {
+		t.Errorf("expected hostname %s, got %v", inv.db.Hostname, row["hostname"])
+	}
+	// the IP list is a JSON document in sqlite
+	if ip, ok := row["ip"].(json.RawMessage); !ok || string(ip) != `["10.0.0.10"]` {
+		t.Errorf("expected a JSON list of IP, got %T %v", row["ip"], row["ip"])
+	}
+
+	result, err = storage.SafeQuery(ctx, "SELECT x'00ff' AS b, NULL AS n, 1.5 AS f", QueryOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, ok := result.Rows[0]["b"].([]byte); !ok || len(b) != 2 || result.Rows[0]["n"] != nil || result.Rows[0]["f"] != 1.5 {
+		t.Errorf("types are not preserved: %#v", result.Rows[0])
+	}
+
+	if _, err := storage.SafeQuery(ctx, "DELETE FROM machines", QueryOptions{}); err == nil {
+		t.Error("write queries must be rejected")
+	}
+	if _, err := storage.SafeQuery(ctx, "SELECT * FROM unknown_table", QueryOptions{}); err == nil {
+		t.Error("errors must be reported")
+	}
+
+	// infinite recursion stopped by the timeout
+	infinite := "WITH RECURSIVE r(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM r) SELECT count(*) FROM r"
+	if _, err := storage.SafeQuery(ctx, infinite, QueryOptions{Timeout: 100 * time.Millisecond}); err == nil {
+		t.Error("the query must time out")
+	}
+
+	// the connection must be writable again
+	if _, err := storage.DB().NewUpdate().Model(inv.db).Set("tag = ?", "test").WherePK().Exec(ctx); err != nil {
+		t.Errorf("the connection is still read-only: %v", err)
+	}
+}
+
+func TestParseNICSearch(t *testing.T) {
+	search, err := ParseNICSearch("port:443 vendor:cisco host:db* fe80::1 web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := NICSearch{Port: 443, Vendor: "cisco", Host: "db*", Text: "fe80::1 web"}
+	if search != expected {
+		t.Errorf("expected %+v, got %+v", expected, search)
+	}
+
+	for _, query := range []string{"port:https", "port:0", "host:"} {
+		if _, err := ParseNICSearch(query); err == nil {
+			t.Errorf("expected an error for %q", query)
+		}
+	}
+}
+
+func TestSearchNICs(t *testing.T) {
+	ctx := context.Background()
+	storage := newTestStorage(t)
+	inv := seedInventory(t, storage)
+
+	cases := []struct {
+		query    string
+		expected []int64
+	}{
+		{"", []int64{inv.dbNIC.ID, inv.webNIC.ID}},
+		{"host:db*", []int64{inv.dbNIC.ID}},
+		{"ip:10.0.0.2*", []int64{inv.webNIC.ID}},
+		{"mac:aa:aa:aa:aa:aa:02", []int64{inv.webNIC.ID}},
+		// bound to the NIC
+		{"port:443", []int64{inv.webNIC.ID}},
+		// bound to all the addresses
+		{"port:5432", []int64{inv.dbNIC.ID}},
+		{"pkg:openssl", []int64{inv.dbNIC.ID}},
+		{"app:nginx", []int64{inv.webNIC.ID}},
+		{"web01", []int64{inv.webNIC.ID}},
+		{"10.0.0.10", []int64{inv.dbNIC.ID}},
+		{"host:db* port:443", []int64{}},
+	}
+	for _, c := range cases {
+		search, err := ParseNICSearch(c.query)
+		if err != nil {
+			t.Fatalf("%q: %v", c.query, err)
+		}
+		nics, more, err := storage.SearchNICs(ctx, search)
+		if err != nil {
+			t.Fatalf("%q: %v", c.query, err)
+		}
+		if more {
+			t.Errorf("%q: unexpected cut off results", c.query)
+		}
+		ids := make([]int64, len(nics))
+		for i, nic := range nics {
+			ids[i] = nic.ID
+		}
+		if !slices.Equal(ids, c.expected) {
+			t.Errorf("%q: expected %v, got %v", c.query, c.expected, ids)
+		}
+		for _, nic := range nics {
+			if nic.Machine == nil || len(nic.Subnetworks) != 1 {
+				t.Errorf("%q: expected machine and subnet to be loaded", c.query)
+			}
+		}
+	}
+
+	// the results are cut off at the limit
+	nics, more, err := storage.SearchNICs(ctx, NICSearch{Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(nics) != 1 || nics[0].ID != inv.dbNIC.ID || !more {
+		t.Errorf("expected the first NIC and more results, got %d (more=%v)", len(nics), more)
+	}
+	if _, more, _ := storage.SearchNICs(ctx, NICSearch{Limit: 2}); more {
+		t.Error("expected no more results when the limit is reached exactly")
+	}
+}
+
+func TestLastUpdate(t *testing.T) {
+	ctx := context.Background()
+	storage := newTestStorage(t)
+
+	last, err := storage.LastUpdate(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !last.IsZero() {
+		t.Errorf("expected zero time on an empty database, got %v", last)
+	}
+
+	inv := seedInventory(t, storage)
+	last, err = storage.LastUpdate(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last.IsZero() {
+		t.Fatal("expected a watermark")
+	}
+
+	later := last.Add(time.Hour)
+	_, err = storage.DB().NewUpdate().
+		Model(inv.dbNIC).
+		Set("updated_at = ?", later).
+		WherePK().
+		Exec(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	last, err = storage.LastUpdate(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// sqlite may not keep the sub-second part
+	if later.Sub(last).Abs() >= time.Second {
+		t.Errorf("expected %v, got %v", later, last)
+	}
+}
+
+func TestRunHistory(t *testing.T) {
+	ctx := context.Background()
+	storage := newTestStorage(t)
+	inv := seedInventory(t, storage)
+	agent := &models.Agent{Agent: "test-agent", LastRunStart: time.Now(), LastStatus: models.AgentStatusSuccess}
+	insert := func(model any) {
+		t.Helper()
+		if _, err := storage.DB().NewInsert().Model(model).Exec(ctx); err != nil {
+			t.Fatalf("failed to insert %T: %v", model, err)
+		}
+	}
+	// the agent runs on web01, the laptop is out of its reach
+	inv.web.Agent = agent.Agent
+	if _, err := storage.DB().NewUpdate().Model(inv.web).Column("agent").WherePK().Exec(ctx); err != nil {
+		t.Fatal(err)
+	}
+	insert(&models.Machine{Hostname: "laptop", Platform: "windows"})
+
+	first, err := storage.RecordRun(ctx, agent, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(first.Snapshot.Machines) != 3 || len(first.Snapshot.Flows) != 1 {
+		t.Fatalf("unexpected snapshot: %+v", first.Snapshot)
+	}
+
+	// change the inventory
+	cam := &models.Machine{Hostname: "cam01", Platform: "linux"}
+	insert(cam)
+	camNIC := &models.NetworkInterface{MAC: "AA:AA:AA:AA:AA:03", IP: []string{"10.0.0.30"}, MachineID: cam.ID}
+	insert(camNIC)
+	insert(&models.NetworkInterfaceSubnet{NetworkInterfaceID: camNIC.ID, SubnetworkID: inv.lan.ID, IP: "10.0.0.30"})
+	insert(&models.Machine{Hostname: "printer", Platform: "linux"})
+	inv.dbNIC.IP = []string{"10.0.0.11"}
+	if _, err := storage.DB().NewUpdate().Model(inv.dbNIC).Column("ip").WherePK().Exec(ctx); err != nil {
+		t.Fatal(err)
+	}
+	insert(&models.ApplicationEndpoint{Port: 22, Protocol: "tcp", Addr: "0.0.0.0", ApplicationID: inv.postgres.ID})
+	if _, err := storage.DB().NewUpdate().Model((*models.Package)(nil)).
+		Set("version = ?", "3.0.13").Where("name = ?", "openssl").Exec(ctx); err != nil {
+		t.Fatal(err)
+	}
+	insert(&models.Flow{SrcApplicationID: inv.postgres.ID, SrcAddr: "10.0.0.11", DstEndpointID: inv.githubEP.ID})
+
+	diff, err := storage.DiffRuns(ctx, first, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff.From.RunID != first.ID || diff.To.RunID != 0 {
+		t.Errorf("unexpected points: %v -> %v", diff.From, diff.To)
+	}
+	if len(diff.NewMachines) != 1 || diff.NewMachines[0].Label != "cam01" || len(diff.VanishedMachines) != 0 {
+		t.Errorf("unexpected machines: +%v -%v", diff.NewMachines, diff.VanishedMachines)
+	}
+	if len(diff.ChangedIPs) != 1 || !slices.Equal(diff.ChangedIPs[0].Added, []string{"10.0.0.11"}) || !slices.Equal(diff.ChangedIPs[0].Removed, []string{"10.0.0.10"}) {
+		t.Errorf("unexpected IP changes: %+v", diff.ChangedIPs)
+	}
+	if len(diff.OpenedPorts) != 1 || diff.OpenedPorts[0].Port != "tcp/22" || len(diff.ClosedPorts) != 0 {
+		t.Errorf("unexpected ports: +%v -%v", diff.OpenedPorts, diff.ClosedPorts)
+	}
+	if len(diff.ChangedPackages) != 1 || diff.ChangedPackages[0].From != "3.0.11" || diff.ChangedPackages[0].To != "3.0.13" {
+		t.Errorf("unexpected package changes: %+v", diff.ChangedPackages)
+	}
+	if len(diff.NewFlows) != 1 || diff.NewFlows[0].Src != "db01" || diff.NewFlows[0].Dst != "140.82.121.3" {
+		t.Errorf("unexpected flows: %+v", diff.NewFlows)
+	}
+	var text strings.Builder
+	if err := diff.WriteText(&text); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(text.String(), "openssl 3.0.11 → 3.0.13") {
+		t.Errorf("unexpected text output:\n%s", text.String())
+	}
+
+	// only the 2 most recent runs of every agent are kept
+	other := &models.Agent{Agent: "other-agent", LastRunStart: time.Now(), LastStatus: models.AgentStatusSuccess}
+	otherRun, err := storage.RecordRun(ctx, other, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(otherRun.Snapshot.Machines) != 0 {
+		t.Errorf("expected an empty snapshot for an agent without machine, got %+v", otherRun.Snapshot)
+	}
+	if _, err := storage.DiffRuns(ctx, first, otherRun); err == nil {
+		t.Error("expected an error when comparing the runs of different agents")
+	}
+	for range 2 {
+		if _, err := storage.RecordRun(ctx, agent, 2); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := storage.GetRun(ctx, otherRun.ID); err != nil {
+		t.Errorf("the run of the other agent must be kept: %v", err)
+	}
+	if _, err := storage.DB().NewDelete().Model(otherRun).WherePK().Exec(ctx); err != nil {
+		t.Fatal(err)
+	}
+	runs, err := storage.ListRuns(ctx, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 2 || runs[0].Snapshot != nil {
+		t.Errorf("expected 2 runs without snapshot, got %v", runs)
+	}
+	if _, err := storage.GetRun(ctx, first.ID); err == nil {
+		t.Error("expected the first run to be pruned")
+	}
+	last, err := storage.GetRunAt(ctx, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last.ID != runs[0].ID || last.Snapshot == nil {
+		t.Errorf("expected the last run, got %v", last)
+	}
+	previous, err := storage.GetPreviousRun(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if previous.ID != runs[1].ID {
+		t.Errorf("expected run #%d, got #%d", runs[1].ID, previous.ID)
+	}
+	diff = DiffSnapshots(last.Snapshot, last.Snapshot)
+	if !diff.Empty() {
+		t.Errorf("expected no changes, got %+v", diff)
+	}
+}
+
+func TestBuildReport(t *testing.T) {
+	ctx := context.Background()
+	storage := newTestStorage(t)
+	inv := seedInventory(t, storage)
+
+	// a certificate that expires in a week
+	expiring := &models.ApplicationEndpoint{
+		Port:          8443,
+		Protocol:      "tcp",
+		Addr:          "10.0.0.20",
+		ApplicationID: inv.nginx.ID,
+		TLS:           &models.TLS{Subject: "CN=web01", NotAfter: time.Now().Add(7 * 24 * time.Hour)},
+	}
+	if _, err := storage.DB().NewInsert().Model(expiring).Exec(ctx); err != nil {
+		t.Fatal(err)
+	}
+	local := &models.ApplicationEndpoint{Port: 6379, Protocol: "tcp", Addr: "127.0.0.1", ApplicationID: inv.postgres.ID}
+	if _, err := storage.DB().NewInsert().Model(local).Exec(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := storage.BuildReport(ctx, ReportOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Subnets) != 1 || len(report.Subnets[0].Hosts) != 2 {
+		t.Fatalf("expected 2 hosts on 1 subnet, got %+v", report.Subnets)
+	}
+	db := report.Subnets[0].Hosts[0]
+	if db.Hostname != "db01" || db.IP != "10.0.0.10" || !slices.Equal(db.Ports, []string{"tcp/5432"}) {
+		t.Errorf("unexpected host: %+v", db)
+	}
+	if len(report.Services) != 3 {
+		t.Errorf("expected 3 exposed services, got %d", len(report.Services))
+	}
+	for _, s := range report.Services {
+		if s.Addr == "127.0.0.1" || s.Addr == inv.githubEP.Addr {
+			t.Errorf("unexpected service: %+v", s)
+		}
+	}
+	if len(report.Certificates) != 1 || report.Certificates[0].Subject != "CN=web01" {
+		t.Errorf("expected the web01 certificate, got %+v", report.Certificates)
+	}
+	if len(report.SaaS) != 1 || report.SaaS[0].Name != "GitHub" || report.SaaS[0].Endpoints != 1 {
+		t.Errorf("unexpected SaaS usage: %+v", report.SaaS)
+	}
+	if len(report.Packages) != 1 || report.Packages[0].Packages != 3 || report.Packages[0].Machines != 2 {
+		t.Errorf("unexpected package counts: %+v", report.Packages)
+	}
+
+	// certificates expiring later are not reported
+	report, err = storage.BuildReport(ctx, ReportOptions{CertificateWindow: 24 * time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Certificates) != 0 {
+		t.Errorf("expected no certificate, got %+v", report.Certificates)
+	}
+}
+
+func TestCannedQueries(t *testing.T) {
+	ctx := context.Background()
+	storage := newTestStorage(t)
+	inv := seedInventory(t, storage)
+
+	for _, ep := range []*models.ApplicationEndpoint{
+		{Port: 8443, Protocol: "tcp", Addr: "10.0.0.20", ApplicationID: inv.nginx.ID,
+			TLS: &models.TLS{Subject: "CN=web01", NotAfter: time.Now().Add(7 * 24 * time.Hour)}},
+		{Port: 9443, Protocol: "tcp", Addr: "10.0.0.20", ApplicationID: inv.nginx.ID,
+			TLS: &models.TLS{Subject: "CN=later", NotAfter: time.Now().Add(365 * 24 * time.Hour)}},
+		{Port: 6379, Protocol: "tcp", Addr: "127.0.0.1", ApplicationID: inv.postgres.ID},
+		// no application nor network interface: attached through the address
+		{Port: 161, Protocol: "udp", Addr: "10.0.0.10"},
+	} {
+		if _, err := storage.DB().NewInsert().Model(ep).Exec(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	result, err := storage.RunCannedQuery(ctx, "exposed-services", 0, QueryOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.RowCount != 5 {
+		t.Fatalf("expected 5 exposed services, got %d: %v", result.RowCount, result.Rows)
+	}
+	snmp := false
+	for _, row := range result.Rows {
+		if row["addr"] == "127.0.0.1" || row["addr"] == inv.githubEP.Addr {
+			t.Errorf("unexpected service: %v", row)
+		}
+		if row["protocol"] == "udp" {
+			snmp = row["hostname"] == "db01"
+		}
+	}
+	if !snmp {
+		t.Errorf("expected the udp endpoint to be attached to db01, got %v", result.Rows)
+	}
+
+	result, err = storage.RunCannedQuery(ctx, "expiring-certs", 0, QueryOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.RowCount != 1 || result.Rows[0]["subject"] != "CN=web01" || result.Rows[0]["hostname"] != "web01" {
+		t.Errorf("expected the web01 certificate, got %v", result.Rows)
+	}
+	result, err = storage.RunCannedQuery(ctx, "expiring-certs", 2*365*24*time.Hour, QueryOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.RowCount != 2 {
+		t.Errorf("expected 2 certificates, got %v", result.Rows)
+	}
+
+	result, err = storage.RunCannedQuery(ctx, "stale-machines", 0, QueryOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.RowCount != 0 {
+		t.Errorf("expected no stale machine, got %v", result.Rows)
+	}
+	if _, err := storage.DB().NewUpdate().Model(inv.db).
+		Set("updated_at = ?", time.Now().Add(-30*24*time.Hour)).
+		WherePK().
+		Exec(ctx); err != nil {
+		t.Fatal(err)
+	}
+	result, err = storage.RunCannedQuery(ctx, "stale-machines", 0, QueryOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.RowCount != 1 || result.Rows[0]["hostname"] != "db01" {
+		t.Errorf("expected db01 to be stale, got %v", result.Rows)
+	}
+
+	if _, err := storage.RunCannedQuery(ctx, "unknown", 0, QueryOptions{}); err == nil {
+		t.Error("expected an error for an unknown canned query")
+	}
+}
+
+func TestInventoryGraph(t *testing.T) {
+	ctx := context.Background()
+	storage := newTestStorage(t)
+	inv := seedInventory(t, storage)
+
+	// an endpoint found by a scan (bound to db01 through its address)
+	snmp := &models.ApplicationEndpoint{Port: 161, Protocol: "udp", Addr: "10.0.0.10"}
+	if _, err := storage.DB().NewInsert().Model(snmp).Exec(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	db := Node{Kind: NodeMachine, ID: inv.db.ID}
+	web := Node{Kind: NodeMachine, ID: inv.web.ID}
+
+	edges, err := storage.Neighbors(ctx, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(edges) != 4 {
+		t.Errorf("expected 4 neighbors of db01, got %v", edges)
+	}
+	for _, e := range edges {
+		if !e.From.is(db) || e.Kind != EdgeHas || e.From.Label != "db01" || e.To.Label == "" {
+			t.Errorf("unexpected edge: %+v", e)
+		}
+	}
+	edges, err = storage.Neighbors(ctx, Node{Kind: NodeNIC, ID: inv.dbNIC.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	kinds := make([]EdgeKind, 0)
+	for _, e := range edges {
+		kinds = append(kinds, e.Kind)
+	}
+	if !slices.Equal(kinds, []EdgeKind{EdgeBinds, EdgeHas, EdgeMember}) {
+		t.Errorf("unexpected neighbors of eth0: %v", edges)
+	}
+
+	path, err := storage.ShortestPath(ctx, web, db, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(path) != 4 || !path[0].From.is(web) || !path[len(path)-1].From.is(db) {
+		t.Errorf("unexpected path from web01 to db01: %v", path)
+	}
+	if _, err := storage.ShortestPath(ctx, web, Node{Kind: NodeEndpoint, ID: inv.githubEP.ID}, 0); err != ErrNoPath {
+		t.Errorf("expected no path to the SaaS endpoint, got %v", err)
+	}
+
+	reached, err := storage.ReachableFrom(ctx, inv.db.ID, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	machines := make(map[string]int)
+	for _, r := range reached {
+		if r.Kind == NodeMachine {
+			machines[r.Label] = r.Depth
+		}
+	}
+	if len(machines) != 2 || machines["web01"] != 4 || machines["frontend"] != 5 {
+		t.Errorf("unexpected machines reachable from db01: %v", machines)
+	}
+
+	reached, err = storage.BlastRadius(ctx, inv.pgEP.ID, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	impacted := make([]string, 0)
+	for _, r := range reached {
+		impacted = append(impacted, fmt.Sprintf("%s:%s:%d", r.Kind, r.Label, r.Depth))
+	}
+	expected := []string{"application:/usr/sbin/nginx:1", "endpoint:10.0.0.20:443/tcp:2", "machine:web01:2"}
+	if !slices.Equal(impacted, expected) {
+		t.Errorf("expected the blast radius %v, got %v", expected, impacted)
+	}
+
+	if n, err := ParseNode("machine:12"); err != nil || n.Kind != NodeMachine || n.ID != 12 {
+		t.Errorf("unexpected node %v (%v)", n, err)
+	}
+	for _, s := range []string{"machine", "router:1", "nic:x"} {
+		if _, err := ParseNode(s); err == nil {
+			t.Errorf("expected an error for %q", s)
+		}
+	}
+}
+
+func TestTopology(t *testing.T) {
+	ctx := context.Background()
+	storage := newTestStorage(t)
+	inv := seedInventory(t, storage)
+
+	// a second subnet with a machine that only talks to web01
+	dmz := &models.Subnetwork{NetworkCIDR: "192.168.1.0/24", NetworkAddr: "192.168.1.0", MaskSize: 24, IPVersion: 4}
+	proxy := &models.Machine{Hostname: "proxy"}
+	for _, model := range []any{dmz, proxy} {
+		if _, err := storage.DB().NewInsert().Model(model).Exec(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	proxyNIC := &models.NetworkInterface{Name: "eth0", MAC: "AA:AA:AA:AA:AA:03", IP: []string{"192.168.1.2"}, MachineID: proxy.ID}
+	if _, err := storage.DB().NewInsert().Model(proxyNIC).Exec(ctx); err != nil {
+		t.Fatal(err)
+	}
+	proxyApp := &models.Application{Name: "/usr/sbin/haproxy", PID: 300, MachineID: proxy.ID}
+	for _, model := range []any{
+		&models.NetworkInterfaceSubnet{NetworkInterfaceID: proxyNIC.ID, SubnetworkID: dmz.ID, IP: "192.168.1.2"},
+		proxyApp,
+	} {
+		if _, err := storage.DB().NewInsert().Model(model).Exec(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, model := range []any{
+		&models.Flow{SrcApplicationID: proxyApp.ID, SrcAddr: "192.168.1.2", DstEndpointID: inv.httpsEP.ID},
+		&models.Flow{SrcApplicationID: inv.nginx.ID, SrcAddr: "10.0.0.20", DstEndpointID: inv.githubEP.ID},
+	} {
+		if _, err := storage.DB().NewInsert().Model(model).Exec(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	topology, err := storage.Topology(ctx, TopologyOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(topology.Subnets) != 2 || len(topology.Machines) != 4 || len(topology.Links) != 3 || len(topology.Flows) != 3 {
+		t.Fatalf("unexpected topology: %d subnets, %d machines, %d links, %d flows",
+			len(topology.Subnets), len(topology.Machines), len(topology.Links), len(topology.Flows))
+	}
+	for _, m := range topology.Machines {
+		if m.Name == "frontend" && m.ParentID != inv.web.ID {
+			t.Errorf("expected the container to be nested under web01: %+v", m)
+		}
+		if m.Name == "db01" && m.SubnetID != inv.lan.ID {
+			t.Errorf("expected db01 in the lan cluster: %+v", m)
+		}
+	}
+	for _, f := range topology.Flows {
+		if f.DstMachineID == 0 && (f.DstAddr != inv.githubEP.Addr || f.SaaS != "GitHub") {
+			t.Errorf("unexpected external flow: %+v", f)
+		}
+	}
+
+	// the dmz: proxy and web01 (out of any cluster) for the flow
+	topology, err = storage.Topology(ctx, TopologyOptions{Subnet: "192.168.1.0/24"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make(map[string]int64)
+	for _, m := range topology.Machines {
+		names[m.Name] = m.SubnetID
+	}
+	if len(topology.Subnets) != 1 || len(names) != 2 || names["proxy"] != dmz.ID || names["web01"] != 0 || len(topology.Flows) != 1 {
+		t.Errorf("unexpected dmz topology: %v, %+v", names, topology.Flows)
+	}
+
+	// db01 and its neighbours: web01 (same subnet and flow) and its container
+	topology, err = storage.Topology(ctx, TopologyOptions{Machine: inv.db.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	names = make(map[string]int64)
+	for _, m := range topology.Machines {
+		names[m.Name] = m.SubnetID
+	}
+	if len(names) != 4 || names["db01"] != inv.lan.ID || names["frontend"] != 0 || names["proxy"] != 0 {
+		t.Errorf("unexpected neighbourhood of db01: %v", names)
+	}
+
+	if _, err := storage.Topology(ctx, TopologyOptions{Subnet: "172.16.0.0/12"}); err == nil {
+		t.Error("expected an error for an unknown subnet")
+	}
+}
+
+func TestNeighbourhood(t *testing.T) {
+	// 1 and 2 share a subnet, 2 and 3 another one, 4 talks to 3
+	links := []*TopologyLink{
+		{MachineID: 1, SubnetID: 10},
+		{MachineID: 2, SubnetID: 10},
+		{MachineID: 2, SubnetID: 20},
+		{MachineID: 3, SubnetID: 20},
+	}
+	flows := []*TopologyFlow{{SrcMachineID: 4, DstMachineID: 3}}
+	for depth, expected := range map[int][]int64{1: {1, 2}, 2: {1, 2, 3}, 3: {1, 2, 3, 4}} {
+		seen := neighbourhood(1, depth, nil, links, flows)
+		if len(seen) != len(expected) {
+			t.Errorf("depth %d: expected %v, got %v", depth, expected, seen)
+		}
+		for _, id := range expected {
+			if !seen[id] {
+				t.Errorf("depth %d: expected %d in %v", depth, id, seen)
+			}
+		}
+	}
+}
@@ -0,0 +1,329 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+
+	"github.com/situation-sh/situation/pkg/models"
+	"github.com/uptrace/bun"
+)
+
+// DefaultTopologyDepth is the number of hops (shared subnet or flow)
+// kept around the machine the topology focuses on
+const DefaultTopologyDepth = 1
+
+// TopologyOptions focuses the topology on a subnet or on the
+// neighbourhood of a machine
+type TopologyOptions struct {
+	Subnet  string // CIDR (or ID) of the subnet
+	Machine int64  // ID of the machine
+	// hops around Machine (DefaultTopologyDepth if not positive)
+	Depth int
+}
+
+// Topology is the network drawn by the export command: the machines,
+// the subnets they are connected to (L2) and the flows between them (L4)
+type Topology struct {
+	Subnets  []*TopologySubnet  `json:"subnets"`
+	Machines []*TopologyMachine `json:"machines"`
+	Links    []*TopologyLink    `json:"links"`
+	Flows    []*TopologyFlow    `json:"flows"`
+}
+
+// TopologySubnet is a subnetwork (drawn as a cluster)
+type TopologySubnet struct {
+	ID     int64  `json:"id"`
+	CIDR   string `json:"cidr"`
+	Tag    string `json:"tag,omitempty"`
+	VLANID int    `json:"vlan_id,omitempty"`
+}
+
+// TopologyMachine is a machine. SubnetID is the cluster it is drawn in
+// (0 if none) and containers are nested under their ParentID.
+type TopologyMachine struct {
+	ID       int64  `json:"id"`
+	Name     string `json:"name"`
+	Platform string `json:"platform,omitempty"`
+	ParentID int64  `json:"parent_id,omitempty"`
+	SubnetID int64  `json:"subnet_id,omitempty"`
+}
+
+// TopologyLink is the membership of a machine to a subnet
+type TopologyLink struct {
+	MachineID int64  `json:"machine_id"`
+	SubnetID  int64  `json:"subnet_id"`
+	IP        string `json:"ip,omitempty"`
+}
+
+// TopologyFlow gathers the flows between two machines on the same port.
+// A machine ID is 0 when the end of the flow is not in the inventory
+// (only its address is known).
+type TopologyFlow struct {
+	SrcMachineID int64    `json:"src_machine_id,omitempty"`
+	SrcAddr      string   `json:"src_addr,omitempty"`
+	DstMachineID int64    `json:"dst_machine_id,omitempty"`
+	DstAddr      string   `json:"dst_addr,omitempty"`
+	SaaS         string   `json:"saas,omitempty"`
+	Protocol     string   `json:"protocol"`
+	Port         uint16   `json:"port"`
+	Applications []string `json:"applications,omitempty"`
+}
+
+// Label returns the protocol and the port of the flow (e.g. tcp/22)
+func (f *TopologyFlow) Label() string {
+	return portString(f.Protocol, f.Port)
+}
+
+// Topology builds the network topology of the inventory
+func (s *BunStorage) Topology(ctx context.Context, opts TopologyOptions) (*Topology, error) {
+	subnets := make([]*models.Subnetwork, 0)
+	if err := s.db.NewSelect().Model(&subnets).Order("network_cidr", "id").Scan(ctx); err != nil {
+		return nil, err
+	}
+	machines := make([]*models.Machine, 0)
+	err := s.db.NewSelect().
+		Model(&machines).
+		Column("machine.id", "machine.hostname", "machine.platform", "machine.parent_machine_id").
+		Order("machine.id").
+		Scan(ctx)
+	if err != nil {
+		return nil, err
+	}
+	links := make([]*TopologyLink, 0)
+	err = s.db.NewSelect().
+		TableExpr("network_interface_subnets AS nis").
+		Join("JOIN network_interfaces AS ni ON ni.id = nis.network_interface_id").
+		ColumnExpr("ni.machine_id, nis.subnetwork_id AS subnet_id, nis.ip").
+		Where("ni.machine_id IS NOT NULL").
+		Order("ni.machine_id", "nis.subnetwork_id", "nis.ip").
+		Scan(ctx, &links)
+	if err != nil {
+		return nil, err
+	}
+	flows, err := s.topologyFlows(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &Topology{Subnets: make([]*TopologySubnet, 0), Machines: make([]*TopologyMachine, 0), Links: make([]*TopologyLink, 0), Flows: make([]*TopologyFlow, 0)}
+	byID := make(map[int64]*models.Machine, len(machines))
+	for _, m := range machines {
+		byID[m.ID] = m
+	}
+
+	// machines in focus
+	var focus map[int64]bool
+	var focusSubnet *models.Subnetwork
+	switch {
+	case opts.Subnet != "":
+		for _, sub := range subnets {
+			if sub.NetworkCIDR == opts.Subnet || strconv.FormatInt(sub.ID, 10) == opts.Subnet {
+				focusSubnet = sub
+				break
+			}
+		}
+		if focusSubnet == nil {
+			return nil, fmt.Errorf("no subnet matches %q", opts.Subnet)
+		}
+		focus = make(map[int64]bool)
+		for _, l := range links {
+			if l.SubnetID == focusSubnet.ID {
+				focus[l.MachineID] = true
+			}
+		}
+	case opts.Machine != 0:
+		if _, exists := byID[opts.Machine]; !exists {
+			return nil, fmt.Errorf("no machine with ID %d", opts.Machine)
+		}
+		focus = neighbourhood(opts.Machine, opts.Depth, machines, links, flows)
+	}
+	if focus != nil {
+		// containers follow their host
+		for _, m := range machines {
+			if focus[m.ParentMachineID] {
+				focus[m.ID] = true
+			}
+		}
+	}
+	kept := func(id int64) bool {
+		return focus == nil || focus[id]
+	}
+
+	// flows from or to a machine in focus (the other end is drawn
+	// out of any cluster if it is not in focus)
+	outside := make(map[int64]bool)
+	for _, f := range flows {
+		if f.SrcMachineID != 0 && f.SrcMachineID == f.DstMachineID {
+			continue
+		}
+		if (f.SrcMachineID == 0 || !kept(f.SrcMachineID)) && (f.DstMachineID == 0 || !kept(f.DstMachineID)) {
+			continue
+		}
+		for _, id := range []int64{f.SrcMachineID, f.DstMachineID} {
+			if id != 0 && !kept(id) {
+				outside[id] = true
+			}
+		}
+		t.Flows = append(t.Flows, f)
+	}
+
+	keptSubnets := make(map[int64]bool)
+	for _, sub := range subnets {
+		if focusSubnet != nil && sub.ID != focusSubnet.ID {
+			continue
+		}
+		used := slices.ContainsFunc(links, func(l *TopologyLink) bool {
+			return l.SubnetID == sub.ID && kept(l.MachineID)
+		})
+		if focusSubnet == nil && !used {
+			continue
+		}
+		keptSubnets[sub.ID] = true
+		t.Subnets = append(t.Subnets, &TopologySubnet{ID: sub.ID, CIDR: sub.NetworkCIDR, Tag: sub.Tag, VLANID: sub.VLANID})
+	}
+
+	for _, l := range links {
+		if kept(l.MachineID) && keptSubnets[l.SubnetID] {
+			t.Links = append(t.Links, l)
+		}
+	}
+	for _, m := range machines {
+		if !kept(m.ID) && !outside[m.ID] {
+			continue
+		}
+		tm := &TopologyMachine{ID: m.ID, Name: machineName(m), Platform: m.Platform}
+		if kept(m.ID) {
+			// the first subnet is the cluster of the machine
+			for _, l := range t.Links {
+				if l.MachineID == m.ID {
+					tm.SubnetID = l.SubnetID
+					break
+				}
+			}
+		}
+		if parent, exists := byID[m.ParentMachineID]; exists && (kept(parent.ID) || outside[parent.ID]) {
+			tm.ParentID = parent.ID
+		}
+		t.Machines = append(t.Machines, tm)
+	}
+	return t, nil
+}
+
+// topologyFlows returns the flows gathered by machine and port. The
+// ends of the flows that are bound to nothing are attached to the
+// machine owning their address.
+func (s *BunStorage) topologyFlows(ctx context.Context) ([]*TopologyFlow, error) {
+	owner := "(SELECT ni.machine_id FROM network_interfaces AS ni WHERE " + s.ANY("ni.ip") + " LIMIT 1)"
+	rows := make([]struct {
+		SrcMachineID int64
+		SrcAddr      string
+		Application  string
+		DstMachineID int64
+		DstAddr      string
+		SaaS         string `bun:"saas"`
+		Protocol     string
+		Port         uint16
+	}, 0)
+	err := s.db.NewSelect().
+		TableExpr("flows AS f").
+		Join("JOIN application_endpoints AS e ON e.id = f.dst_endpoint_id").
+		Join("LEFT JOIN applications AS sa ON sa.id = f.src_application_id").
+		Join("LEFT JOIN network_interfaces AS sn ON sn.id = f.src_network_interface_id").
+		Join("LEFT JOIN applications AS da ON da.id = e.application_id").
+		Join("LEFT JOIN network_interfaces AS dn ON dn.id = e.network_interface_id").
+		ColumnExpr("COALESCE(sa.machine_id, sn.machine_id, "+owner+") AS src_machine_id", bun.Ident("f.src_addr")).
+		ColumnExpr("f.src_addr, sa.name AS application").
+		ColumnExpr("COALESCE(da.machine_id, dn.machine_id, "+owner+") AS dst_machine_id", bun.Ident("e.addr")).
+		ColumnExpr("e.addr AS dst_addr, e.saas, e.protocol, e.port").
+		Order("f.id").
+		Scan(ctx, &rows)
+	if err != nil {
+		return nil, err
+	}
+
+	flows := make([]*TopologyFlow, 0)
+	byKey := make(map[string]*TopologyFlow)
+	for _, r := range rows {
+		f := &TopologyFlow{SrcMachineID: r.SrcMachineID, DstMachineID: r.DstMachineID, SaaS: r.SaaS, Protocol: r.Protocol, Port: r.Port}
+		// addresses only matter when the machine is unknown
+		if f.SrcMachineID == 0 {
+			f.SrcAddr = r.SrcAddr
+		}
+		if f.DstMachineID == 0 {
+			f.DstAddr = r.DstAddr
+		}
+		key := fmt.Sprintf("%d|%s|%d|%s|%s", f.SrcMachineID, f.SrcAddr, f.DstMachineID, f.DstAddr, f.Label())
+		if existing, exists := byKey[key]; exists {
+			f = existing
+		} else {
+			byKey[key] = f
+			flows = append(flows, f)
+		}
+		if r.Application != "" && !slices.Contains(f.Applications, r.Application) {
+			f.Applications = append(f.Applications, r.Application)
+		}
+	}
+	return flows, nil
+}
+
+// neighbourhood returns the machines at most depth hops away from the
+// machine, a hop being a shared subnet, a flow (in any direction) or
+// a parent/child relationship
+func neighbourhood(start int64, depth int, machines []*models.Machine, links []*TopologyLink, flows []*TopologyFlow) map[int64]bool {
+	if depth <= 0 {
+		depth = DefaultTopologyDepth
+	}
+	adjacency := make(map[int64][]int64)
+	connect := func(a, b int64) {
+		if a != 0 && b != 0 && a != b {
+			adjacency[a] = append(adjacency[a], b)
+			adjacency[b] = append(adjacency[b], a)
+		}
+	}
+	for _, f := range flows {
+		connect(f.SrcMachineID, f.DstMachineID)
+	}
+	for _, m := range machines {
+		connect(m.ID, m.ParentMachineID)
+	}
+	// the subnets are intermediate nodes (machine -> subnet -> machine
+	// is a single hop) so that memory stays linear in the links
+	members := make(map[int64][]int64)
+	subnets := make(map[int64][]int64)
+	for _, l := range links {
+		members[l.SubnetID] = append(members[l.SubnetID], l.MachineID)
+		subnets[l.MachineID] = append(subnets[l.MachineID], l.SubnetID)
+	}
+
+	seen := map[int64]bool{start: true}
+	expanded := make(map[int64]bool)
+	frontier := []int64{start}
+	for hop := 0; hop < depth && len(frontier) > 0; hop++ {
+		next := make([]int64, 0)
+		visit := func(n int64) {
+			if n != 0 && !seen[n] {
+				seen[n] = true
+				next = append(next, n)
+			}
+		}
+		for _, id := range frontier {
+			for _, n := range adjacency[id] {
+				visit(n)
+			}
+			for _, subnet := range subnets[id] {
+				// the members of a subnet are all reached at once
+				if expanded[subnet] {
+					continue
+				}
+				expanded[subnet] = true
+				for _, n := range members[subnet] {
+					visit(n)
+				}
+			}
+		}
+		frontier = next
+	}
+	return seen
+}
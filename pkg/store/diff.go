@@ -0,0 +1,361 @@
+package store
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/situation-sh/situation/pkg/models"
+)
+
+// DiffPoint is one side of a diff: a run of the history
+// or the current state of the inventory (RunID is 0)
+type DiffPoint struct {
+	RunID int64     `json:"run_id,omitempty"`
+	Time  time.Time `json:"time"`
+}
+
+func (p DiffPoint) String() string {
+	t := p.Time.Local().Format(time.DateTime)
+	if p.RunID == 0 {
+		return fmt.Sprintf("now (%s)", t)
+	}
+	return fmt.Sprintf("run #%d (%s)", p.RunID, t)
+}
+
+// DiffMachine identifies a machine in a diff
+type DiffMachine struct {
+	ID    int64  `json:"id"`
+	Label string `json:"label"`
+}
+
+// IPChange lists the addresses added to or removed from
+// a network interface (identified by its MAC or its name)
+type IPChange struct {
+	Machine DiffMachine `json:"machine"`
+	NIC     string      `json:"nic"`
+	Added   []string    `json:"added,omitempty"`
+	Removed []string    `json:"removed,omitempty"`
+}
+
+// PortChange is a port opened or closed on a machine
+type PortChange struct {
+	Machine DiffMachine `json:"machine"`
+	Port    string      `json:"port"`
+}
+
+// PackageChange is a package upgraded (or downgraded), installed
+// (From is empty) or removed (To is empty)
+type PackageChange struct {
+	Machine DiffMachine `json:"machine"`
+	Name    string      `json:"name"`
+	From    string      `json:"from,omitempty"`
+	To      string      `json:"to,omitempty"`
+}
+
+// FlowChange is a flow from a machine (or an address) to an endpoint
+type FlowChange struct {
+	Src         string `json:"src"`
+	Application string `json:"application,omitempty"`
+	Dst         string `json:"dst"`
+	Endpoint    string `json:"endpoint"`
+}
+
+// Diff gathers what has changed in the inventory between two points.
+// Addresses, ports and packages are only compared on the machines
+// present at both points.
+type Diff struct {
+	From DiffPoint `json:"from"`
+	To   DiffPoint `json:"to"`
+
+	NewMachines      []DiffMachine    `json:"new_machines"`
+	VanishedMachines []DiffMachine    `json:"vanished_machines"`
+	ChangedIPs       []*IPChange      `json:"changed_ips"`
+	OpenedPorts      []*PortChange    `json:"opened_ports"`
+	ClosedPorts      []*PortChange    `json:"closed_ports"`
+	ChangedPackages  []*PackageChange `json:"changed_packages"`
+	NewFlows         []*FlowChange    `json:"new_flows"`
+}
+
+// snapshotLabel returns the hostname of the machine,
+// its first address or its ID
+func snapshotLabel(m *models.SnapshotMachine) string {
+	if m.Hostname != "" {
+		return m.Hostname
+	}
+	for _, nic := range m.NICS {
+		if len(nic.IP) > 0 {
+			return nic.IP[0]
+		}
+	}
+	return fmt.Sprintf("#%d", m.ID)
+}
+
+func snapshotMachines(s *models.Snapshot) map[int64]*models.SnapshotMachine {
+	machines := make(map[int64]*models.SnapshotMachine)
+	if s == nil {
+		return machines
+	}
+	for _, m := range s.Machines {
+		machines[m.ID] = m
+	}
+	return machines
+}
+
+// nicKey identifies a network interface across snapshots
+func nicKey(nic *models.SnapshotNIC) string {
+	if nic.MAC != "" {
+		return nic.MAC
+	}
+	return nic.Name
+}
+
+// added returns the items of b that are not in a
+func added(a []string, b []string) []string {
+	out := make([]string, 0)
+	for _, x := range b {
+		if !slices.Contains(a, x) {
+			out = append(out, x)
+		}
+	}
+	return out
+}
+
+// flowKey identifies a flow across snapshots: known machines
+// are identified by their ID (their address may change)
+func flowKey(f *models.SnapshotFlow) string {
+	src := f.SrcAddr
+	if f.SrcMachineID != 0 {
+		src = fmt.Sprintf("#%d", f.SrcMachineID)
+	}
+	dst := f.DstAddr
+	if f.DstMachineID != 0 {
+		dst = fmt.Sprintf("#%d", f.DstMachineID)
+	}
+	return strings.Join([]string{src, f.Application, dst, portString(f.Protocol, f.Port)}, "|")
+}
+
+// DiffSnapshots compares two snapshots of the inventory
+func DiffSnapshots(from *models.Snapshot, to *models.Snapshot) *Diff {
+	before := snapshotMachines(from)
+	after := snapshotMachines(to)
+	diff := &Diff{
+		NewMachines:      make([]DiffMachine, 0),
+		VanishedMachines: make([]DiffMachine, 0),
+		ChangedIPs:       make([]*IPChange, 0),
+		OpenedPorts:      make([]*PortChange, 0),
+		ClosedPorts:      make([]*PortChange, 0),
+		ChangedPackages:  make([]*PackageChange, 0),
+		NewFlows:         make([]*FlowChange, 0),
+	}
+
+	for id, m := range before {
+		if _, exists := after[id]; !exists {
+			diff.VanishedMachines = append(diff.VanishedMachines, DiffMachine{ID: id, Label: snapshotLabel(m)})
+		}
+	}
+
+	for id, m := range after {
+		machine := DiffMachine{ID: id, Label: snapshotLabel(m)}
+		old, exists := before[id]
+		if !exists {
+			diff.NewMachines = append(diff.NewMachines, machine)
+			continue
+		}
+
+		oldIPs := make(map[string][]string)
+		for _, nic := range old.NICS {
+			oldIPs[nicKey(nic)] = nic.IP
+		}
+		for _, nic := range m.NICS {
+			key := nicKey(nic)
+			if key == "" {
+				continue
+			}
+			ip := oldIPs[key]
+			change := &IPChange{Machine: machine, NIC: key, Added: added(ip, nic.IP), Removed: added(nic.IP, ip)}
+			if len(change.Added) > 0 || len(change.Removed) > 0 {
+				diff.ChangedIPs = append(diff.ChangedIPs, change)
+			}
+		}
+
+		for _, port := range added(old.Ports, m.Ports) {
+			diff.OpenedPorts = append(diff.OpenedPorts, &PortChange{Machine: machine, Port: port})
+		}
+		for _, port := range added(m.Ports, old.Ports) {
+			diff.ClosedPorts = append(diff.ClosedPorts, &PortChange{Machine: machine, Port: port})
+		}
+
+		for name, version := range m.Packages {
+			if previous := old.Packages[name]; previous != version {
+				diff.ChangedPackages = append(diff.ChangedPackages,
+					&PackageChange{Machine: machine, Name: name, From: previous, To: version})
+			}
+		}
+		for name, version := range old.Packages {
+			if _, exists := m.Packages[name]; !exists {
+				diff.ChangedPackages = append(diff.ChangedPackages,
+					&PackageChange{Machine: machine, Name: name, From: version})
+			}
+		}
+	}
+
+	if to != nil {
+		known := make(map[string]bool)
+		if from != nil {
+			for _, f := range from.Flows {
+				known[flowKey(f)] = true
+			}
+		}
+		label := func(id int64, addr string) string {
+			if m, exists := after[id]; exists {
+				return snapshotLabel(m)
+			}
+			return addr
+		}
+		for _, f := range to.Flows {
+			key := flowKey(f)
+			if known[key] {
+				continue
+			}
+			// the same flow may appear with several source addresses
+			known[key] = true
+			app := ""
+			if f.Application != "" {
+				app = path.Base(f.Application)
+			}
+			diff.NewFlows = append(diff.NewFlows, &FlowChange{
+				Src:         label(f.SrcMachineID, f.SrcAddr),
+				Application: app,
+				Dst:         label(f.DstMachineID, f.DstAddr),
+				Endpoint:    portString(f.Protocol, f.Port),
+			})
+		}
+	}
+
+	diff.sort()
+	return diff
+}
+
+func compareMachines(a DiffMachine, b DiffMachine) int {
+	return cmp.Or(cmp.Compare(a.Label, b.Label), cmp.Compare(a.ID, b.ID))
+}
+
+// sort orders the changes by machine
+func (d *Diff) sort() {
+	slices.SortFunc(d.NewMachines, compareMachines)
+	slices.SortFunc(d.VanishedMachines, compareMachines)
+	slices.SortFunc(d.ChangedIPs, func(a, b *IPChange) int {
+		return cmp.Or(compareMachines(a.Machine, b.Machine), cmp.Compare(a.NIC, b.NIC))
+	})
+	comparePorts := func(a, b *PortChange) int {
+		return cmp.Or(compareMachines(a.Machine, b.Machine), cmp.Compare(a.Port, b.Port))
+	}
+	slices.SortFunc(d.OpenedPorts, comparePorts)
+	slices.SortFunc(d.ClosedPorts, comparePorts)
+	slices.SortFunc(d.ChangedPackages, func(a, b *PackageChange) int {
+		return cmp.Or(compareMachines(a.Machine, b.Machine), cmp.Compare(a.Name, b.Name))
+	})
+	slices.SortFunc(d.NewFlows, func(a, b *FlowChange) int {
+		return cmp.Or(cmp.Compare(a.Src, b.Src), cmp.Compare(a.Dst, b.Dst), cmp.Compare(a.Endpoint, b.Endpoint))
+	})
+}
+
+// Empty returns whether nothing has changed
+func (d *Diff) Empty() bool {
+	return len(d.NewMachines) == 0 &&
+		len(d.VanishedMachines) == 0 &&
+		len(d.ChangedIPs) == 0 &&
+		len(d.OpenedPorts) == 0 &&
+		len(d.ClosedPorts) == 0 &&
+		len(d.ChangedPackages) == 0 &&
+		len(d.NewFlows) == 0
+}
+
+// WriteText writes a human readable version of the diff
+// (+ added, - removed, ~ changed)
+func (d *Diff) WriteText(w io.Writer) error {
+	lines := []string{fmt.Sprintf("Changes from %s to %s", d.From, d.To)}
+	section := func(title string, items []string) {
+		if len(items) == 0 {
+			return
+		}
+		lines = append(lines, "", fmt.Sprintf("%s (%d)", title, len(items)))
+		for _, item := range items {
+			lines = append(lines, "  "+item)
+		}
+	}
+	machine := func(m DiffMachine) string {
+		return fmt.Sprintf("%s (#%d)", m.Label, m.ID)
+	}
+
+	items := make([]string, 0)
+	for _, m := range d.NewMachines {
+		items = append(items, "+ "+machine(m))
+	}
+	section("New machines", items)
+
+	items = make([]string, 0)
+	for _, m := range d.VanishedMachines {
+		items = append(items, "- "+machine(m))
+	}
+	section("Vanished machines", items)
+
+	items = make([]string, 0)
+	for _, c := range d.ChangedIPs {
+		changes := make([]string, 0, len(c.Added)+len(c.Removed))
+		for _, ip := range c.Added {
+			changes = append(changes, "+"+ip)
+		}
+		for _, ip := range c.Removed {
+			changes = append(changes, "-"+ip)
+		}
+		items = append(items, fmt.Sprintf("~ %s %s: %s", machine(c.Machine), c.NIC, strings.Join(changes, " ")))
+	}
+	section("Changed addresses", items)
+
+	items = make([]string, 0)
+	for _, c := range d.OpenedPorts {
+		items = append(items, fmt.Sprintf("+ %s %s", machine(c.Machine), c.Port))
+	}
+	section("Opened ports", items)
+
+	items = make([]string, 0)
+	for _, c := range d.ClosedPorts {
+		items = append(items, fmt.Sprintf("- %s %s", machine(c.Machine), c.Port))
+	}
+	section("Closed ports", items)
+
+	items = make([]string, 0)
+	for _, c := range d.ChangedPackages {
+		switch {
+		case c.From == "":
+			items = append(items, fmt.Sprintf("+ %s %s %s", machine(c.Machine), c.Name, c.To))
+		case c.To == "":
+			items = append(items, fmt.Sprintf("- %s %s %s", machine(c.Machine), c.Name, c.From))
+		default:
+			items = append(items, fmt.Sprintf("~ %s %s %s → %s", machine(c.Machine), c.Name, c.From, c.To))
+		}
+	}
+	section("Changed packages", items)
+
+	items = make([]string, 0)
+	for _, f := range d.NewFlows {
+		src := f.Src
+		if f.Application != "" {
+			src += " " + f.Application
+		}
+		items = append(items, fmt.Sprintf("+ %s → %s %s", src, f.Dst, f.Endpoint))
+	}
+	section("New flows", items)
+
+	if d.Empty() {
+		lines = append(lines, "", "No changes")
+	}
+	_, err := io.WriteString(w, strings.Join(lines, "\n")+"\n")
+	return err
+}
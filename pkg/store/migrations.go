@@ -33,6 +33,10 @@ var TrackedModels = []any{
 	(*models.UserApplication)(nil),
 	(*models.Flow)(nil),
 	(*models.EndpointPolicy)(nil),
+	(*models.Agent)(nil),
+	(*models.AgentConfig)(nil),
+	(*models.Run)(nil),
+	(*models.SweepCursor)(nil),
 }
 
 // GenerateSchema returns SQL CREATE TABLE statements for all tracked models
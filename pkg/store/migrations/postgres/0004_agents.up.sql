@@ -0,0 +1 @@
+CREATE TABLE IF NOT EXISTS "agents" ("id" BIGSERIAL NOT NULL, "created_at" TIMESTAMPTZ NOT NULL DEFAULT current_timestamp, "updated_at" TIMESTAMPTZ NOT NULL DEFAULT current_timestamp, "agent" VARCHAR NOT NULL, "version" VARCHAR, "commit" VARCHAR, "platform" VARCHAR, "arch" VARCHAR, "last_seen" TIMESTAMPTZ, "last_run_start" TIMESTAMPTZ, "last_run_duration" BIGINT, "last_status" VARCHAR, "last_error" VARCHAR, "module_errors" json, "machine_id" BIGINT, PRIMARY KEY ("id"), UNIQUE ("agent"), FOREIGN KEY ("machine_id") REFERENCES "machines" ("id") ON UPDATE NO ACTION ON DELETE SET NULL);
@@ -0,0 +1,2 @@
+ALTER TABLE "machines" ADD COLUMN IF NOT EXISTS "tag" VARCHAR;
+CREATE TABLE IF NOT EXISTS "agent_configs" ("id" BIGSERIAL NOT NULL, "created_at" TIMESTAMPTZ NOT NULL DEFAULT current_timestamp, "updated_at" TIMESTAMPTZ NOT NULL DEFAULT current_timestamp, "name" VARCHAR, "target_type" VARCHAR NOT NULL, "target" VARCHAR, "priority" BIGINT NOT NULL DEFAULT 0, "disabled" BOOLEAN NOT NULL DEFAULT false, "config" json, PRIMARY KEY ("id"));
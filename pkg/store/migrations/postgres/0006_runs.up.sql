@@ -0,0 +1,2 @@
+CREATE TABLE IF NOT EXISTS "runs" ("id" BIGSERIAL NOT NULL, "created_at" TIMESTAMPTZ NOT NULL DEFAULT current_timestamp, "updated_at" TIMESTAMPTZ NOT NULL DEFAULT current_timestamp, "agent" VARCHAR NOT NULL, "started_at" TIMESTAMPTZ, "finished_at" TIMESTAMPTZ NOT NULL, "status" VARCHAR, "snapshot" json, PRIMARY KEY ("id"));
+CREATE INDEX IF NOT EXISTS "run_finished_at" ON "runs" ("finished_at");
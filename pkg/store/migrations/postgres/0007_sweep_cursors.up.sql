@@ -0,0 +1 @@
+CREATE TABLE IF NOT EXISTS "sweep_cursors" ("id" BIGSERIAL NOT NULL, "created_at" TIMESTAMPTZ NOT NULL DEFAULT current_timestamp, "updated_at" TIMESTAMPTZ NOT NULL DEFAULT current_timestamp, "agent" VARCHAR NOT NULL, "position" BIGINT, "passes" BIGINT, "subnetwork_id" BIGINT NOT NULL, PRIMARY KEY ("id"), CONSTRAINT "agent_subnetwork" UNIQUE ("agent", "subnetwork_id"), FOREIGN KEY ("subnetwork_id") REFERENCES "subnetworks" ("id") ON UPDATE NO ACTION ON DELETE CASCADE);
@@ -0,0 +1,4 @@
+ALTER TABLE "machines" DROP COLUMN IF EXISTS "manufacturer";
+ALTER TABLE "machines" DROP COLUMN IF EXISTS "model";
+ALTER TABLE "machines" DROP COLUMN IF EXISTS "serial_number";
+ALTER TABLE "machines" DROP COLUMN IF EXISTS "device_type";
@@ -0,0 +1,4 @@
+ALTER TABLE "machines" ADD COLUMN IF NOT EXISTS "manufacturer" VARCHAR;
+ALTER TABLE "machines" ADD COLUMN IF NOT EXISTS "model" VARCHAR;
+ALTER TABLE "machines" ADD COLUMN IF NOT EXISTS "serial_number" VARCHAR;
+ALTER TABLE "machines" ADD COLUMN IF NOT EXISTS "device_type" VARCHAR;
@@ -0,0 +1 @@
+CREATE TABLE IF NOT EXISTS "agents" ("id" INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT, "created_at" TIMESTAMP NOT NULL DEFAULT current_timestamp, "updated_at" TIMESTAMP NOT NULL DEFAULT current_timestamp, "agent" VARCHAR NOT NULL, "version" VARCHAR, "commit" VARCHAR, "platform" VARCHAR, "arch" VARCHAR, "last_seen" TIMESTAMP, "last_run_start" TIMESTAMP, "last_run_duration" INTEGER, "last_status" VARCHAR, "last_error" VARCHAR, "module_errors" json, "machine_id" INTEGER, UNIQUE ("agent"), FOREIGN KEY ("machine_id") REFERENCES "machines" ("id") ON UPDATE NO ACTION ON DELETE SET NULL);
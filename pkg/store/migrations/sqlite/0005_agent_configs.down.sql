@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS "agent_configs";
+ALTER TABLE "machines" DROP COLUMN "tag";
@@ -0,0 +1,2 @@
+ALTER TABLE "machines" ADD COLUMN "tag" VARCHAR;
+CREATE TABLE IF NOT EXISTS "agent_configs" ("id" INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT, "created_at" TIMESTAMP NOT NULL DEFAULT current_timestamp, "updated_at" TIMESTAMP NOT NULL DEFAULT current_timestamp, "name" VARCHAR, "target_type" VARCHAR NOT NULL, "target" VARCHAR, "priority" INTEGER NOT NULL DEFAULT 0, "disabled" BOOLEAN NOT NULL DEFAULT false, "config" json);
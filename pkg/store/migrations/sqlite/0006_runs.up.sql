@@ -0,0 +1,2 @@
+CREATE TABLE IF NOT EXISTS "runs" ("id" INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT, "created_at" TIMESTAMP NOT NULL DEFAULT current_timestamp, "updated_at" TIMESTAMP NOT NULL DEFAULT current_timestamp, "agent" VARCHAR NOT NULL, "started_at" TIMESTAMP, "finished_at" TIMESTAMP NOT NULL, "status" VARCHAR, "snapshot" json);
+CREATE INDEX IF NOT EXISTS "run_finished_at" ON "runs" ("finished_at");
@@ -0,0 +1 @@
+CREATE TABLE IF NOT EXISTS "sweep_cursors" ("id" INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT, "created_at" TIMESTAMP NOT NULL DEFAULT current_timestamp, "updated_at" TIMESTAMP NOT NULL DEFAULT current_timestamp, "agent" VARCHAR NOT NULL, "position" INTEGER, "passes" INTEGER, "subnetwork_id" INTEGER NOT NULL, CONSTRAINT "agent_subnetwork" UNIQUE ("agent", "subnetwork_id"), FOREIGN KEY ("subnetwork_id") REFERENCES "subnetworks" ("id") ON UPDATE NO ACTION ON DELETE CASCADE);
@@ -0,0 +1,4 @@
+ALTER TABLE "machines" DROP COLUMN "manufacturer";
+ALTER TABLE "machines" DROP COLUMN "model";
+ALTER TABLE "machines" DROP COLUMN "serial_number";
+ALTER TABLE "machines" DROP COLUMN "device_type";
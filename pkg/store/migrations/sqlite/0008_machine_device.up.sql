@@ -0,0 +1,4 @@
+ALTER TABLE "machines" ADD COLUMN "manufacturer" VARCHAR;
+ALTER TABLE "machines" ADD COLUMN "model" VARCHAR;
+ALTER TABLE "machines" ADD COLUMN "serial_number" VARCHAR;
+ALTER TABLE "machines" ADD COLUMN "device_type" VARCHAR;
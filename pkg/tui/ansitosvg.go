@@ -2,6 +2,7 @@ package tui
 
 import (
 	"fmt"
+	"html"
 	"strings"
 
 	ansi "github.com/leaanthony/go-ansi-parser"
@@ -35,7 +36,9 @@ func buildAttrs(obj *ansi.StyledText) string {
 	return " " + strings.Join(attrs, " ")
 }
 
-func ansi2svg(raw string) (string, error) {
+// ANSIToSVG converts a text rendered with ANSI escape
+// codes (like a view of the explorer) to an SVG image
+func ANSIToSVG(raw string) (string, error) {
 	fontSize := SVG_FONT_SIZE
 	lineHeight := fontSize * SVG_LINE_HEIGHT_RATIO
 
@@ -61,7 +64,7 @@ func ansi2svg(raw string) (string, error) {
 
 		if strings.Contains(obj.Label, "\n") {
 			lines := strings.Split(obj.Label, "\n")
-			buffer.WriteString(lines[0])
+			buffer.WriteString(html.EscapeString(lines[0]))
 			curCols += len(lines[0])
 			content := buffer.String()
 			chunks = append(chunks, fmt.Sprintf(`<text x="%d" y="%.2f"%s>%s</text>`, 0, y, attrs, content))
@@ -75,19 +78,19 @@ func ansi2svg(raw string) (string, error) {
 				if line == "" {
 					continue
 				}
-				chunks = append(chunks, fmt.Sprintf(`<text x="%d" y="%.2f"%s>%s</text>`, 0, y+lineHeight, attrs, line))
+				chunks = append(chunks, fmt.Sprintf(`<text x="%d" y="%.2f"%s>%s</text>`, 0, y+lineHeight, attrs, html.EscapeString(line)))
 				if len(line) > maxCols {
 					maxCols = len(line)
 				}
 				y += lineHeight
 			}
 
-			buffer.WriteString(lines[len(lines)-1])
+			buffer.WriteString(html.EscapeString(lines[len(lines)-1]))
 			curCols = len(lines[len(lines)-1])
 			y += lineHeight
 
 		} else {
-			tspan := fmt.Sprintf(`<tspan%s>%s</tspan>`, attrs, obj.Label)
+			tspan := fmt.Sprintf(`<tspan%s>%s</tspan>`, attrs, html.EscapeString(obj.Label))
 			buffer.WriteString(tspan)
 			curCols += len(obj.Label)
 		}
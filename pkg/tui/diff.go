@@ -0,0 +1,128 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	"charm.land/bubbles/v2/viewport"
+	tea "charm.land/bubbletea/v2"
+	"charm.land/lipgloss/v2"
+	"github.com/situation-sh/situation/pkg/models"
+	"github.com/situation-sh/situation/pkg/store"
+)
+
+var addedStyle = lipgloss.NewStyle().Foreground(AccentColor)
+
+var removedStyle = lipgloss.NewStyle().Foreground(ErrorBgColor)
+
+// newDiffMsg carries the changes between a run of
+// the history and the current state
+type newDiffMsg struct {
+	runs []*models.Run
+	// index of the run the diff starts from
+	base int
+	diff *store.Diff
+}
+
+// diffBaseMsg asks to compare the current state with another run
+type diffBaseMsg struct {
+	base int
+}
+
+// closeDiffMsg asks to go back to the subnet view
+type closeDiffMsg struct{}
+
+// DiffModel shows what has changed since a run of the history
+type DiffModel struct {
+	SizedModel
+
+	runs     []*models.Run
+	base     int
+	diff     *store.Diff
+	viewport viewport.Model
+}
+
+func NewDiffModel() *DiffModel {
+	return &DiffModel{viewport: viewport.New()}
+}
+
+func (m *DiffModel) SetSize(width, height int) {
+	m.SizedModel.SetSize(width, height)
+	// remove borders and padding
+	m.viewport.SetWidth(width - 4)
+	m.viewport.SetHeight(height - 2)
+}
+
+func (m *DiffModel) SetDiff(runs []*models.Run, base int, diff *store.Diff) {
+	m.runs = runs
+	m.base = base
+	m.diff = diff
+	m.viewport.SetContent(m.render())
+	m.viewport.GotoTop()
+}
+
+func (m *DiffModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m *DiffModel) Update(msg tea.Msg) (*DiffModel, tea.Cmd) {
+	var cmd tea.Cmd
+	if key, ok := msg.(tea.KeyMsg); ok {
+		switch key.String() {
+		case "left", "h":
+			// runs are sorted from the most recent
+			if m.base < len(m.runs)-1 {
+				return m, func() tea.Msg { return diffBaseMsg{base: m.base + 1} }
+			}
+			return m, nil
+		case "right", "l":
+			if m.base > 0 {
+				return m, func() tea.Msg { return diffBaseMsg{base: m.base - 1} }
+			}
+			return m, nil
+		case "esc", "d":
+			return m, func() tea.Msg { return closeDiffMsg{} }
+		}
+	}
+	m.viewport, cmd = m.viewport.Update(msg)
+	return m, cmd
+}
+
+// render colours the text output of the diff
+func (m *DiffModel) render() string {
+	if m.diff == nil {
+		return ""
+	}
+	var text strings.Builder
+	if err := m.diff.WriteText(&text); err != nil {
+		return err.Error()
+	}
+	lines := strings.Split(strings.TrimRight(text.String(), "\n"), "\n")
+	for i, line := range lines {
+		switch {
+		case i == 0:
+			lines[i] = faintStyle.Render(line)
+		case strings.HasPrefix(line, "  +"):
+			lines[i] = addedStyle.Render(line)
+		case strings.HasPrefix(line, "  -"):
+			lines[i] = removedStyle.Render(line)
+		case strings.HasPrefix(line, "  "):
+			// changed
+		case line != "":
+			lines[i] = sectionStyle.MarginTop(0).Render(line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (m *DiffModel) View() string {
+	title := "Changes"
+	if m.diff != nil {
+		title = fmt.Sprintf("Changes since run #%d (%d/%d)", m.diff.From.RunID, m.base+1, len(m.runs))
+	}
+	return machineBaseStyle.
+		BorderStyle(TitleBorder(lipgloss.NormalBorder(), title)).
+		Width(m.width).
+		Height(m.height).
+		Render(m.viewport.View())
+}
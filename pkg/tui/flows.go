@@ -0,0 +1,353 @@
+package tui
+
+import (
+	"cmp"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	tea "charm.land/bubbletea/v2"
+	"charm.land/lipgloss/v2"
+	"github.com/situation-sh/situation/pkg/models"
+)
+
+// groups of the nodes that are not attached to a known subnet
+const (
+	otherGroup    = "Other"
+	externalGroup = "External"
+)
+
+var flowNodeStyle = lipgloss.NewStyle().
+	BorderStyle(lipgloss.RoundedBorder()).
+	BorderForeground(AccentColor).
+	Padding(0, 1).
+	Align(lipgloss.Center)
+
+var groupStyle = lipgloss.NewStyle().Faint(true).Bold(true)
+
+var nodesStyle = sidebarStyle.
+	BorderStyle(TitleBorder(lipgloss.NormalBorder(), "Nodes"))
+
+// newFlowsMsg carries the data of the flow view
+type newFlowsMsg struct {
+	flows    []*models.Flow
+	machines []*models.Machine
+	// machine to focus on
+	focus int64
+}
+
+// closeFlowsMsg asks to go back to the subnet view
+type closeFlowsMsg struct{}
+
+// flowNode is a machine, or a remote address when the
+// destination (or the source) is not a known machine
+type flowNode struct {
+	key       string
+	label     string
+	group     string
+	machineID int64
+	// incoming and outgoing edges
+	upstream   []*flowEdge
+	downstream []*flowEdge
+}
+
+// flowEdge gathers the flows of an application towards an endpoint
+type flowEdge struct {
+	from     *flowNode
+	to       *flowNode
+	app      string
+	endpoint string
+	count    int
+}
+
+// flowGraph is the graph of the flows between the nodes
+type flowGraph struct {
+	// nodes sorted by group then by label
+	nodes []*flowNode
+}
+
+func machineLabel(m *models.Machine) string {
+	if m.Hostname != "" {
+		return m.Hostname
+	}
+	for _, nic := range m.NICS {
+		if len(nic.IP) > 0 {
+			return nic.IP[0]
+		}
+	}
+	return fmt.Sprintf("#%d", m.ID)
+}
+
+// machineGroup returns the (smallest) subnet the machine is connected to
+func machineGroup(m *models.Machine) string {
+	subnets := make([]string, 0)
+	for _, nic := range m.NICS {
+		for _, s := range nic.Subnetworks {
+			subnets = append(subnets, s.NetworkCIDR)
+		}
+	}
+	if len(subnets) == 0 {
+		return otherGroup
+	}
+	slices.Sort(subnets)
+	return subnets[0]
+}
+
+// flowSource returns the machine that emits the flow (0 if unknown)
+func flowSource(f *models.Flow) int64 {
+	if f.SrcApplication != nil && f.SrcApplication.MachineID != 0 {
+		return f.SrcApplication.MachineID
+	}
+	if f.SrcNetworkInterface != nil {
+		return f.SrcNetworkInterface.MachineID
+	}
+	return 0
+}
+
+// flowDestination returns the machine that owns the
+// destination endpoint (0 if unknown)
+func flowDestination(f *models.Flow) int64 {
+	if f.DstEndpoint == nil {
+		return 0
+	}
+	if f.DstEndpoint.Application != nil && f.DstEndpoint.Application.MachineID != 0 {
+		return f.DstEndpoint.Application.MachineID
+	}
+	if f.DstEndpoint.NetworkInterface != nil {
+		return f.DstEndpoint.NetworkInterface.MachineID
+	}
+	return 0
+}
+
+func newFlowGraph(flows []*models.Flow, machines []*models.Machine) *flowGraph {
+	byID := make(map[int64]*models.Machine, len(machines))
+	for _, m := range machines {
+		byID[m.ID] = m
+	}
+	nodes := make(map[string]*flowNode)
+	edges := make(map[string]*flowEdge)
+
+	node := func(machineID int64, addr string, saas string) *flowNode {
+		key := fmt.Sprintf("m%d", machineID)
+		if machineID == 0 {
+			key = "a" + addr
+		}
+		if n, exists := nodes[key]; exists {
+			return n
+		}
+		n := &flowNode{key: key, machineID: machineID, label: addr, group: externalGroup}
+		if m, exists := byID[machineID]; exists {
+			n.label = machineLabel(m)
+			n.group = machineGroup(m)
+		} else if saas != "" {
+			n.label = fmt.Sprintf("%s (%s)", addr, saas)
+		}
+		nodes[key] = n
+		return n
+	}
+
+	for _, f := range flows {
+		if f.DstEndpoint == nil {
+			continue
+		}
+		from := node(flowSource(f), f.SrcAddr, "")
+		to := node(flowDestination(f), f.DstEndpoint.Addr, f.DstEndpoint.SaaS)
+
+		app := ""
+		if f.SrcApplication != nil {
+			app = path.Base(f.SrcApplication.Name)
+		}
+		endpoint := fmt.Sprintf("%s/%d", f.DstEndpoint.Protocol, f.DstEndpoint.Port)
+		if len(f.DstEndpoint.ApplicationProtocols) > 0 {
+			endpoint += " " + f.DstEndpoint.ApplicationProtocols[0]
+		}
+
+		key := strings.Join([]string{from.key, to.key, app, endpoint}, "|")
+		if e, exists := edges[key]; exists {
+			e.count++
+			continue
+		}
+		e := &flowEdge{from: from, to: to, app: app, endpoint: endpoint, count: 1}
+		edges[key] = e
+		from.downstream = append(from.downstream, e)
+		to.upstream = append(to.upstream, e)
+	}
+
+	g := &flowGraph{nodes: make([]*flowNode, 0, len(nodes))}
+	for _, n := range nodes {
+		g.nodes = append(g.nodes, n)
+	}
+	slices.SortFunc(g.nodes, func(a, b *flowNode) int {
+		return cmp.Or(
+			cmp.Compare(groupRank(a.group), groupRank(b.group)),
+			cmp.Compare(a.group, b.group),
+			cmp.Compare(a.label, b.label),
+		)
+	})
+	return g
+}
+
+// groupRank puts the subnets first and the external nodes last
+func groupRank(group string) int {
+	switch group {
+	case otherGroup:
+		return 1
+	case externalGroup:
+		return 2
+	default:
+		return 0
+	}
+}
+
+// FlowModel renders the flows as a graph: the nodes grouped by subnet
+// on the left and the upstream and downstream dependencies of the
+// selected node on the right
+type FlowModel struct {
+	SizedModel
+
+	graph  *flowGraph
+	cursor int
+}
+
+func NewFlowModel() *FlowModel {
+	return &FlowModel{graph: &flowGraph{}}
+}
+
+func (m *FlowModel) SetFlows(flows []*models.Flow, machines []*models.Machine, focus int64) {
+	m.graph = newFlowGraph(flows, machines)
+	m.cursor = 0
+	for i, n := range m.graph.nodes {
+		if focus != 0 && n.machineID == focus {
+			m.cursor = i
+			break
+		}
+	}
+}
+
+// Selected returns the node the view focuses on
+func (m *FlowModel) Selected() *flowNode {
+	if m.cursor < len(m.graph.nodes) {
+		return m.graph.nodes[m.cursor]
+	}
+	return nil
+}
+
+func (m *FlowModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m *FlowModel) Update(msg tea.Msg) (*FlowModel, tea.Cmd) {
+	key, ok := msg.(tea.KeyMsg)
+	if !ok {
+		return m, nil
+	}
+	switch key.String() {
+	case "up", "k":
+		m.cursor = max(m.cursor-1, 0)
+	case "down", "j":
+		m.cursor = min(m.cursor+1, max(len(m.graph.nodes)-1, 0))
+	case "home", "g":
+		m.cursor = 0
+	case "end", "G":
+		m.cursor = max(len(m.graph.nodes)-1, 0)
+	case "enter":
+		if n := m.Selected(); n != nil && n.machineID != 0 {
+			return m, func() tea.Msg { return openMachineMsg{id: n.machineID} }
+		}
+	case "esc", "f":
+		return m, func() tea.Msg { return closeFlowsMsg{} }
+	}
+	return m, nil
+}
+
+// listView renders the nodes grouped by subnet. Only the lines
+// around the cursor are kept.
+func (m *FlowModel) listView(width, height int) string {
+	lines := make([]string, 0)
+	cursorLine := 0
+	group := ""
+	for i, n := range m.graph.nodes {
+		if n.group != group {
+			group = n.group
+			lines = append(lines, groupStyle.Render(group))
+		}
+		line := fmt.Sprintf("%s ↑%d ↓%d", truncate(n.label, max(width-10, 1)), len(n.upstream), len(n.downstream))
+		if i == m.cursor {
+			cursorLine = len(lines)
+			line = selectedItemStyle.AlignHorizontal(lipgloss.Left).Width(width).Render(line)
+		}
+		lines = append(lines, line)
+	}
+	start := max(cursorLine-height/2, 0)
+	end := min(start+height, len(lines))
+	start = max(end-height, 0)
+	return lipgloss.NewStyle().Width(width).Render(strings.Join(lines[start:end], "\n"))
+}
+
+func edgeCount(e *flowEdge) string {
+	if e.count > 1 {
+		return fmt.Sprintf("×%d", e.count)
+	}
+	return ""
+}
+
+// focusView draws the selected node below its upstream
+// dependencies and above its downstream dependencies
+func (m *FlowModel) focusView() string {
+	n := m.Selected()
+	if n == nil {
+		return faintStyle.Render("no flows")
+	}
+
+	upstream := make([][]string, 0, len(n.upstream))
+	for _, e := range n.upstream {
+		upstream = append(upstream, []string{e.from.label, e.app, "── " + e.endpoint + " ──▶", edgeCount(e)})
+	}
+	downstream := make([][]string, 0, len(n.downstream))
+	for _, e := range n.downstream {
+		downstream = append(downstream, []string{e.app, "── " + e.endpoint + " ──▶", e.to.label, edgeCount(e)})
+	}
+
+	edges := func(rows [][]string, app int) string {
+		if len(rows) == 0 {
+			return faintStyle.Render("none")
+		}
+		return baseTable().
+			StyleFunc(func(row, col int) lipgloss.Style {
+				if col == app || col == 3 {
+					return faintStyle.PaddingRight(1)
+				}
+				return lipgloss.NewStyle().PaddingRight(1)
+			}).
+			Rows(rows...).
+			String()
+	}
+
+	center := flowNodeStyle.Render(lipgloss.JoinVertical(lipgloss.Center,
+		lipgloss.NewStyle().Bold(true).Render(n.label),
+		faintStyle.Render(n.group),
+	))
+	return lipgloss.JoinVertical(lipgloss.Left,
+		sectionStyle.MarginTop(0).Render(fmt.Sprintf("Upstream (%d)", len(n.upstream))),
+		edges(upstream, 1),
+		lipgloss.NewStyle().MarginLeft(2).Render(center),
+		sectionStyle.MarginTop(0).Render(fmt.Sprintf("Downstream (%d)", len(n.downstream))),
+		edges(downstream, 0),
+	)
+}
+
+func (m *FlowModel) View() string {
+	// the width is 0 until the first WindowSizeMsg
+	listWidth := min(32, m.width/3)
+	h := max(m.height-2, 0)
+	list := nodesStyle.Width(listWidth).Height(m.height).Render(m.listView(max(listWidth-2, 0), h))
+	focus := lipgloss.NewStyle().
+		BorderStyle(TitleBorder(lipgloss.NormalBorder(), "Flows")).
+		Padding(0, 1).
+		Width(m.width - listWidth).
+		Height(m.height).
+		MaxHeight(m.height).
+		Render(m.focusView())
+	return lipgloss.JoinHorizontal(lipgloss.Top, list, focus)
+}
@@ -13,6 +13,13 @@ type keyMap struct {
 	Up         key.Binding
 	Down       key.Binding
 	Tab        key.Binding
+	Open       key.Binding
+	Flows      key.Binding
+	Diff       key.Binding
+	Search     key.Binding
+	Sort       key.Binding
+	Reverse    key.Binding
+	Reload     key.Binding
 	Screenshot key.Binding
 	Quit       key.Binding
 }
@@ -20,15 +27,16 @@ type keyMap struct {
 // ShortHelp returns keybindings to be shown in the mini help view. It's part
 // of the key.Map interface.
 func (k keyMap) ShortHelp() []key.Binding {
-	return []key.Binding{k.Tab, k.Up, k.Down, k.Screenshot, k.Quit}
+	return []key.Binding{k.Tab, k.Up, k.Down, k.Open, k.Flows, k.Diff, k.Search, k.Sort, k.Reload, k.Screenshot, k.Quit}
 }
 
 // FullHelp returns keybindings for the expanded help view. It's part of the
 // key.Map interface.
 func (k keyMap) FullHelp() [][]key.Binding {
 	return [][]key.Binding{
-		{k.Up, k.Down},                // first column
-		{k.Tab, k.Screenshot, k.Quit}, // second column
+		{k.Up, k.Down, k.Open, k.Flows, k.Diff}, // first column
+		{k.Search, k.Sort, k.Reverse},           // second column
+		{k.Tab, k.Reload, k.Screenshot, k.Quit}, // third column
 	}
 }
 
@@ -45,6 +53,34 @@ var keys = keyMap{
 		key.WithKeys("tab"),
 		key.WithHelp("tab", "next zone"),
 	),
+	Open: key.NewBinding(
+		key.WithKeys("enter"),
+		key.WithHelp("enter", "open machine"),
+	),
+	Flows: key.NewBinding(
+		key.WithKeys("f"),
+		key.WithHelp("f", "flows"),
+	),
+	Diff: key.NewBinding(
+		key.WithKeys("d"),
+		key.WithHelp("d", "changes"),
+	),
+	Search: key.NewBinding(
+		key.WithKeys("/"),
+		key.WithHelp("/", "search"),
+	),
+	Sort: key.NewBinding(
+		key.WithKeys("s"),
+		key.WithHelp("s", "sort"),
+	),
+	Reverse: key.NewBinding(
+		key.WithKeys("S"),
+		key.WithHelp("S", "reverse sort"),
+	),
+	Reload: key.NewBinding(
+		key.WithKeys("r"),
+		key.WithHelp("r", "reload"),
+	),
 	Screenshot: key.NewBinding(
 		key.WithKeys("ctrl+s"),
 		key.WithHelp("ctrl+s", "take screenshot"),
@@ -55,11 +91,123 @@ var keys = keyMap{
 	),
 }
 
+// machineKeyMap defines the keybindings of the machine view
+type machineKeyMap struct {
+	Up         key.Binding
+	Down       key.Binding
+	Search     key.Binding
+	Parent     key.Binding
+	Back       key.Binding
+	Screenshot key.Binding
+	Quit       key.Binding
+}
+
+func (k machineKeyMap) ShortHelp() []key.Binding {
+	return []key.Binding{k.Up, k.Down, k.Search, k.Parent, k.Back, k.Screenshot, k.Quit}
+}
+
+func (k machineKeyMap) FullHelp() [][]key.Binding {
+	return [][]key.Binding{
+		{k.Up, k.Down, k.Search},
+		{k.Parent, k.Back, k.Screenshot, k.Quit},
+	}
+}
+
+var machineKeys = machineKeyMap{
+	Up:   keys.Up,
+	Down: keys.Down,
+	Search: key.NewBinding(
+		key.WithKeys("/"),
+		key.WithHelp("/", "search packages"),
+	),
+	Parent: key.NewBinding(
+		key.WithKeys("p"),
+		key.WithHelp("p", "open parent"),
+	),
+	Back: key.NewBinding(
+		key.WithKeys("esc", "backspace"),
+		key.WithHelp("esc", "back"),
+	),
+	Screenshot: keys.Screenshot,
+	Quit: key.NewBinding(
+		key.WithKeys("q", "ctrl+c"),
+		key.WithHelp("q", "quit"),
+	),
+}
+
+// flowKeyMap defines the keybindings of the flow view
+type flowKeyMap struct {
+	Up         key.Binding
+	Down       key.Binding
+	Open       key.Binding
+	Back       key.Binding
+	Screenshot key.Binding
+	Quit       key.Binding
+}
+
+func (k flowKeyMap) ShortHelp() []key.Binding {
+	return []key.Binding{k.Up, k.Down, k.Open, k.Back, k.Screenshot, k.Quit}
+}
+
+func (k flowKeyMap) FullHelp() [][]key.Binding {
+	return [][]key.Binding{
+		{k.Up, k.Down, k.Open},
+		{k.Back, k.Screenshot, k.Quit},
+	}
+}
+
+var flowKeys = flowKeyMap{
+	Up:         keys.Up,
+	Down:       keys.Down,
+	Open:       keys.Open,
+	Back:       machineKeys.Back,
+	Screenshot: keys.Screenshot,
+	Quit:       machineKeys.Quit,
+}
+
+// diffKeyMap defines the keybindings of the diff view
+type diffKeyMap struct {
+	Up         key.Binding
+	Down       key.Binding
+	Older      key.Binding
+	Newer      key.Binding
+	Back       key.Binding
+	Screenshot key.Binding
+	Quit       key.Binding
+}
+
+func (k diffKeyMap) ShortHelp() []key.Binding {
+	return []key.Binding{k.Up, k.Down, k.Older, k.Newer, k.Back, k.Screenshot, k.Quit}
+}
+
+func (k diffKeyMap) FullHelp() [][]key.Binding {
+	return [][]key.Binding{
+		{k.Up, k.Down, k.Older, k.Newer},
+		{k.Back, k.Screenshot, k.Quit},
+	}
+}
+
+var diffKeys = diffKeyMap{
+	Up:   keys.Up,
+	Down: keys.Down,
+	Older: key.NewBinding(
+		key.WithKeys("left", "h"),
+		key.WithHelp("←", "older run"),
+	),
+	Newer: key.NewBinding(
+		key.WithKeys("right", "l"),
+		key.WithHelp("→", "newer run"),
+	),
+	Back:       machineKeys.Back,
+	Screenshot: keys.Screenshot,
+	Quit:       machineKeys.Quit,
+}
+
 type FooterModel struct {
 	SizedModel
 
 	help help.Model
-	keys keyMap
+	keys help.KeyMap
 }
 
 var helpKeyStyle = lipgloss.NewStyle().Foreground(AccentColor).Faint(true)
@@ -90,6 +238,12 @@ func (m FooterModel) SetSize(width, height int) {
 	// m.help.Width = width
 }
 
+// WithKeys returns the footer showing the given keybindings
+func (m FooterModel) WithKeys(keys help.KeyMap) FooterModel {
+	m.keys = keys
+	return m
+}
+
 func (m FooterModel) Init() tea.Cmd {
 	return nil
 }
@@ -9,8 +9,15 @@ var headerStyle = lipgloss.NewStyle().
 	Faint(true)
 	// Background(PrimaryMutedColor).PaddingLeft(1)
 
+var statusStyle = lipgloss.NewStyle().
+	Foreground(AccentColor).
+	Align(lipgloss.Right)
+
 type HeaderModel struct {
 	SizedModel
+
+	// status of the run followed by the explorer (if any)
+	status string
 }
 
 func (m HeaderModel) Init() tea.Cmd {
@@ -27,5 +34,13 @@ func (m HeaderModel) Update(msg tea.Msg) (HeaderModel, tea.Cmd) {
 }
 
 func (m HeaderModel) View() string {
-	return headerStyle.Width(m.width).Height(1).Render("Situation - Explore")
+	title := "Situation - Explore"
+	if m.status == "" {
+		return headerStyle.Width(m.width).Height(1).Render(title)
+	}
+	w := lipgloss.Width(title)
+	return lipgloss.JoinHorizontal(lipgloss.Top,
+		headerStyle.Width(w).Height(1).Render(title),
+		statusStyle.Width(max(m.width-w, 0)).Height(1).Render(m.status),
+	)
 }
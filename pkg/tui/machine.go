@@ -0,0 +1,386 @@
+package tui
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"charm.land/bubbles/v2/textinput"
+	"charm.land/bubbles/v2/viewport"
+	tea "charm.land/bubbletea/v2"
+	"charm.land/lipgloss/v2"
+	"charm.land/lipgloss/v2/table"
+	"github.com/situation-sh/situation/pkg/models"
+	"github.com/situation-sh/situation/pkg/store"
+)
+
+// maximum number of packages loaded in the machine view
+// (the search filters them locally)
+const machinePackagesLimit = 10000
+
+var machineBaseStyle = lipgloss.
+	NewStyle().
+	Padding(0, 1)
+
+var sectionStyle = lipgloss.NewStyle().Bold(true).MarginTop(1)
+
+var faintStyle = lipgloss.NewStyle().Faint(true)
+
+// newMachineMsg carries the data of the machine to display
+type newMachineMsg struct {
+	details  *store.MachineDetails
+	packages []*models.Package
+}
+
+// openMachineMsg asks to open the view of a machine
+type openMachineMsg struct {
+	id int64
+}
+
+// closeMachineMsg asks to go back to the subnet view
+type closeMachineMsg struct{}
+
+// MachineModel is the drill-down view of a single machine
+type MachineModel struct {
+	SizedModel
+
+	details  *store.MachineDetails
+	packages []*models.Package
+
+	viewport viewport.Model
+	search   textinput.Model
+	// line of the packages section within the content
+	packagesLine int
+}
+
+func NewMachineModel() *MachineModel {
+	search := textinput.New()
+	search.Prompt = "/ "
+	search.Placeholder = "search packages"
+	return &MachineModel{
+		viewport: viewport.New(),
+		search:   search,
+	}
+}
+
+func (m *MachineModel) SetSize(width, height int) {
+	m.SizedModel.SetSize(width, height)
+	// remove borders and padding
+	m.viewport.SetWidth(width - 4)
+	m.viewport.SetHeight(height - 2)
+	m.search.SetWidth(min(width-8, 40))
+	m.refresh()
+}
+
+func (m *MachineModel) SetMachine(details *store.MachineDetails, packages []*models.Package) {
+	m.details = details
+	m.packages = packages
+	m.search.Reset()
+	m.search.Blur()
+	m.viewport.GotoTop()
+	m.refresh()
+}
+
+// Searching returns whether the package search input has the focus
+func (m *MachineModel) Searching() bool {
+	return m.search.Focused()
+}
+
+func (m *MachineModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m *MachineModel) Update(msg tea.Msg) (*MachineModel, tea.Cmd) {
+	var cmd tea.Cmd
+	if m.details == nil {
+		return m, nil
+	}
+
+	if msg, ok := msg.(tea.KeyMsg); ok {
+		if m.search.Focused() {
+			switch msg.String() {
+			case "enter", "esc":
+				m.search.Blur()
+				return m, nil
+			}
+			m.search, cmd = m.search.Update(msg)
+			m.refresh()
+			return m, cmd
+		}
+
+		switch msg.String() {
+		case "/":
+			m.viewport.SetYOffset(m.packagesLine)
+			cmd = m.search.Focus()
+			m.refresh()
+			return m, cmd
+		case "esc", "backspace":
+			return m, func() tea.Msg { return closeMachineMsg{} }
+		case "p":
+			if m.details.ParentMachineID != 0 {
+				return m, func() tea.Msg { return openMachineMsg{id: m.details.ParentMachineID} }
+			}
+			return m, nil
+		}
+	}
+
+	m.viewport, cmd = m.viewport.Update(msg)
+	return m, cmd
+}
+
+// refresh renders the content of the viewport
+func (m *MachineModel) refresh() {
+	if m.details == nil {
+		m.viewport.SetContent("")
+		return
+	}
+	sections := []string{
+		m.identity(),
+		m.hardware(),
+		section("Network interfaces", m.nics()),
+		section("Applications", m.applications()),
+		section("Hosted machines", m.children()),
+	}
+	before := lipgloss.JoinVertical(lipgloss.Left, sections...)
+	m.packagesLine = lipgloss.Height(before)
+	content := lipgloss.JoinVertical(lipgloss.Left,
+		before,
+		section(fmt.Sprintf("Packages (%d)", len(m.filteredPackages())), m.search.View()+"\n"+m.packageList()),
+	)
+	m.viewport.SetContent(content)
+}
+
+// section renders a titled block (a placeholder is shown when it is empty)
+func section(title string, body string) string {
+	if body == "" {
+		body = faintStyle.Render("none")
+	}
+	return lipgloss.JoinVertical(lipgloss.Left, sectionStyle.Render(title), body)
+}
+
+// listTable renders rows under faint headers
+func listTable(headers []string, rows [][]string) string {
+	if len(rows) == 0 {
+		return ""
+	}
+	return baseTable().
+		StyleFunc(func(row, col int) lipgloss.Style {
+			if row == table.HeaderRow {
+				return faintStyle.PaddingRight(2)
+			}
+			return lipgloss.NewStyle().PaddingRight(2)
+		}).
+		Headers(headers...).
+		BorderHeader(false).
+		Rows(rows...).
+		String()
+}
+
+func formatBytes(size uint64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := uint64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+func (m *MachineModel) identity() string {
+	machine := m.details.Machine
+	parent := ""
+	if machine.ParentMachine != nil {
+		parent = fmt.Sprintf("%s (#%d)", machine.ParentMachine.Hostname, machine.ParentMachineID)
+	}
+	uptime := ""
+	if machine.Uptime > 0 {
+		uptime = machine.Uptime.Truncate(time.Second).String()
+	}
+	rows := [][]string{
+		{"ID", fmt.Sprintf("%d", machine.ID)},
+		{"Hostname", machine.Hostname},
+		{"Host ID", machine.HostID},
+		{"Platform", machine.Platform},
+		{"Distribution", strings.TrimSpace(machine.Distribution + " " + machine.DistributionVersion)},
+		{"Family", machine.DistributionFamily},
+		{"Arch", machine.Arch},
+		{"Chassis", machine.Chassis},
+		{"Manufacturer", machine.Manufacturer},
+		{"Model", machine.Model},
+		{"Serial", machine.SerialNumber},
+		{"Device", machine.DeviceType},
+		{"Uptime", uptime},
+		{"CPE", machine.CPE},
+		{"Tag", machine.Tag},
+		{"Agent", machine.Agent},
+		{"Parent", parent},
+		{"Updated", machine.UpdatedAt.Local().Format(time.DateTime)},
+	}
+	// only keep the known fields
+	out := make([][]string, 0, len(rows))
+	for _, row := range rows {
+		if row[1] != "" {
+			out = append(out, row)
+		}
+	}
+	return section("Identity", baseTable().Rows(out...).String())
+}
+
+func (m *MachineModel) hardware() string {
+	machine := m.details.Machine
+
+	cpu := ""
+	if machine.CPU != nil {
+		cpu = baseTable().Rows(
+			[]string{"Model", machine.CPU.ModelName},
+			[]string{"Vendor", machine.CPU.Vendor},
+			[]string{"Cores", fmt.Sprintf("%d", machine.CPU.Cores)},
+		).String()
+	}
+
+	disks := make([][]string, 0)
+	for _, d := range machine.Disks {
+		disks = append(disks, []string{d.Name, d.Model, formatBytes(d.Size), d.Type, d.Controller})
+		for _, p := range d.Partitions {
+			mode := ""
+			if p.ReadOnly {
+				mode = "ro"
+			}
+			disks = append(disks, []string{"└ " + p.Name, "", formatBytes(p.Size), p.Type, mode})
+		}
+	}
+
+	gpus := make([][]string, 0)
+	for _, g := range machine.GPUS {
+		gpus = append(gpus, []string{fmt.Sprintf("%d", g.Index), g.Product, g.Vendor, g.Driver})
+	}
+
+	return lipgloss.JoinVertical(lipgloss.Left,
+		section("CPU", cpu),
+		section("Disks", listTable([]string{"Name", "Model", "Size", "Type", "Controller"}, disks)),
+		section("GPUs", listTable([]string{"Index", "Product", "Vendor", "Driver"}, gpus)),
+	)
+}
+
+func (m *MachineModel) nics() string {
+	rows := make([][]string, 0)
+	for _, nic := range m.details.NICS {
+		subnets := make([]string, 0, len(nic.Subnetworks))
+		for _, s := range nic.Subnetworks {
+			subnets = append(subnets, s.NetworkCIDR)
+		}
+		rows = append(rows, []string{
+			nic.Name,
+			nic.MAC,
+			nic.MACVendor,
+			strings.Join(nic.IP, ", "),
+			strings.Join(subnets, ", "),
+			nic.Gateway,
+		})
+	}
+	return listTable([]string{"Name", "MAC", "Vendor", "IP", "Subnets", "Gateway"}, rows)
+}
+
+func (m *MachineModel) applications() string {
+	rows := make([][]string, 0)
+	for _, app := range m.details.Applications {
+		users := make([]string, 0, len(app.Users))
+		for _, u := range app.Users {
+			name := u.Username
+			if name == "" {
+				name = u.Name
+			}
+			if name == "" {
+				name = u.UID
+			}
+			users = append(users, name)
+		}
+		endpoints := make([]string, 0, len(app.Endpoints))
+		for _, e := range app.Endpoints {
+			endpoints = append(endpoints, fmt.Sprintf("%s/%d", e.Protocol, e.Port))
+		}
+		pid := ""
+		if app.PID > 0 {
+			pid = fmt.Sprintf("%d", app.PID)
+		}
+		rows = append(rows, []string{
+			pid,
+			path.Base(app.Name),
+			truncate(strings.Join(app.Args, " "), 48),
+			strings.Join(users, ", "),
+			strings.Join(endpoints, ", "),
+		})
+	}
+	return listTable([]string{"PID", "Name", "Args", "Users", "Endpoints"}, rows)
+}
+
+func (m *MachineModel) children() string {
+	rows := make([][]string, 0)
+	for _, c := range m.details.Children {
+		rows = append(rows, []string{
+			fmt.Sprintf("%d", c.ID),
+			c.Hostname,
+			c.Platform,
+			strings.TrimSpace(c.Distribution + " " + c.DistributionVersion),
+		})
+	}
+	return listTable([]string{"ID", "Hostname", "Platform", "Distribution"}, rows)
+}
+
+func (m *MachineModel) filteredPackages() []*models.Package {
+	query := strings.ToLower(strings.TrimSpace(m.search.Value()))
+	if query == "" {
+		return m.packages
+	}
+	out := make([]*models.Package, 0)
+	for _, p := range m.packages {
+		if strings.Contains(strings.ToLower(p.Name), query) {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+func (m *MachineModel) packageList() string {
+	rows := make([][]string, 0)
+	for _, p := range m.filteredPackages() {
+		installed := ""
+		if p.InstallTimeUnix > 0 {
+			installed = time.Unix(p.InstallTimeUnix, 0).Format(time.DateOnly)
+		}
+		rows = append(rows, []string{p.Name, p.Version, p.Manager, p.Vendor, installed})
+	}
+	return listTable([]string{"Name", "Version", "Manager", "Vendor", "Installed"}, rows)
+}
+
+// truncate shortens s to n runes (nothing is left when n is not
+// positive)
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) <= n {
+		return s
+	}
+	if n <= 0 {
+		return ""
+	}
+	return string(r[:n-1]) + "…"
+}
+
+func (m *MachineModel) View() string {
+	title := "Machine"
+	if m.details != nil {
+		title = fmt.Sprintf("Machine #%d", m.details.ID)
+		if m.details.Hostname != "" {
+			title = m.details.Hostname
+		}
+	}
+	return machineBaseStyle.
+		BorderStyle(TitleBorder(lipgloss.NormalBorder(), title)).
+		Width(m.width).
+		Height(m.height).
+		Render(m.viewport.View())
+}
@@ -8,9 +8,11 @@ import (
 	"path"
 	"time"
 
+	"charm.land/bubbles/v2/textinput"
 	tea "charm.land/bubbletea/v2"
 	"charm.land/lipgloss/v2"
 	"github.com/situation-sh/situation/pkg/models"
+	"github.com/situation-sh/situation/pkg/modules"
 	"github.com/situation-sh/situation/pkg/store"
 )
 
@@ -30,8 +32,28 @@ type RootModel struct {
 	sidebar *SidebarModel
 	table   *TableModel
 	card    *CardModel
+	machine *MachineModel
+	flows   *FlowModel
+	diff    *DiffModel
 	footer  FooterModel
 
+	// whether the machine view (or the flow view, or the diff view)
+	// is displayed. The machine view is above the flow view.
+	showMachine bool
+	showFlows   bool
+	showDiff    bool
+
+	// search prompt and the query whose results are displayed
+	search textinput.Model
+	query  string
+
+	// live updates: interval between two checks of the database,
+	// last update seen and progress of the run (if any)
+	refresh   time.Duration
+	watermark time.Time
+	progress  <-chan modules.Progress
+	runErrors int
+
 	err     error
 	success string
 
@@ -39,15 +61,34 @@ type RootModel struct {
 	height int
 }
 
+// searchResultMsg carries the NICs matching a query (more is true
+// when the results are cut off)
+type searchResultMsg struct {
+	query string
+	nics  []*models.NetworkInterface
+	more  bool
+}
+
 func NewRootModel(ctx context.Context, storage *store.BunStorage) RootModel {
+	search := textinput.New()
+	search.Prompt = "/ "
+	search.Placeholder = "port:443 vendor:cisco host:db*"
+	table := NewTableModel()
+	// highlight what is new or changed from now on
+	table.SetSince(time.Now())
 	return RootModel{
 		ctx:     ctx,
 		storage: storage,
-		table:   NewTableModel(),
+		table:   table,
 		header:  HeaderModel{},
 		sidebar: NewSidebarModel(),
 		card:    NewCardModel(),
+		machine: NewMachineModel(),
+		flows:   NewFlowModel(),
+		diff:    NewDiffModel(),
 		footer:  NewFooterModel(),
+		search:  search,
+		refresh: DefaultRefreshInterval,
 	}
 }
 
@@ -60,7 +101,15 @@ func (m RootModel) FetchSubnets() error {
 	if err != nil {
 		return err
 	}
+	// keep the selected subnet when the subnets are reloaded
+	var selected int64
+	if s := m.sidebar.Selected(); s != nil {
+		selected = s.ID
+	}
 	subnet := m.sidebar.SetSubnets(subnets)
+	if s := m.sidebar.Select(selected); s != nil {
+		subnet = s
+	}
 	if subnet != nil {
 		return m.FetchNICs(subnet)
 	}
@@ -90,9 +139,126 @@ func (m RootModel) FetchNICs(subnet *models.Subnetwork) error {
 		return err
 	}
 	m.table.SetNics(nics, subnet.NetworkCIDR)
+	m.table.SetTitle("Data")
 	return nil
 }
 
+// Search runs the query across all the subnets
+func (m RootModel) Search(query string) tea.Cmd {
+	return func() tea.Msg {
+		search, err := store.ParseNICSearch(query)
+		if err != nil {
+			return err
+		}
+		nics, more, err := m.storage.SearchNICs(m.ctx, search)
+		if err != nil {
+			return err
+		}
+		return searchResultMsg{query: query, nics: nics, more: more}
+	}
+}
+
+// JumpTo selects the subnet of the NIC in the sidebar and
+// the NIC in the table
+func (m RootModel) JumpTo(nic *models.NetworkInterface) tea.Cmd {
+	return func() tea.Msg {
+		for _, s := range nic.Subnetworks {
+			if subnet := m.sidebar.Select(s.ID); subnet != nil {
+				if err := m.FetchNICs(subnet); err != nil {
+					return err
+				}
+				m.table.SelectNIC(nic.ID)
+				return okMsg{}
+			}
+		}
+		return fmt.Errorf("no subnet found for this interface")
+	}
+}
+
+// Reload fetches again the displayed data
+func (m RootModel) Reload() tea.Cmd {
+	if m.query != "" {
+		return m.Search(m.query)
+	}
+	return func() tea.Msg {
+		if err := m.FetchSubnets(); err != nil {
+			return err
+		}
+		return okMsg{}
+	}
+}
+
+// FetchMachine loads a machine (with its children) and its packages
+func (m RootModel) FetchMachine(id int64) tea.Cmd {
+	return func() tea.Msg {
+		details, err := m.storage.GetMachineDetails(m.ctx, id)
+		if err != nil {
+			return fmt.Errorf("cannot load machine %d: %w", id, err)
+		}
+		packages, err := m.storage.GetPackagesOn(m.ctx, id, "", machinePackagesLimit)
+		if err != nil {
+			return fmt.Errorf("cannot load packages of machine %d: %w", id, err)
+		}
+		return newMachineMsg{details: details, packages: packages}
+	}
+}
+
+// FetchFlows loads all the flows and the machines (with their subnets)
+func (m RootModel) FetchFlows(focus int64) tea.Cmd {
+	return func() tea.Msg {
+		flows := make([]*models.Flow, 0)
+		err := m.storage.DB().NewSelect().
+			Model(&flows).
+			Relation("SrcApplication").
+			Relation("SrcNetworkInterface").
+			Relation("DstEndpoint").
+			Relation("DstEndpoint.Application").
+			Relation("DstEndpoint.NetworkInterface").
+			Scan(m.ctx)
+		if err != nil {
+			return fmt.Errorf("cannot load flows: %w", err)
+		}
+		machines := make([]*models.Machine, 0)
+		err = m.storage.DB().NewSelect().
+			Model(&machines).
+			Relation("NICS").
+			Relation("NICS.Subnetworks").
+			Scan(m.ctx)
+		if err != nil {
+			return fmt.Errorf("cannot load machines: %w", err)
+		}
+		return newFlowsMsg{flows: flows, machines: machines, focus: focus}
+	}
+}
+
+// FetchDiff compares the current state with a run of the history
+// (base is its index among the most recent runs, -1 picks the run
+// before the latest one)
+func (m RootModel) FetchDiff(base int) tea.Cmd {
+	return func() tea.Msg {
+		runs, err := m.storage.ListRuns(m.ctx, 0)
+		if err != nil {
+			return fmt.Errorf("cannot load the run history: %w", err)
+		}
+		if len(runs) == 0 {
+			return fmt.Errorf("the run history is empty")
+		}
+		if base < 0 {
+			base = 1
+		}
+		base = min(base, len(runs)-1)
+		run, err := m.storage.GetRun(m.ctx, runs[base].ID)
+		if err != nil {
+			return fmt.Errorf("cannot load run %d: %w", runs[base].ID, err)
+		}
+		diff, err := m.storage.DiffRuns(m.ctx, run, nil)
+		if err != nil {
+			return fmt.Errorf("cannot compare with run %d: %w", run.ID, err)
+		}
+		return newDiffMsg{runs: runs, base: base, diff: diff}
+	}
+}
+
 func (m RootModel) Fetch() tea.Cmd {
 	return func() tea.Msg {
 		err := m.FetchSubnets()
@@ -110,7 +276,7 @@ func (m RootModel) Screenshot() tea.Msg {
 	if err != nil {
 		return err
 	}
-	svg, err := ansi2svg(m.View().Content)
+	svg, err := ANSIToSVG(m.View().Content)
 	if err != nil {
 		return err
 	}
@@ -129,7 +295,7 @@ func (m RootModel) Screenshot() tea.Msg {
 
 func (m RootModel) Init() tea.Cmd {
 	// return tea.Batch(m.Fetch(), tea.WindowSize())
-	return tea.Batch(m.Fetch())
+	return tea.Batch(m.Fetch(), m.tick(), m.waitProgress)
 }
 
 func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
@@ -163,19 +329,140 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.sidebar.SetSize(24, msg.Height-2)
 		m.table.SetSize(msg.Width-24, h2)
 		m.card.SetSize(msg.Width-24, msg.Height-2-h2)
+		m.machine.SetSize(msg.Width, msg.Height-2)
+		m.flows.SetSize(msg.Width, msg.Height-2)
+		m.diff.SetSize(msg.Width, msg.Height-2)
+		m.search.SetWidth(msg.Width - 4)
 		m.footer.SetSize(msg.Width, 1)
 	case tea.KeyMsg:
+		if m.showMachine {
+			// the machine view handles its own keys (its search input especially)
+			switch msg.String() {
+			case "ctrl+c":
+				return m, tea.Quit
+			case "ctrl+s":
+				return m, m.Screenshot
+			case "q":
+				if !m.machine.Searching() {
+					return m, tea.Quit
+				}
+			}
+			m.machine, cmd1 = m.machine.Update(msg)
+			return m, cmd1
+		}
+		if m.showFlows {
+			switch msg.String() {
+			case "q", "ctrl+c":
+				return m, tea.Quit
+			case "ctrl+s":
+				return m, m.Screenshot
+			}
+			m.flows, cmd1 = m.flows.Update(msg)
+			return m, cmd1
+		}
+		if m.showDiff {
+			switch msg.String() {
+			case "q", "ctrl+c":
+				return m, tea.Quit
+			case "ctrl+s":
+				return m, m.Screenshot
+			}
+			m.diff, cmd1 = m.diff.Update(msg)
+			return m, cmd1
+		}
+		if m.search.Focused() {
+			switch msg.String() {
+			case "ctrl+c":
+				return m, tea.Quit
+			case "enter":
+				m.search.Blur()
+				if query := m.search.Value(); query != "" {
+					return m, m.Search(query)
+				}
+				return m, nil
+			case "esc":
+				m.search.Blur()
+				return m, nil
+			}
+			m.search, cmd1 = m.search.Update(msg)
+			return m, cmd1
+		}
 		switch msg.String() {
 		case "q", "ctrl+c":
 			return m, tea.Quit
+		case "/":
+			return m, m.search.Focus()
+		case "esc":
+			if m.query != "" {
+				m.query = ""
+				m.search.Reset()
+				return m, m.Reload()
+			}
+		case "enter":
+			nic := m.table.SelectedNIC()
+			if nic == nil {
+				return m, nil
+			}
+			if m.query != "" {
+				m.query = ""
+				m.search.Reset()
+				return m, m.JumpTo(nic)
+			}
+			return m, m.FetchMachine(nic.MachineID)
+		case "f":
+			focus := int64(0)
+			if nic := m.table.SelectedNIC(); nic != nil {
+				focus = nic.MachineID
+			}
+			return m, m.FetchFlows(focus)
+		case "d":
+			return m, m.FetchDiff(-1)
 		case "tab":
 			return m, m.sidebar.Next
 		case "ctrl+s":
 			return m, m.Screenshot
+		case "s":
+			m.table.NextSort()
+		case "S":
+			m.table.ReverseSort()
 		case "r":
-			return m, ErrorCmd("You have pressed 'r'")
+			return m, m.Reload()
+		}
+	case tickMsg:
+		return m, tea.Batch(m.checkUpdates, m.tick())
+	case watermarkMsg:
+		if last := time.Time(msg); last.After(m.watermark) {
+			m.watermark = last
+			return m, m.Reload()
+		}
+		return m, nil
+	case progressMsg:
+		if msg.Done && msg.Err != nil {
+			m.runErrors++
+		}
+		m.header.status = m.runStatus(msg)
+		cmds := []tea.Cmd{m.waitProgress}
+		if msg.Done {
+			// show what the module has found
+			cmds = append(cmds, m.Reload())
+		}
+		return m, tea.Batch(cmds...)
+	case runFinishedMsg:
+		m.header.status = "Run finished"
+		if m.runErrors > 0 {
+			m.header.status += fmt.Sprintf(" (%d modules failed)", m.runErrors)
 		}
+		return m, m.Reload()
+	case searchResultMsg:
+		m.query = msg.query
+		m.table.SetNics(msg.nics, "")
+		count := fmt.Sprint(len(msg.nics))
+		if msg.more {
+			count = fmt.Sprintf("first %d, more results…", len(msg.nics))
+		}
+		m.table.SetTitle(fmt.Sprintf("Search: %s (%s)", msg.query, count))
 	case newSubnetMsg:
+		m.query = ""
 		return m, func() tea.Msg {
 			err := m.FetchNICs(msg.subnet)
 			if err != nil {
@@ -186,11 +473,52 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case newNodeMsg:
 		m.card.SetSource(msg.nic, msg.addr)
 		// return m, nil
+	case openMachineMsg:
+		return m, m.FetchMachine(msg.id)
+	case newMachineMsg:
+		m.machine.SetMachine(msg.details, msg.packages)
+		m.showMachine = true
+		m.footer = m.footer.WithKeys(machineKeys)
+		return m, nil
+	case closeMachineMsg:
+		m.showMachine = false
+		m.footer = m.footer.WithKeys(keys)
+		if m.showFlows {
+			m.footer = m.footer.WithKeys(flowKeys)
+		}
+		return m, nil
+	case newFlowsMsg:
+		m.flows.SetFlows(msg.flows, msg.machines, msg.focus)
+		m.showFlows = true
+		m.footer = m.footer.WithKeys(flowKeys)
+		return m, nil
+	case closeFlowsMsg:
+		m.showFlows = false
+		m.footer = m.footer.WithKeys(keys)
+		return m, nil
+	case newDiffMsg:
+		m.diff.SetDiff(msg.runs, msg.base, msg.diff)
+		m.showDiff = true
+		m.footer = m.footer.WithKeys(diffKeys)
+		return m, nil
+	case diffBaseMsg:
+		return m, m.FetchDiff(msg.base)
+	case closeDiffMsg:
+		m.showDiff = false
+		m.footer = m.footer.WithKeys(keys)
+		return m, nil
 	case okMsg:
 		// do nothing - just re-render with new data
 	}
 
-	// pass message to sub-models (only table can handle them for now)
+	// pass message to sub-models
+	if m.showMachine {
+		m.machine, cmd1 = m.machine.Update(msg)
+		return m, cmd1
+	}
+	if m.showFlows || m.showDiff {
+		return m, nil
+	}
 	m.table, cmd1 = m.table.Update(msg)
 	return m, cmd1
 }
@@ -203,19 +531,31 @@ func (v Viewable) View() string {
 
 func (m RootModel) View() tea.View {
 	compositor := lipgloss.NewCompositor()
+	main := lipgloss.JoinHorizontal(
+		lipgloss.Top,
+		m.sidebar.View(),
+		lipgloss.JoinVertical(
+			lipgloss.Left,
+			m.table.View(),
+			m.card.View(),
+		),
+	)
+	if m.showMachine {
+		main = m.machine.View()
+	} else if m.showFlows {
+		main = m.flows.View()
+	} else if m.showDiff {
+		main = m.diff.View()
+	}
+	header := m.header.View()
+	if m.search.Focused() && !m.showMachine && !m.showFlows && !m.showDiff {
+		header = m.search.View()
+	}
 	// background layer
 	bg := lipgloss.NewLayer(
 		lipgloss.JoinVertical(lipgloss.Left,
-			m.header.View(),
-			lipgloss.JoinHorizontal(
-				lipgloss.Top,
-				m.sidebar.View(),
-				lipgloss.JoinVertical(
-					lipgloss.Left,
-					m.table.View(),
-					m.card.View(),
-				),
-			),
+			header,
+			main,
 			m.footer.View(),
 		),
 	)
@@ -36,12 +36,33 @@ func NewSidebarModel() *SidebarModel {
 
 func (m *SidebarModel) SetSubnets(subnets []*models.Subnetwork) *models.Subnetwork {
 	m.subnets = subnets
+	m.selected = 0
 	if len(subnets) > 0 {
 		return subnets[0]
 	}
 	return nil
 }
 
+// Selected returns the selected subnet
+func (m *SidebarModel) Selected() *models.Subnetwork {
+	if m.selected < len(m.subnets) {
+		return m.subnets[m.selected]
+	}
+	return nil
+}
+
+// Select selects the subnet with the given ID (nil is
+// returned if it is unknown)
+func (m *SidebarModel) Select(id int64) *models.Subnetwork {
+	for i, s := range m.subnets {
+		if s.ID == id {
+			m.selected = i
+			return s
+		}
+	}
+	return nil
+}
+
 func (m *SidebarModel) Next() tea.Msg {
 	if len(m.subnets) == 0 {
 		return nil
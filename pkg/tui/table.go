@@ -1,9 +1,14 @@
 package tui
 
 import (
+	"bytes"
+	"cmp"
 	"fmt"
 	"net"
 	"os"
+	"slices"
+	"strconv"
+	"time"
 
 	"charm.land/bubbles/v2/table"
 	tea "charm.land/bubbletea/v2"
@@ -44,14 +49,30 @@ type newNodeMsg struct {
 }
 
 type TableModel struct {
-	table        table.Model
-	nics         []*models.NetworkInterface
-	lastCursor   int
+	table      table.Model
+	nics       []*models.NetworkInterface
+	lastCursor int
+	title      string
+
+	// NICs and rows in the order of the database
+	sourceNics []*models.NetworkInterface
+	sourceRows []table.Row
+
+	// rows created or updated after since are highlighted
+	since   time.Time
+	created int
+	updated int
+
+	// index of the column used to sort the rows (-1 to keep the
+	// order of the database)
+	sortColumn int
+	sortDesc   bool
 }
 
 func NewTableModel() *TableModel {
 	t := table.New(
-		table.WithColumns(columns),
+		// the titles of the columns change with the sort
+		table.WithColumns(slices.Clone(columns)),
 		table.WithRows(nil),
 		table.WithFocused(true),
 	)
@@ -68,12 +89,19 @@ func NewTableModel() *TableModel {
 	t.SetStyles(s)
 
 	return &TableModel{
-		table: t,
-		nics:  make([]*models.NetworkInterface, 0),
+		table:      t,
+		nics:       make([]*models.NetworkInterface, 0),
+		title:      "Data",
+		sortColumn: -1,
 	}
 }
 
+// filterIP returns the IP within the given subnet (or the
+// first one if the subnet is empty)
 func filterIP(ips []string, cidr string) string {
+	if cidr == "" && len(ips) > 0 {
+		return ips[0]
+	}
 	_, n, err := net.ParseCIDR(cidr)
 	if err != nil {
 		return ""
@@ -107,8 +135,36 @@ func (m *TableModel) SetSize(width, height int) {
 	m.table.SetWidth(width - 2)
 }
 
+// SetSince sets the time after which the rows are
+// considered new or changed
+func (m *TableModel) SetSince(since time.Time) {
+	// timestamps have a one-second resolution in sqlite
+	m.since = since.Truncate(time.Second)
+}
+
+// activity returns a marker if the NIC (or its machine, or its
+// endpoints) has been created or updated since the reference time
+func (m *TableModel) activity(nic *models.NetworkInterface) string {
+	if m.since.IsZero() {
+		return ""
+	}
+	if !nic.CreatedAt.Before(m.since) {
+		return "+"
+	}
+	changed := !nic.UpdatedAt.Before(m.since) ||
+		(nic.Machine != nil && !nic.Machine.UpdatedAt.Before(m.since))
+	for _, e := range nic.Endpoints {
+		changed = changed || !e.UpdatedAt.Before(m.since)
+	}
+	if changed {
+		return "~"
+	}
+	return ""
+}
+
 func (m *TableModel) SetNics(nics []*models.NetworkInterface, cidr string) {
-	m.nics = nics
+	m.sourceNics = nics
+	m.created, m.updated = 0, 0
 	rows := make([]table.Row, len(nics))
 	for i, nic := range nics {
 		ip := filterIP(nic.IP, cidr)
@@ -116,6 +172,14 @@ func (m *TableModel) SetNics(nics []*models.NetworkInterface, cidr string) {
 		if nic.Machine != nil {
 			name = nic.Machine.Hostname
 		}
+		switch marker := m.activity(nic); marker {
+		case "+":
+			m.created++
+			name = marker + " " + name
+		case "~":
+			m.updated++
+			name = marker + " " + name
+		}
 		endpoints := 0
 		if len(nic.Endpoints) > 0 {
 			for _, ep := range nic.Endpoints {
@@ -127,9 +191,126 @@ func (m *TableModel) SetNics(nics []*models.NetworkInterface, cidr string) {
 		rows[i] = table.Row{name, ip, nic.MAC, nic.MACVendor, fmt.Sprintf("%d", endpoints)}
 	}
 
+	m.sourceRows = rows
+	m.sort()
+	// force the card to be updated
+	m.lastCursor = -1
+}
+
+// SetTitle changes the title of the table border
+func (m *TableModel) SetTitle(title string) {
+	m.title = title
+}
+
+// fullTitle appends the number of new and changed rows to the title
+func (m *TableModel) fullTitle() string {
+	if m.created == 0 && m.updated == 0 {
+		return m.title
+	}
+	return fmt.Sprintf("%s [+%d new, ~%d changed]", m.title, m.created, m.updated)
+}
+
+// compareCells compares two cells of the given column
+// (IPs and numbers are not compared as strings)
+func compareCells(col int, a, b string) int {
+	switch columns[col].Title {
+	case "IP":
+		ipa, ipb := net.ParseIP(a), net.ParseIP(b)
+		if ipa != nil && ipb != nil {
+			return bytes.Compare(ipa.To16(), ipb.To16())
+		}
+	case "Endpoints":
+		na, erra := strconv.Atoi(a)
+		nb, errb := strconv.Atoi(b)
+		if erra == nil && errb == nil {
+			return cmp.Compare(na, nb)
+		}
+	}
+	return cmp.Compare(a, b)
+}
+
+// sort orders the rows (and the NICs) according to the sort
+// column and updates the column titles
+func (m *TableModel) sort() {
+	order := make([]int, len(m.sourceRows))
+	for i := range order {
+		order[i] = i
+	}
+	if m.sortColumn >= 0 {
+		slices.SortStableFunc(order, func(i, j int) int {
+			a, b := m.sourceRows[i][m.sortColumn], m.sourceRows[j][m.sortColumn]
+			c := compareCells(m.sortColumn, a, b)
+			if m.sortDesc {
+				return -c
+			}
+			return c
+		})
+	}
+
+	rows := make([]table.Row, len(order))
+	nics := make([]*models.NetworkInterface, len(order))
+	for k, i := range order {
+		rows[k] = m.sourceRows[i]
+		nics[k] = m.sourceNics[i]
+	}
+	m.nics = nics
+
+	cols := m.table.Columns()
+	for i := range cols {
+		cols[i].Title = columns[i].Title
+		if i == m.sortColumn {
+			if m.sortDesc {
+				cols[i].Title += " ▼"
+			} else {
+				cols[i].Title += " ▲"
+			}
+		}
+	}
+	m.table.SetColumns(cols)
 	m.table.SetRows(rows)
 }
 
+// NextSort sorts the rows by the next column
+func (m *TableModel) NextSort() {
+	m.sortColumn++
+	if m.sortColumn >= len(columns) {
+		m.sortColumn = -1
+	}
+	m.sortDesc = false
+	m.sort()
+	m.lastCursor = -1
+}
+
+// ReverseSort reverses the order of the rows
+func (m *TableModel) ReverseSort() {
+	if m.sortColumn < 0 {
+		return
+	}
+	m.sortDesc = !m.sortDesc
+	m.sort()
+	m.lastCursor = -1
+}
+
+// SelectNIC moves the cursor to the row of the given NIC
+func (m *TableModel) SelectNIC(id int64) {
+	for i, nic := range m.nics {
+		if nic.ID == id {
+			m.table.SetCursor(i)
+			m.lastCursor = -1
+			return
+		}
+	}
+}
+
+// SelectedNIC returns the NIC of the selected row
+func (m *TableModel) SelectedNIC() *models.NetworkInterface {
+	index := m.table.Cursor()
+	if index < 0 || index >= len(m.nics) {
+		return nil
+	}
+	return m.nics[index]
+}
+
 func (m *TableModel) Init() tea.Cmd {
 	return nil
 }
@@ -163,6 +344,6 @@ func (m *TableModel) Update(msg tea.Msg) (*TableModel, tea.Cmd) {
 func (m *TableModel) View() string {
 	return lipgloss.
 		NewStyle().
-		BorderStyle(TitleBorder(lipgloss.NormalBorder(), "Data")).
+		BorderStyle(TitleBorder(lipgloss.NormalBorder(), m.fullTitle())).
 		Render(m.table.View())
 }
@@ -0,0 +1,80 @@
+package tui
+
+import (
+	"fmt"
+	"time"
+
+	tea "charm.land/bubbletea/v2"
+	"github.com/situation-sh/situation/pkg/modules"
+)
+
+// DefaultRefreshInterval is the default time between two
+// checks of the database
+const DefaultRefreshInterval = 5 * time.Second
+
+// tickMsg triggers a check of the database
+type tickMsg time.Time
+
+// watermarkMsg carries the last update time of the database
+type watermarkMsg time.Time
+
+// progressMsg is sent when a module starts or finishes
+type progressMsg modules.Progress
+
+// runFinishedMsg is sent when all the modules have run
+type runFinishedMsg struct{}
+
+// WithRefresh makes the explorer check the database every interval
+// and reload the data when it has changed (0 disables the refresh)
+func (m RootModel) WithRefresh(interval time.Duration) RootModel {
+	m.refresh = interval
+	return m
+}
+
+// WithProgress makes the explorer follow a run. The channel
+// must be closed when the run is over.
+func (m RootModel) WithProgress(progress <-chan modules.Progress) RootModel {
+	m.progress = progress
+	m.header.status = "Starting"
+	return m
+}
+
+func (m RootModel) tick() tea.Cmd {
+	if m.refresh <= 0 {
+		return nil
+	}
+	return tea.Tick(m.refresh, func(t time.Time) tea.Msg {
+		return tickMsg(t)
+	})
+}
+
+// checkUpdates fetches the watermark of the database
+func (m RootModel) checkUpdates() tea.Msg {
+	last, err := m.storage.LastUpdate(m.ctx)
+	if err != nil {
+		// the next tick will try again
+		return nil
+	}
+	return watermarkMsg(last)
+}
+
+// waitProgress waits for the next event of the run
+func (m RootModel) waitProgress() tea.Msg {
+	if m.progress == nil {
+		return nil
+	}
+	p, ok := <-m.progress
+	if !ok {
+		return runFinishedMsg{}
+	}
+	return progressMsg(p)
+}
+
+// runStatus returns the status of the run displayed in the header
+func (m RootModel) runStatus(p progressMsg) string {
+	status := fmt.Sprintf("Running %s (%d/%d)", p.Module, p.Index, p.Total)
+	if m.runErrors > 0 {
+		status += fmt.Sprintf(" - %d failed", m.runErrors)
+	}
+	return status
+}
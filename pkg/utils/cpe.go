@@ -0,0 +1,29 @@
+package utils
+
+import "strings"
+
+// ApplicationCPE builds the CPE 2.3 formatted string of an application
+// from its vendor:product part and its version (any version if empty)
+func ApplicationCPE(product string, version string) string {
+	version = cpeEscape(version)
+	if version == "" {
+		version = "*"
+	}
+	return "cpe:2.3:a:" + product + ":" + version + ":*:*:*:*:*:*:*"
+}
+
+// cpeEscape escapes the characters that are not allowed as is in a
+// CPE 2.3 formatted string
+func cpeEscape(value string) string {
+	var b strings.Builder
+	for _, c := range value {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '.', c == '_', c == '-':
+			b.WriteRune(c)
+		default:
+			b.WriteRune('\\')
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
@@ -1,7 +1,11 @@
 package utils
 
 import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
 	"net"
+	"strings"
 )
 
 // CopyIP returns a new buffer containing
@@ -201,3 +205,81 @@ func IPVersionFromCIDR(cidr string) int {
 	}
 	return 6
 }
+
+// IPv4ToUint32 returns the IPv4 address as an integer
+// (0 if ip is not an IPv4 address)
+func IPv4ToUint32(ip net.IP) uint32 {
+	ip4 := ip.To4()
+	if ip4 == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint32(ip4)
+}
+
+// Uint32ToIPv4 is the inverse of IPv4ToUint32
+func Uint32ToIPv4(u uint32) net.IP {
+	ip := make(net.IP, 4)
+	binary.BigEndian.PutUint32(ip, u)
+	return ip
+}
+
+// ParseIPRange parses a single address, a network in CIDR notation
+// (10.0.0.0/24) or a range of addresses (10.0.0.100-10.0.0.200, or
+// 10.0.0.100-200 for short) and returns its first and last addresses
+func ParseIPRange(s string) (net.IP, net.IP, error) {
+	s = strings.TrimSpace(s)
+	if strings.Contains(s, "/") {
+		_, ipnet, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, nil, err
+		}
+		first := ipnet.IP
+		last := make(net.IP, len(first))
+		for i := range first {
+			last[i] = first[i] | ^ipnet.Mask[i]
+		}
+		return first, last, nil
+	}
+
+	start, end, isRange := strings.Cut(s, "-")
+	first := net.ParseIP(strings.TrimSpace(start))
+	if first == nil {
+		return nil, nil, fmt.Errorf("invalid IP address: %s", start)
+	}
+	if ip4 := first.To4(); ip4 != nil {
+		first = ip4
+	}
+	if !isRange {
+		return first, first, nil
+	}
+
+	end = strings.TrimSpace(end)
+	last := net.ParseIP(end)
+	if last == nil && first.To4() != nil && !strings.ContainsAny(end, ".:") {
+		// short form: only the last byte is given
+		var b uint8
+		if _, err := fmt.Sscanf(end, "%d", &b); err == nil {
+			last = CopyIP(first)
+			last[3] = b
+		}
+	}
+	if last == nil {
+		return nil, nil, fmt.Errorf("invalid IP address: %s", end)
+	}
+	if ip4 := last.To4(); ip4 != nil {
+		last = ip4
+	}
+	if len(first) != len(last) || bytes.Compare(first, last) > 0 {
+		return nil, nil, fmt.Errorf("invalid IP range: %s", s)
+	}
+	return first, last, nil
+}
+
+// IPInRange returns whether ip lies between first and last (included)
+func IPInRange(ip net.IP, first net.IP, last net.IP) bool {
+	ip, first, last = ip.To16(), first.To16(), last.To16()
+	if ip == nil || first == nil || last == nil {
+		return false
+	}
+	return bytes.Compare(ip, first) >= 0 && bytes.Compare(ip, last) <= 0
+}
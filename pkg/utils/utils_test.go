@@ -191,6 +191,44 @@ func TestIsReserved(t *testing.T) {
 	// return false
 }
 
+func TestParseIPRange(t *testing.T) {
+	valid := map[string][2]string{
+		"10.0.0.1":                {"10.0.0.1", "10.0.0.1"},
+		"10.0.0.0/22":             {"10.0.0.0", "10.0.3.255"},
+		"10.0.0.100-10.0.1.20":    {"10.0.0.100", "10.0.1.20"},
+		"10.0.0.100 - 200":        {"10.0.0.100", "10.0.0.200"},
+		"fd00::/126":              {"fd00::", "fd00::3"},
+		"fd00::10-fd00::1:0":      {"fd00::10", "fd00::1:0"},
+		"192.168.1.1-192.168.1.1": {"192.168.1.1", "192.168.1.1"},
+	}
+	for s, expected := range valid {
+		first, last, err := ParseIPRange(s)
+		if err != nil {
+			t.Errorf("%s: %v", s, err)
+			continue
+		}
+		if first.String() != expected[0] || last.String() != expected[1] {
+			t.Errorf("%s: expected %v, got %v-%v", s, expected, first, last)
+		}
+	}
+
+	for _, s := range []string{"", "10.0.0", "10.0.0.200-100", "10.0.0.1-fd00::1", "10.0.0.1-300", "10.0.0.0/33"} {
+		if _, _, err := ParseIPRange(s); err == nil {
+			t.Errorf("%q: expected an error", s)
+		}
+	}
+
+	ip := net.IPv4(10, 1, 2, 3)
+	if u := IPv4ToUint32(ip); u != 0x0a010203 || !Uint32ToIPv4(u).Equal(ip) {
+		t.Errorf("bad conversion of %v: %x", ip, u)
+	}
+
+	first, last, _ := ParseIPRange("10.1.0.0/16")
+	if !IPInRange(ip, first, last) || IPInRange(net.IPv4(10, 2, 0, 0), first, last) || IPInRange(net.ParseIP("fd00::1"), first, last) {
+		t.Errorf("bad IPInRange for %v-%v", first, last)
+	}
+}
+
 func TestIsPublic(t *testing.T) {
 	a := net.IPv4(192, 168, 0, 1)
 	b := net.IPv4(8, 8, 8, 8)
@@ -441,3 +479,15 @@ func TestEnforceMask(t *testing.T) {
 	}
 
 }
+
+func TestApplicationCPE(t *testing.T) {
+	for version, expected := range map[string]string{
+		"":        "cpe:2.3:a:f5:nginx:*:*:*:*:*:*:*:*",
+		"1.24.0":  "cpe:2.3:a:f5:nginx:1.24.0:*:*:*:*:*:*:*",
+		"1.2+git": "cpe:2.3:a:f5:nginx:1.2\\+git:*:*:*:*:*:*:*",
+	} {
+		if cpe := ApplicationCPE("f5:nginx", version); cpe != expected {
+			t.Errorf("expected %s, got %s", expected, cpe)
+		}
+	}
+}